@@ -23,6 +23,11 @@ type Beskar7ClusterSpec struct {
 	// +kubebuilder:validation:Optional
 	// +optional
 	ControlPlaneEndpoint clusterv1.APIEndpoint `json:"controlPlaneEndpoint"`
+
+	// NonControlPlaneFailureDomains lists failure domains, discovered from the zone label
+	// of PhysicalHosts, that must not host control plane machines.
+	// +optional
+	NonControlPlaneFailureDomains []string `json:"nonControlPlaneFailureDomains,omitempty"`
 }
 
 // Beskar7ClusterStatus defines the observed state of Beskar7Cluster.
@@ -108,4 +113,9 @@ func (in *Beskar7ClusterStatus) DeepCopyInto(out *Beskar7ClusterStatus) {
 func (in *Beskar7ClusterSpec) DeepCopyInto(out *Beskar7ClusterSpec) {
 	*out = *in
 	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	if in.NonControlPlaneFailureDomains != nil {
+		in, out := &in.NonControlPlaneFailureDomains, &out.NonControlPlaneFailureDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
@@ -13,6 +13,12 @@ const (
 	PhysicalHostAssociatedCondition clusterv1.ConditionType = "PhysicalHostAssociated"
 	// MachineProvisionedCondition indicates whether the machine has been provisioned
 	MachineProvisionedCondition clusterv1.ConditionType = "MachineProvisioned"
+	// BootstrapDataDeliveredCondition indicates whether the PhysicalHost has fetched
+	// the bootstrap data generated by the Machine's bootstrap provider.
+	BootstrapDataDeliveredCondition clusterv1.ConditionType = "BootstrapDataDelivered"
+	// HostDeprovisionedCondition indicates whether the PhysicalHost released by a deleted
+	// Beskar7Machine has been cleaned and powered off.
+	HostDeprovisionedCondition clusterv1.ConditionType = "HostDeprovisioned"
 )
 
 // Reasons for condition failures
@@ -23,6 +29,9 @@ const (
 	// WaitingForPhysicalHostReason (Severity=Info) indicates that the Beskar7Machine
 	// is waiting for an available PhysicalHost to be claimed.
 	WaitingForPhysicalHostReason string = "WaitingForPhysicalHost"
+	// WaitingForHostInFailureDomainReason (Severity=Info) indicates that the Beskar7Machine
+	// is waiting for an available PhysicalHost in the failure domain of its Machine.
+	WaitingForHostInFailureDomainReason string = "WaitingForHostInFailureDomain"
 	// WaitingForHostReason (Severity=Info) indicates waiting for a host (alias for compatibility)
 	WaitingForHostReason string = "WaitingForHost"
 	// PhysicalHostNotReadyReason (Severity=Info) indicates that the associated PhysicalHost
@@ -31,9 +40,28 @@ const (
 	// PhysicalHostErrorReason (Severity=Error) indicates that the associated PhysicalHost
 	// is in an Error state.
 	PhysicalHostErrorReason string = "PhysicalHostError"
+	// HardwareRequirementsNotMetReason (Severity=Warning) indicates that the inspected
+	// PhysicalHost did not meet the hardware requirements and was released, so another
+	// PhysicalHost is claimed instead.
+	HardwareRequirementsNotMetReason string = "HardwareRequirementsNotMet"
 	// ReleasePhysicalHostFailedReason (Severity=Warning) indicates that releasing the
 	// associated PhysicalHost failed during deletion.
 	ReleasePhysicalHostFailedReason string = "ReleasePhysicalHostFailed"
+	// WaitingForProvisioningReason (Severity=Info) indicates that the target image has been
+	// handed to the PhysicalHost and the installed OS has not reported back yet.
+	WaitingForProvisioningReason string = "WaitingForProvisioning"
+	// ProvisioningFailedReason (Severity=Error) indicates that the installation of the
+	// target image failed or did not report back in time.
+	ProvisioningFailedReason string = "ProvisioningFailed"
+	// WaitingForBootstrapDataReason (Severity=Info) indicates that the bootstrap data secret
+	// has not been generated yet or has not been fetched by the PhysicalHost.
+	WaitingForBootstrapDataReason string = "WaitingForBootstrapData"
+	// WipingHostReason (Severity=Info) indicates that the released PhysicalHost is being
+	// cleaned and has not reported the wipe as complete yet.
+	WipingHostReason string = "WipingHost"
+	// WipeFailedReason (Severity=Warning) indicates that cleaning the released PhysicalHost
+	// failed or did not report back in time. The PhysicalHost retries the wipe.
+	WipeFailedReason string = "WipeFailed"
 )
 
 // Beskar7MachineSpec defines the desired state of Beskar7Machine.
@@ -43,30 +71,107 @@ type Beskar7MachineSpec struct {
 	// +optional
 	ProviderID *string `json:"providerID,omitempty"`
 
-	// InspectionImageURL is the iPXE boot script URL that boots the inspection image.
+	// BootMethod selects how the inspection and target images are booted. PXE chains
+	// the image URLs from the iPXE boot script and requires DHCP and iPXE on the host
+	// network. UEFIHTTP points the BMC's UEFI HTTP boot at the per-host boot script
+	// instead, skipping TFTP, and falls back to PXE if the BMC does not support it.
+	// VirtualMedia inserts them as ISO images through the BMC, so the image URLs must
+	// point at ISO images.
+	// +kubebuilder:validation:Enum=PXE;UEFIHTTP;VirtualMedia
+	// +kubebuilder:default=PXE
+	// +optional
+	BootMethod BootMethod `json:"bootMethod,omitempty"`
+
+	// InspectionImageURL is the iPXE boot script URL that boots the inspection image,
+	// or the URL of the inspection ISO image when BootMethod is VirtualMedia.
 	// The inspection image will collect hardware information and report back to Beskar7.
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:Pattern="^https?://.*"
 	InspectionImageURL string `json:"inspectionImageURL"`
 
 	// TargetImageURL is the URL of the final OS image to boot via kexec after inspection.
-	// This should be a kernel+initrd or complete bootable image.
+	// This should be a kernel+initrd or complete bootable image, or an ISO image when
+	// BootMethod is VirtualMedia.
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:Pattern="^https?://.*"
 	TargetImageURL string `json:"targetImageURL"`
 
 	// ConfigurationURL is an optional URL for OS-specific configuration.
 	// The inspection image will pass this to the target OS during kexec.
+	// When empty, the target OS is pointed at the bootstrap data generated by the
+	// Machine's bootstrap provider instead.
 	// +kubebuilder:validation:Pattern="^https?://.*"
 	// +optional
 	ConfigurationURL string `json:"configurationURL,omitempty"`
 
+	// InspectionTimeout is how long the inspection image may take to report back,
+	// including the time the host needs to POST. Defaults to 10 minutes.
+	// +optional
+	InspectionTimeout *metav1.Duration `json:"inspectionTimeout,omitempty"`
+
+	// ProvisioningTimeout is how long the installed OS may take to report back after
+	// the target image was handed to the host. Defaults to 30 minutes.
+	// +optional
+	ProvisioningTimeout *metav1.Duration `json:"provisioningTimeout,omitempty"`
+
 	// HardwareRequirements specifies minimum hardware requirements for this machine.
 	// The inspection phase will validate against these requirements.
 	// +optional
 	HardwareRequirements *HardwareRequirements `json:"hardwareRequirements,omitempty"`
+
+	// HostSelectionPolicy controls which Available PhysicalHost is claimed when several
+	// may satisfy the HardwareRequirements. Hosts whose inspection report shows they are
+	// too small are never claimed.
+	// +kubebuilder:validation:Enum=BestFit;FirstAvailable
+	// +kubebuilder:default=BestFit
+	// +optional
+	HostSelectionPolicy HostSelectionPolicy `json:"hostSelectionPolicy,omitempty"`
+
+	// HostSelector restricts the PhysicalHosts this machine may claim to those whose
+	// labels match, e.g. to draw control plane and worker machines from separate racks
+	// or hardware classes. When empty, any Available host in the namespace may be claimed.
+	// +optional
+	HostSelector *metav1.LabelSelector `json:"hostSelector,omitempty"`
+
+	// FirmwareSettings are BIOS attributes by their Redfish attribute name, such as
+	// SriovGlobalEnable: Enabled, enforced on the host before the OS is installed. Values
+	// are converted to the type of the attribute. The settings are staged through the BMC
+	// and applied by the reboot into the inspection image; a host whose settings did not
+	// apply is not provisioned.
+	// +optional
+	FirmwareSettings map[string]string `json:"firmwareSettings,omitempty"`
+
+	// Storage configures the disks of the host before the OS is installed: a RAID
+	// volume built through the BMC and the disk the target image is installed to.
+	// +optional
+	Storage *StorageConfig `json:"storage,omitempty"`
 }
 
+// BootMethod defines how a host boots the inspection and target images.
+type BootMethod string
+
+const (
+	// BootMethodPXE network boots the host into the iPXE boot script served by Beskar7.
+	BootMethodPXE BootMethod = "PXE"
+	// BootMethodUEFIHTTP boots the host into the boot script served by Beskar7 over UEFI
+	// HTTP boot, falling back to PXE if the BMC does not support it.
+	BootMethodUEFIHTTP BootMethod = "UEFIHTTP"
+	// BootMethodVirtualMedia boots the host from ISO images inserted through the BMC.
+	BootMethodVirtualMedia BootMethod = "VirtualMedia"
+)
+
+// HostSelectionPolicy defines how candidate PhysicalHosts are ranked when claiming.
+type HostSelectionPolicy string
+
+const (
+	// HostSelectionPolicyBestFit claims the smallest inspected host that meets the
+	// requirements, keeping larger hosts for machines that need them. Hosts without an
+	// inspection report are only claimed when no inspected host fits.
+	HostSelectionPolicyBestFit HostSelectionPolicy = "BestFit"
+	// HostSelectionPolicyFirstAvailable claims the first eligible host by name.
+	HostSelectionPolicyFirstAvailable HostSelectionPolicy = "FirstAvailable"
+)
+
 // HardwareRequirements specifies hardware requirements for a machine.
 type HardwareRequirements struct {
 	// MinCPUCores is the minimum number of CPU cores required.
@@ -83,6 +188,224 @@ type HardwareRequirements struct {
 	// +optional
 	// +kubebuilder:validation:Minimum=1
 	MinDiskGB int `json:"minDiskGB,omitempty"`
+
+	// CPUVendor is a regular expression the vendor of every CPU must match, such as
+	// AuthenticAMD or GenuineIntel.
+	// +optional
+	CPUVendor string `json:"cpuVendor,omitempty"`
+
+	// CPUModel is a regular expression the model name of every CPU must match, such as
+	// "EPYC 9[0-9]{3}".
+	// +optional
+	CPUModel string `json:"cpuModel,omitempty"`
+
+	// MinNICs is the minimum number of network interfaces required. If MinNICSpeedMbps
+	// is set, only interfaces at least that fast are counted.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MinNICs int `json:"minNICs,omitempty"`
+
+	// MinNICSpeedMbps is the minimum link speed in Mbit/s of the interfaces counted by
+	// MinNICs, or of at least one interface if MinNICs is not set.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MinNICSpeedMbps int `json:"minNICSpeedMbps,omitempty"`
+
+	// Disks are the minimum numbers of disks of a type required, such as two NVMe
+	// disks of at least 900 GB.
+	// +optional
+	Disks []DiskRequirement `json:"disks,omitempty"`
+
+	// MinGPUs is the minimum number of GPUs required.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MinGPUs int `json:"minGPUs,omitempty"`
+
+	// Expressions are requirements on facts of the inspection report, written like
+	// the match expressions of a label selector, such as system.manufacturer In (Dell)
+	// or memory.gb Gt 512. Values are compared as plain, case sensitive strings, which
+	// unlike label values may contain spaces. All expressions must be met. See the
+	// HardwareFact constants for the facts available.
+	// +optional
+	Expressions []HardwareExpression `json:"expressions,omitempty"`
+}
+
+// DiskType is the type of a disk found by inspection.
+type DiskType string
+
+const (
+	// DiskTypeNVMe is an NVMe disk.
+	DiskTypeNVMe DiskType = "NVMe"
+	// DiskTypeSSD is a SATA or SAS solid state disk.
+	DiskTypeSSD DiskType = "SSD"
+	// DiskTypeHDD is a spinning disk.
+	DiskTypeHDD DiskType = "HDD"
+)
+
+// DiskRequirement requires a minimum number of disks of a type.
+type DiskRequirement struct {
+	// Type is the type of the disks.
+	// +kubebuilder:validation:Enum=NVMe;SSD;HDD
+	Type DiskType `json:"type"`
+
+	// Count is the minimum number of disks of the type.
+	// +kubebuilder:validation:Minimum=1
+	Count int `json:"count"`
+
+	// MinSizeGB is the minimum size of each counted disk in GB.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MinSizeGB int `json:"minSizeGB,omitempty"`
+}
+
+// HardwareExpressionOperator is the operator of a hardware expression.
+type HardwareExpressionOperator string
+
+const (
+	// HardwareExpressionOpIn requires the fact to be one of the values.
+	HardwareExpressionOpIn HardwareExpressionOperator = "In"
+	// HardwareExpressionOpNotIn requires the fact to be none of the values.
+	HardwareExpressionOpNotIn HardwareExpressionOperator = "NotIn"
+	// HardwareExpressionOpExists requires the fact to be reported.
+	HardwareExpressionOpExists HardwareExpressionOperator = "Exists"
+	// HardwareExpressionOpDoesNotExist requires the fact not to be reported.
+	HardwareExpressionOpDoesNotExist HardwareExpressionOperator = "DoesNotExist"
+	// HardwareExpressionOpGt requires the fact to be an integer greater than the value.
+	HardwareExpressionOpGt HardwareExpressionOperator = "Gt"
+	// HardwareExpressionOpLt requires the fact to be an integer less than the value.
+	HardwareExpressionOpLt HardwareExpressionOperator = "Lt"
+)
+
+// Facts of the inspection report hardware expressions can refer to. Facts of the CPUs
+// and GPUs are taken from the first one reported.
+const (
+	HardwareFactSystemManufacturer = "system.manufacturer"
+	HardwareFactSystemModel        = "system.model"
+	HardwareFactSystemBootMode     = "system.boot-mode"
+	HardwareFactCPUVendor          = "cpu.vendor"
+	HardwareFactCPUModel           = "cpu.model"
+	HardwareFactCPUCount           = "cpu.count"
+	HardwareFactCPUCores           = "cpu.cores"
+	HardwareFactCPUThreads         = "cpu.threads"
+	HardwareFactMemoryGB           = "memory.gb"
+	HardwareFactDiskCount          = "disk.count"
+	HardwareFactDiskGB             = "disk.gb"
+	HardwareFactDiskNVMeCount      = "disk.nvme.count"
+	HardwareFactDiskSSDCount       = "disk.ssd.count"
+	HardwareFactDiskHDDCount       = "disk.hdd.count"
+	HardwareFactNICCount           = "nic.count"
+	HardwareFactNICMaxSpeedMbps    = "nic.max-speed-mbps"
+	HardwareFactGPUCount           = "gpu.count"
+	HardwareFactGPUVendor          = "gpu.vendor"
+	HardwareFactGPUModel           = "gpu.model"
+)
+
+// HardwareExpression is a requirement on a fact of the inspection report.
+type HardwareExpression struct {
+	// Key is the fact the expression applies to, such as cpu.vendor.
+	Key string `json:"key"`
+
+	// Operator relates the fact to the values.
+	// +kubebuilder:validation:Enum=In;NotIn;Exists;DoesNotExist;Gt;Lt
+	Operator HardwareExpressionOperator `json:"operator"`
+
+	// Values are the values of the fact for the In and NotIn operators, or a single
+	// integer for the Gt and Lt operators. Must be empty for Exists and DoesNotExist.
+	// +optional
+	Values []string `json:"values,omitempty"`
+}
+
+// StorageConfig configures the disks of a host before the OS is installed.
+type StorageConfig struct {
+	// RAID is the RAID volume built from the drives of the host through the Redfish
+	// Storage API. It is created before the reboot into the inspection image, which
+	// applies it on BMCs that stage volume changes, and the host is not provisioned
+	// without it. Volumes that already exist are kept.
+	// +optional
+	RAID *RAIDConfig `json:"raid,omitempty"`
+
+	// RootDeviceHints select the disk the target image is installed to among those in
+	// the inspection report. The smallest matching disk is used. When unset, the RAID
+	// volume is used, if any.
+	// +optional
+	RootDeviceHints *RootDeviceHints `json:"rootDeviceHints,omitempty"`
+}
+
+// RAIDLevel is the RAID type of a volume, as named by Redfish.
+type RAIDLevel string
+
+const (
+	// RAIDLevel0 stripes data across the member drives without redundancy.
+	RAIDLevel0 RAIDLevel = "RAID0"
+	// RAIDLevel1 mirrors data across the member drives.
+	RAIDLevel1 RAIDLevel = "RAID1"
+	// RAIDLevel5 stripes data and parity across the member drives.
+	RAIDLevel5 RAIDLevel = "RAID5"
+	// RAIDLevel6 stripes data and two parity blocks across the member drives.
+	RAIDLevel6 RAIDLevel = "RAID6"
+	// RAIDLevel10 stripes data across mirrored pairs of drives.
+	RAIDLevel10 RAIDLevel = "RAID10"
+)
+
+// RAIDConfig describes a RAID volume built from the drives of a host.
+type RAIDConfig struct {
+	// Level is the RAID level of the volume.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=RAID0;RAID1;RAID5;RAID6;RAID10
+	Level RAIDLevel `json:"level"`
+
+	// MemberDiskHints select the drives the volume is built from. Drives that are
+	// members of another volume are never used. When unset, any such drive may be used.
+	// +optional
+	MemberDiskHints *DiskHints `json:"memberDiskHints,omitempty"`
+
+	// DiskCount is the number of member drives. Defaults to the minimum for the level:
+	// 1 for RAID0, 2 for RAID1, 3 for RAID5 and 4 for RAID6 and RAID10.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	DiskCount int32 `json:"diskCount,omitempty"`
+
+	// VolumeName is the name of the volume, which identifies it on later boots.
+	// Defaults to beskar7-root.
+	// +kubebuilder:validation:MaxLength=64
+	// +optional
+	VolumeName string `json:"volumeName,omitempty"`
+}
+
+// DiskHints select disks by their properties. A disk has to match all hints that are set.
+type DiskHints struct {
+	// Model matches disks whose model contains it, ignoring case.
+	// +optional
+	Model string `json:"model,omitempty"`
+
+	// SerialNumber matches the disk with this serial number, ignoring case.
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// MinSizeGB matches disks of at least this size in GB.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinSizeGB int32 `json:"minSizeGB,omitempty"`
+}
+
+// RootDeviceHints select the disk the target image is installed to. A disk has to match
+// all hints that are set.
+type RootDeviceHints struct {
+	DiskHints `json:",inline"`
+
+	// Name matches the disk with this device name, e.g. /dev/sda. Device names may change
+	// between boots, prefer the serial number or WWN.
+	// +kubebuilder:validation:Pattern=`^/dev/.+`
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// WWN matches the disk with this World Wide Name, ignoring case.
+	// +optional
+	WWN string `json:"wwn,omitempty"`
+
+	// Rotational matches spinning disks if true and solid state disks if false.
+	// +optional
+	Rotational *bool `json:"rotational,omitempty"`
 }
 
 // Beskar7MachineStatus defines the observed state of Beskar7Machine.
@@ -106,6 +429,11 @@ type Beskar7MachineStatus struct {
 	// Addresses contains the associated addresses for the machine.
 	Addresses []clusterv1.MachineAddress `json:"addresses,omitempty"`
 
+	// RootDevice is the disk of the host the target image is installed to, resolved
+	// from the inspection report with the storage configuration.
+	// +optional
+	RootDevice string `json:"rootDevice,omitempty"`
+
 	// Conditions defines current service state of the Beskar7Machine.
 	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
 }
@@ -156,16 +484,136 @@ func (in *Beskar7MachineSpec) DeepCopyInto(out *Beskar7MachineSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.InspectionTimeout != nil {
+		in, out := &in.InspectionTimeout, &out.InspectionTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ProvisioningTimeout != nil {
+		in, out := &in.ProvisioningTimeout, &out.ProvisioningTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 	if in.HardwareRequirements != nil {
 		in, out := &in.HardwareRequirements, &out.HardwareRequirements
 		*out = new(HardwareRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HostSelector != nil {
+		in, out := &in.HostSelector, &out.HostSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FirmwareSettings != nil {
+		in, out := &in.FirmwareSettings, &out.FirmwareSettings
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(StorageConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageConfig) DeepCopyInto(out *StorageConfig) {
+	*out = *in
+	if in.RAID != nil {
+		in, out := &in.RAID, &out.RAID
+		*out = new(RAIDConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RootDeviceHints != nil {
+		in, out := &in.RootDeviceHints, &out.RootDeviceHints
+		*out = new(RootDeviceHints)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageConfig.
+func (in *StorageConfig) DeepCopy() *StorageConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RAIDConfig) DeepCopyInto(out *RAIDConfig) {
+	*out = *in
+	if in.MemberDiskHints != nil {
+		in, out := &in.MemberDiskHints, &out.MemberDiskHints
+		*out = new(DiskHints)
 		**out = **in
 	}
 }
 
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RAIDConfig.
+func (in *RAIDConfig) DeepCopy() *RAIDConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RAIDConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskHints) DeepCopyInto(out *DiskHints) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskHints.
+func (in *DiskHints) DeepCopy() *DiskHints {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskHints)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RootDeviceHints) DeepCopyInto(out *RootDeviceHints) {
+	*out = *in
+	out.DiskHints = in.DiskHints
+	if in.Rotational != nil {
+		in, out := &in.Rotational, &out.Rotational
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RootDeviceHints.
+func (in *RootDeviceHints) DeepCopy() *RootDeviceHints {
+	if in == nil {
+		return nil
+	}
+	out := new(RootDeviceHints)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HardwareRequirements) DeepCopyInto(out *HardwareRequirements) {
 	*out = *in
+	if in.Disks != nil {
+		in, out := &in.Disks, &out.Disks
+		*out = make([]DiskRequirement, len(*in))
+		copy(*out, *in)
+	}
+	if in.Expressions != nil {
+		in, out := &in.Expressions, &out.Expressions
+		*out = make([]HardwareExpression, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HardwareRequirements.
@@ -178,6 +626,41 @@ func (in *HardwareRequirements) DeepCopy() *HardwareRequirements {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskRequirement) DeepCopyInto(out *DiskRequirement) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskRequirement.
+func (in *DiskRequirement) DeepCopy() *DiskRequirement {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskRequirement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HardwareExpression) DeepCopyInto(out *HardwareExpression) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HardwareExpression.
+func (in *HardwareExpression) DeepCopy() *HardwareExpression {
+	if in == nil {
+		return nil
+	}
+	out := new(HardwareExpression)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Beskar7MachineStatus) DeepCopyInto(out *Beskar7MachineStatus) {
 	*out = *in
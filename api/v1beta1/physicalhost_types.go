@@ -2,6 +2,7 @@ package v1beta1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
@@ -22,6 +23,12 @@ const (
 	StateInspecting = "Inspecting"
 	// StateReady indicates inspection is complete and host is ready for provisioning
 	StateReady = "Ready"
+	// StateCleaning indicates the host was released and is being wiped before it
+	// becomes available again
+	StateCleaning = "Cleaning"
+	// StateUpdating indicates a firmware update is running on the unclaimed host, which
+	// becomes available again once it has finished
+	StateUpdating = "Updating"
 	// StateError indicates the host is in an error state
 	StateError = "Error"
 
@@ -42,6 +49,15 @@ const (
 	InspectionTimeout    = "Timeout"
 )
 
+// RetryAnnotation can be set on a PhysicalHost in Error to retry it right away,
+// even after its automatic retries are exhausted. The controller removes the
+// annotation once the retry has been scheduled.
+const RetryAnnotation = "beskar7.io/retry"
+
+// ForceDeleteAnnotation must be set to "true" on a PhysicalHost before it can be
+// deleted while a Beskar7Machine still claims it.
+const ForceDeleteAnnotation = "beskar7.io/force-delete"
+
 // RedfishConnection contains the information needed to connect to a Redfish service
 type RedfishConnection struct {
 	// Address is the URL of the Redfish service
@@ -71,6 +87,11 @@ type HardwareDetails struct {
 	// SerialNumber is the serial number of the physical host
 	SerialNumber string `json:"serialNumber,omitempty"`
 
+	// MACAddresses lists the MAC addresses of the network interfaces reported by the BMC.
+	// Inspection reports are checked against them to detect miswired hosts.
+	// +optional
+	MACAddresses []string `json:"macAddresses,omitempty"`
+
 	// Status contains the current status of the host
 	Status HardwareStatus `json:"status,omitempty"`
 }
@@ -96,11 +117,146 @@ type PhysicalHostSpec struct {
 	// RedfishConnection contains the connection details for the Redfish endpoint
 	RedfishConnection RedfishConnection `json:"redfishConnection"`
 
+	// BootMACAddress is the MAC address of the NIC the host network boots from.
+	// It is used to identify the host when it requests its iPXE boot script.
+	// +kubebuilder:validation:Pattern="^([0-9a-fA-F]{2}[:-]){5}[0-9a-fA-F]{2}$"
+	// +optional
+	BootMACAddress string `json:"bootMACAddress,omitempty"`
+
 	// ConsumerRef is a reference to the Beskar7Machine that is using this host
 	// +optional
 	ConsumerRef *corev1.ObjectReference `json:"consumerRef,omitempty"`
+
+	// CleaningMode selects how thoroughly the disks are wiped when the host is released
+	// after the target OS was installed. The host only becomes Available again once
+	// cleaning has completed.
+	// +kubebuilder:validation:Enum=None;MetadataOnly;Full
+	// +kubebuilder:default=MetadataOnly
+	// +optional
+	CleaningMode CleaningMode `json:"cleaningMode,omitempty"`
+
+	// CleaningImageURL is the iPXE boot script URL that boots the cleaning image, or
+	// the URL of the cleaning ISO image if the host is consumed by Beskar7Machines with
+	// boot method VirtualMedia, as the host is cleaned with the boot method of its last
+	// consumer. The cleaning image wipes the disks and reports back to Beskar7. Required
+	// unless CleaningMode is None.
+	// +kubebuilder:validation:Pattern="^https?://.*"
+	// +optional
+	CleaningImageURL string `json:"cleaningImageURL,omitempty"`
+
+	// CleaningTimeout is how long the cleaning image may take to report back before
+	// the host is moved to Error and cleaned again. A Full wipe of large disks may need
+	// more than the default of one hour.
+	// +optional
+	CleaningTimeout *metav1.Duration `json:"cleaningTimeout,omitempty"`
+
+	// FirmwareSettings override the firmware settings of the Beskar7Machine claiming the
+	// host attribute by attribute, e.g. for a host whose BIOS names an attribute
+	// differently. They are only enforced while the host is claimed.
+	// +optional
+	FirmwareSettings map[string]string `json:"firmwareSettings,omitempty"`
+
+	// FirmwareUpdate requests a firmware update through the Redfish UpdateService. It is
+	// applied while the host is Available and unclaimed, and the host cannot be claimed
+	// until the update has finished. Changing the image or target requests another
+	// update.
+	// +optional
+	FirmwareUpdate *FirmwareUpdate `json:"firmwareUpdate,omitempty"`
+}
+
+// FirmwareUpdate describes a firmware image to apply to a host
+type FirmwareUpdate struct {
+	// ImageURI is the URL the BMC fetches the firmware image from
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern="^https?://.*"
+	ImageURI string `json:"imageURI"`
+
+	// Target is the ID of the component in status.firmwareInventory to update, e.g.
+	// BMC or BIOS. The BMC applies the image to every applicable component if unset.
+	// +optional
+	Target string `json:"target,omitempty"`
 }
 
+// FirmwareComponent is a firmware component of the host as reported by the BMC
+type FirmwareComponent struct {
+	// ID identifies the component in the firmware inventory of the BMC
+	ID string `json:"id"`
+
+	// Name is the display name of the component
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Version is the firmware version the component runs
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Updateable indicates whether the component can be updated through the BMC
+	// +optional
+	Updateable bool `json:"updateable,omitempty"`
+}
+
+// FirmwareUpdatePhase represents the progress of a firmware update
+type FirmwareUpdatePhase string
+
+const (
+	// FirmwareUpdatePhasePending indicates the update is about to be handed to the BMC
+	FirmwareUpdatePhasePending FirmwareUpdatePhase = "Pending"
+	// FirmwareUpdatePhaseRunning indicates the BMC is applying the update
+	FirmwareUpdatePhaseRunning FirmwareUpdatePhase = "Running"
+	// FirmwareUpdatePhaseCompleted indicates the BMC reported the update as completed
+	FirmwareUpdatePhaseCompleted FirmwareUpdatePhase = "Completed"
+	// FirmwareUpdatePhaseFailed indicates the update could not be started, failed or
+	// timed out
+	FirmwareUpdatePhaseFailed FirmwareUpdatePhase = "Failed"
+)
+
+// FirmwareUpdateStatus tracks a firmware update requested through spec.firmwareUpdate
+type FirmwareUpdateStatus struct {
+	// ImageURI is the URL of the firmware image
+	ImageURI string `json:"imageURI"`
+
+	// Target is the ID of the component updated, if any
+	// +optional
+	Target string `json:"target,omitempty"`
+
+	// Phase is the progress of the update
+	Phase FirmwareUpdatePhase `json:"phase"`
+
+	// TaskURI is the Redfish task tracking the update on the BMC
+	// +optional
+	TaskURI string `json:"taskURI,omitempty"`
+
+	// PercentComplete is the progress of the task, if the BMC reports it
+	// +optional
+	PercentComplete int32 `json:"percentComplete,omitempty"`
+
+	// Message contains the messages the BMC reported for the task, or why the update
+	// failed
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartTime is when the update was requested
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the update completed or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// CleaningMode defines how the disks of a released host are wiped
+type CleaningMode string
+
+const (
+	// CleaningModeNone skips cleaning and only powers the host off
+	CleaningModeNone CleaningMode = "None"
+	// CleaningModeMetadataOnly erases partition tables, filesystem signatures and RAID
+	// metadata, which is quick but leaves data blocks in place
+	CleaningModeMetadataOnly CleaningMode = "MetadataOnly"
+	// CleaningModeFull performs a secure erase of every disk
+	CleaningModeFull CleaningMode = "Full"
+)
+
 // InspectionPhase represents the current phase of hardware inspection
 type InspectionPhase string
 
@@ -119,6 +275,36 @@ const (
 	InspectionPhaseTimeout InspectionPhase = "Timeout"
 )
 
+// ProvisioningPhase represents the progress of the target OS installation
+// once inspection has been validated.
+type ProvisioningPhase string
+
+const (
+	// ProvisioningPhaseProvisioning indicates the target image and configuration
+	// have been handed to the host and the installation is in progress
+	ProvisioningPhaseProvisioning ProvisioningPhase = "Provisioning"
+	// ProvisioningPhaseProvisioned indicates the installed OS reported back successfully
+	ProvisioningPhaseProvisioned ProvisioningPhase = "Provisioned"
+	// ProvisioningPhaseFailed indicates the installation reported a failure or timed out
+	ProvisioningPhaseFailed ProvisioningPhase = "Failed"
+)
+
+// CleaningPhase represents the progress of wiping a released host
+type CleaningPhase string
+
+const (
+	// CleaningPhaseBooting indicates the host is being booted into the cleaning image
+	CleaningPhaseBooting CleaningPhase = "Booting"
+	// CleaningPhaseWiping indicates the cleaning image is wiping the disks
+	CleaningPhaseWiping CleaningPhase = "Wiping"
+	// CleaningPhaseComplete indicates the cleaning image reported the wipe as complete
+	CleaningPhaseComplete CleaningPhase = "Complete"
+	// CleaningPhaseFailed indicates the cleaning image reported a failure
+	CleaningPhaseFailed CleaningPhase = "Failed"
+	// CleaningPhaseTimeout indicates cleaning did not complete in time
+	CleaningPhaseTimeout CleaningPhase = "Timeout"
+)
+
 // InspectionReport contains hardware information collected during inspection
 type InspectionReport struct {
 	// Timestamp when the inspection was performed
@@ -159,6 +345,10 @@ type InspectionReport struct {
 	// NICs contains network interface information
 	// +optional
 	NICs []NICInfo `json:"nics,omitempty"`
+
+	// GPUs contains information about GPUs and other accelerators
+	// +optional
+	GPUs []GPUInfo `json:"gpus,omitempty"`
 }
 
 // CPUInfo contains information about a CPU
@@ -202,6 +392,11 @@ type MemoryInfo struct {
 	// +optional
 	Capacity string `json:"capacity,omitempty"`
 
+	// Size is the memory capacity as a quantity (e.g., 32Gi). Capacities are parsed with
+	// the units of a quantity, so 32G and 32GB are decimal, 32Gi and 32GiB binary.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
 	// Speed is the memory speed (e.g., "3200MHz")
 	// +optional
 	Speed string `json:"speed,omitempty"`
@@ -228,6 +423,14 @@ type DiskInfo struct {
 	// SerialNumber is the disk serial number
 	// +optional
 	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// WWN is the World Wide Name of the disk
+	// +optional
+	WWN string `json:"wwn,omitempty"`
+
+	// Rotational indicates a spinning disk
+	// +optional
+	Rotational bool `json:"rotational,omitempty"`
 }
 
 // NICInfo contains information about a network interface card
@@ -248,11 +451,30 @@ type NICInfo struct {
 	// +optional
 	Speed string `json:"speed,omitempty"`
 
+	// SpeedMbps is the link speed in Mbit/s
+	// +optional
+	SpeedMbps int `json:"speedMbps,omitempty"`
+
 	// IPAddresses are the IP addresses assigned to this interface
 	// +optional
 	IPAddresses []string `json:"ipAddresses,omitempty"`
 }
 
+// GPUInfo contains information about a GPU or other accelerator
+type GPUInfo struct {
+	// ID is the PCI address of the device
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// Vendor is the GPU vendor (e.g., NVIDIA, AMD)
+	// +optional
+	Vendor string `json:"vendor,omitempty"`
+
+	// Model is the GPU model name
+	// +optional
+	Model string `json:"model,omitempty"`
+}
+
 // PhysicalHostStatus defines the observed state of PhysicalHost
 type PhysicalHostStatus struct {
 	// Ready indicates if the host is ready and enrolled
@@ -267,6 +489,12 @@ type PhysicalHostStatus struct {
 	// +optional
 	ObservedPowerState string `json:"observedPowerState,omitempty"`
 
+	// PowerAction is the power action in progress on the host. The controllers send one
+	// reset at a time and check on the host again on a later reconcile instead of
+	// waiting for it.
+	// +optional
+	PowerAction *PowerActionStatus `json:"powerAction,omitempty"`
+
 	// ErrorMessage contains details on the last error encountered
 	// +optional
 	ErrorMessage string `json:"errorMessage,omitempty"`
@@ -291,6 +519,101 @@ type PhysicalHostStatus struct {
 	// +optional
 	InspectionTimestamp *metav1.Time `json:"inspectionTimestamp,omitempty"`
 
+	// InspectionToken tracks the one-time token the inspection image must present
+	// when reporting back
+	// +optional
+	InspectionToken *InspectionToken `json:"inspectionToken,omitempty"`
+
+	// ProvisioningPhase tracks the installation of the target OS after inspection
+	// +optional
+	ProvisioningPhase ProvisioningPhase `json:"provisioningPhase,omitempty"`
+
+	// ProvisioningTimestamp is when the target image was handed to the host
+	// +optional
+	ProvisioningTimestamp *metav1.Time `json:"provisioningTimestamp,omitempty"`
+
+	// TargetImageServed records that the target image of the current consumer was
+	// handed to the host. It is set before the host is booted into the target image,
+	// and a released host with it set is cleaned before it becomes Available again.
+	// +optional
+	TargetImageServed bool `json:"targetImageServed,omitempty"`
+
+	// ProvisioningTokenHash is the SHA-256 hash of the one-time token the installed OS
+	// must present when reporting the provisioning result
+	// +optional
+	ProvisioningTokenHash string `json:"provisioningTokenHash,omitempty"`
+
+	// BootstrapTokenHash is the SHA-256 hash of the token the host must present
+	// to fetch its bootstrap data
+	// +optional
+	BootstrapTokenHash string `json:"bootstrapTokenHash,omitempty"`
+
+	// BootstrapDataTimestamp is when the host last fetched its bootstrap data
+	// +optional
+	BootstrapDataTimestamp *metav1.Time `json:"bootstrapDataTimestamp,omitempty"`
+
+	// CleaningPhase tracks the wipe of the host after it was released
+	// +optional
+	CleaningPhase CleaningPhase `json:"cleaningPhase,omitempty"`
+
+	// CleaningTimestamp is when cleaning started
+	// +optional
+	CleaningTimestamp *metav1.Time `json:"cleaningTimestamp,omitempty"`
+
+	// CleaningTokenHash is the SHA-256 hash of the token the cleaning image must
+	// present when reporting back
+	// +optional
+	CleaningTokenHash string `json:"cleaningTokenHash,omitempty"`
+
+	// VirtualMediaImage is the ISO image inserted into the virtual CD/DVD drive of the
+	// host for a Beskar7Machine with boot method VirtualMedia. It is ejected once the
+	// target OS is provisioned or the host is released.
+	// +optional
+	VirtualMediaImage string `json:"virtualMediaImage,omitempty"`
+
+	// BootMethod is the boot method the consumer booted the host with. A released host
+	// is booted into the cleaning image the same way, as the network may not support
+	// any other. It is cleared once the host is Available again.
+	// +optional
+	BootMethod BootMethod `json:"bootMethod,omitempty"`
+
+	// PersistentBootTarget is the boot source override Beskar7 set on the host until
+	// cleared, Hdd once the target OS is installed. It is cleared when the host is
+	// released.
+	// +optional
+	PersistentBootTarget string `json:"persistentBootTarget,omitempty"`
+
+	// RootDevice is the disk the target image is installed to, e.g. /dev/sda,
+	// resolved from the inspection report and the storage configuration of the
+	// consumer. It is cleared when the host is released.
+	// +optional
+	RootDevice string `json:"rootDevice,omitempty"`
+
+	// RetryCount is the number of automatic retries made since the host last
+	// recovered from Error
+	// +optional
+	RetryCount int32 `json:"retryCount,omitempty"`
+
+	// NextRetryTime is when the host in Error is retried next. It is unset once the
+	// retries are exhausted or the failure is not retried automatically.
+	// +optional
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+
+	// FailureHistory records the most recent failures that moved the host to Error,
+	// oldest first
+	// +optional
+	FailureHistory []HostFailure `json:"failureHistory,omitempty"`
+
+	// FirmwareInventory lists the firmware components of the host and their versions,
+	// as reported by the Redfish UpdateService
+	// +optional
+	FirmwareInventory []FirmwareComponent `json:"firmwareInventory,omitempty"`
+
+	// FirmwareUpdate tracks the last firmware update requested through
+	// spec.firmwareUpdate
+	// +optional
+	FirmwareUpdate *FirmwareUpdateStatus `json:"firmwareUpdate,omitempty"`
+
 	// Conditions defines current service state of the PhysicalHost
 	// +optional
 	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
@@ -298,9 +621,12 @@ type PhysicalHostStatus struct {
 
 // Redfish conditions and reasons - simplified for power management only
 const (
-	RedfishConnectionReadyCondition clusterv1.ConditionType = "RedfishConnectionReady"
-	HostAvailableCondition          clusterv1.ConditionType = "HostAvailable"
-	HostInspectedCondition          clusterv1.ConditionType = "HostInspected"
+	RedfishConnectionReadyCondition  clusterv1.ConditionType = "RedfishConnectionReady"
+	HostAvailableCondition           clusterv1.ConditionType = "HostAvailable"
+	HostInspectedCondition           clusterv1.ConditionType = "HostInspected"
+	FirmwareSettingsAppliedCondition clusterv1.ConditionType = "FirmwareSettingsApplied"
+	FirmwareUpdatedCondition         clusterv1.ConditionType = "FirmwareUpdated"
+	StorageConfiguredCondition       clusterv1.ConditionType = "StorageConfigured"
 
 	// Reasons
 	MissingCredentialsReason      string = "MissingCredentials"
@@ -314,6 +640,46 @@ const (
 	SetBootPXEFailedReason        string = "SetBootPXEFailed"
 	InspectionFailedReason        string = "InspectionFailed"
 	InspectionTimeoutReason       string = "InspectionTimeout"
+	IdentityMismatchReason        string = "IdentityMismatch"
+	MissingCleaningImageReason    string = "MissingCleaningImage"
+	CleaningFailedReason          string = "CleaningFailed"
+	CleaningTimeoutReason         string = "CleaningTimeout"
+
+	// FirmwareSettingsPendingRebootReason (Severity=Info) indicates that the BIOS
+	// attributes are staged and applied on the next reboot
+	FirmwareSettingsPendingRebootReason string = "FirmwareSettingsPendingReboot"
+	// FirmwareSettingsDriftedReason (Severity=Warning) indicates that BIOS attributes
+	// changed after they were applied. They are staged again for the next reboot.
+	FirmwareSettingsDriftedReason string = "FirmwareSettingsDrifted"
+	// FirmwareSettingsFailedReason (Severity=Warning) indicates that the BIOS attributes
+	// could not be read or staged, or were not applied by a reboot
+	FirmwareSettingsFailedReason string = "FirmwareSettingsFailed"
+	// InvalidFirmwareSettingsReason (Severity=Error) indicates that the firmware settings
+	// name attributes the host does not have, or values that do not fit them
+	InvalidFirmwareSettingsReason string = "InvalidFirmwareSettings"
+
+	// FirmwareUpdateDeferredReason (Severity=Info) indicates that the firmware update
+	// waits until the host is released
+	FirmwareUpdateDeferredReason string = "FirmwareUpdateDeferred"
+	// FirmwareUpdateInProgressReason (Severity=Info) indicates that the BMC is applying
+	// the firmware update
+	FirmwareUpdateInProgressReason string = "FirmwareUpdateInProgress"
+	// FirmwareUpdateFailedReason (Severity=Warning) indicates that the firmware update
+	// could not be started, failed or timed out
+	FirmwareUpdateFailedReason string = "FirmwareUpdateFailed"
+	// InvalidFirmwareUpdateReason (Severity=Error) indicates that the firmware update
+	// targets a component the host does not have or cannot update
+	InvalidFirmwareUpdateReason string = "InvalidFirmwareUpdate"
+
+	// StorageConfigurationPendingReason (Severity=Info) indicates that the RAID volume
+	// was requested from the BMC and is created by the next reboot
+	StorageConfigurationPendingReason string = "StorageConfigurationPending"
+	// StorageConfigurationFailedReason (Severity=Warning) indicates that the RAID volume
+	// could not be created, or was not created by the inspection boot
+	StorageConfigurationFailedReason string = "StorageConfigurationFailed"
+	// InvalidStorageConfigurationReason (Severity=Error) indicates that the host has no
+	// drives for the RAID volume, or no disk matching the root device hints
+	InvalidStorageConfigurationReason string = "InvalidStorageConfiguration"
 )
 
 // RedfishConnectionInfo contains the information needed to connect to a Redfish service
@@ -371,13 +737,34 @@ func (in *PhysicalHostSpec) DeepCopyInto(out *PhysicalHostSpec) {
 		*out = new(corev1.ObjectReference)
 		**out = **in
 	}
+	if in.CleaningTimeout != nil {
+		in, out := &in.CleaningTimeout, &out.CleaningTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.FirmwareSettings != nil {
+		in, out := &in.FirmwareSettings, &out.FirmwareSettings
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.FirmwareUpdate != nil {
+		in, out := &in.FirmwareUpdate, &out.FirmwareUpdate
+		*out = new(FirmwareUpdate)
+		**out = **in
+	}
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PhysicalHostStatus) DeepCopyInto(out *PhysicalHostStatus) {
 	*out = *in
-	// HardwareDetails is a value type, so direct assignment is fine
-	out.HardwareDetails = in.HardwareDetails
+	if in.PowerAction != nil {
+		in, out := &in.PowerAction, &out.PowerAction
+		*out = new(PowerActionStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	in.HardwareDetails.DeepCopyInto(&out.HardwareDetails)
 	if in.Addresses != nil {
 		in, out := &in.Addresses, &out.Addresses
 		*out = make([]clusterv1.MachineAddress, len(*in))
@@ -392,6 +779,44 @@ func (in *PhysicalHostStatus) DeepCopyInto(out *PhysicalHostStatus) {
 		in, out := &in.InspectionTimestamp, &out.InspectionTimestamp
 		*out = (*in).DeepCopy()
 	}
+	if in.InspectionToken != nil {
+		in, out := &in.InspectionToken, &out.InspectionToken
+		*out = new(InspectionToken)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ProvisioningTimestamp != nil {
+		in, out := &in.ProvisioningTimestamp, &out.ProvisioningTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.BootstrapDataTimestamp != nil {
+		in, out := &in.BootstrapDataTimestamp, &out.BootstrapDataTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.CleaningTimestamp != nil {
+		in, out := &in.CleaningTimestamp, &out.CleaningTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.FailureHistory != nil {
+		in, out := &in.FailureHistory, &out.FailureHistory
+		*out = make([]HostFailure, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.FirmwareInventory != nil {
+		in, out := &in.FirmwareInventory, &out.FirmwareInventory
+		*out = make([]FirmwareComponent, len(*in))
+		copy(*out, *in)
+	}
+	if in.FirmwareUpdate != nil {
+		in, out := &in.FirmwareUpdate, &out.FirmwareUpdate
+		*out = new(FirmwareUpdateStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make(clusterv1.Conditions, len(*in))
@@ -399,6 +824,125 @@ func (in *PhysicalHostStatus) DeepCopyInto(out *PhysicalHostStatus) {
 	}
 }
 
+// HostFailure records a failure that moved a PhysicalHost to Error.
+type HostFailure struct {
+	// Timestamp is when the failure occurred
+	Timestamp metav1.Time `json:"timestamp"`
+
+	// State is the state the host was in before it failed
+	// +optional
+	State string `json:"state,omitempty"`
+
+	// Reason is a machine readable reason for the failure
+	Reason string `json:"reason"`
+
+	// Message is a human readable description of the failure
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// DeepCopyInto is an autogenerated deepcopy function for HostFailure
+func (in *HostFailure) DeepCopyInto(out *HostFailure) {
+	*out = *in
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+}
+
+// DeepCopy is an autogenerated deepcopy function for HostFailure
+func (in *HostFailure) DeepCopy() *HostFailure {
+	if in == nil {
+		return nil
+	}
+	out := new(HostFailure)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function for FirmwareUpdateStatus
+func (in *FirmwareUpdateStatus) DeepCopyInto(out *FirmwareUpdateStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function for FirmwareUpdateStatus
+func (in *FirmwareUpdateStatus) DeepCopy() *FirmwareUpdateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FirmwareUpdateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// InspectionToken is a one-time token minted for a single inspection run.
+// Only the SHA-256 hash of the token is stored.
+type InspectionToken struct {
+	// Hash is the hex encoded SHA-256 hash of the token
+	Hash string `json:"hash"`
+
+	// ExpiresAt is when the token stops being accepted
+	ExpiresAt metav1.Time `json:"expiresAt"`
+
+	// UsedAt is when an inspection report was accepted with the token
+	// +optional
+	UsedAt *metav1.Time `json:"usedAt,omitempty"`
+}
+
+// DeepCopyInto is an autogenerated deepcopy function for InspectionToken
+func (in *InspectionToken) DeepCopyInto(out *InspectionToken) {
+	*out = *in
+	in.ExpiresAt.DeepCopyInto(&out.ExpiresAt)
+	if in.UsedAt != nil {
+		in, out := &in.UsedAt, &out.UsedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function for InspectionToken
+func (in *InspectionToken) DeepCopy() *InspectionToken {
+	if in == nil {
+		return nil
+	}
+	out := new(InspectionToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// PowerActionStatus records the progress of a power action on the host.
+type PowerActionStatus struct {
+	// Action is the requested power action: PowerOff, PowerOn or Restart
+	Action string `json:"action"`
+
+	// ResetType is the last reset sent to the host, e.g. GracefulShutdown
+	ResetType string `json:"resetType"`
+
+	// Deadline is when the host must have reached the power state requested by the
+	// reset. A graceful shutdown still in progress is forced off after it.
+	Deadline metav1.Time `json:"deadline"`
+}
+
+// DeepCopyInto is an autogenerated deepcopy function for PowerActionStatus
+func (in *PowerActionStatus) DeepCopyInto(out *PowerActionStatus) {
+	*out = *in
+	in.Deadline.DeepCopyInto(&out.Deadline)
+}
+
+// DeepCopy is an autogenerated deepcopy function for PowerActionStatus
+func (in *PowerActionStatus) DeepCopy() *PowerActionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PowerActionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function for InspectionReport
 func (in *InspectionReport) DeepCopyInto(out *InspectionReport) {
 	*out = *in
@@ -411,7 +955,9 @@ func (in *InspectionReport) DeepCopyInto(out *InspectionReport) {
 	if in.Memory != nil {
 		in, out := &in.Memory, &out.Memory
 		*out = make([]MemoryInfo, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.Disks != nil {
 		in, out := &in.Disks, &out.Disks
@@ -421,6 +967,13 @@ func (in *InspectionReport) DeepCopyInto(out *InspectionReport) {
 	if in.NICs != nil {
 		in, out := &in.NICs, &out.NICs
 		*out = make([]NICInfo, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.GPUs != nil {
+		in, out := &in.GPUs, &out.GPUs
+		*out = make([]GPUInfo, len(*in))
 		copy(*out, *in)
 	}
 }
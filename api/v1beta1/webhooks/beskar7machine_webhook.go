@@ -0,0 +1,416 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrav1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+const (
+	// MinInspectionTimeout is the shortest inspection timeout accepted. Servers rarely
+	// POST and boot the inspection image any faster.
+	MinInspectionTimeout = time.Minute
+
+	// MaxInspectionTimeout is the longest inspection timeout accepted.
+	MaxInspectionTimeout = 24 * time.Hour
+
+	// MinProvisioningTimeout is the shortest provisioning timeout accepted. Installing
+	// the target image and booting the installed OS rarely takes less.
+	MinProvisioningTimeout = 5 * time.Minute
+
+	// MaxProvisioningTimeout is the longest provisioning timeout accepted.
+	MaxProvisioningTimeout = 24 * time.Hour
+)
+
+// Beskar7MachineWebhook implements a validating and defaulting webhook for Beskar7Machine.
+type Beskar7MachineWebhook struct{}
+
+// SetupWebhookWithManager sets up the webhook with the manager.
+func (webhook *Beskar7MachineWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&infrav1beta1.Beskar7Machine{}).
+		WithValidator(webhook).
+		WithDefaulter(webhook).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-beskar7machine,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=beskar7machines,versions=v1beta1,name=validation.beskar7.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-beskar7machine,mutating=true,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=beskar7machines,versions=v1beta1,name=defaulting.beskar7.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1
+
+var _ webhook.CustomValidator = &Beskar7MachineWebhook{}
+var _ webhook.CustomDefaulter = &Beskar7MachineWebhook{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type.
+func (webhook *Beskar7MachineWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	machine := obj.(*infrav1beta1.Beskar7Machine)
+	return webhook.validateBeskar7Machine(machine)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type.
+func (webhook *Beskar7MachineWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldMachine := oldObj.(*infrav1beta1.Beskar7Machine)
+	newMachine := newObj.(*infrav1beta1.Beskar7Machine)
+
+	// The ProviderID identifies the host to the workload cluster and CAPI, it must not
+	// move to another host once set
+	if oldMachine.Spec.ProviderID != nil && *oldMachine.Spec.ProviderID != "" {
+		if newMachine.Spec.ProviderID == nil || *newMachine.Spec.ProviderID != *oldMachine.Spec.ProviderID {
+			return nil, apierrors.NewInvalid(
+				newMachine.GroupVersionKind().GroupKind(),
+				newMachine.Name,
+				field.ErrorList{field.Forbidden(field.NewPath("spec", "providerID"), "providerID is immutable once set")},
+			)
+		}
+	}
+
+	return webhook.validateBeskar7Machine(newMachine)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type.
+func (webhook *Beskar7MachineWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	// No specific validations needed for deletion
+	return nil, nil
+}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type.
+func (webhook *Beskar7MachineWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	machine := obj.(*infrav1beta1.Beskar7Machine)
+	defaultBeskar7MachineSpec(&machine.Spec)
+	return nil
+}
+
+func (webhook *Beskar7MachineWebhook) validateBeskar7Machine(machine *infrav1beta1.Beskar7Machine) (admission.Warnings, error) {
+	allErrs := validateBeskar7MachineSpec(machine.Spec, field.NewPath("spec"))
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(
+			machine.GroupVersionKind().GroupKind(),
+			machine.Name,
+			allErrs,
+		)
+	}
+
+	return nil, nil
+}
+
+// validateBeskar7MachineSpec validates a machine spec, shared by Beskar7Machines and the
+// spec of Beskar7MachineTemplates.
+func validateBeskar7MachineSpec(spec infrav1beta1.Beskar7MachineSpec, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch spec.BootMethod {
+	case "", infrav1beta1.BootMethodPXE, infrav1beta1.BootMethodUEFIHTTP, infrav1beta1.BootMethodVirtualMedia:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fieldPath.Child("bootMethod"), spec.BootMethod,
+			[]string{string(infrav1beta1.BootMethodPXE), string(infrav1beta1.BootMethodUEFIHTTP), string(infrav1beta1.BootMethodVirtualMedia)}))
+	}
+
+	allErrs = append(allErrs, validateBootURL(spec.InspectionImageURL, fieldPath.Child("inspectionImageURL"), true)...)
+	allErrs = append(allErrs, validateBootURL(spec.TargetImageURL, fieldPath.Child("targetImageURL"), true)...)
+	allErrs = append(allErrs, validateBootURL(spec.ConfigurationURL, fieldPath.Child("configurationURL"), false)...)
+
+	if spec.InspectionTimeout != nil {
+		allErrs = append(allErrs, validateInspectionTimeout(spec.InspectionTimeout, fieldPath.Child("inspectionTimeout"))...)
+	}
+	if spec.ProvisioningTimeout != nil {
+		allErrs = append(allErrs, validateProvisioningTimeout(spec.ProvisioningTimeout, fieldPath.Child("provisioningTimeout"))...)
+	}
+
+	if spec.HardwareRequirements != nil {
+		allErrs = append(allErrs, validateHardwareRequirements(spec.HardwareRequirements, fieldPath.Child("hardwareRequirements"))...)
+	}
+
+	if spec.HostSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(spec.HostSelector); err != nil {
+			allErrs = append(allErrs, field.Invalid(fieldPath.Child("hostSelector"), spec.HostSelector, err.Error()))
+		}
+	}
+
+	allErrs = append(allErrs, validateFirmwareSettings(spec.FirmwareSettings, fieldPath.Child("firmwareSettings"))...)
+
+	if spec.Storage != nil {
+		allErrs = append(allErrs, validateStorage(spec.Storage, fieldPath.Child("storage"))...)
+	}
+
+	return allErrs
+}
+
+// defaultBeskar7MachineSpec defaults a machine spec, shared by Beskar7Machines and the
+// spec of Beskar7MachineTemplates.
+func defaultBeskar7MachineSpec(spec *infrav1beta1.Beskar7MachineSpec) {
+	if spec.BootMethod == "" {
+		spec.BootMethod = infrav1beta1.BootMethodPXE
+	}
+	if spec.HostSelectionPolicy == "" {
+		spec.HostSelectionPolicy = infrav1beta1.HostSelectionPolicyBestFit
+	}
+}
+
+// validateBootURL validates a URL the host fetches while it boots. Hosts fetch them
+// from iPXE and the inspection image, which only speak HTTP and HTTPS.
+func validateBootURL(value string, fieldPath *field.Path, required bool) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if value == "" {
+		if required {
+			allErrs = append(allErrs, field.Required(fieldPath, "URL is required"))
+		}
+		return allErrs
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fieldPath, value, "must be a valid URL: "+err.Error()))
+		return allErrs
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		allErrs = append(allErrs, field.Invalid(fieldPath, value, "URL scheme must be http or https"))
+	}
+	if u.Host == "" {
+		allErrs = append(allErrs, field.Invalid(fieldPath, value, "URL must include a host"))
+	}
+
+	return allErrs
+}
+
+func validateHardwareRequirements(requirements *infrav1beta1.HardwareRequirements, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// Zero means no requirement
+	for _, requirement := range []struct {
+		name  string
+		value int
+	}{
+		{"minCPUCores", requirements.MinCPUCores},
+		{"minMemoryGB", requirements.MinMemoryGB},
+		{"minDiskGB", requirements.MinDiskGB},
+		{"minNICs", requirements.MinNICs},
+		{"minNICSpeedMbps", requirements.MinNICSpeedMbps},
+		{"minGPUs", requirements.MinGPUs},
+	} {
+		if requirement.value < 0 {
+			allErrs = append(allErrs, field.Invalid(fieldPath.Child(requirement.name), requirement.value, "must not be negative"))
+		}
+	}
+
+	for _, pattern := range []struct {
+		name  string
+		value string
+	}{
+		{"cpuVendor", requirements.CPUVendor},
+		{"cpuModel", requirements.CPUModel},
+	} {
+		if _, err := regexp.Compile(pattern.value); err != nil {
+			allErrs = append(allErrs, field.Invalid(fieldPath.Child(pattern.name), pattern.value,
+				fmt.Sprintf("must be a regular expression: %v", err)))
+		}
+	}
+
+	for i, disk := range requirements.Disks {
+		diskPath := fieldPath.Child("disks").Index(i)
+		switch disk.Type {
+		case infrav1beta1.DiskTypeNVMe, infrav1beta1.DiskTypeSSD, infrav1beta1.DiskTypeHDD:
+		default:
+			allErrs = append(allErrs, field.NotSupported(diskPath.Child("type"), disk.Type, []string{
+				string(infrav1beta1.DiskTypeNVMe), string(infrav1beta1.DiskTypeSSD), string(infrav1beta1.DiskTypeHDD),
+			}))
+		}
+		if disk.Count < 1 {
+			allErrs = append(allErrs, field.Invalid(diskPath.Child("count"), disk.Count, "must be at least 1"))
+		}
+		if disk.MinSizeGB < 0 {
+			allErrs = append(allErrs, field.Invalid(diskPath.Child("minSizeGB"), disk.MinSizeGB, "must not be negative"))
+		}
+	}
+
+	for i, expression := range requirements.Expressions {
+		allErrs = append(allErrs, validateHardwareExpression(expression, fieldPath.Child("expressions").Index(i))...)
+	}
+
+	return allErrs
+}
+
+// hardwareFacts are the facts of the inspection report hardware expressions can refer to.
+var hardwareFacts = []string{
+	infrav1beta1.HardwareFactSystemManufacturer, infrav1beta1.HardwareFactSystemModel, infrav1beta1.HardwareFactSystemBootMode,
+	infrav1beta1.HardwareFactCPUVendor, infrav1beta1.HardwareFactCPUModel, infrav1beta1.HardwareFactCPUCount,
+	infrav1beta1.HardwareFactCPUCores, infrav1beta1.HardwareFactCPUThreads, infrav1beta1.HardwareFactMemoryGB,
+	infrav1beta1.HardwareFactDiskCount, infrav1beta1.HardwareFactDiskGB, infrav1beta1.HardwareFactDiskNVMeCount,
+	infrav1beta1.HardwareFactDiskSSDCount, infrav1beta1.HardwareFactDiskHDDCount, infrav1beta1.HardwareFactNICCount,
+	infrav1beta1.HardwareFactNICMaxSpeedMbps, infrav1beta1.HardwareFactGPUCount, infrav1beta1.HardwareFactGPUVendor,
+	infrav1beta1.HardwareFactGPUModel,
+}
+
+// validateHardwareExpression validates a hardware expression refers to a known fact and
+// has the values its operator needs. Values of In and NotIn are plain strings, unlike
+// label values, so models with spaces or parentheses can be matched.
+func validateHardwareExpression(expression infrav1beta1.HardwareExpression, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if !slices.Contains(hardwareFacts, expression.Key) {
+		allErrs = append(allErrs, field.NotSupported(fieldPath.Child("key"), expression.Key, hardwareFacts))
+	}
+	valuesPath := fieldPath.Child("values")
+	switch expression.Operator {
+	case infrav1beta1.HardwareExpressionOpIn, infrav1beta1.HardwareExpressionOpNotIn:
+		if len(expression.Values) == 0 {
+			allErrs = append(allErrs, field.Required(valuesPath, fmt.Sprintf("must be set for operator %s", expression.Operator)))
+		}
+	case infrav1beta1.HardwareExpressionOpExists, infrav1beta1.HardwareExpressionOpDoesNotExist:
+		if len(expression.Values) > 0 {
+			allErrs = append(allErrs, field.Forbidden(valuesPath, fmt.Sprintf("must be empty for operator %s", expression.Operator)))
+		}
+	case infrav1beta1.HardwareExpressionOpGt, infrav1beta1.HardwareExpressionOpLt:
+		valid := len(expression.Values) == 1
+		if valid {
+			_, err := strconv.ParseInt(expression.Values[0], 10, 64)
+			valid = err == nil
+		}
+		if !valid {
+			allErrs = append(allErrs, field.Invalid(valuesPath, expression.Values, fmt.Sprintf("must be a single integer for operator %s", expression.Operator)))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fieldPath.Child("operator"), expression.Operator, []string{
+			string(infrav1beta1.HardwareExpressionOpIn), string(infrav1beta1.HardwareExpressionOpNotIn),
+			string(infrav1beta1.HardwareExpressionOpExists), string(infrav1beta1.HardwareExpressionOpDoesNotExist),
+			string(infrav1beta1.HardwareExpressionOpGt), string(infrav1beta1.HardwareExpressionOpLt),
+		}))
+	}
+
+	return allErrs
+}
+
+// biosAttributeNamePattern matches the BIOS attribute names allowed by the Redfish
+// attribute registry schema.
+var biosAttributeNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// validateFirmwareSettings validates the BIOS attribute names of firmware settings.
+// Whether the host has the attributes is only known once its BMC is asked.
+func validateFirmwareSettings(settings map[string]string, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		if !biosAttributeNamePattern.MatchString(name) {
+			allErrs = append(allErrs, field.Invalid(fieldPath.Key(name), name,
+				"must be a BIOS attribute name starting with a letter, followed by letters, digits or underscores"))
+		}
+	}
+
+	return allErrs
+}
+
+// raidMinimumDisks is the number of member drives each RAID level needs.
+var raidMinimumDisks = map[infrav1beta1.RAIDLevel]int32{
+	infrav1beta1.RAIDLevel0:  1,
+	infrav1beta1.RAIDLevel1:  2,
+	infrav1beta1.RAIDLevel5:  3,
+	infrav1beta1.RAIDLevel6:  4,
+	infrav1beta1.RAIDLevel10: 4,
+}
+
+// validateStorage validates a storage configuration. Whether the host has the drives
+// is only known once its BMC is asked.
+func validateStorage(storage *infrav1beta1.StorageConfig, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if storage.RAID == nil && storage.RootDeviceHints == nil {
+		allErrs = append(allErrs, field.Required(fieldPath, "raid or rootDeviceHints must be set"))
+	}
+
+	if raid := storage.RAID; raid != nil {
+		raidPath := fieldPath.Child("raid")
+		minimum, ok := raidMinimumDisks[raid.Level]
+		if !ok {
+			allErrs = append(allErrs, field.NotSupported(raidPath.Child("level"), raid.Level, []string{
+				string(infrav1beta1.RAIDLevel0), string(infrav1beta1.RAIDLevel1), string(infrav1beta1.RAIDLevel5),
+				string(infrav1beta1.RAIDLevel6), string(infrav1beta1.RAIDLevel10),
+			}))
+		} else if raid.DiskCount != 0 && raid.DiskCount < minimum {
+			allErrs = append(allErrs, field.Invalid(raidPath.Child("diskCount"), raid.DiskCount,
+				fmt.Sprintf("%s needs at least %d disks", raid.Level, minimum)))
+		}
+		if raid.Level == infrav1beta1.RAIDLevel10 && raid.DiskCount%2 != 0 {
+			allErrs = append(allErrs, field.Invalid(raidPath.Child("diskCount"), raid.DiskCount, "RAID10 needs an even number of disks"))
+		}
+		if raid.MemberDiskHints != nil {
+			allErrs = append(allErrs, validateDiskHints(raid.MemberDiskHints, raidPath.Child("memberDiskHints"))...)
+		}
+	}
+
+	if storage.RootDeviceHints != nil {
+		allErrs = append(allErrs, validateRootDeviceHints(storage.RootDeviceHints, fieldPath.Child("rootDeviceHints"))...)
+	}
+
+	return allErrs
+}
+
+func validateDiskHints(hints *infrav1beta1.DiskHints, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if *hints == (infrav1beta1.DiskHints{}) {
+		allErrs = append(allErrs, field.Required(fieldPath, "at least one hint must be set"))
+	}
+	if hints.MinSizeGB < 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("minSizeGB"), hints.MinSizeGB, "must not be negative"))
+	}
+
+	return allErrs
+}
+
+func validateRootDeviceHints(hints *infrav1beta1.RootDeviceHints, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if hints.Name == "" && hints.WWN == "" && hints.Rotational == nil {
+		allErrs = append(allErrs, validateDiskHints(&hints.DiskHints, fieldPath)...)
+	} else if hints.MinSizeGB < 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("minSizeGB"), hints.MinSizeGB, "must not be negative"))
+	}
+	if hints.Name != "" && !strings.HasPrefix(hints.Name, "/dev/") {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("name"), hints.Name, "must be a device path starting with /dev/"))
+	}
+
+	return allErrs
+}
+
+func validateInspectionTimeout(timeout *metav1.Duration, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if timeout.Duration < MinInspectionTimeout || timeout.Duration > MaxInspectionTimeout {
+		allErrs = append(allErrs, field.Invalid(
+			fieldPath,
+			timeout.Duration.String(),
+			"inspectionTimeout must be between "+MinInspectionTimeout.String()+" and "+MaxInspectionTimeout.String(),
+		))
+	}
+
+	return allErrs
+}
+
+func validateProvisioningTimeout(timeout *metav1.Duration, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if timeout.Duration < MinProvisioningTimeout || timeout.Duration > MaxProvisioningTimeout {
+		allErrs = append(allErrs, field.Invalid(
+			fieldPath,
+			timeout.Duration.String(),
+			"provisioningTimeout must be between "+MinProvisioningTimeout.String()+" and "+MaxProvisioningTimeout.String(),
+		))
+	}
+
+	return allErrs
+}
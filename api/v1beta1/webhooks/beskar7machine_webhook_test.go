@@ -0,0 +1,436 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+var _ = Describe("Beskar7Machine Webhook", func() {
+	var webhook *Beskar7MachineWebhook
+	var ctx context.Context
+
+	newMachine := func() *infrav1beta1.Beskar7Machine {
+		return &infrav1beta1.Beskar7Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-machine",
+				Namespace: "default",
+			},
+			Spec: infrav1beta1.Beskar7MachineSpec{
+				InspectionImageURL: "http://boot-server/ipxe/inspect.ipxe",
+				TargetImageURL:     "http://boot-server/images/kairos.tar.gz",
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		webhook = &Beskar7MachineWebhook{}
+		ctx = context.Background()
+	})
+
+	Describe("ValidateCreate", func() {
+		It("should accept a machine without an inspection timeout", func() {
+			warnings, err := webhook.ValidateCreate(ctx, newMachine())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("should accept an inspection timeout for slow servers", func() {
+			machine := newMachine()
+			machine.Spec.InspectionTimeout = &metav1.Duration{Duration: 25 * time.Minute}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject an inspection timeout that is too short", func() {
+			machine := newMachine()
+			machine.Spec.InspectionTimeout = &metav1.Duration{Duration: 10 * time.Second}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.inspectionTimeout"))
+		})
+
+		It("should reject an inspection timeout that is too long", func() {
+			machine := newMachine()
+			machine.Spec.InspectionTimeout = &metav1.Duration{Duration: 48 * time.Hour}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject a provisioning timeout outside the accepted range", func() {
+			machine := newMachine()
+			machine.Spec.ProvisioningTimeout = &metav1.Duration{Duration: time.Minute}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.provisioningTimeout"))
+
+			machine.Spec.ProvisioningTimeout = &metav1.Duration{Duration: 2 * time.Hour}
+			_, err = webhook.ValidateCreate(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject a missing target image URL", func() {
+			machine := newMachine()
+			machine.Spec.TargetImageURL = ""
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.targetImageURL"))
+		})
+
+		It("should reject URLs with a scheme hosts cannot boot from", func() {
+			machine := newMachine()
+			machine.Spec.InspectionImageURL = "ftp://boot-server/ipxe/inspect.ipxe"
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.inspectionImageURL"))
+		})
+
+		It("should reject URLs without a host", func() {
+			machine := newMachine()
+			machine.Spec.ConfigurationURL = "https:///kairos/config.yaml"
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.configurationURL"))
+		})
+
+		It("should reject negative hardware requirements", func() {
+			machine := newMachine()
+			machine.Spec.HardwareRequirements = &infrav1beta1.HardwareRequirements{
+				MinCPUCores: 4,
+				MinMemoryGB: -1,
+			}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.hardwareRequirements.minMemoryGB"))
+		})
+
+		It("should accept rich hardware requirements", func() {
+			machine := newMachine()
+			machine.Spec.HardwareRequirements = &infrav1beta1.HardwareRequirements{
+				CPUVendor:       "AuthenticAMD",
+				CPUModel:        "EPYC 9[0-9]{3}",
+				MinNICs:         2,
+				MinNICSpeedMbps: 25000,
+				Disks:           []infrav1beta1.DiskRequirement{{Type: infrav1beta1.DiskTypeNVMe, Count: 2, MinSizeGB: 900}},
+				MinGPUs:         1,
+				Expressions: []infrav1beta1.HardwareExpression{
+					{Key: infrav1beta1.HardwareFactSystemManufacturer, Operator: infrav1beta1.HardwareExpressionOpIn, Values: []string{"Dell Inc.", "HPE"}},
+					{Key: infrav1beta1.HardwareFactSystemModel, Operator: infrav1beta1.HardwareExpressionOpIn, Values: []string{"PowerEdge R650 (SKU=0A1B)"}},
+					{Key: infrav1beta1.HardwareFactMemoryGB, Operator: infrav1beta1.HardwareExpressionOpGt, Values: []string{"512"}},
+				},
+			}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject invalid CPU patterns, disk requirements and expressions", func() {
+			machine := newMachine()
+			machine.Spec.HardwareRequirements = &infrav1beta1.HardwareRequirements{
+				CPUModel: "EPYC (",
+				Disks:    []infrav1beta1.DiskRequirement{{Type: "Tape", Count: 0}},
+				Expressions: []infrav1beta1.HardwareExpression{
+					{Key: "cpu.speed", Operator: infrav1beta1.HardwareExpressionOpExists},
+					{Key: infrav1beta1.HardwareFactMemoryGB, Operator: infrav1beta1.HardwareExpressionOpGt, Values: []string{"lots"}},
+					{Key: infrav1beta1.HardwareFactGPUModel, Operator: infrav1beta1.HardwareExpressionOpIn},
+				},
+			}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.hardwareRequirements.cpuModel"))
+			Expect(err.Error()).To(ContainSubstring("spec.hardwareRequirements.disks[0].type"))
+			Expect(err.Error()).To(ContainSubstring("spec.hardwareRequirements.disks[0].count"))
+			Expect(err.Error()).To(ContainSubstring("spec.hardwareRequirements.expressions[0].key"))
+			Expect(err.Error()).To(ContainSubstring("spec.hardwareRequirements.expressions[1].values"))
+			Expect(err.Error()).To(ContainSubstring("spec.hardwareRequirements.expressions[2].values"))
+		})
+
+		It("should accept virtual media boot", func() {
+			machine := newMachine()
+			machine.Spec.BootMethod = infrav1beta1.BootMethodVirtualMedia
+			machine.Spec.InspectionImageURL = "https://boot-server/images/inspector.iso"
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should accept UEFI HTTP boot", func() {
+			machine := newMachine()
+			machine.Spec.BootMethod = infrav1beta1.BootMethodUEFIHTTP
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject an unknown boot method", func() {
+			machine := newMachine()
+			machine.Spec.BootMethod = "Floppy"
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.bootMethod"))
+		})
+
+		It("should reject an invalid host selector", func() {
+			machine := newMachine()
+			machine.Spec.HostSelector = &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      "rack",
+					Operator: "Near",
+				}},
+			}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.hostSelector"))
+		})
+
+		It("should accept firmware settings", func() {
+			machine := newMachine()
+			machine.Spec.FirmwareSettings = map[string]string{
+				"SriovGlobalEnable":  "Enabled",
+				"ProcVirtualization": "Enabled",
+				"SysProfile":         "PerfOptimized",
+			}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject firmware settings that are not BIOS attribute names", func() {
+			machine := newMachine()
+			machine.Spec.FirmwareSettings = map[string]string{"VT-d": "Enabled"}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.firmwareSettings[VT-d]"))
+		})
+
+		It("should accept a RAID volume with member disk hints", func() {
+			machine := newMachine()
+			machine.Spec.Storage = &infrav1beta1.StorageConfig{
+				RAID: &infrav1beta1.RAIDConfig{
+					Level:           infrav1beta1.RAIDLevel1,
+					MemberDiskHints: &infrav1beta1.DiskHints{Model: "SSD", MinSizeGB: 400},
+				},
+			}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject a RAID volume with too few disks", func() {
+			machine := newMachine()
+			machine.Spec.Storage = &infrav1beta1.StorageConfig{
+				RAID: &infrav1beta1.RAIDConfig{Level: infrav1beta1.RAIDLevel5, DiskCount: 2},
+			}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.storage.raid.diskCount"))
+		})
+
+		It("should accept root device hints", func() {
+			machine := newMachine()
+			rotational := false
+			machine.Spec.Storage = &infrav1beta1.StorageConfig{
+				RootDeviceHints: &infrav1beta1.RootDeviceHints{
+					DiskHints:  infrav1beta1.DiskHints{Model: "PM1733", MinSizeGB: 900},
+					WWN:        "eui.0025385b71b0c9a1",
+					Rotational: &rotational,
+				},
+			}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+
+			machine.Spec.Storage.RootDeviceHints = &infrav1beta1.RootDeviceHints{Rotational: &rotational}
+			_, err = webhook.ValidateCreate(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject a root device name that is not a device path", func() {
+			machine := newMachine()
+			machine.Spec.Storage = &infrav1beta1.StorageConfig{
+				RootDeviceHints: &infrav1beta1.RootDeviceHints{Name: "sda"},
+			}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.storage.rootDeviceHints.name"))
+		})
+
+		It("should reject a storage configuration without RAID or root device hints", func() {
+			machine := newMachine()
+			machine.Spec.Storage = &infrav1beta1.StorageConfig{}
+
+			_, err := webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.storage"))
+
+			machine.Spec.Storage.RootDeviceHints = &infrav1beta1.RootDeviceHints{}
+			_, err = webhook.ValidateCreate(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.storage.rootDeviceHints"))
+		})
+	})
+
+	Describe("ValidateUpdate", func() {
+		It("should reject a negative inspection timeout", func() {
+			oldMachine := newMachine()
+			newMachine := newMachine()
+			newMachine.Spec.InspectionTimeout = &metav1.Duration{Duration: -time.Minute}
+
+			_, err := webhook.ValidateUpdate(ctx, oldMachine, newMachine)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should allow setting the providerID", func() {
+			oldMachine := newMachine()
+			newMachine := newMachine()
+			newMachine.Spec.ProviderID = stringPtr("b7://default/host-1")
+
+			_, err := webhook.ValidateUpdate(ctx, oldMachine, newMachine)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject changing the providerID once set", func() {
+			oldMachine := newMachine()
+			oldMachine.Spec.ProviderID = stringPtr("b7://default/host-1")
+			newMachine := newMachine()
+			newMachine.Spec.ProviderID = stringPtr("b7://default/host-2")
+
+			_, err := webhook.ValidateUpdate(ctx, oldMachine, newMachine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("spec.providerID"))
+
+			newMachine.Spec.ProviderID = nil
+			_, err = webhook.ValidateUpdate(ctx, oldMachine, newMachine)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Default", func() {
+		It("should default the host selection policy", func() {
+			machine := newMachine()
+			Expect(webhook.Default(ctx, machine)).To(Succeed())
+			Expect(machine.Spec.HostSelectionPolicy).To(Equal(infrav1beta1.HostSelectionPolicyBestFit))
+		})
+
+		It("should default the boot method to PXE", func() {
+			machine := newMachine()
+			Expect(webhook.Default(ctx, machine)).To(Succeed())
+			Expect(machine.Spec.BootMethod).To(Equal(infrav1beta1.BootMethodPXE))
+
+			machine.Spec.BootMethod = infrav1beta1.BootMethodVirtualMedia
+			Expect(webhook.Default(ctx, machine)).To(Succeed())
+			Expect(machine.Spec.BootMethod).To(Equal(infrav1beta1.BootMethodVirtualMedia))
+		})
+	})
+})
+
+var _ = Describe("Beskar7MachineTemplate Webhook", func() {
+	var webhook *Beskar7MachineTemplateWebhook
+	var ctx context.Context
+
+	BeforeEach(func() {
+		webhook = &Beskar7MachineTemplateWebhook{}
+		ctx = context.Background()
+	})
+
+	newTemplate := func() *infrav1beta1.Beskar7MachineTemplate {
+		return &infrav1beta1.Beskar7MachineTemplate{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-template",
+				Namespace: "default",
+			},
+			Spec: infrav1beta1.Beskar7MachineTemplateSpec{
+				Template: infrav1beta1.Beskar7MachineTemplateResource{
+					Spec: infrav1beta1.Beskar7MachineSpec{
+						InspectionImageURL: "http://boot-server/ipxe/inspect.ipxe",
+						TargetImageURL:     "http://boot-server/images/kairos.tar.gz",
+						InspectionTimeout:  &metav1.Duration{Duration: 20 * time.Minute},
+					},
+				},
+			},
+		}
+	}
+
+	It("should validate the timeouts of the template spec", func() {
+		template := newTemplate()
+		_, err := webhook.ValidateCreate(ctx, template)
+		Expect(err).NotTo(HaveOccurred())
+
+		template.Spec.Template.Spec.InspectionTimeout = &metav1.Duration{Duration: time.Second}
+		_, err = webhook.ValidateCreate(ctx, template)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.template.spec.inspectionTimeout"))
+
+		template.Spec.Template.Spec.InspectionTimeout = nil
+		template.Spec.Template.Spec.ProvisioningTimeout = &metav1.Duration{Duration: 48 * time.Hour}
+		_, err = webhook.ValidateCreate(ctx, template)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.template.spec.provisioningTimeout"))
+	})
+
+	It("should validate the URLs of the template spec", func() {
+		template := newTemplate()
+		template.Spec.Template.Spec.TargetImageURL = "file:///images/kairos.tar.gz"
+
+		_, err := webhook.ValidateCreate(ctx, template)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.template.spec.targetImageURL"))
+	})
+
+	It("should reject a providerID in the template spec", func() {
+		template := newTemplate()
+		template.Spec.Template.Spec.ProviderID = stringPtr("b7://default/host-1")
+
+		_, err := webhook.ValidateCreate(ctx, template)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.template.spec.providerID"))
+	})
+
+	It("should reject changes to the template spec", func() {
+		oldTemplate := newTemplate()
+		newTemplate := newTemplate()
+		newTemplate.Spec.Template.Spec.TargetImageURL = "http://boot-server/images/kairos-v2.tar.gz"
+
+		_, err := webhook.ValidateUpdate(ctx, oldTemplate, newTemplate)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("immutable"))
+	})
+
+	It("should allow metadata-only updates", func() {
+		oldTemplate := newTemplate()
+		newTemplate := newTemplate()
+		newTemplate.Labels = map[string]string{"team": "platform"}
+
+		_, err := webhook.ValidateUpdate(ctx, oldTemplate, newTemplate)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should default the host selection policy of the template spec", func() {
+		template := newTemplate()
+		Expect(webhook.Default(ctx, template)).To(Succeed())
+		Expect(template.Spec.Template.Spec.HostSelectionPolicy).To(Equal(infrav1beta1.HostSelectionPolicyBestFit))
+	})
+})
+
+func stringPtr(s string) *string {
+	return &s
+}
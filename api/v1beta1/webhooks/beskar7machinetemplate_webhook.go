@@ -0,0 +1,91 @@
+package webhooks
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrav1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+// Beskar7MachineTemplateWebhook implements a validating and defaulting webhook for Beskar7MachineTemplate.
+type Beskar7MachineTemplateWebhook struct{}
+
+// SetupWebhookWithManager sets up the webhook with the manager.
+func (webhook *Beskar7MachineTemplateWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&infrav1beta1.Beskar7MachineTemplate{}).
+		WithValidator(webhook).
+		WithDefaulter(webhook).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-beskar7machinetemplate,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=beskar7machinetemplates,versions=v1beta1,name=validation.beskar7machinetemplate.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-beskar7machinetemplate,mutating=true,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=beskar7machinetemplates,versions=v1beta1,name=defaulting.beskar7machinetemplate.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1
+
+var _ webhook.CustomValidator = &Beskar7MachineTemplateWebhook{}
+var _ webhook.CustomDefaulter = &Beskar7MachineTemplateWebhook{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type.
+func (webhook *Beskar7MachineTemplateWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	template := obj.(*infrav1beta1.Beskar7MachineTemplate)
+	return webhook.validateBeskar7MachineTemplate(template)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type.
+func (webhook *Beskar7MachineTemplateWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldTemplate := oldObj.(*infrav1beta1.Beskar7MachineTemplate)
+	newTemplate := newObj.(*infrav1beta1.Beskar7MachineTemplate)
+
+	// Machine templates are immutable per the Cluster API contract, rollouts are done by
+	// pointing the owner at a new template
+	if !equality.Semantic.DeepEqual(oldTemplate.Spec.Template.Spec, newTemplate.Spec.Template.Spec) {
+		return nil, apierrors.NewInvalid(
+			newTemplate.GroupVersionKind().GroupKind(),
+			newTemplate.Name,
+			field.ErrorList{field.Forbidden(field.NewPath("spec", "template", "spec"),
+				"Beskar7MachineTemplate spec is immutable, create a new template instead")},
+		)
+	}
+
+	return webhook.validateBeskar7MachineTemplate(newTemplate)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type.
+func (webhook *Beskar7MachineTemplateWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	// No specific validations needed for deletion
+	return nil, nil
+}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the type.
+func (webhook *Beskar7MachineTemplateWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	template := obj.(*infrav1beta1.Beskar7MachineTemplate)
+	defaultBeskar7MachineSpec(&template.Spec.Template.Spec)
+	return nil
+}
+
+func (webhook *Beskar7MachineTemplateWebhook) validateBeskar7MachineTemplate(template *infrav1beta1.Beskar7MachineTemplate) (admission.Warnings, error) {
+	fieldPath := field.NewPath("spec", "template", "spec")
+	allErrs := validateBeskar7MachineSpec(template.Spec.Template.Spec, fieldPath)
+
+	// The ProviderID is set per machine once it has a host
+	if template.Spec.Template.Spec.ProviderID != nil {
+		allErrs = append(allErrs, field.Forbidden(fieldPath.Child("providerID"), "providerID cannot be set in a template"))
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(
+			template.GroupVersionKind().GroupKind(),
+			template.Name,
+			allErrs,
+		)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,281 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrav1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+const (
+	// MinCleaningTimeout is the shortest cleaning timeout accepted. Booting the cleaning
+	// image alone takes a few minutes.
+	MinCleaningTimeout = 5 * time.Minute
+
+	// MaxCleaningTimeout is the longest cleaning timeout accepted, enough for a Full
+	// wipe of large spinning disks.
+	MaxCleaningTimeout = 7 * 24 * time.Hour
+)
+
+// PhysicalHostWebhook implements a validating webhook for PhysicalHost.
+type PhysicalHostWebhook struct {
+	// Client is used to look up other PhysicalHosts using the same BMC address.
+	Client client.Reader
+}
+
+// SetupWebhookWithManager sets up the webhook with the manager.
+func (webhook *PhysicalHostWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&infrav1beta1.PhysicalHost{}).
+		WithValidator(webhook).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update;delete,path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-physicalhost,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=infrastructure.cluster.x-k8s.io,resources=physicalhosts,versions=v1beta1,name=validation.physicalhost.infrastructure.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1
+
+var _ webhook.CustomValidator = &PhysicalHostWebhook{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type.
+func (webhook *PhysicalHostWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	host := obj.(*infrav1beta1.PhysicalHost)
+
+	allErrs := validateRedfishConnection(host.Spec.RedfishConnection, field.NewPath("spec", "redfishConnection"))
+	if len(allErrs) == 0 {
+		errs, err := webhook.validateUniqueAddress(ctx, host)
+		if err != nil {
+			return nil, apierrors.NewInternalError(err)
+		}
+		allErrs = append(allErrs, errs...)
+	}
+	allErrs = append(allErrs, validateFirmwareSettings(host.Spec.FirmwareSettings, field.NewPath("spec", "firmwareSettings"))...)
+	allErrs = append(allErrs, validateFirmwareUpdate(host.Spec.FirmwareUpdate, field.NewPath("spec", "firmwareUpdate"))...)
+	allErrs = append(allErrs, validateCleaningTimeout(host.Spec.CleaningTimeout, field.NewPath("spec", "cleaningTimeout"))...)
+
+	return physicalHostWarnings(host), physicalHostInvalid(host, allErrs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type.
+func (webhook *PhysicalHostWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldHost := oldObj.(*infrav1beta1.PhysicalHost)
+	newHost := newObj.(*infrav1beta1.PhysicalHost)
+	addressPath := field.NewPath("spec", "redfishConnection", "address")
+
+	allErrs := validateRedfishConnection(newHost.Spec.RedfishConnection, field.NewPath("spec", "redfishConnection"))
+
+	if newHost.Spec.RedfishConnection.Address != oldHost.Spec.RedfishConnection.Address {
+		// Pointing a claimed host at another BMC would make the consumer power cycle
+		// and provision a server it never inspected
+		if oldHost.Spec.ConsumerRef != nil {
+			allErrs = append(allErrs, field.Forbidden(addressPath,
+				"address cannot be changed while the host is claimed by "+oldHost.Spec.ConsumerRef.Name))
+		}
+
+		// Only check for duplicates when the address changes, so pre-existing duplicates
+		// do not block the controllers from claiming and releasing hosts
+		if len(allErrs) == 0 {
+			errs, err := webhook.validateUniqueAddress(ctx, newHost)
+			if err != nil {
+				return nil, apierrors.NewInternalError(err)
+			}
+			allErrs = append(allErrs, errs...)
+		}
+	}
+	allErrs = append(allErrs, validateFirmwareSettings(newHost.Spec.FirmwareSettings, field.NewPath("spec", "firmwareSettings"))...)
+	allErrs = append(allErrs, validateFirmwareUpdate(newHost.Spec.FirmwareUpdate, field.NewPath("spec", "firmwareUpdate"))...)
+	allErrs = append(allErrs, validateCleaningTimeout(newHost.Spec.CleaningTimeout, field.NewPath("spec", "cleaningTimeout"))...)
+
+	return physicalHostWarnings(newHost), physicalHostInvalid(newHost, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type.
+func (webhook *PhysicalHostWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	host := obj.(*infrav1beta1.PhysicalHost)
+
+	if host.Spec.ConsumerRef == nil {
+		return nil, nil
+	}
+
+	if host.Annotations[infrav1beta1.ForceDeleteAnnotation] == "true" {
+		return admission.Warnings{fmt.Sprintf("deleting PhysicalHost %s while it is claimed by %s %s",
+			host.Name, host.Spec.ConsumerRef.Kind, host.Spec.ConsumerRef.Name)}, nil
+	}
+
+	return nil, apierrors.NewForbidden(
+		infrav1beta1.GroupVersion.WithResource("physicalhosts").GroupResource(),
+		host.Name,
+		fmt.Errorf("host is claimed by %s %s, delete the consumer first or set the %s=true annotation",
+			host.Spec.ConsumerRef.Kind, host.Spec.ConsumerRef.Name, infrav1beta1.ForceDeleteAnnotation),
+	)
+}
+
+// validateUniqueAddress rejects hosts whose BMC is already managed by another PhysicalHost.
+// Two hosts driving the same BMC would fight over its power and boot settings.
+func (webhook *PhysicalHostWebhook) validateUniqueAddress(ctx context.Context, host *infrav1beta1.PhysicalHost) (field.ErrorList, error) {
+	var allErrs field.ErrorList
+
+	if webhook.Client == nil {
+		return allErrs, nil
+	}
+
+	key, err := bmcAddressKey(host.Spec.RedfishConnection.Address)
+	if err != nil {
+		// Already reported by validateRedfishConnection
+		return allErrs, nil
+	}
+
+	hostList := &infrav1beta1.PhysicalHostList{}
+	if err := webhook.Client.List(ctx, hostList); err != nil {
+		return nil, fmt.Errorf("failed to list PhysicalHosts: %w", err)
+	}
+
+	for i := range hostList.Items {
+		other := &hostList.Items[i]
+		if other.Namespace == host.Namespace && other.Name == host.Name {
+			continue
+		}
+		otherKey, err := bmcAddressKey(other.Spec.RedfishConnection.Address)
+		if err != nil || otherKey != key {
+			continue
+		}
+		allErrs = append(allErrs, field.Duplicate(
+			field.NewPath("spec", "redfishConnection", "address"),
+			fmt.Sprintf("%s (already used by PhysicalHost %s/%s)", host.Spec.RedfishConnection.Address, other.Namespace, other.Name),
+		))
+		break
+	}
+
+	return allErrs, nil
+}
+
+func validateRedfishConnection(connection infrav1beta1.RedfishConnection, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, validateBMCAddress(connection.Address, fieldPath.Child("address"))...)
+
+	if strings.TrimSpace(connection.CredentialsSecretRef) == "" {
+		allErrs = append(allErrs, field.Required(fieldPath.Child("credentialsSecretRef"), "credentialsSecretRef is required"))
+	}
+
+	return allErrs
+}
+
+func validateBMCAddress(address string, fieldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if address == "" {
+		allErrs = append(allErrs, field.Required(fieldPath, "address is required"))
+		return allErrs
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fieldPath, address, "must be a valid URL: "+err.Error()))
+		return allErrs
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		allErrs = append(allErrs, field.Invalid(fieldPath, address, "scheme must be http or https"))
+	}
+
+	if u.User != nil {
+		allErrs = append(allErrs, field.Invalid(fieldPath, address, "must not contain credentials, use credentialsSecretRef"))
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		allErrs = append(allErrs, field.Invalid(fieldPath, address, "must include a host"))
+	} else if net.ParseIP(host) == nil && len(validation.IsDNS1123Subdomain(strings.ToLower(host))) > 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath, address, "host must be a valid IP address or hostname"))
+	}
+
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			allErrs = append(allErrs, field.Invalid(fieldPath, address, "port must be between 1 and 65535"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateFirmwareUpdate validates the firmware update requested for a host. The BMC
+// fetches the image over HTTP or HTTPS, like hosts fetch their boot URLs.
+func validateFirmwareUpdate(update *infrav1beta1.FirmwareUpdate, fieldPath *field.Path) field.ErrorList {
+	if update == nil {
+		return nil
+	}
+	return validateBootURL(update.ImageURI, fieldPath.Child("imageURI"), true)
+}
+
+// validateCleaningTimeout validates how long the cleaning image of a host may run.
+func validateCleaningTimeout(timeout *metav1.Duration, fieldPath *field.Path) field.ErrorList {
+	if timeout == nil {
+		return nil
+	}
+	if timeout.Duration < MinCleaningTimeout || timeout.Duration > MaxCleaningTimeout {
+		return field.ErrorList{field.Invalid(
+			fieldPath,
+			timeout.Duration.String(),
+			"cleaningTimeout must be between "+MinCleaningTimeout.String()+" and "+MaxCleaningTimeout.String(),
+		)}
+	}
+	return nil
+}
+
+// bmcAddressKey returns the host and port a BMC address connects to, so addresses
+// that only differ in case, path or an explicit default port compare equal.
+func bmcAddressKey(address string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("address %q has no host", address)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port), nil
+}
+
+func physicalHostWarnings(host *infrav1beta1.PhysicalHost) admission.Warnings {
+	var warnings admission.Warnings
+
+	if host.Spec.RedfishConnection.InsecureSkipVerify != nil && *host.Spec.RedfishConnection.InsecureSkipVerify {
+		warnings = append(warnings, "spec.redfishConnection.insecureSkipVerify is true, the BMC certificate will not be verified")
+	}
+
+	return warnings
+}
+
+func physicalHostInvalid(host *infrav1beta1.PhysicalHost, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		host.GroupVersionKind().GroupKind(),
+		host.Name,
+		allErrs,
+	)
+}
@@ -302,9 +302,29 @@ func (in *DiskInfo) DeepCopy() *DiskInfo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GPUInfo) DeepCopyInto(out *GPUInfo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GPUInfo.
+func (in *GPUInfo) DeepCopy() *GPUInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(GPUInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HardwareDetails) DeepCopyInto(out *HardwareDetails) {
 	*out = *in
+	if in.MACAddresses != nil {
+		in, out := &in.MACAddresses, &out.MACAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	out.Status = in.Status
 }
 
@@ -336,6 +356,11 @@ func (in *HardwareStatus) DeepCopy() *HardwareStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MemoryInfo) DeepCopyInto(out *MemoryInfo) {
 	*out = *in
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemoryInfo.
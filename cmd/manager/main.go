@@ -20,6 +20,7 @@ import (
 	"context"
 	"flag"
 	"os"
+	"strings"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -41,6 +42,7 @@ import (
 	"github.com/wrkode/beskar7/api/v1beta1/webhooks"
 	"github.com/wrkode/beskar7/controllers"
 	internalmetrics "github.com/wrkode/beskar7/internal/metrics"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -73,6 +75,16 @@ func main() {
 	var enableWebhook bool
 	var webhookPort int
 	var webhookCertDir string
+	var inspectionCallbackURL string
+	var inspectionBindAddress string
+	var bootScriptURL string
+	var inspectionCertFile string
+	var inspectionKeyFile string
+	var inspectionClientCAFile string
+	var pollInterval time.Duration
+	var hostWaitInterval time.Duration
+	var physicalHostResyncPeriod time.Duration
+	var gracefulShutdownTimeout time.Duration
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -91,6 +103,29 @@ func main() {
 		"Webhook server port.")
 	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
 		"Webhook server certificate directory.")
+	flag.StringVar(&inspectionCallbackURL, "inspection-callback-url", "",
+		"Externally reachable inspection report URL injected into iPXE boot scripts. "+
+			"Derived from the boot script request when empty.")
+	flag.StringVar(&bootScriptURL, "boot-script-url", "",
+		"Externally reachable boot script URL hosts of UEFIHTTP machines are pointed at. "+
+			"Derived from --inspection-callback-url when empty.")
+	flag.StringVar(&inspectionBindAddress, "inspection-bind-address", controllers.DefaultInspectionServerBindAddress,
+		"The address the inspection server binds to.")
+	flag.StringVar(&inspectionCertFile, "inspection-cert-file", "",
+		"TLS certificate file for the inspection server. Enables TLS together with --inspection-key-file.")
+	flag.StringVar(&inspectionKeyFile, "inspection-key-file", "",
+		"TLS private key file for the inspection server.")
+	flag.StringVar(&inspectionClientCAFile, "inspection-client-ca-file", "",
+		"CA bundle used to verify client certificates of inspection, cleaning and installed images. Requires TLS.")
+	flag.DurationVar(&pollInterval, "poll-interval", controllers.DefaultPollInterval,
+		"How often the controllers check on a PhysicalHost while it is inspected, provisioned or cleaned.")
+	flag.DurationVar(&hostWaitInterval, "host-wait-interval", controllers.DefaultHostWaitInterval,
+		"How long a Beskar7Machine waits before looking for an available PhysicalHost again, "+
+			"or checking on a PhysicalHost in Error.")
+	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", internalredfish.DefaultGracefulShutdownTimeout,
+		"How long a host may take to shut down gracefully before it is forced off.")
+	flag.DurationVar(&physicalHostResyncPeriod, "physicalhost-resync-period", controllers.DefaultPhysicalHostResyncPeriod,
+		"How often PhysicalHosts are reconciled to refresh their state from the BMC.")
 
 	opts := zap.Options{
 		Development: true,
@@ -100,6 +135,17 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	for name, interval := range map[string]time.Duration{
+		"poll-interval":              pollInterval,
+		"host-wait-interval":         hostWaitInterval,
+		"physicalhost-resync-period": physicalHostResyncPeriod,
+	} {
+		if interval <= 0 {
+			setupLog.Error(nil, "interval must be positive", "flag", name, "value", interval)
+			os.Exit(1)
+		}
+	}
+
 	// Setup metrics registry
 	internalmetrics.Init()
 
@@ -125,12 +171,21 @@ func main() {
 		os.Exit(1)
 	}
 
+	if bootScriptURL == "" && inspectionCallbackURL != "" {
+		// The boot script is served next to the inspection endpoint
+		bootScriptURL = strings.TrimSuffix(inspectionCallbackURL, controllers.InspectionPath) + controllers.BootScriptPath
+	}
+
 	// Setup controllers
 	if err = (&controllers.Beskar7MachineReconciler{
-		Client:               mgr.GetClient(),
-		Scheme:               mgr.GetScheme(),
-		RedfishClientFactory: nil, // Use default
-		Log:                  ctrl.Log.WithName("controllers").WithName("Beskar7Machine"),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		RedfishClientFactory:    nil, // Use default
+		Log:                     ctrl.Log.WithName("controllers").WithName("Beskar7Machine"),
+		PollInterval:            pollInterval,
+		HostWaitInterval:        hostWaitInterval,
+		BootScriptURL:           bootScriptURL,
+		GracefulShutdownTimeout: gracefulShutdownTimeout,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Beskar7Machine")
 		os.Exit(1)
@@ -145,17 +200,28 @@ func main() {
 	}
 
 	if err = (&controllers.PhysicalHostReconciler{
-		Client:               mgr.GetClient(),
-		Scheme:               mgr.GetScheme(),
-		RedfishClientFactory: nil, // Use default
-		Log:                  ctrl.Log.WithName("controllers").WithName("PhysicalHost"),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		RedfishClientFactory:    nil, // Use default
+		Log:                     ctrl.Log.WithName("controllers").WithName("PhysicalHost"),
+		Recorder:                mgr.GetEventRecorderFor("physicalhost-controller"),
+		PollInterval:            pollInterval,
+		ResyncPeriod:            physicalHostResyncPeriod,
+		GracefulShutdownTimeout: gracefulShutdownTimeout,
+		BootScriptURL:           bootScriptURL,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PhysicalHost")
 		os.Exit(1)
 	}
 
 	// Setup inspection handler
-	if err := controllers.SetupInspectionServer(mgr, 8082); err != nil {
+	if err := controllers.SetupInspectionServer(mgr, controllers.InspectionServerOptions{
+		BindAddress:  inspectionBindAddress,
+		CallbackURL:  inspectionCallbackURL,
+		CertFile:     inspectionCertFile,
+		KeyFile:      inspectionKeyFile,
+		ClientCAFile: inspectionClientCAFile,
+	}); err != nil {
 		setupLog.Error(err, "unable to setup inspection server")
 		os.Exit(1)
 	}
@@ -167,6 +233,20 @@ func main() {
 			setupLog.Error(err, "unable to setup webhook", "webhook", "Beskar7Cluster")
 			os.Exit(1)
 		}
+		if err = (&webhooks.Beskar7MachineWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to setup webhook", "webhook", "Beskar7Machine")
+			os.Exit(1)
+		}
+		if err = (&webhooks.Beskar7MachineTemplateWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to setup webhook", "webhook", "Beskar7MachineTemplate")
+			os.Exit(1)
+		}
+		if err = (&webhooks.PhysicalHostWebhook{
+			Client: mgr.GetClient(),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to setup webhook", "webhook", "PhysicalHost")
+			os.Exit(1)
+		}
 	}
 	//+kubebuilder:scaffold:builder
 
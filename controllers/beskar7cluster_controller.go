@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"reflect"
+	"slices"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -218,7 +219,8 @@ func (r *Beskar7ClusterReconciler) reconcileFailureDomains(ctx context.Context,
 	for _, ph := range phList.Items {
 		if zone, exists := ph.Labels[zoneLabel]; exists && zone != "" {
 			newFailureDomains[zone] = clusterv1.FailureDomainSpec{
-				ControlPlane: true, // Assume control plane can be placed in any discovered zone
+				// Control planes may be placed in any discovered zone unless excluded
+				ControlPlane: !slices.Contains(b7cluster.Spec.NonControlPlaneFailureDomains, zone),
 			}
 		}
 	}
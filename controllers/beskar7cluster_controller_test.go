@@ -18,6 +18,7 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -397,6 +398,31 @@ var _ = Describe("Beskar7Cluster Reconciler", func() {
 			}, "5s", "100ms").Should(Succeed(), "FailureDomains should be discovered correctly")
 		})
 
+		It("should exclude non-control-plane FailureDomains from control plane placement", func() {
+			b7cluster.Spec.NonControlPlaneFailureDomains = []string{"zone-b"}
+			Expect(k8sClient.Create(ctx, b7cluster)).To(Succeed())
+			reconciler := &Beskar7ClusterReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			zoneLabel := "topology.kubernetes.io/zone"
+			for i, zone := range []string{"zone-a", "zone-b"} {
+				Expect(k8sClient.Create(ctx, &infrastructurev1beta1.PhysicalHost{
+					ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("fd-cp-host-%d", i), Namespace: testNs.Name, Labels: map[string]string{zoneLabel: zone}},
+					Spec:       infrastructurev1beta1.PhysicalHostSpec{RedfishConnection: infrastructurev1beta1.RedfishConnection{Address: fmt.Sprintf("https://cp-host-%d.example.com", i), CredentialsSecretRef: "dummy"}},
+				})).To(Succeed())
+			}
+
+			_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func(g Gomega) {
+				g.Expect(k8sClient.Get(ctx, key, b7cluster)).To(Succeed())
+				g.Expect(b7cluster.Status.FailureDomains).To(HaveKeyWithValue("zone-a", clusterv1.FailureDomainSpec{ControlPlane: true}))
+				g.Expect(b7cluster.Status.FailureDomains).To(HaveKeyWithValue("zone-b", clusterv1.FailureDomainSpec{ControlPlane: false}))
+			}, "5s", "100ms").Should(Succeed())
+		})
+
 		It("should optimize failure domain discovery by avoiding unnecessary updates", func() {
 			// Create the Beskar7Cluster first (will have finalizer added on first reconcile)
 			Expect(k8sClient.Create(ctx, b7cluster)).To(Succeed())
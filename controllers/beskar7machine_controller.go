@@ -29,6 +29,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
@@ -50,8 +51,11 @@ const (
 	// InfrastructureAPIVersion for owner references
 	InfrastructureAPIVersion = "infrastructure.cluster.x-k8s.io/v1beta1"
 
-	// Inspection timeout
+	// Inspection timeout, unless set on the Beskar7Machine
 	DefaultInspectionTimeout = 10 * time.Minute
+
+	// Provisioning timeout for the installed OS to report back, unless set on the Beskar7Machine
+	DefaultProvisioningTimeout = 30 * time.Minute
 )
 
 // Beskar7MachineReconciler reconciles a Beskar7Machine object.
@@ -61,6 +65,21 @@ type Beskar7MachineReconciler struct {
 	Scheme               *runtime.Scheme
 	RedfishClientFactory internalredfish.RedfishClientFactory
 	Log                  logr.Logger
+
+	// PollInterval is how often the machine checks on its host while it is inspected
+	// or provisioned. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// HostWaitInterval is how long the machine waits for an available host, or for a
+	// host in Error to recover. Defaults to DefaultHostWaitInterval.
+	HostWaitInterval time.Duration
+
+	// BootScriptURL is the externally reachable boot script URL hosts of UEFIHTTP
+	// machines are pointed at. When empty, those hosts are PXE booted instead.
+	BootScriptURL string
+	// GracefulShutdownTimeout is how long a running host may take to shut down
+	// gracefully before it is forced off to boot the inspection image. Defaults to
+	// internalredfish.DefaultGracefulShutdownTimeout.
+	GracefulShutdownTimeout time.Duration
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=beskar7machines,verbs=get;list;watch;create;update;patch;delete
@@ -68,6 +87,7 @@ type Beskar7MachineReconciler struct {
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=beskar7machines/finalizers,verbs=update
 //+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=physicalhosts,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
 
 // Reconcile handles Beskar7Machine reconciliation for iPXE + inspection workflow.
 func (r *Beskar7MachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
@@ -100,7 +120,7 @@ func (r *Beskar7MachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}
 	if machine == nil {
 		log.Info("Waiting for Machine Controller to set OwnerRef")
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
 	}
 
 	log = log.WithValues("machine", machine.Name)
@@ -157,7 +177,7 @@ func (r *Beskar7MachineReconciler) reconcileNormal(ctx context.Context, logger l
 	}
 
 	// Find or get associated host
-	physicalHost, result, err := r.findAndClaimOrGetAssociatedHost(ctx, logger, b7machine)
+	physicalHost, result, err := r.findAndClaimOrGetAssociatedHost(ctx, logger, b7machine, machine)
 	if err != nil {
 		logger.Error(err, "Failed to find, claim, or get associated PhysicalHost")
 		conditions.MarkFalse(b7machine, infrastructurev1beta1.PhysicalHostAssociatedCondition,
@@ -169,12 +189,18 @@ func (r *Beskar7MachineReconciler) reconcileNormal(ctx context.Context, logger l
 	if physicalHost != nil {
 		logger.Info("Successfully associated with PhysicalHost", "physicalhost", physicalHost.Name)
 		conditions.MarkTrue(b7machine, infrastructurev1beta1.PhysicalHostAssociatedCondition)
+	} else if failureDomain := machineFailureDomain(machine); failureDomain != "" {
+		logger.Info("No available PhysicalHost found in failure domain, requeuing", "failureDomain", failureDomain)
+		conditions.MarkFalse(b7machine, infrastructurev1beta1.PhysicalHostAssociatedCondition,
+			infrastructurev1beta1.WaitingForHostInFailureDomainReason, clusterv1.ConditionSeverityInfo,
+			"No available PhysicalHost found in failure domain %q", failureDomain)
+		return ctrl.Result{RequeueAfter: r.hostWaitInterval()}, nil
 	} else {
 		logger.Info("No available or associated PhysicalHost found, requeuing")
 		conditions.MarkFalse(b7machine, infrastructurev1beta1.PhysicalHostAssociatedCondition,
 			infrastructurev1beta1.WaitingForPhysicalHostReason, clusterv1.ConditionSeverityInfo,
 			"No available PhysicalHost found")
-		return ctrl.Result{RequeueAfter: time.Minute}, nil
+		return ctrl.Result{RequeueAfter: r.hostWaitInterval()}, nil
 	}
 
 	if !result.IsZero() {
@@ -184,16 +210,28 @@ func (r *Beskar7MachineReconciler) reconcileNormal(ctx context.Context, logger l
 	logger = logger.WithValues("physicalhost", physicalHost.Name)
 
 	// Handle based on PhysicalHost state and inspection status
-	return r.handlePhysicalHostState(ctx, logger, b7machine, physicalHost)
+	return r.handlePhysicalHostState(ctx, logger, b7machine, machine, physicalHost)
 }
 
 // handlePhysicalHostState processes the PhysicalHost based on its current state.
-func (r *Beskar7MachineReconciler) handlePhysicalHostState(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
+func (r *Beskar7MachineReconciler) handlePhysicalHostState(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, machine *clusterv1.Machine, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
+	// Finish the power action in progress before moving the host on
+	if physicalHost.Status.PowerAction != nil {
+		done, err := r.reconcileHostPowerAction(ctx, logger, physicalHost)
+		if err != nil {
+			logger.Error(err, "Failed to continue power action", "powerAction", physicalHost.Status.PowerAction)
+			return ctrl.Result{}, err
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+		}
+	}
+
 	switch physicalHost.Status.State {
 	case infrastructurev1beta1.StateReady:
 		// Inspection complete and validated, host ready for final provisioning
 		logger.Info("PhysicalHost inspection complete and ready")
-		return r.handleReadyHost(ctx, logger, b7machine, physicalHost)
+		return r.handleReadyHost(ctx, logger, b7machine, machine, physicalHost)
 
 	case infrastructurev1beta1.StateInspecting:
 		// Inspection in progress
@@ -206,14 +244,7 @@ func (r *Beskar7MachineReconciler) handlePhysicalHostState(ctx context.Context,
 		return r.triggerInspection(ctx, logger, b7machine, physicalHost)
 
 	case infrastructurev1beta1.StateError:
-		logger.Error(nil, "PhysicalHost is in error state", "errorMessage", physicalHost.Status.ErrorMessage)
-		conditions.MarkFalse(b7machine, infrastructurev1beta1.InfrastructureReadyCondition,
-			infrastructurev1beta1.PhysicalHostErrorReason, clusterv1.ConditionSeverityError,
-			"PhysicalHost %q in error state: %s", physicalHost.Name, physicalHost.Status.ErrorMessage)
-		phase := "Failed"
-		b7machine.Status.Phase = &phase
-		b7machine.Status.Ready = false
-		return ctrl.Result{}, nil
+		return r.handleErrorHost(logger, b7machine, physicalHost)
 
 	default:
 		logger.Info("PhysicalHost in intermediate state", "hostState", physicalHost.Status.State)
@@ -222,14 +253,51 @@ func (r *Beskar7MachineReconciler) handlePhysicalHostState(ctx context.Context,
 			"PhysicalHost %q is in state: %s", physicalHost.Name, physicalHost.Status.State)
 		phase := "Pending"
 		b7machine.Status.Phase = &phase
-		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
 	}
 }
 
+// handleErrorHost reports a PhysicalHost in Error on the machine. The PhysicalHost
+// controller retries the host with exponential backoff, so the machine only fails once
+// the host is out of automatic retries. It keeps polling the host either way, since an
+// operator can still retry it with the retry annotation.
+func (r *Beskar7MachineReconciler) handleErrorHost(logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
+	b7machine.Status.Ready = false
+
+	if next := physicalHost.Status.NextRetryTime; next != nil {
+		logger.Info("PhysicalHost is in error state, waiting for retry",
+			"errorMessage", physicalHost.Status.ErrorMessage, "nextRetryTime", next.Time, "retryCount", physicalHost.Status.RetryCount)
+		conditions.MarkFalse(b7machine, infrastructurev1beta1.InfrastructureReadyCondition,
+			infrastructurev1beta1.PhysicalHostErrorReason, clusterv1.ConditionSeverityWarning,
+			"PhysicalHost %q in error state, retrying at %s: %s", physicalHost.Name, next.UTC().Format(time.RFC3339), physicalHost.Status.ErrorMessage)
+		phase := "Pending"
+		b7machine.Status.Phase = &phase
+		requeueAfter := time.Until(next.Time)
+		if requeueAfter < r.pollInterval() {
+			requeueAfter = r.pollInterval()
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	logger.Error(nil, "PhysicalHost is in error state", "errorMessage", physicalHost.Status.ErrorMessage, "retryCount", physicalHost.Status.RetryCount)
+	conditions.MarkFalse(b7machine, infrastructurev1beta1.InfrastructureReadyCondition,
+		infrastructurev1beta1.PhysicalHostErrorReason, clusterv1.ConditionSeverityError,
+		"PhysicalHost %q in error state: %s", physicalHost.Name, physicalHost.Status.ErrorMessage)
+	phase := "Failed"
+	b7machine.Status.Phase = &phase
+	return ctrl.Result{RequeueAfter: r.hostWaitInterval()}, nil
+}
+
 // triggerInspection initiates the inspection phase by booting the inspection image.
 func (r *Beskar7MachineReconciler) triggerInspection(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
 	logger.Info("Triggering inspection boot")
 
+	// Mint the one-time token the inspection image authenticates its report with
+	if err := mintInspectionToken(ctx, r.Client, r.Scheme, physicalHost, inspectionTimeoutFor(b7machine)); err != nil {
+		logger.Error(err, "Failed to mint inspection token")
+		return ctrl.Result{}, err
+	}
+
 	// Get Redfish client
 	rfClient, err := r.getRedfishClientForHost(ctx, logger, physicalHost)
 	if err != nil {
@@ -238,26 +306,47 @@ func (r *Beskar7MachineReconciler) triggerInspection(ctx context.Context, logger
 	}
 	defer rfClient.Close(ctx)
 
-	// Set boot to PXE
-	if err := rfClient.SetBootSourcePXE(ctx); err != nil {
-		logger.Error(err, "Failed to set boot source to PXE")
+	// Stage the firmware settings, the restart into the inspection image applies them
+	if _, err := reconcileFirmwareSettings(ctx, logger, rfClient, physicalHost, firmwareSettingsFor(b7machine, physicalHost)); err != nil {
+		if errors.Is(err, internalredfish.ErrInvalidBIOSAttribute) {
+			if err := r.failFirmwareSettings(ctx, logger, physicalHost, infrastructurev1beta1.InvalidFirmwareSettingsReason, err.Error()); err != nil {
+				return ctrl.Result{}, err
+			}
+			return r.handleErrorHost(logger, b7machine, physicalHost)
+		}
+		logger.Error(err, "Failed to stage firmware settings")
 		return ctrl.Result{}, err
 	}
 
-	// Power on the system
-	powerState, err := rfClient.GetPowerState(ctx)
-	if err != nil {
-		logger.Error(err, "Failed to get power state")
+	// Request the RAID volume, which is created by the same restart
+	if storage := b7machine.Spec.Storage; storage != nil && storage.RAID != nil {
+		if _, err := reconcileRAIDVolume(ctx, logger, rfClient, physicalHost, storage.RAID); err != nil {
+			if errors.Is(err, errInvalidStorageConfiguration) {
+				if err := r.failStorage(ctx, logger, physicalHost, infrastructurev1beta1.InvalidStorageConfigurationReason, err.Error()); err != nil {
+					return ctrl.Result{}, err
+				}
+				return r.handleErrorHost(logger, b7machine, physicalHost)
+			}
+			logger.Error(err, "Failed to request RAID volume")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Boot the inspection image on the next boot
+	bootScriptURL := hostBootScriptURL(r.BootScriptURL, physicalHost)
+	if err := setHostBootImage(ctx, logger, rfClient, physicalHost, bootMethodFor(b7machine), b7machine.Spec.InspectionImageURL, bootScriptURL); err != nil {
+		logger.Error(err, "Failed to set inspection boot image", "bootMethod", bootMethodFor(b7machine))
 		return ctrl.Result{}, err
 	}
 
-	if powerState != redfish.OnPowerState {
-		if err := rfClient.SetPowerState(ctx, redfish.OnPowerState); err != nil {
-			logger.Error(err, "Failed to power on system")
-			return ctrl.Result{}, err
-		}
-		logger.Info("Powered on system for inspection")
+	// Power on the system, or restart it so the boot override takes effect. Hosts whose
+	// inspection is retried may still run a hung inspection image, which is forced off
+	// on a later reconcile if it does not shut down in time.
+	if _, err := startPowerAction(ctx, logger, rfClient, physicalHost, internalredfish.PowerOperationRestart, r.powerActionOptions()); err != nil {
+		logger.Error(err, "Failed to restart system")
+		return ctrl.Result{}, err
 	}
+	logger.Info("Restarting system for inspection")
 
 	// Update PhysicalHost to Inspecting state
 	physicalHost.Status.State = infrastructurev1beta1.StateInspecting
@@ -272,8 +361,11 @@ func (r *Beskar7MachineReconciler) triggerInspection(ctx context.Context, logger
 
 	phase := "Inspecting"
 	b7machine.Status.Phase = &phase
+	// A retried inspection starts over, whatever the previous attempt failed with
+	b7machine.Status.FailureReason = nil
+	b7machine.Status.FailureMessage = nil
 	logger.Info("Inspection boot triggered successfully")
-	return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
 }
 
 // handleInspectingHost monitors the inspection phase.
@@ -283,15 +375,16 @@ func (r *Beskar7MachineReconciler) handleInspectingHost(ctx context.Context, log
 	// Check for timeout
 	if physicalHost.Status.InspectionTimestamp != nil {
 		elapsed := time.Since(physicalHost.Status.InspectionTimestamp.Time)
-		if elapsed > DefaultInspectionTimeout {
+		if elapsed > inspectionTimeoutFor(b7machine) {
 			logger.Error(nil, "Inspection timeout", "elapsed", elapsed)
 			physicalHost.Status.InspectionPhase = infrastructurev1beta1.InspectionPhaseTimeout
-			physicalHost.Status.State = infrastructurev1beta1.StateError
-			physicalHost.Status.ErrorMessage = fmt.Sprintf("Inspection timeout after %v", elapsed)
+			failHost(physicalHost, infrastructurev1beta1.InspectionTimeoutReason,
+				fmt.Sprintf("Inspection timeout after %v", elapsed.Round(time.Second)))
 			if err := r.Status().Update(ctx, physicalHost); err != nil {
 				logger.Error(err, "Failed to update timeout status")
+				return ctrl.Result{}, err
 			}
-			return ctrl.Result{}, fmt.Errorf("inspection timeout")
+			return r.handleErrorHost(logger, b7machine, physicalHost)
 		}
 	}
 
@@ -303,7 +396,7 @@ func (r *Beskar7MachineReconciler) handleInspectingHost(ctx context.Context, log
 
 	phase := "Inspecting"
 	b7machine.Status.Phase = &phase
-	return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
 }
 
 // validateInspectionReport validates the inspection report against requirements.
@@ -311,63 +404,37 @@ func (r *Beskar7MachineReconciler) validateInspectionReport(ctx context.Context,
 	logger.Info("Validating inspection report")
 
 	if physicalHost.Status.InspectionReport == nil {
-		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
 	}
 
 	report := physicalHost.Status.InspectionReport
 
-	// Validate hardware requirements if specified
-	if b7machine.Spec.HardwareRequirements != nil {
-		reqs := b7machine.Spec.HardwareRequirements
-
-		// Calculate total cores from all CPUs
-		totalCores := 0
-		for _, cpu := range report.CPUs {
-			totalCores += cpu.Cores
-		}
-
-		if reqs.MinCPUCores > 0 && totalCores < reqs.MinCPUCores {
-			err := fmt.Errorf("insufficient CPU cores: found %d, required %d", totalCores, reqs.MinCPUCores)
-			logger.Error(err, "Hardware validation failed")
-			return ctrl.Result{}, err
-		}
-
-		// Calculate total memory from all DIMMs
-		totalMemoryGB := 0
-		for _, mem := range report.Memory {
-			// Parse capacity string (e.g., "32GB" -> 32)
-			var memGB int
-			if _, err := fmt.Sscanf(mem.Capacity, "%d", &memGB); err != nil {
-				logger.Error(err, "Failed to parse memory capacity", "capacity", mem.Capacity)
-				continue
-			}
-			totalMemoryGB += memGB
-		}
-
-		if reqs.MinMemoryGB > 0 && totalMemoryGB < reqs.MinMemoryGB {
-			err := fmt.Errorf("insufficient memory: found %d GB, required %d GB", totalMemoryGB, reqs.MinMemoryGB)
-			logger.Error(err, "Hardware validation failed")
-			return ctrl.Result{}, err
-		}
+	// Never provision a host whose report came from a different machine than the BMC manages
+	if err := verifyHostIdentity(physicalHost); err != nil {
+		return r.failInspectionIdentity(ctx, logger, b7machine, physicalHost, err)
+	}
 
-		if reqs.MinDiskGB > 0 {
-			totalDisk := 0
-			for _, disk := range report.Disks {
-				totalDisk += disk.SizeGB
-			}
-			if totalDisk < reqs.MinDiskGB {
-				err := fmt.Errorf("insufficient disk space: found %d GB, required %d GB", totalDisk, reqs.MinDiskGB)
-				logger.Error(err, "Hardware validation failed")
-				return ctrl.Result{}, err
-			}
-		}
+	// Validate hardware requirements if specified
+	if err := checkHardwareRequirements(b7machine.Spec.HardwareRequirements, report); err != nil {
+		return r.rejectInspectedHost(ctx, logger, b7machine, physicalHost, err)
 	}
 
 	logger.Info("Hardware validation passed")
 
+	// Check the RAID volume and pick the disk the target image is installed to
+	configured, err := r.verifyStorage(ctx, logger, b7machine, physicalHost)
+	if err != nil {
+		logger.Error(err, "Failed to verify storage")
+		return ctrl.Result{}, err
+	}
+	if !configured {
+		return r.handleErrorHost(logger, b7machine, physicalHost)
+	}
+
 	// Transition to Ready state
 	physicalHost.Status.State = infrastructurev1beta1.StateReady
 	conditions.MarkTrue(physicalHost, infrastructurev1beta1.HostInspectedCondition)
+	resetRetries(physicalHost)
 	if err := r.Status().Update(ctx, physicalHost); err != nil {
 		logger.Error(err, "Failed to update PhysicalHost to Ready")
 		return ctrl.Result{}, err
@@ -376,10 +443,60 @@ func (r *Beskar7MachineReconciler) validateInspectionReport(ctx context.Context,
 	return ctrl.Result{Requeue: true}, nil
 }
 
-// handleReadyHost handles a host that's ready after inspection.
-func (r *Beskar7MachineReconciler) handleReadyHost(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
-	logger.Info("Host ready, marking infrastructure as ready")
+// rejectInspectedHost releases a host whose inspection report does not meet the hardware
+// requirements of the machine, so another host is claimed instead. The report stays on the
+// host, which keeps it from being selected for this machine again.
+func (r *Beskar7MachineReconciler) rejectInspectedHost(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost, requirementsErr error) (ctrl.Result, error) {
+	logger.Info("PhysicalHost does not meet the hardware requirements, releasing it", "host", physicalHost.Name, "reason", requirementsErr.Error())
+	if err := r.releaseHost(ctx, logger, b7machine, physicalHost); err != nil {
+		logger.Error(err, "Failed to release PhysicalHost that does not meet the hardware requirements")
+		return ctrl.Result{}, err
+	}
 
+	conditions.MarkFalse(b7machine, infrastructurev1beta1.PhysicalHostAssociatedCondition,
+		infrastructurev1beta1.HardwareRequirementsNotMetReason, clusterv1.ConditionSeverityWarning,
+		"PhysicalHost %q does not meet the hardware requirements: %v", physicalHost.Name, requirementsErr)
+	conditions.MarkFalse(b7machine, infrastructurev1beta1.InfrastructureReadyCondition,
+		infrastructurev1beta1.HardwareRequirementsNotMetReason, clusterv1.ConditionSeverityWarning,
+		"PhysicalHost %q does not meet the hardware requirements: %v", physicalHost.Name, requirementsErr)
+	phase := "Pending"
+	b7machine.Status.Phase = &phase
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// failInspectionIdentity fails the inspection of a host whose report does not match the
+// identity observed through its BMC. The host stays in Error until it is released or an
+// operator retries it, and the machine is marked failed, so the miswired host is never
+// provisioned as another one.
+func (r *Beskar7MachineReconciler) failInspectionIdentity(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost, identityErr error) (ctrl.Result, error) {
+	logger.Error(identityErr, "Inspection report does not match the BMC identity")
+	message := fmt.Sprintf("Identity mismatch: %v", identityErr)
+
+	physicalHost.Status.InspectionPhase = infrastructurev1beta1.InspectionPhaseFailed
+	failHost(physicalHost, infrastructurev1beta1.IdentityMismatchReason, message)
+	conditions.MarkFalse(physicalHost, infrastructurev1beta1.HostInspectedCondition,
+		infrastructurev1beta1.IdentityMismatchReason, clusterv1.ConditionSeverityError, "%s", message)
+	if err := r.Status().Update(ctx, physicalHost); err != nil {
+		logger.Error(err, "Failed to update PhysicalHost after identity mismatch")
+		return ctrl.Result{}, err
+	}
+
+	conditions.MarkFalse(b7machine, infrastructurev1beta1.InfrastructureReadyCondition,
+		infrastructurev1beta1.IdentityMismatchReason, clusterv1.ConditionSeverityError,
+		"Inspection of PhysicalHost %q failed: %s", physicalHost.Name, message)
+	phase := "Failed"
+	b7machine.Status.Phase = &phase
+	b7machine.Status.Ready = false
+	reason := infrastructurev1beta1.IdentityMismatchReason
+	b7machine.Status.FailureReason = &reason
+	b7machine.Status.FailureMessage = &message
+	return ctrl.Result{RequeueAfter: r.hostWaitInterval()}, nil
+}
+
+// handleReadyHost drives the final provisioning phase of a host that passed inspection.
+// The target image and configuration are handed to the host through the boot script and
+// provisioning endpoints, and the machine only becomes ready once the installed OS reports back.
+func (r *Beskar7MachineReconciler) handleReadyHost(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, machine *clusterv1.Machine, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
 	// Set ProviderID
 	currentProviderID := providerID(physicalHost.Namespace, physicalHost.Name)
 	if b7machine.Spec.ProviderID == nil || *b7machine.Spec.ProviderID != currentProviderID {
@@ -387,6 +504,143 @@ func (r *Beskar7MachineReconciler) handleReadyHost(ctx context.Context, logger l
 		b7machine.Spec.ProviderID = &currentProviderID
 	}
 
+	waitForBootstrapData := reconcileBootstrapDataCondition(b7machine, machine, physicalHost)
+
+	switch physicalHost.Status.ProvisioningPhase {
+	case infrastructurev1beta1.ProvisioningPhaseProvisioned:
+		return r.handleProvisionedHost(ctx, logger, b7machine, physicalHost)
+
+	case infrastructurev1beta1.ProvisioningPhaseFailed:
+		logger.Error(nil, "Provisioning failed", "errorMessage", physicalHost.Status.ErrorMessage)
+		conditions.MarkFalse(b7machine, infrastructurev1beta1.MachineProvisionedCondition,
+			infrastructurev1beta1.ProvisioningFailedReason, clusterv1.ConditionSeverityError,
+			"%s", physicalHost.Status.ErrorMessage)
+		conditions.MarkFalse(b7machine, infrastructurev1beta1.InfrastructureReadyCondition,
+			infrastructurev1beta1.ProvisioningFailedReason, clusterv1.ConditionSeverityError,
+			"Provisioning of PhysicalHost %q failed", physicalHost.Name)
+		phase := "Failed"
+		b7machine.Status.Phase = &phase
+		b7machine.Status.Ready = false
+		reason := infrastructurev1beta1.ProvisioningFailedReason
+		b7machine.Status.FailureReason = &reason
+		message := physicalHost.Status.ErrorMessage
+		b7machine.Status.FailureMessage = &message
+		return ctrl.Result{}, nil
+
+	case infrastructurev1beta1.ProvisioningPhaseProvisioning:
+		if physicalHost.Status.ProvisioningTimestamp != nil {
+			elapsed := time.Since(physicalHost.Status.ProvisioningTimestamp.Time)
+			if elapsed > provisioningTimeoutFor(b7machine) {
+				logger.Error(nil, "Provisioning timeout", "elapsed", elapsed)
+				physicalHost.Status.ProvisioningPhase = infrastructurev1beta1.ProvisioningPhaseFailed
+				physicalHost.Status.ErrorMessage = fmt.Sprintf("Provisioning timeout after %v", elapsed.Round(time.Second))
+				if err := r.Status().Update(ctx, physicalHost); err != nil {
+					logger.Error(err, "Failed to update provisioning timeout status")
+					return ctrl.Result{}, err
+				}
+				return ctrl.Result{Requeue: true}, nil
+			}
+		}
+		logger.Info("Waiting for installed OS to report back")
+
+	default:
+		if waitForBootstrapData {
+			logger.Info("Waiting for bootstrap data before provisioning")
+			conditions.MarkFalse(b7machine, infrastructurev1beta1.InfrastructureReadyCondition,
+				infrastructurev1beta1.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo,
+				"Waiting for the bootstrap provider to generate bootstrap data")
+			phase := "Pending"
+			b7machine.Status.Phase = &phase
+			return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+		}
+
+		applied, err := r.verifyFirmwareSettings(ctx, logger, b7machine, physicalHost)
+		if err != nil {
+			logger.Error(err, "Failed to verify firmware settings")
+			return ctrl.Result{}, err
+		}
+		if !applied {
+			return r.handleErrorHost(logger, b7machine, physicalHost)
+		}
+
+		// Mint the one-time token the installed OS authenticates its report with, and the
+		// token it fetches its bootstrap data with. The handlers only hand them out.
+		if err := mintProvisioningToken(ctx, r.Client, r.Scheme, physicalHost); err != nil {
+			logger.Error(err, "Failed to mint provisioning token")
+			return ctrl.Result{}, err
+		}
+		if machine.Spec.Bootstrap.DataSecretName != nil {
+			if err := mintBootstrapToken(ctx, r.Client, r.Scheme, physicalHost); err != nil {
+				logger.Error(err, "Failed to mint bootstrap token")
+				return ctrl.Result{}, err
+			}
+		}
+
+		// Record that the target image is handed out before booting it, so the host is
+		// cleaned when released even if it is never moved to Provisioning below
+		physicalHost.Status.TargetImageServed = true
+		if err := r.Status().Update(ctx, physicalHost); err != nil {
+			logger.Error(err, "Failed to record target image on PhysicalHost")
+			return ctrl.Result{}, err
+		}
+
+		// Hand the target image to the host; the boot script and provisioning endpoints
+		// serve it from now on
+		logger.Info("Starting provisioning", "targetImageURL", b7machine.Spec.TargetImageURL)
+		if err := r.bootTargetImage(ctx, logger, b7machine, physicalHost); err != nil {
+			logger.Error(err, "Failed to boot target image")
+			return ctrl.Result{}, err
+		}
+		physicalHost.Status.ProvisioningPhase = infrastructurev1beta1.ProvisioningPhaseProvisioning
+		now := metav1.Now()
+		physicalHost.Status.ProvisioningTimestamp = &now
+		physicalHost.Status.BootstrapDataTimestamp = nil
+		if err := r.Status().Update(ctx, physicalHost); err != nil {
+			logger.Error(err, "Failed to update PhysicalHost to Provisioning")
+			return ctrl.Result{}, err
+		}
+	}
+
+	conditions.MarkFalse(b7machine, infrastructurev1beta1.MachineProvisionedCondition,
+		infrastructurev1beta1.WaitingForProvisioningReason, clusterv1.ConditionSeverityInfo,
+		"Waiting for PhysicalHost %q to install %s", physicalHost.Name, b7machine.Spec.TargetImageURL)
+	conditions.MarkFalse(b7machine, infrastructurev1beta1.InfrastructureReadyCondition,
+		infrastructurev1beta1.WaitingForProvisioningReason, clusterv1.ConditionSeverityInfo,
+		"Waiting for PhysicalHost %q to finish provisioning", physicalHost.Name)
+	phase := "Provisioning"
+	b7machine.Status.Phase = &phase
+	b7machine.Status.Ready = false
+	return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+}
+
+// reconcileBootstrapDataCondition reflects the delivery of the Machine's bootstrap data
+// on the BootstrapDataDelivered condition. It reports whether provisioning has to wait
+// for the bootstrap provider, which is the case when no ConfigurationURL is set.
+func reconcileBootstrapDataCondition(b7machine *infrastructurev1beta1.Beskar7Machine, machine *clusterv1.Machine, physicalHost *infrastructurev1beta1.PhysicalHost) bool {
+	if machine.Spec.Bootstrap.DataSecretName == nil {
+		if b7machine.Spec.ConfigurationURL != "" {
+			return false
+		}
+		conditions.MarkFalse(b7machine, infrastructurev1beta1.BootstrapDataDeliveredCondition,
+			infrastructurev1beta1.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for the bootstrap provider to generate bootstrap data")
+		return true
+	}
+
+	if physicalHost.Status.BootstrapDataTimestamp != nil {
+		conditions.MarkTrue(b7machine, infrastructurev1beta1.BootstrapDataDeliveredCondition)
+	} else {
+		conditions.MarkFalse(b7machine, infrastructurev1beta1.BootstrapDataDeliveredCondition,
+			infrastructurev1beta1.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for PhysicalHost %q to fetch bootstrap data", physicalHost.Name)
+	}
+	return false
+}
+
+// handleProvisionedHost marks the machine ready once the installed OS has reported back.
+func (r *Beskar7MachineReconciler) handleProvisionedHost(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
+	logger.Info("Host provisioned, marking infrastructure as ready")
+
 	// Copy addresses from PhysicalHost
 	if len(physicalHost.Status.Addresses) > 0 {
 		b7machine.Status.Addresses = physicalHost.Status.Addresses
@@ -394,79 +648,156 @@ func (r *Beskar7MachineReconciler) handleReadyHost(ctx context.Context, logger l
 	}
 
 	// Mark as ready
+	conditions.MarkTrue(b7machine, infrastructurev1beta1.MachineProvisionedCondition)
 	conditions.MarkTrue(b7machine, infrastructurev1beta1.InfrastructureReadyCondition)
 	b7machine.Status.Ready = true
 	phase := "Provisioned"
 	b7machine.Status.Phase = &phase
 
+	// The installed OS boots from disk from now on
+	if physicalHost.Status.VirtualMediaImage != "" ||
+		physicalHost.Status.PersistentBootTarget != string(redfish.HddBootSourceOverrideTarget) {
+		if err := r.bootFromDisk(ctx, logger, physicalHost); err != nil {
+			logger.Error(err, "Failed to make provisioned host boot from disk")
+			return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+		}
+	}
+
 	logger.Info("Beskar7Machine infrastructure is ready")
 	return ctrl.Result{}, nil
 }
 
+// bootTargetImage makes the host boot the target image on its next boot and starts
+// restarting it. Until provisioning starts the boot script sends hosts to local boot, so a host
+// that rebooted after its inspection report only picks up the target image this way.
+// The caller persists the host status.
+func (r *Beskar7MachineReconciler) bootTargetImage(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost) error {
+	rfClient, err := r.getRedfishClientForHost(ctx, logger, physicalHost)
+	if err != nil {
+		return err
+	}
+	defer rfClient.Close(ctx)
+
+	method := bootMethodFor(b7machine)
+	bootScriptURL := hostBootScriptURL(r.BootScriptURL, physicalHost)
+	if err := setHostBootImage(ctx, logger, rfClient, physicalHost, method, b7machine.Spec.TargetImageURL, bootScriptURL); err != nil {
+		return err
+	}
+	if _, err := startPowerAction(ctx, logger, rfClient, physicalHost, internalredfish.PowerOperationRestart, r.powerActionOptions()); err != nil {
+		return fmt.Errorf("failed to restart host: %w", err)
+	}
+	logger.Info("Restarting host into target image", "bootMethod", method)
+	return nil
+}
+
+// bootFromDisk ejects the ISO image inserted for the host and makes it boot from disk
+// until released, then persists the host status.
+func (r *Beskar7MachineReconciler) bootFromDisk(ctx context.Context, logger logr.Logger, physicalHost *infrastructurev1beta1.PhysicalHost) error {
+	rfClient, err := r.getRedfishClientForHost(ctx, logger, physicalHost)
+	if err != nil {
+		return err
+	}
+	defer rfClient.Close(ctx)
+
+	if err := ejectHostVirtualMedia(ctx, logger, rfClient, physicalHost); err != nil {
+		return err
+	}
+	if err := setHostDiskBoot(ctx, logger, rfClient, physicalHost); err != nil {
+		return err
+	}
+	return r.Status().Update(ctx, physicalHost)
+}
+
 // findAndClaimOrGetAssociatedHost finds an available host or returns the associated one.
-func (r *Beskar7MachineReconciler) findAndClaimOrGetAssociatedHost(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine) (*infrastructurev1beta1.PhysicalHost, ctrl.Result, error) {
+// New hosts are only claimed from the failure domain the Machine was placed in.
+func (r *Beskar7MachineReconciler) findAndClaimOrGetAssociatedHost(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, machine *clusterv1.Machine) (*infrastructurev1beta1.PhysicalHost, ctrl.Result, error) {
 	// Check if we already have an associated host via ProviderID
 	if b7machine.Spec.ProviderID != nil && *b7machine.Spec.ProviderID != "" {
 		ns, name, err := parseProviderID(*b7machine.Spec.ProviderID)
 		if err == nil && ns == b7machine.Namespace {
 			host := &infrastructurev1beta1.PhysicalHost{}
 			if err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, host); err == nil {
+				if !isClaimedBy(host, b7machine) {
+					return nil, ctrl.Result{}, fmt.Errorf("PhysicalHost %s/%s is no longer claimed by this machine", ns, name)
+				}
 				return host, ctrl.Result{}, nil
 			}
 		}
 	}
 
-	// Find available host
 	hostList := &infrastructurev1beta1.PhysicalHostList{}
 	if err := r.List(ctx, hostList, client.InNamespace(b7machine.Namespace)); err != nil {
 		return nil, ctrl.Result{}, err
 	}
 
-	for i := range hostList.Items {
-		host := &hostList.Items[i]
-		if host.Status.State == infrastructurev1beta1.StateAvailable && host.Spec.ConsumerRef == nil {
-			// Claim this host
-			logger.Info("Claiming available PhysicalHost", "host", host.Name)
-			host.Spec.ConsumerRef = &corev1.ObjectReference{
-				Kind:       b7machine.Kind,
-				APIVersion: b7machine.APIVersion,
-				Name:       b7machine.Name,
-				Namespace:  b7machine.Namespace,
-				UID:        b7machine.UID,
-			}
-			if err := r.Update(ctx, host); err != nil {
-				logger.Error(err, "Failed to claim host")
-				return nil, ctrl.Result{}, err
-			}
-			return host, ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	// A host claimed by an earlier reconcile has no ProviderID yet, find it by its ConsumerRef
+	if host := findClaimedHost(b7machine, hostList.Items); host != nil {
+		return host, ctrl.Result{}, nil
+	}
+
+	// Find available host among those the machine's host selector and failure domain allow
+	selector, err := hostSelectorFor(b7machine, machine)
+	if err != nil {
+		return nil, ctrl.Result{}, err
+	}
+	var selected []infrastructurev1beta1.PhysicalHost
+	for _, host := range hostList.Items {
+		if selector.Matches(labels.Set(host.Labels)) {
+			selected = append(selected, host)
 		}
 	}
 
-	return nil, ctrl.Result{}, nil
+	// Never claim hosts known to be too small, and rank the rest by the selection policy
+	candidates := selectHostCandidates(b7machine, selected)
+	logger.Info("Claiming available PhysicalHost", "candidates", len(candidates), "policy", b7machine.Spec.HostSelectionPolicy)
+	host, err := r.claimFirstAvailableHost(ctx, logger, b7machine, candidates)
+	if err != nil {
+		logger.Error(err, "Failed to claim host")
+		return nil, ctrl.Result{}, err
+	}
+	if host == nil {
+		return nil, ctrl.Result{}, nil
+	}
+	return host, ctrl.Result{RequeueAfter: r.pollInterval()}, nil
 }
 
 // reconcileDelete handles deletion.
 func (r *Beskar7MachineReconciler) reconcileDelete(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine) (ctrl.Result, error) {
 	logger.Info("Reconciling deletion")
 
-	// Release the host
-	if b7machine.Spec.ProviderID != nil && *b7machine.Spec.ProviderID != "" {
-		ns, name, err := parseProviderID(*b7machine.Spec.ProviderID)
-		if err == nil {
-			host := &infrastructurev1beta1.PhysicalHost{}
-			if err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, host); err == nil {
-				if host.Spec.ConsumerRef != nil && host.Spec.ConsumerRef.Name == b7machine.Name {
-					host.Spec.ConsumerRef = nil
-					if err := r.Update(ctx, host); err != nil {
-						logger.Error(err, "Failed to release host")
-						return ctrl.Result{}, err
-					}
-					logger.Info("Released PhysicalHost", "host", name)
-				}
-			}
+	// Release the host claimed by this machine, whether or not the ProviderID was set yet
+	hostList := &infrastructurev1beta1.PhysicalHostList{}
+	if err := r.List(ctx, hostList, client.InNamespace(b7machine.Namespace)); err != nil {
+		logger.Error(err, "Failed to list PhysicalHosts")
+		return ctrl.Result{}, err
+	}
+	if host := findClaimedHost(b7machine, hostList.Items); host != nil {
+		if err := r.releaseHost(ctx, logger, b7machine, host); err != nil {
+			logger.Error(err, "Failed to release host")
+			conditions.MarkFalse(b7machine, infrastructurev1beta1.PhysicalHostAssociatedCondition,
+				infrastructurev1beta1.ReleasePhysicalHostFailedReason, clusterv1.ConditionSeverityWarning,
+				"Failed to release PhysicalHost %q: %v", host.Name, err)
+			return ctrl.Result{}, err
+		}
+		if needsCleaning(host) {
+			conditions.MarkFalse(b7machine, infrastructurev1beta1.HostDeprovisionedCondition,
+				infrastructurev1beta1.WipingHostReason, clusterv1.ConditionSeverityInfo,
+				"Waiting for PhysicalHost %q to start cleaning", host.Name)
+			return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
 		}
 	}
 
+	// Keep the finalizer until the released host has been wiped, so the Machine is not
+	// gone while the previous cluster's data is still on the disks
+	done, err := r.hostDeprovisioned(ctx, logger, b7machine)
+	if err != nil {
+		logger.Error(err, "Failed to check on released host")
+		return ctrl.Result{}, err
+	}
+	if !done {
+		return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+	}
+
 	// Remove finalizer
 	if controllerutil.RemoveFinalizer(b7machine, Beskar7MachineFinalizer) {
 		logger.Info("Removing finalizer")
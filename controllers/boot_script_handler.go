@@ -0,0 +1,294 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+const (
+	// BootScriptPath is the path hosts chain-load their iPXE script from.
+	BootScriptPath = "/api/v1/boot/ipxe"
+
+	// InspectionPath is the path inspection images report hardware details to.
+	InspectionPath = "/api/v1/inspection"
+)
+
+// bootScriptTemplate chains to the image URL selected for the host. The beskar7-*
+// variables remain set across the chain so the inspection or target image scripts
+// can pass them on as kernel parameters.
+var bootScriptTemplate = template.Must(template.New("boot").Parse(`#!ipxe
+
+echo Beskar7: {{ .Message }}
+{{- if .ImageURL }}
+
+set beskar7-namespace {{ .Namespace }}
+set beskar7-host {{ .HostName }}
+set beskar7-api {{ .CallbackURL }}
+{{- range $key, $value := .Extra }}
+set beskar7-{{ $key }} {{ $value }}
+{{- end }}
+
+chain --autofree {{ .ImageURL }} || goto failed
+
+:failed
+echo Beskar7: boot failed, retrying in 30 seconds
+sleep 30
+reboot
+{{- else }}
+exit
+{{- end }}
+`))
+
+// bootScriptData holds the values rendered into bootScriptTemplate.
+type bootScriptData struct {
+	Message     string
+	Namespace   string
+	HostName    string
+	CallbackURL string
+	ImageURL    string
+	Extra       map[string]string
+}
+
+// BootScriptHandler renders per-host iPXE scripts. Hosts are identified by the
+// "mac" or "serial" query parameters and chained to the inspection or target
+// image of the Beskar7Machine that claimed them, or to their cleaning image once
+// released. Boot scripts are served without authentication, so each token of a host
+// is only injected into the first script served after it was minted.
+type BootScriptHandler struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// CallbackURL is the externally reachable inspection report URL injected into
+	// boot scripts. When empty it is derived from the incoming request.
+	CallbackURL string
+}
+
+// ServeHTTP handles boot script requests
+func (h *BootScriptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := h.Log.WithValues("method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Info("Method not allowed", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mac := normalizeMACAddress(r.URL.Query().Get("mac"))
+	serial := strings.TrimSpace(r.URL.Query().Get("serial"))
+	if mac == "" && serial == "" {
+		log.Info("Missing host identification")
+		http.Error(w, "mac or serial query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	log = log.WithValues("mac", mac, "serial", serial)
+	ctx := r.Context()
+
+	host, err := h.findPhysicalHost(ctx, mac, serial)
+	if err != nil {
+		log.Error(err, "Failed to look up PhysicalHost")
+		http.Error(w, fmt.Sprintf("Failed to look up PhysicalHost: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if host == nil {
+		log.Info("No PhysicalHost matches boot request")
+		http.Error(w, "No PhysicalHost matches the given mac or serial", http.StatusNotFound)
+		return
+	}
+
+	log = log.WithValues("namespace", host.Namespace, "host", host.Name)
+
+	data, err := h.scriptDataForHost(ctx, r, host)
+	if err != nil {
+		log.Error(err, "Failed to build boot script")
+		http.Error(w, fmt.Sprintf("Failed to build boot script: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var script bytes.Buffer
+	if err := bootScriptTemplate.Execute(&script, data); err != nil {
+		log.Error(err, "Failed to render boot script")
+		http.Error(w, "Failed to render boot script", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info("Serving boot script", "state", host.Status.State, "image", data.ImageURL)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(script.Bytes()); err != nil {
+		log.Error(err, "Failed to write boot script")
+	}
+}
+
+// scriptDataForHost selects the image to chain to based on the host state.
+func (h *BootScriptHandler) scriptDataForHost(ctx context.Context, r *http.Request, host *infrastructurev1beta1.PhysicalHost) (*bootScriptData, error) {
+	data := &bootScriptData{
+		Namespace: host.Namespace,
+		HostName:  host.Name,
+		Extra:     map[string]string{},
+	}
+
+	// A released host boots the cleaning image until it has been wiped
+	if host.Status.State == infrastructurev1beta1.StateCleaning {
+		data.Message = fmt.Sprintf("booting cleaning image for %s/%s", host.Namespace, host.Name)
+		data.ImageURL = host.Spec.CleaningImageURL
+		data.CallbackURL = h.callbackURL(r, CleaningPath)
+		data.Extra["cleaning-mode"] = string(cleaningModeFor(host))
+		token, err := takeCleaningToken(ctx, h.Client, host)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			data.Extra["token"] = token
+		}
+		return data, nil
+	}
+
+	b7machine, err := getConsumerBeskar7Machine(ctx, h.Client, host)
+	if err != nil {
+		return nil, err
+	}
+	if b7machine == nil {
+		data.Message = fmt.Sprintf("host %s/%s is not claimed, continuing local boot", host.Namespace, host.Name)
+		return data, nil
+	}
+
+	switch host.Status.State {
+	case infrastructurev1beta1.StateInUse, infrastructurev1beta1.StateInspecting:
+		data.Message = fmt.Sprintf("booting inspection image for %s/%s", host.Namespace, host.Name)
+		data.ImageURL = b7machine.Spec.InspectionImageURL
+		data.CallbackURL = h.callbackURL(r, InspectionPath)
+		token, err := takeInspectionToken(ctx, h.Client, host)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			data.Extra["token"] = token
+		}
+	case infrastructurev1beta1.StateReady:
+		// Only hand out the target image while provisioning, never before the bootstrap
+		// data is there nor to an installed or failed host that reboots
+		if host.Status.ProvisioningPhase != infrastructurev1beta1.ProvisioningPhaseProvisioning {
+			data.Message = fmt.Sprintf("host %s/%s is not provisioning (phase %q), continuing local boot",
+				host.Namespace, host.Name, host.Status.ProvisioningPhase)
+			return data, nil
+		}
+
+		// The installed OS reports back to the provisioning endpoint instead
+		data.Message = fmt.Sprintf("booting target image for %s/%s", host.Namespace, host.Name)
+		data.ImageURL = b7machine.Spec.TargetImageURL
+		data.CallbackURL = h.callbackURL(r, ProvisioningPath)
+		if b7machine.Spec.ConfigurationURL != "" {
+			data.Extra["config"] = b7machine.Spec.ConfigurationURL
+		}
+		if host.Status.RootDevice != "" {
+			data.Extra["root-device"] = host.Status.RootDevice
+		}
+		token, err := takeProvisioningToken(ctx, h.Client, host)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			data.Extra["token"] = token
+		}
+		bootstrapURL, err := takeBootstrapDataURL(ctx, h.Client, host, h.callbackURL(r, BootstrapPath))
+		if err != nil {
+			return nil, err
+		}
+		if bootstrapURL != "" {
+			data.Extra["bootstrap"] = bootstrapURL
+			if b7machine.Spec.ConfigurationURL == "" {
+				data.Extra["config"] = bootstrapURL
+			}
+		}
+	default:
+		data.Message = fmt.Sprintf("host %s/%s is in state %q, continuing local boot", host.Namespace, host.Name, host.Status.State)
+	}
+
+	return data, nil
+}
+
+// callbackURL returns the URL for the given API path injected into boot scripts.
+// Other paths are resolved relative to a configured inspection callback URL.
+func (h *BootScriptHandler) callbackURL(r *http.Request, path string) string {
+	return apiURL(r, h.CallbackURL, path)
+}
+
+// apiURL returns the URL of the given API path handed to hosts. It is resolved relative
+// to the configured inspection callback URL, or derived from the request if none is set.
+func apiURL(r *http.Request, callbackURL, path string) string {
+	if callbackURL != "" {
+		return strings.TrimSuffix(callbackURL, InspectionPath) + path
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, path)
+}
+
+// findPhysicalHost returns the PhysicalHost matching the given MAC address or
+// serial number, or nil if none matches.
+func (h *BootScriptHandler) findPhysicalHost(ctx context.Context, mac, serial string) (*infrastructurev1beta1.PhysicalHost, error) {
+	hostList := &infrastructurev1beta1.PhysicalHostList{}
+	if err := h.Client.List(ctx, hostList); err != nil {
+		return nil, fmt.Errorf("failed to list PhysicalHosts: %w", err)
+	}
+
+	for i := range hostList.Items {
+		host := &hostList.Items[i]
+		if mac != "" && hostHasMACAddress(host, mac) {
+			return host, nil
+		}
+		if serial != "" && strings.EqualFold(host.Status.HardwareDetails.SerialNumber, serial) {
+			return host, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// hostHasMACAddress checks the boot MAC address and any inspected NICs of the host.
+func hostHasMACAddress(host *infrastructurev1beta1.PhysicalHost, mac string) bool {
+	if normalizeMACAddress(host.Spec.BootMACAddress) == mac {
+		return true
+	}
+	if host.Status.InspectionReport != nil {
+		for _, nic := range host.Status.InspectionReport.NICs {
+			if normalizeMACAddress(nic.MACAddress) == mac {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeMACAddress lowercases a MAC address and uses colons as separators.
+func normalizeMACAddress(mac string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(mac)), "-", ":")
+}
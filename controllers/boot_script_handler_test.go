@@ -0,0 +1,251 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+var _ = Describe("BootScriptHandler", func() {
+	var (
+		testNs       *corev1.Namespace
+		physicalHost *infrastructurev1beta1.PhysicalHost
+		handler      *BootScriptHandler
+	)
+
+	serve := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://beskar7.local:8082"+BootScriptPath+"?"+query, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	setHostState := func(state string) {
+		physicalHost.Status.State = state
+		Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		testNs = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "bootscript-test-"},
+		}
+		Expect(k8sClient.Create(ctx, testNs)).To(Succeed())
+
+		b7machine := &infrastructurev1beta1.Beskar7Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.Beskar7MachineSpec{
+				InspectionImageURL: "http://boot-server/ipxe/inspect.ipxe",
+				TargetImageURL:     "http://boot-server/ipxe/kairos.ipxe",
+				ConfigurationURL:   "http://boot-server/configs/node.yaml",
+			},
+		}
+		Expect(k8sClient.Create(ctx, b7machine)).To(Succeed())
+
+		physicalHost = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				RedfishConnection: infrastructurev1beta1.RedfishConnection{
+					Address:              "https://192.168.1.100",
+					CredentialsSecretRef: "test-bmc-creds",
+				},
+				BootMACAddress: "AA-BB-CC-DD-EE-01",
+				ConsumerRef: &corev1.ObjectReference{
+					Name:      b7machine.Name,
+					Namespace: b7machine.Namespace,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, physicalHost)).To(Succeed())
+		physicalHost.Status.HardwareDetails.SerialNumber = "SN-BOOT-0001"
+		setHostState(infrastructurev1beta1.StateInspecting)
+
+		handler = &BootScriptHandler{
+			Client: k8sClient,
+			Log:    ctrl.Log.WithName("boot-script-handler-test"),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, testNs)).To(Succeed())
+	})
+
+	It("should reject requests without host identification", func() {
+		Expect(serve("").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should return not found for unknown hosts", func() {
+		Expect(serve("mac=00:00:00:00:00:00").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should chain to the inspection image while inspecting", func() {
+		rec := serve("mac=aa:bb:cc:dd:ee:01")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		body := rec.Body.String()
+		Expect(body).To(HavePrefix("#!ipxe"))
+		Expect(body).To(ContainSubstring("set beskar7-namespace " + testNs.Name))
+		Expect(body).To(ContainSubstring("set beskar7-host test-host"))
+		Expect(body).To(ContainSubstring("set beskar7-api http://beskar7.local:8082" + InspectionPath))
+		Expect(body).To(ContainSubstring("chain --autofree http://boot-server/ipxe/inspect.ipxe"))
+	})
+
+	It("should inject the inspection token while inspecting", func() {
+		Expect(mintInspectionToken(ctx, k8sClient, k8sClient.Scheme(), physicalHost, time.Minute)).To(Succeed())
+		Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+		token, err := getInspectionToken(ctx, k8sClient, physicalHost)
+		Expect(err).NotTo(HaveOccurred())
+
+		rec := serve("mac=aa:bb:cc:dd:ee:01")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("set beskar7-token " + token))
+
+		// Anyone else asking for the boot script of the host later does not get the token
+		rec = serve("serial=sn-boot-0001")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("chain --autofree http://boot-server/ipxe/inspect.ipxe"))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("beskar7-token"))
+	})
+
+	It("should chain to the target image once the host is provisioning", func() {
+		physicalHost.Status.ProvisioningPhase = infrastructurev1beta1.ProvisioningPhaseProvisioning
+		setHostState(infrastructurev1beta1.StateReady)
+		handler.CallbackURL = "https://beskar7.example.com/api/v1/inspection"
+
+		rec := serve("serial=sn-boot-0001")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		body := rec.Body.String()
+		Expect(body).To(ContainSubstring("set beskar7-api https://beskar7.example.com" + ProvisioningPath))
+		Expect(body).To(ContainSubstring("set beskar7-config http://boot-server/configs/node.yaml"))
+		Expect(body).To(ContainSubstring("chain --autofree http://boot-server/ipxe/kairos.ipxe"))
+		Expect(body).NotTo(ContainSubstring("beskar7-root-device"))
+	})
+
+	It("should inject the provisioning token into the target image", func() {
+		physicalHost.Status.ProvisioningPhase = infrastructurev1beta1.ProvisioningPhaseProvisioning
+		Expect(mintProvisioningToken(ctx, k8sClient, k8sClient.Scheme(), physicalHost)).To(Succeed())
+		setHostState(infrastructurev1beta1.StateReady)
+		token, err := getProvisioningToken(ctx, k8sClient, physicalHost)
+		Expect(err).NotTo(HaveOccurred())
+
+		rec := serve("mac=aa:bb:cc:dd:ee:01")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("set beskar7-token " + token))
+
+		rec = serve("mac=aa:bb:cc:dd:ee:01")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("beskar7-token"))
+	})
+
+	It("should hand out the bootstrap data URL only once", func() {
+		physicalHost.Status.ProvisioningPhase = infrastructurev1beta1.ProvisioningPhaseProvisioning
+		Expect(mintBootstrapToken(ctx, k8sClient, k8sClient.Scheme(), physicalHost)).To(Succeed())
+		setHostState(infrastructurev1beta1.StateReady)
+		token, err := getHostToken(ctx, k8sClient, physicalHost, bootstrapTokenKind)
+		Expect(err).NotTo(HaveOccurred())
+
+		rec := serve("mac=aa:bb:cc:dd:ee:01")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("set beskar7-bootstrap "))
+		Expect(rec.Body.String()).To(ContainSubstring(token))
+
+		rec = serve("mac=aa:bb:cc:dd:ee:01")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("beskar7-bootstrap"))
+		Expect(rec.Body.String()).NotTo(ContainSubstring(token))
+
+		// The bootstrap token itself stays valid for the host that received it
+		host := &infrastructurev1beta1.PhysicalHost{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: testNs.Name, Name: "test-host"}, host)).To(Succeed())
+		Expect(host.Status.BootstrapTokenHash).To(Equal(physicalHost.Status.BootstrapTokenHash))
+	})
+
+	It("should pass the root device to the target image", func() {
+		physicalHost.Status.RootDevice = "/dev/sdb"
+		physicalHost.Status.ProvisioningPhase = infrastructurev1beta1.ProvisioningPhaseProvisioning
+		setHostState(infrastructurev1beta1.StateReady)
+
+		rec := serve("serial=sn-boot-0001")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("set beskar7-root-device /dev/sdb"))
+	})
+
+	It("should continue local boot for ready hosts that are not provisioning", func() {
+		for _, phase := range []infrastructurev1beta1.ProvisioningPhase{
+			"", // waiting for bootstrap data
+			infrastructurev1beta1.ProvisioningPhaseProvisioned,
+			infrastructurev1beta1.ProvisioningPhaseFailed,
+		} {
+			physicalHost.Status.ProvisioningPhase = phase
+			setHostState(infrastructurev1beta1.StateReady)
+
+			rec := serve("mac=aa:bb:cc:dd:ee:01")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(ContainSubstring("exit"), "phase %q", phase)
+			Expect(rec.Body.String()).NotTo(ContainSubstring("chain"), "phase %q", phase)
+		}
+	})
+
+	It("should chain to the cleaning image while cleaning", func() {
+		physicalHost.Spec.ConsumerRef = nil
+		physicalHost.Spec.CleaningMode = infrastructurev1beta1.CleaningModeFull
+		physicalHost.Spec.CleaningImageURL = "http://boot-server/ipxe/clean.ipxe"
+		Expect(k8sClient.Update(ctx, physicalHost)).To(Succeed())
+		physicalHost.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseWiping
+		Expect(mintCleaningToken(ctx, k8sClient, k8sClient.Scheme(), physicalHost)).To(Succeed())
+		setHostState(infrastructurev1beta1.StateCleaning)
+		token, err := getCleaningToken(ctx, k8sClient, physicalHost)
+		Expect(err).NotTo(HaveOccurred())
+		hash := physicalHost.Status.CleaningTokenHash
+
+		rec := serve("mac=aa:bb:cc:dd:ee:01")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		body := rec.Body.String()
+		Expect(body).To(ContainSubstring("set beskar7-api http://beskar7.local:8082" + CleaningPath))
+		Expect(body).To(ContainSubstring("set beskar7-cleaning-mode Full"))
+		Expect(body).To(ContainSubstring("set beskar7-token " + token))
+		Expect(body).To(ContainSubstring("chain --autofree http://boot-server/ipxe/clean.ipxe"))
+
+		// Serving the boot script never rotates the token of the real host, nor hands it
+		// out again
+		host := &infrastructurev1beta1.PhysicalHost{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: testNs.Name, Name: "test-host"}, host)).To(Succeed())
+		Expect(host.Status.CleaningTokenHash).To(Equal(hash))
+		rec = serve("mac=aa:bb:cc:dd:ee:01")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("beskar7-token"))
+	})
+
+	It("should fall back to local boot for unclaimed hosts", func() {
+		physicalHost.Spec.ConsumerRef = nil
+		Expect(k8sClient.Update(ctx, physicalHost)).To(Succeed())
+
+		rec := serve("mac=aa:bb:cc:dd:ee:01")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("exit"))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("chain"))
+	})
+})
@@ -0,0 +1,189 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	"github.com/wrkode/beskar7/internal/security"
+)
+
+const (
+	// BootstrapPath is the path hosts fetch their CAPI bootstrap data from, as
+	// BootstrapPath/{namespace}/{host}.
+	BootstrapPath = "/api/v1/bootstrap"
+
+	// BootstrapFormatCloudConfig is cloud-init user data
+	BootstrapFormatCloudConfig = "cloud-config"
+	// BootstrapFormatIgnition is an Ignition JSON document
+	BootstrapFormatIgnition = "ignition"
+
+	// BootstrapFormatHeader reports the detected format of the served bootstrap data
+	BootstrapFormatHeader = "X-Beskar7-Bootstrap-Format"
+)
+
+// BootstrapHandler serves the bootstrap data secret generated by the CAPI bootstrap
+// provider of the Machine that owns the Beskar7Machine claiming a host. Requests must
+// carry the per-host token handed out in the boot script, either as a bearer token or
+// as the "token" query parameter.
+type BootstrapHandler struct {
+	Client client.Client
+	Log    logr.Logger
+}
+
+// ServeHTTP handles bootstrap data requests
+func (h *BootstrapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := h.Log.WithValues("method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Info("Method not allowed", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, BootstrapPath+"/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "expected "+BootstrapPath+"/{namespace}/{host}", http.StatusBadRequest)
+		return
+	}
+	namespace, hostName := parts[0], parts[1]
+	log = log.WithValues("namespace", namespace, "host", hostName)
+	ctx := r.Context()
+
+	host := &infrastructurev1beta1.PhysicalHost{}
+	if err := h.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: hostName}, host); err != nil {
+		log.Info("PhysicalHost not found", "error", err.Error())
+		// Do not reveal which hosts exist to unauthenticated callers
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !security.TokenMatchesHash(requestToken(r), host.Status.BootstrapTokenHash) {
+		log.Info("Rejected bootstrap data request with invalid token")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, format, err := h.getBootstrapData(ctx, host)
+	if err != nil {
+		log.Error(err, "Failed to get bootstrap data")
+		http.Error(w, fmt.Sprintf("Failed to get bootstrap data: %v", err), http.StatusNotFound)
+		return
+	}
+
+	now := metav1.Now()
+	host.Status.BootstrapDataTimestamp = &now
+	if err := h.Client.Status().Update(ctx, host); err != nil {
+		log.Error(err, "Failed to record bootstrap data delivery")
+		http.Error(w, fmt.Sprintf("Failed to update PhysicalHost: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Info("Serving bootstrap data", "format", format)
+	if format == BootstrapFormatIgnition {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/cloud-config; charset=utf-8")
+	}
+	w.Header().Set(BootstrapFormatHeader, format)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		log.Error(err, "Failed to write bootstrap data")
+	}
+}
+
+// getBootstrapData returns the bootstrap data of the Machine owning the consumer of
+// the host, along with its format.
+func (h *BootstrapHandler) getBootstrapData(ctx context.Context, host *infrastructurev1beta1.PhysicalHost) ([]byte, string, error) {
+	b7machine, err := getConsumerBeskar7Machine(ctx, h.Client, host)
+	if err != nil {
+		return nil, "", err
+	}
+	if b7machine == nil {
+		return nil, "", fmt.Errorf("PhysicalHost %s/%s is not claimed", host.Namespace, host.Name)
+	}
+
+	machine, err := util.GetOwnerMachine(ctx, h.Client, b7machine.ObjectMeta)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get owner Machine: %w", err)
+	}
+	if machine == nil || machine.Spec.Bootstrap.DataSecretName == nil {
+		return nil, "", fmt.Errorf("bootstrap data for Beskar7Machine %s/%s is not available yet", b7machine.Namespace, b7machine.Name)
+	}
+
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: machine.Namespace, Name: *machine.Spec.Bootstrap.DataSecretName}
+	if err := h.Client.Get(ctx, key, secret); err != nil {
+		return nil, "", fmt.Errorf("failed to get bootstrap data secret %s: %w", key, err)
+	}
+
+	value, ok := secret.Data["value"]
+	if !ok {
+		return nil, "", fmt.Errorf("bootstrap data secret %s has no value key", key)
+	}
+
+	format := string(secret.Data["format"])
+	if format == "" {
+		format = detectBootstrapFormat(value)
+	}
+	return value, format, nil
+}
+
+// detectBootstrapFormat tells Ignition JSON apart from cloud-init user data for
+// bootstrap secrets that do not declare their format.
+func detectBootstrapFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		return BootstrapFormatCloudConfig
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &doc); err == nil {
+		if _, ok := doc["ignition"]; ok {
+			return BootstrapFormatIgnition
+		}
+	}
+	return BootstrapFormatCloudConfig
+}
+
+// requestToken extracts a bearer token from the Authorization header or the
+// "token" query parameter.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// bootstrapDataURL returns the URL a host fetches its bootstrap data from.
+func bootstrapDataURL(baseURL string, host *infrastructurev1beta1.PhysicalHost, token string) string {
+	return fmt.Sprintf("%s/%s/%s?token=%s", baseURL,
+		url.PathEscape(host.Namespace), url.PathEscape(host.Name), url.QueryEscape(token))
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	"github.com/wrkode/beskar7/internal/security"
+)
+
+var _ = Describe("BootstrapHandler", func() {
+	const cloudConfig = "#cloud-config\nruncmd:\n- kubeadm join\n"
+
+	var (
+		testNs  *corev1.Namespace
+		token   string
+		handler *BootstrapHandler
+	)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	hostURL := func() string {
+		return BootstrapPath + "/" + testNs.Name + "/test-host"
+	}
+
+	BeforeEach(func() {
+		testNs = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "bootstrap-test-"},
+		}
+		Expect(k8sClient.Create(ctx, testNs)).To(Succeed())
+
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-machine-bootstrap", Namespace: testNs.Name},
+			Data:       map[string][]byte{"value": []byte(cloudConfig)},
+		})).To(Succeed())
+
+		dataSecretName := "test-machine-bootstrap"
+		machine := &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: testNs.Name},
+			Spec: clusterv1.MachineSpec{
+				ClusterName: "test-cluster",
+				Bootstrap:   clusterv1.Bootstrap{DataSecretName: &dataSecretName},
+			},
+		}
+		Expect(k8sClient.Create(ctx, machine)).To(Succeed())
+
+		b7machine := &infrastructurev1beta1.Beskar7Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-machine",
+				Namespace: testNs.Name,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Machine",
+					Name:       machine.Name,
+					UID:        machine.UID,
+				}},
+			},
+			Spec: infrastructurev1beta1.Beskar7MachineSpec{
+				InspectionImageURL: "http://boot-server/ipxe/inspect.ipxe",
+				TargetImageURL:     "http://boot-server/images/kairos.tar.gz",
+			},
+		}
+		Expect(k8sClient.Create(ctx, b7machine)).To(Succeed())
+
+		physicalHost := &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				RedfishConnection: infrastructurev1beta1.RedfishConnection{
+					Address:              "https://192.168.1.100",
+					CredentialsSecretRef: "test-bmc-creds",
+				},
+				ConsumerRef: &corev1.ObjectReference{
+					Name:      b7machine.Name,
+					Namespace: b7machine.Namespace,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, physicalHost)).To(Succeed())
+
+		var hash string
+		var err error
+		token, hash, err = security.GenerateToken()
+		Expect(err).NotTo(HaveOccurred())
+		physicalHost.Status.State = infrastructurev1beta1.StateReady
+		physicalHost.Status.BootstrapTokenHash = hash
+		Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+
+		handler = &BootstrapHandler{
+			Client: k8sClient,
+			Log:    ctrl.Log.WithName("bootstrap-handler-test"),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, testNs)).To(Succeed())
+	})
+
+	It("should reject requests without a valid token", func() {
+		Expect(serve(httptest.NewRequest(http.MethodGet, hostURL(), nil)).Code).To(Equal(http.StatusUnauthorized))
+		Expect(serve(httptest.NewRequest(http.MethodGet, hostURL()+"?token=wrong", nil)).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should serve the bootstrap data and record the delivery", func() {
+		rec := serve(httptest.NewRequest(http.MethodGet, hostURL()+"?token="+token, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(Equal(cloudConfig))
+		Expect(rec.Header().Get(BootstrapFormatHeader)).To(Equal(BootstrapFormatCloudConfig))
+
+		host := &infrastructurev1beta1.PhysicalHost{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: testNs.Name, Name: "test-host"}, host)).To(Succeed())
+		Expect(host.Status.BootstrapDataTimestamp).NotTo(BeNil())
+	})
+
+	It("should accept the token as a bearer token", func() {
+		req := httptest.NewRequest(http.MethodGet, hostURL(), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		Expect(serve(req).Code).To(Equal(http.StatusOK))
+	})
+
+	It("should detect the bootstrap data format", func() {
+		Expect(detectBootstrapFormat([]byte(cloudConfig))).To(Equal(BootstrapFormatCloudConfig))
+		Expect(detectBootstrapFormat([]byte(`{"ignition": {"version": "3.4.0"}}`))).To(Equal(BootstrapFormatIgnition))
+		Expect(detectBootstrapFormat([]byte(`{"not": "ignition"}`))).To(Equal(BootstrapFormatCloudConfig))
+	})
+})
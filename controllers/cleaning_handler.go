@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	"github.com/wrkode/beskar7/internal/security"
+)
+
+// CleaningPath is the path cleaning images report the wipe result to.
+const CleaningPath = "/api/v1/cleaning"
+
+// CleaningHandler records the wipe result reported by the cleaning image.
+type CleaningHandler struct {
+	Client client.Client
+	Log    logr.Logger
+}
+
+// CleaningStatusRequest is the JSON payload reported by the cleaning image
+type CleaningStatusRequest struct {
+	// Namespace and name to identify the PhysicalHost
+	Namespace string `json:"namespace"`
+	HostName  string `json:"hostName"`
+
+	// Token is the token handed to the cleaning image in its boot script. It may
+	// also be sent as a bearer token.
+	Token string `json:"token,omitempty"`
+
+	// Phase is either Complete or Failed
+	Phase infrastructurev1beta1.CleaningPhase `json:"phase"`
+
+	// Message optionally describes a failure
+	Message string `json:"message,omitempty"`
+}
+
+// ServeHTTP handles wipe status reports
+func (h *CleaningHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := h.Log.WithValues("method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Info("Method not allowed", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CleaningStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(err, "Failed to decode cleaning status")
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	log = log.WithValues("namespace", req.Namespace, "host", req.HostName, "phase", req.Phase)
+	log.Info("Received cleaning status")
+
+	if req.Namespace == "" || req.HostName == "" {
+		http.Error(w, "namespace and hostName are required", http.StatusBadRequest)
+		return
+	}
+	if req.Phase != infrastructurev1beta1.CleaningPhaseComplete &&
+		req.Phase != infrastructurev1beta1.CleaningPhaseFailed {
+		http.Error(w, fmt.Sprintf("phase must be %q or %q",
+			infrastructurev1beta1.CleaningPhaseComplete, infrastructurev1beta1.CleaningPhaseFailed),
+			http.StatusBadRequest)
+		return
+	}
+
+	host := &infrastructurev1beta1.PhysicalHost{}
+	if err := h.Client.Get(r.Context(), types.NamespacedName{Namespace: req.Namespace, Name: req.HostName}, host); err != nil {
+		log.Info("PhysicalHost not found", "error", err.Error())
+		// Do not reveal which hosts exist to unauthenticated callers
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if host.Status.State != infrastructurev1beta1.StateCleaning ||
+		(host.Status.CleaningPhase != infrastructurev1beta1.CleaningPhaseBooting &&
+			host.Status.CleaningPhase != infrastructurev1beta1.CleaningPhaseWiping) {
+		log.Info("PhysicalHost is not cleaning", "state", host.Status.State, "cleaningPhase", host.Status.CleaningPhase)
+		http.Error(w, fmt.Sprintf("PhysicalHost is not cleaning (phase %q)", host.Status.CleaningPhase), http.StatusConflict)
+		return
+	}
+
+	token := requestToken(r)
+	if token == "" {
+		token = req.Token
+	}
+	if !security.TokenMatchesHash(token, host.Status.CleaningTokenHash) {
+		log.Info("Rejected cleaning status with invalid token")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	host.Status.CleaningPhase = req.Phase
+	host.Status.CleaningTokenHash = ""
+	if req.Phase == infrastructurev1beta1.CleaningPhaseFailed {
+		host.Status.ErrorMessage = fmt.Sprintf("Cleaning failed: %s", req.Message)
+	}
+	if err := h.Client.Status().Update(r.Context(), host); err != nil {
+		log.Error(err, "Failed to update PhysicalHost")
+		http.Error(w, fmt.Sprintf("Failed to update PhysicalHost: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := deleteCleaningToken(r.Context(), h.Client, host); err != nil {
+		// The token can no longer be used, only the handoff Secret is left behind
+		log.Error(err, "Failed to delete used cleaning token")
+	}
+
+	log.Info("Successfully recorded cleaning status")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Cleaning status recorded",
+	}); err != nil {
+		log.Error(err, "Failed to encode response")
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	"github.com/wrkode/beskar7/internal/security"
+)
+
+var _ = Describe("CleaningHandler", func() {
+	const token = "wipe-token"
+
+	var (
+		testNs       *corev1.Namespace
+		physicalHost *infrastructurev1beta1.PhysicalHost
+		handler      *CleaningHandler
+	)
+
+	report := func(phase infrastructurev1beta1.CleaningPhase, token string) int {
+		body, err := json.Marshal(CleaningStatusRequest{Namespace: testNs.Name, HostName: "test-host", Token: token, Phase: phase, Message: "secure erase unsupported"})
+		Expect(err).NotTo(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, CleaningPath, bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	getHost := func() *infrastructurev1beta1.PhysicalHost {
+		host := &infrastructurev1beta1.PhysicalHost{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: testNs.Name, Name: "test-host"}, host)).To(Succeed())
+		return host
+	}
+
+	BeforeEach(func() {
+		testNs = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "cleaning-test-"},
+		}
+		Expect(k8sClient.Create(ctx, testNs)).To(Succeed())
+
+		physicalHost = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				RedfishConnection: infrastructurev1beta1.RedfishConnection{
+					Address:              "https://192.168.1.100",
+					CredentialsSecretRef: "test-bmc-creds",
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, physicalHost)).To(Succeed())
+		physicalHost.Status.State = infrastructurev1beta1.StateCleaning
+		physicalHost.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseWiping
+		physicalHost.Status.CleaningTokenHash = security.HashToken(token)
+		Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+
+		handler = &CleaningHandler{
+			Client: k8sClient,
+			Log:    ctrl.Log.WithName("cleaning-handler-test"),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, testNs)).To(Succeed())
+	})
+
+	It("should reject reports without a valid token", func() {
+		Expect(report(infrastructurev1beta1.CleaningPhaseComplete, "")).To(Equal(http.StatusUnauthorized))
+		Expect(report(infrastructurev1beta1.CleaningPhaseComplete, "forged")).To(Equal(http.StatusUnauthorized))
+		Expect(getHost().Status.CleaningPhase).To(Equal(infrastructurev1beta1.CleaningPhaseWiping))
+	})
+
+	It("should not reveal which hosts exist", func() {
+		body, err := json.Marshal(CleaningStatusRequest{Namespace: testNs.Name, HostName: "unknown-host", Token: token, Phase: infrastructurev1beta1.CleaningPhaseComplete})
+		Expect(err).NotTo(HaveOccurred())
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, CleaningPath, bytes.NewReader(body)))
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should record a completed wipe once", func() {
+		Expect(report(infrastructurev1beta1.CleaningPhaseComplete, token)).To(Equal(http.StatusOK))
+		host := getHost()
+		Expect(host.Status.CleaningPhase).To(Equal(infrastructurev1beta1.CleaningPhaseComplete))
+		Expect(host.Status.CleaningTokenHash).To(BeEmpty())
+
+		Expect(report(infrastructurev1beta1.CleaningPhaseComplete, token)).To(Equal(http.StatusConflict))
+	})
+
+	It("should record a failed wipe", func() {
+		Expect(report(infrastructurev1beta1.CleaningPhaseFailed, token)).To(Equal(http.StatusOK))
+		host := getHost()
+		Expect(host.Status.CleaningPhase).To(Equal(infrastructurev1beta1.CleaningPhaseFailed))
+		Expect(host.Status.ErrorMessage).To(ContainSubstring("secure erase unsupported"))
+	})
+
+	It("should reject unknown phases", func() {
+		Expect(report(infrastructurev1beta1.CleaningPhaseWiping, token)).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+// hostDeprovisioned reports whether the host released by a deleted machine has been
+// cleaned, so the machine's finalizer may be removed. The PhysicalHostReconciler wipes
+// and powers off released hosts in the Cleaning state; the machine only reflects its
+// progress in the HostDeprovisioned condition. Hosts released before a ProviderID was
+// set never received the target image and have nothing to wipe.
+func (r *Beskar7MachineReconciler) hostDeprovisioned(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine) (bool, error) {
+	if b7machine.Spec.ProviderID == nil || *b7machine.Spec.ProviderID == "" {
+		conditions.MarkTrue(b7machine, infrastructurev1beta1.HostDeprovisionedCondition)
+		return true, nil
+	}
+	ns, name, err := parseProviderID(*b7machine.Spec.ProviderID)
+	if err != nil {
+		logger.Error(err, "Failed to parse ProviderID, not waiting for host cleaning", "providerID", *b7machine.Spec.ProviderID)
+		conditions.MarkTrue(b7machine, infrastructurev1beta1.HostDeprovisionedCondition)
+		return true, nil
+	}
+
+	host := &infrastructurev1beta1.PhysicalHost{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, host); err != nil {
+		if apierrors.IsNotFound(err) {
+			conditions.MarkTrue(b7machine, infrastructurev1beta1.HostDeprovisionedCondition)
+			return true, nil
+		}
+		return false, err
+	}
+
+	// A host claimed by another machine has been cleaned and made Available in between
+	if (host.Spec.ConsumerRef != nil && !isClaimedBy(host, b7machine)) || !needsCleaning(host) {
+		logger.Info("Released PhysicalHost deprovisioned", "host", host.Name)
+		conditions.MarkTrue(b7machine, infrastructurev1beta1.HostDeprovisionedCondition)
+		return true, nil
+	}
+
+	switch host.Status.State {
+	case infrastructurev1beta1.StateCleaning:
+		conditions.MarkFalse(b7machine, infrastructurev1beta1.HostDeprovisionedCondition,
+			infrastructurev1beta1.WipingHostReason, clusterv1.ConditionSeverityInfo,
+			"Wiping PhysicalHost %q (%s)", host.Name, cleaningModeFor(host))
+	case infrastructurev1beta1.StateError:
+		conditions.MarkFalse(b7machine, infrastructurev1beta1.HostDeprovisionedCondition,
+			infrastructurev1beta1.WipeFailedReason, clusterv1.ConditionSeverityWarning,
+			"Wiping PhysicalHost %q failed: %s", host.Name, host.Status.ErrorMessage)
+	default:
+		conditions.MarkFalse(b7machine, infrastructurev1beta1.HostDeprovisionedCondition,
+			infrastructurev1beta1.WipingHostReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for PhysicalHost %q to start cleaning", host.Name)
+	}
+	logger.Info("Waiting for released PhysicalHost to be cleaned", "host", host.Name, "state", host.Status.State, "cleaningPhase", host.Status.CleaningPhase)
+	return false, nil
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+var _ = Describe("Host deprovisioning", func() {
+	var (
+		testNs     *corev1.Namespace
+		b7machine  *infrastructurev1beta1.Beskar7Machine
+		reconciler *Beskar7MachineReconciler
+	)
+
+	getHost := func() *infrastructurev1beta1.PhysicalHost {
+		host := &infrastructurev1beta1.PhysicalHost{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: testNs.Name, Name: "test-host"}, host)).To(Succeed())
+		return host
+	}
+
+	// newClaimedHost creates a host claimed by the machine, which may have been handed
+	// the target image
+	newClaimedHost := func(targetImageServed bool) *infrastructurev1beta1.PhysicalHost {
+		host := &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				RedfishConnection: infrastructurev1beta1.RedfishConnection{
+					Address:              "https://192.168.1.100",
+					CredentialsSecretRef: "test-bmc-creds",
+				},
+				CleaningImageURL: "http://boot-server/ipxe/clean.ipxe",
+				ConsumerRef:      consumerRefFor(b7machine),
+			},
+		}
+		Expect(k8sClient.Create(ctx, host)).To(Succeed())
+		host.Status.State = infrastructurev1beta1.StateReady
+		host.Status.TargetImageServed = targetImageServed
+		Expect(k8sClient.Status().Update(ctx, host)).To(Succeed())
+
+		providerID := providerID(testNs.Name, host.Name)
+		b7machine.Spec.ProviderID = &providerID
+		return host
+	}
+
+	updateHostStatus := func(mutate func(*infrastructurev1beta1.PhysicalHost)) {
+		host := getHost()
+		mutate(host)
+		Expect(k8sClient.Status().Update(ctx, host)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		testNs = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "deprovisioning-test-"},
+		}
+		Expect(k8sClient.Create(ctx, testNs)).To(Succeed())
+
+		b7machine = &infrastructurev1beta1.Beskar7Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test-machine",
+				Namespace:  testNs.Name,
+				Finalizers: []string{Beskar7MachineFinalizer},
+			},
+			Spec: infrastructurev1beta1.Beskar7MachineSpec{
+				InspectionImageURL: "http://boot-server/ipxe/inspect.ipxe",
+				TargetImageURL:     "http://boot-server/images/kairos.tar.gz",
+			},
+		}
+		Expect(k8sClient.Create(ctx, b7machine)).To(Succeed())
+
+		reconciler = &Beskar7MachineReconciler{
+			Client: k8sClient,
+			Scheme: k8sClient.Scheme(),
+			Log:    ctrl.Log.WithName("deprovisioning-test"),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, testNs)).To(Succeed())
+	})
+
+	It("should keep the finalizer until the released host has been cleaned", func() {
+		newClaimedHost(true)
+
+		result, err := reconciler.reconcileDelete(ctx, reconciler.Log, b7machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(DefaultPollInterval))
+		Expect(getHost().Spec.ConsumerRef).To(BeNil())
+		Expect(controllerutil.ContainsFinalizer(b7machine, Beskar7MachineFinalizer)).To(BeTrue())
+		Expect(conditions.GetReason(b7machine, infrastructurev1beta1.HostDeprovisionedCondition)).To(Equal(infrastructurev1beta1.WipingHostReason))
+
+		By("reporting a failed wipe while the host retries it")
+		updateHostStatus(func(host *infrastructurev1beta1.PhysicalHost) {
+			host.Status.State = infrastructurev1beta1.StateError
+			host.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseTimeout
+			host.Status.ErrorMessage = "Cleaning timeout after 1h0m0s"
+		})
+		_, err = reconciler.reconcileDelete(ctx, reconciler.Log, b7machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controllerutil.ContainsFinalizer(b7machine, Beskar7MachineFinalizer)).To(BeTrue())
+		Expect(conditions.GetReason(b7machine, infrastructurev1beta1.HostDeprovisionedCondition)).To(Equal(infrastructurev1beta1.WipeFailedReason))
+
+		By("removing the finalizer once the host is Available again")
+		updateHostStatus(func(host *infrastructurev1beta1.PhysicalHost) {
+			host.Status.State = infrastructurev1beta1.StateAvailable
+			host.Status.TargetImageServed = false
+			host.Status.CleaningPhase = ""
+			host.Status.ErrorMessage = ""
+		})
+		result, err = reconciler.reconcileDelete(ctx, reconciler.Log, b7machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(controllerutil.ContainsFinalizer(b7machine, Beskar7MachineFinalizer)).To(BeFalse())
+		Expect(conditions.IsTrue(b7machine, infrastructurev1beta1.HostDeprovisionedCondition)).To(BeTrue())
+	})
+
+	It("should not wait for hosts that never received the target image", func() {
+		newClaimedHost(false)
+
+		result, err := reconciler.reconcileDelete(ctx, reconciler.Log, b7machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(getHost().Spec.ConsumerRef).To(BeNil())
+		Expect(controllerutil.ContainsFinalizer(b7machine, Beskar7MachineFinalizer)).To(BeFalse())
+	})
+
+	It("should not wait for a host claimed by another machine in the meantime", func() {
+		newClaimedHost(true)
+		host := getHost()
+		patched := host.DeepCopy()
+		patched.Spec.ConsumerRef = &corev1.ObjectReference{Name: "other-machine", Namespace: testNs.Name, UID: "other-uid"}
+		Expect(k8sClient.Patch(ctx, patched, client.MergeFrom(host))).To(Succeed())
+
+		_, err := reconciler.reconcileDelete(ctx, reconciler.Log, b7machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(controllerutil.ContainsFinalizer(b7machine, Beskar7MachineFinalizer)).To(BeFalse())
+	})
+})
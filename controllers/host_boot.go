@@ -0,0 +1,156 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/stmcginnis/gofish/redfish"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+// bootMethodFor returns the boot method of the machine, defaulting to PXE.
+func bootMethodFor(b7machine *infrastructurev1beta1.Beskar7Machine) infrastructurev1beta1.BootMethod {
+	if b7machine.Spec.BootMethod == "" {
+		return infrastructurev1beta1.BootMethodPXE
+	}
+	return b7machine.Spec.BootMethod
+}
+
+// cleaningBootMethodFor returns the boot method the released host is booted into the
+// cleaning image with: the one its last consumer used, defaulting to PXE.
+func cleaningBootMethodFor(physicalHost *infrastructurev1beta1.PhysicalHost) infrastructurev1beta1.BootMethod {
+	if physicalHost.Status.BootMethod == "" {
+		return infrastructurev1beta1.BootMethodPXE
+	}
+	return physicalHost.Status.BootMethod
+}
+
+// hostBootScriptURL returns the boot script URL of the host, identified by its boot MAC
+// address or, failing that, its serial number. It returns an empty string if no boot
+// script URL is configured or the host cannot be identified yet.
+func hostBootScriptURL(bootScriptURL string, physicalHost *infrastructurev1beta1.PhysicalHost) string {
+	if bootScriptURL == "" {
+		return ""
+	}
+
+	query := url.Values{}
+	if mac := normalizeMACAddress(physicalHost.Spec.BootMACAddress); mac != "" {
+		query.Set("mac", mac)
+	} else if serial := strings.TrimSpace(physicalHost.Status.HardwareDetails.SerialNumber); serial != "" {
+		query.Set("serial", serial)
+	} else {
+		return ""
+	}
+
+	separator := "?"
+	if strings.Contains(bootScriptURL, "?") {
+		separator = "&"
+	}
+	return bootScriptURL + separator + query.Encode()
+}
+
+// setHostBootImage makes the host boot the given image on its next boot. PXE hosts only
+// need the one-time network boot override, since the boot script handler chains them to
+// the image matching the host state. UEFI HTTP hosts are pointed at their boot script
+// URL instead, falling back to PXE if the BMC does not support UEFI HTTP boot or the
+// URL is empty. Virtual media hosts get the ISO image inserted and a one-time boot
+// override to the virtual CD. The method is recorded on the host, so it is cleaned the
+// same way once released. The caller persists the host status.
+func setHostBootImage(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost, method infrastructurev1beta1.BootMethod, imageURL, bootScriptURL string) error {
+	physicalHost.Status.BootMethod = method
+	switch method {
+	case infrastructurev1beta1.BootMethodVirtualMedia:
+		if err := rfClient.InsertVirtualMedia(ctx, imageURL); err != nil {
+			return fmt.Errorf("failed to insert virtual media: %w", err)
+		}
+		physicalHost.Status.VirtualMediaImage = imageURL
+		logger.Info("Inserted virtual media", "image", imageURL)
+
+		if err := rfClient.SetBootSourceVirtualCD(ctx); err != nil {
+			return fmt.Errorf("failed to set boot source to virtual CD: %w", err)
+		}
+		return nil
+	case infrastructurev1beta1.BootMethodUEFIHTTP:
+		if bootScriptURL == "" {
+			logger.Info("No boot script URL for UEFI HTTP boot, falling back to PXE")
+			break
+		}
+		httpBoot, err := rfClient.SetBootSourceHTTP(ctx, bootScriptURL)
+		if err != nil {
+			return fmt.Errorf("failed to set boot source to UEFI HTTP: %w", err)
+		}
+		if !httpBoot {
+			logger.Info("BMC does not support UEFI HTTP boot, fell back to PXE")
+		}
+		return nil
+	}
+
+	if err := rfClient.SetBootSourcePXE(ctx); err != nil {
+		return fmt.Errorf("failed to set boot source to PXE: %w", err)
+	}
+	return nil
+}
+
+// ejectHostVirtualMedia ejects the ISO image inserted for the host, if any. The caller
+// persists the host status.
+func ejectHostVirtualMedia(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost) error {
+	if physicalHost.Status.VirtualMediaImage == "" {
+		return nil
+	}
+	if err := rfClient.EjectVirtualMedia(ctx); err != nil {
+		return fmt.Errorf("failed to eject virtual media: %w", err)
+	}
+	logger.Info("Ejected virtual media", "image", physicalHost.Status.VirtualMediaImage)
+	physicalHost.Status.VirtualMediaImage = ""
+	return nil
+}
+
+// setHostDiskBoot makes the host boot from disk until the override is cleared, so the
+// installed OS does not network boot into inspection again when it reboots. The caller
+// persists the host status.
+func setHostDiskBoot(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost) error {
+	if physicalHost.Status.PersistentBootTarget == string(redfish.HddBootSourceOverrideTarget) {
+		return nil
+	}
+	if err := rfClient.SetBootOverride(ctx, redfish.HddBootSourceOverrideTarget, redfish.ContinuousBootSourceOverrideEnabled); err != nil {
+		return fmt.Errorf("failed to set boot source to disk: %w", err)
+	}
+	logger.Info("Set persistent boot from disk")
+	physicalHost.Status.PersistentBootTarget = string(redfish.HddBootSourceOverrideTarget)
+	return nil
+}
+
+// clearHostBootOverride clears the persistent boot override set for the host, if any.
+// The caller persists the host status.
+func clearHostBootOverride(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost) error {
+	if physicalHost.Status.PersistentBootTarget == "" {
+		return nil
+	}
+	if err := rfClient.ClearBootOverride(ctx); err != nil {
+		return fmt.Errorf("failed to clear boot source override: %w", err)
+	}
+	logger.Info("Cleared persistent boot override", "target", physicalHost.Status.PersistentBootTarget)
+	physicalHost.Status.PersistentBootTarget = ""
+	return nil
+}
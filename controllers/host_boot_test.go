@@ -0,0 +1,150 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stmcginnis/gofish/redfish"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+var _ = Describe("Host boot", func() {
+	var (
+		host         *infrastructurev1beta1.PhysicalHost
+		mockRfClient *internalredfish.MockClient
+	)
+
+	logger := ctrl.Log.WithName("host-boot-test")
+
+	BeforeEach(func() {
+		host = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"},
+		}
+		mockRfClient = internalredfish.NewMockClient()
+	})
+
+	It("should default the boot method to PXE", func() {
+		b7machine := &infrastructurev1beta1.Beskar7Machine{}
+		Expect(bootMethodFor(b7machine)).To(Equal(infrastructurev1beta1.BootMethodPXE))
+
+		b7machine.Spec.BootMethod = infrastructurev1beta1.BootMethodVirtualMedia
+		Expect(bootMethodFor(b7machine)).To(Equal(infrastructurev1beta1.BootMethodVirtualMedia))
+	})
+
+	It("should network boot PXE hosts without inserting virtual media", func() {
+		Expect(setHostBootImage(ctx, logger, mockRfClient, host, infrastructurev1beta1.BootMethodPXE,
+			"http://boot-server/ipxe/inspect.ipxe", "")).To(Succeed())
+		Expect(mockRfClient.BootSourceIsPXE).To(BeTrue())
+		Expect(mockRfClient.InsertVirtualMediaCalled).To(BeFalse())
+		Expect(host.Status.VirtualMediaImage).To(BeEmpty())
+	})
+
+	It("should insert the ISO image and boot virtual media hosts from the virtual CD", func() {
+		Expect(setHostBootImage(ctx, logger, mockRfClient, host, infrastructurev1beta1.BootMethodVirtualMedia,
+			"http://boot-server/images/inspect.iso", "")).To(Succeed())
+		Expect(mockRfClient.VirtualMediaImage).To(Equal("http://boot-server/images/inspect.iso"))
+		Expect(mockRfClient.BootSourceIsCD).To(BeTrue())
+		Expect(mockRfClient.SetBootSourcePXECalled).To(BeFalse())
+		Expect(host.Status.VirtualMediaImage).To(Equal("http://boot-server/images/inspect.iso"))
+
+		Expect(ejectHostVirtualMedia(ctx, logger, mockRfClient, host)).To(Succeed())
+		Expect(mockRfClient.VirtualMediaImage).To(BeEmpty())
+		Expect(host.Status.VirtualMediaImage).To(BeEmpty())
+	})
+
+	It("should not record the image when it could not be inserted", func() {
+		mockRfClient.ShouldFail["InsertVirtualMedia"] = fmt.Errorf("no virtual CD/DVD drive found")
+
+		err := setHostBootImage(ctx, logger, mockRfClient, host, infrastructurev1beta1.BootMethodVirtualMedia,
+			"http://boot-server/images/inspect.iso", "")
+		Expect(err).To(HaveOccurred())
+		Expect(host.Status.VirtualMediaImage).To(BeEmpty())
+		Expect(mockRfClient.SetBootSourceCDCalled).To(BeFalse())
+	})
+
+	It("should point UEFI HTTP hosts at their boot script", func() {
+		mockRfClient.SupportsHTTPBoot = true
+		host.Spec.BootMACAddress = "AA-BB-CC-DD-EE-FF"
+		bootScriptURL := hostBootScriptURL("https://beskar7.example.com/api/v1/boot/ipxe", host)
+		Expect(bootScriptURL).To(Equal("https://beskar7.example.com/api/v1/boot/ipxe?mac=aa%3Abb%3Acc%3Add%3Aee%3Aff"))
+
+		Expect(setHostBootImage(ctx, logger, mockRfClient, host, infrastructurev1beta1.BootMethodUEFIHTTP,
+			"http://boot-server/ipxe/inspect.ipxe", bootScriptURL)).To(Succeed())
+		Expect(mockRfClient.HTTPBootURI).To(Equal(bootScriptURL))
+		Expect(mockRfClient.SetBootSourcePXECalled).To(BeFalse())
+	})
+
+	It("should fall back to PXE when the BMC does not support UEFI HTTP boot", func() {
+		Expect(setHostBootImage(ctx, logger, mockRfClient, host, infrastructurev1beta1.BootMethodUEFIHTTP,
+			"http://boot-server/ipxe/inspect.ipxe", "https://beskar7.example.com/api/v1/boot/ipxe?serial=ABC123")).To(Succeed())
+		Expect(mockRfClient.SetBootSourceHTTPCalled).To(BeTrue())
+		Expect(mockRfClient.BootSourceIsPXE).To(BeTrue())
+		Expect(mockRfClient.HTTPBootURI).To(BeEmpty())
+	})
+
+	It("should fall back to PXE when the host has no boot script URL", func() {
+		mockRfClient.SupportsHTTPBoot = true
+		Expect(hostBootScriptURL("https://beskar7.example.com/api/v1/boot/ipxe", host)).To(BeEmpty())
+
+		Expect(setHostBootImage(ctx, logger, mockRfClient, host, infrastructurev1beta1.BootMethodUEFIHTTP,
+			"http://boot-server/ipxe/inspect.ipxe", "")).To(Succeed())
+		Expect(mockRfClient.SetBootSourceHTTPCalled).To(BeFalse())
+		Expect(mockRfClient.BootSourceIsPXE).To(BeTrue())
+	})
+
+	It("should identify hosts without a boot MAC address by serial number", func() {
+		host.Status.HardwareDetails.SerialNumber = "ABC 123"
+		Expect(hostBootScriptURL("https://beskar7.example.com/api/v1/boot/ipxe", host)).To(
+			Equal("https://beskar7.example.com/api/v1/boot/ipxe?serial=ABC+123"))
+		Expect(hostBootScriptURL("", host)).To(BeEmpty())
+	})
+
+	It("should make provisioned hosts boot from disk until the override is cleared", func() {
+		Expect(setHostDiskBoot(ctx, logger, mockRfClient, host)).To(Succeed())
+		Expect(mockRfClient.BootOverrideTarget).To(Equal(redfish.HddBootSourceOverrideTarget))
+		Expect(mockRfClient.BootOverrideEnabled).To(Equal(redfish.ContinuousBootSourceOverrideEnabled))
+		Expect(host.Status.PersistentBootTarget).To(Equal(string(redfish.HddBootSourceOverrideTarget)))
+
+		// Only set once
+		mockRfClient.SetBootOverrideCalled = false
+		Expect(setHostDiskBoot(ctx, logger, mockRfClient, host)).To(Succeed())
+		Expect(mockRfClient.SetBootOverrideCalled).To(BeFalse())
+
+		Expect(clearHostBootOverride(ctx, logger, mockRfClient, host)).To(Succeed())
+		Expect(mockRfClient.BootOverrideEnabled).To(Equal(redfish.DisabledBootSourceOverrideEnabled))
+		Expect(host.Status.PersistentBootTarget).To(BeEmpty())
+	})
+
+	It("should keep the disk boot pending when it could not be set", func() {
+		mockRfClient.ShouldFail["SetBootOverride"] = fmt.Errorf("BMC busy")
+
+		Expect(setHostDiskBoot(ctx, logger, mockRfClient, host)).NotTo(Succeed())
+		Expect(host.Status.PersistentBootTarget).To(BeEmpty())
+	})
+
+	It("should only eject virtual media it inserted", func() {
+		Expect(ejectHostVirtualMedia(ctx, logger, mockRfClient, host)).To(Succeed())
+		Expect(mockRfClient.EjectVirtualMediaCalled).To(BeFalse())
+	})
+})
@@ -0,0 +1,188 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	"github.com/wrkode/beskar7/internal/metrics"
+)
+
+// isClaimedBy reports whether the host is claimed by the given Beskar7Machine. Claims are
+// matched by UID so that a machine recreated with the same name, or a machine of the same
+// name in another cluster, is never mistaken for the owner.
+func isClaimedBy(host *infrastructurev1beta1.PhysicalHost, b7machine *infrastructurev1beta1.Beskar7Machine) bool {
+	ref := host.Spec.ConsumerRef
+	if ref == nil {
+		return false
+	}
+	if ref.UID != "" {
+		return ref.UID == b7machine.UID
+	}
+	// Claims without a UID predate UID tracking; fall back to the namespaced name
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = host.Namespace
+	}
+	return ref.Name == b7machine.Name && namespace == b7machine.Namespace
+}
+
+// consumerRefFor builds the ConsumerRef recorded on a host claimed by the machine.
+func consumerRefFor(b7machine *infrastructurev1beta1.Beskar7Machine) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind:       "Beskar7Machine",
+		APIVersion: infrastructurev1beta1.GroupVersion.String(),
+		Name:       b7machine.Name,
+		Namespace:  b7machine.Namespace,
+		UID:        b7machine.UID,
+	}
+}
+
+// findClaimedHost returns the host among hosts that is claimed by the machine, if any.
+func findClaimedHost(b7machine *infrastructurev1beta1.Beskar7Machine, hosts []infrastructurev1beta1.PhysicalHost) *infrastructurev1beta1.PhysicalHost {
+	for i := range hosts {
+		if isClaimedBy(&hosts[i], b7machine) {
+			return &hosts[i]
+		}
+	}
+	return nil
+}
+
+// claimFirstAvailableHost claims the first candidate that can still be claimed, in the
+// order the candidates were ranked. It returns nil if every candidate was claimed by
+// someone else in the meantime.
+func (r *Beskar7MachineReconciler) claimFirstAvailableHost(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, candidates []hostCandidate) (*infrastructurev1beta1.PhysicalHost, error) {
+	start := time.Now()
+	if len(candidates) == 0 {
+		metrics.RecordHostClaimAttempt(b7machine.Namespace, metrics.ClaimOutcomeNoHosts, metrics.ConflictReasonNone)
+		return nil, nil
+	}
+
+	for _, candidate := range candidates {
+		host, err := r.claimHost(ctx, logger, b7machine, candidate.host)
+		if err != nil {
+			metrics.RecordHostClaimAttempt(b7machine.Namespace, metrics.ClaimOutcomeError, metrics.ConflictReasonNone)
+			metrics.RecordHostClaimDuration(b7machine.Namespace, metrics.ClaimOutcomeError, time.Since(start))
+			return nil, err
+		}
+		if host != nil {
+			metrics.RecordHostClaimAttempt(b7machine.Namespace, metrics.ClaimOutcomeSuccess, metrics.ConflictReasonNone)
+			metrics.RecordHostClaimDuration(b7machine.Namespace, metrics.ClaimOutcomeSuccess, time.Since(start))
+			return host, nil
+		}
+	}
+
+	metrics.RecordHostClaimDuration(b7machine.Namespace, metrics.ClaimOutcomeConflict, time.Since(start))
+	return nil, nil
+}
+
+// claimHost sets the ConsumerRef of the host with a patch guarded by its resourceVersion,
+// so a concurrent claim by another machine fails instead of being overwritten. Conflicts
+// are retried against the latest version of the host for as long as it is still Available,
+// unclaimed and has no pending firmware update. It returns nil if the host was claimed by
+// someone else or can no longer be claimed.
+func (r *Beskar7MachineReconciler) claimHost(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, host *infrastructurev1beta1.PhysicalHost) (*infrastructurev1beta1.PhysicalHost, error) {
+	host = host.DeepCopy()
+	claimed := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if isClaimedBy(host, b7machine) {
+			claimed = true
+			return nil
+		}
+		if host.Spec.ConsumerRef != nil {
+			logger.Info("PhysicalHost was claimed by another machine", "host", host.Name, "consumer", host.Spec.ConsumerRef.Name)
+			metrics.RecordHostClaimAttempt(b7machine.Namespace, metrics.ClaimOutcomeConflict, metrics.ConflictReasonAlreadyClaimed)
+			return nil
+		}
+		if host.Status.State != infrastructurev1beta1.StateAvailable {
+			logger.Info("PhysicalHost is no longer available", "host", host.Name, "state", host.Status.State)
+			metrics.RecordHostClaimAttempt(b7machine.Namespace, metrics.ClaimOutcomeConflict, metrics.ConflictReasonInvalidState)
+			return nil
+		}
+		if firmwareUpdateRequested(host) {
+			// The PhysicalHost controller is about to move the host to Updating
+			logger.Info("PhysicalHost has a pending firmware update", "host", host.Name)
+			metrics.RecordHostClaimAttempt(b7machine.Namespace, metrics.ClaimOutcomeConflict, metrics.ConflictReasonInvalidState)
+			return nil
+		}
+
+		original := host.DeepCopy()
+		host.Spec.ConsumerRef = consumerRefFor(b7machine)
+		if err := r.Patch(ctx, host, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+			if !apierrors.IsConflict(err) {
+				return err
+			}
+			logger.Info("Conflict while claiming PhysicalHost, retrying with latest version", "host", host.Name)
+			metrics.RecordHostClaimAttempt(b7machine.Namespace, metrics.ClaimOutcomeConflict, metrics.ConflictReasonOptimisticLock)
+			if getErr := r.Get(ctx, client.ObjectKeyFromObject(host), host); getErr != nil {
+				return getErr
+			}
+			return err
+		}
+		claimed = true
+		return nil
+	})
+	if apierrors.IsConflict(err) {
+		// Still contended after all retries, leave this host to the other claimant
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim PhysicalHost %s: %w", host.Name, err)
+	}
+	if !claimed {
+		return nil, nil
+	}
+
+	logger.Info("Claimed PhysicalHost", "host", host.Name)
+	return host, nil
+}
+
+// releaseHost clears the ConsumerRef of a host claimed by the machine, guarded by the
+// host's resourceVersion. Hosts claimed by other machines are left untouched.
+func (r *Beskar7MachineReconciler) releaseHost(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, host *infrastructurev1beta1.PhysicalHost) error {
+	host = host.DeepCopy()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !isClaimedBy(host, b7machine) {
+			if host.Spec.ConsumerRef != nil {
+				logger.Info("PhysicalHost is claimed by another machine, not releasing", "host", host.Name, "consumer", host.Spec.ConsumerRef.Name)
+			}
+			return nil
+		}
+
+		original := host.DeepCopy()
+		host.Spec.ConsumerRef = nil
+		if err := r.Patch(ctx, host, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+			if apierrors.IsConflict(err) {
+				if getErr := r.Get(ctx, client.ObjectKeyFromObject(host), host); getErr != nil {
+					return client.IgnoreNotFound(getErr)
+				}
+			}
+			return client.IgnoreNotFound(err)
+		}
+		logger.Info("Released PhysicalHost", "host", host.Name)
+		return nil
+	})
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	conditions "sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+var _ = Describe("Host claiming", func() {
+	var (
+		testNs     *corev1.Namespace
+		reconciler *Beskar7MachineReconciler
+	)
+
+	newMachine := func(name string) *infrastructurev1beta1.Beskar7Machine {
+		b7machine := &infrastructurev1beta1.Beskar7Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.Beskar7MachineSpec{
+				InspectionImageURL: "http://boot-server/ipxe/inspect.ipxe",
+				TargetImageURL:     "http://boot-server/images/kairos.tar.gz",
+			},
+		}
+		Expect(k8sClient.Create(ctx, b7machine)).To(Succeed())
+		return b7machine
+	}
+
+	newAvailableHost := func(name string) *infrastructurev1beta1.PhysicalHost {
+		host := &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				RedfishConnection: infrastructurev1beta1.RedfishConnection{
+					Address:              "https://192.168.1.100",
+					CredentialsSecretRef: "test-bmc-creds",
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, host)).To(Succeed())
+		host.Status.State = infrastructurev1beta1.StateAvailable
+		Expect(k8sClient.Status().Update(ctx, host)).To(Succeed())
+		return host
+	}
+
+	getHost := func(name string) *infrastructurev1beta1.PhysicalHost {
+		host := &infrastructurev1beta1.PhysicalHost{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: testNs.Name, Name: name}, host)).To(Succeed())
+		return host
+	}
+
+	BeforeEach(func() {
+		testNs = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "host-claim-test-"},
+		}
+		Expect(k8sClient.Create(ctx, testNs)).To(Succeed())
+		reconciler = &Beskar7MachineReconciler{
+			Client: k8sClient,
+			Scheme: k8sClient.Scheme(),
+			Log:    ctrl.Log.WithName("host-claim-test"),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, testNs)).To(Succeed())
+	})
+
+	It("should match claims by UID rather than name", func() {
+		b7machine := newMachine("worker-0")
+		host := &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNs.Name},
+			Spec:       infrastructurev1beta1.PhysicalHostSpec{ConsumerRef: consumerRefFor(b7machine)},
+		}
+		Expect(isClaimedBy(host, b7machine)).To(BeTrue())
+
+		recreated := b7machine.DeepCopy()
+		recreated.UID = "another-uid"
+		Expect(isClaimedBy(host, recreated)).To(BeFalse())
+	})
+
+	It("should not let a stale candidate list steal a claimed host", func() {
+		first := newMachine("worker-0")
+		second := newMachine("worker-1")
+		newAvailableHost("host-0")
+
+		// Both machines see the host as Available before either claims it
+		stale := getHost("host-0")
+		claimed, err := reconciler.claimFirstAvailableHost(ctx, reconciler.Log, first, []hostCandidate{{host: getHost("host-0")}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claimed).NotTo(BeNil())
+
+		claimed, err = reconciler.claimFirstAvailableHost(ctx, reconciler.Log, second, []hostCandidate{{host: stale}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claimed).To(BeNil())
+		Expect(getHost("host-0").Spec.ConsumerRef.UID).To(Equal(first.UID))
+	})
+
+	It("should fall through to the next candidate when the first was taken", func() {
+		first := newMachine("worker-0")
+		second := newMachine("worker-1")
+		newAvailableHost("host-0")
+		newAvailableHost("host-1")
+
+		stale := []hostCandidate{{host: getHost("host-0")}, {host: getHost("host-1")}}
+		_, err := reconciler.claimFirstAvailableHost(ctx, reconciler.Log, first, stale[:1])
+		Expect(err).NotTo(HaveOccurred())
+
+		claimed, err := reconciler.claimFirstAvailableHost(ctx, reconciler.Log, second, stale)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claimed).NotTo(BeNil())
+		Expect(claimed.Name).To(Equal("host-1"))
+		Expect(getHost("host-1").Spec.ConsumerRef.UID).To(Equal(second.UID))
+	})
+
+	It("should not claim a host whose firmware update was requested after it was listed", func() {
+		b7machine := newMachine("worker-0")
+		newAvailableHost("host-0")
+
+		stale := getHost("host-0")
+		host := getHost("host-0")
+		host.Spec.FirmwareUpdate = &infrastructurev1beta1.FirmwareUpdate{ImageURI: "http://images.example.com/bios.bin"}
+		Expect(k8sClient.Update(ctx, host)).To(Succeed())
+
+		claimed, err := reconciler.claimFirstAvailableHost(ctx, reconciler.Log, b7machine, []hostCandidate{{host: stale}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claimed).To(BeNil())
+		Expect(getHost("host-0").Spec.ConsumerRef).To(BeNil())
+	})
+
+	It("should release an inspected host that does not meet the hardware requirements", func() {
+		b7machine := newMachine("worker-0")
+		b7machine.Spec.HardwareRequirements = &infrastructurev1beta1.HardwareRequirements{MinCPUCores: 32}
+		host := newAvailableHost("host-0")
+		patched := host.DeepCopy()
+		patched.Spec.ConsumerRef = consumerRefFor(b7machine)
+		Expect(k8sClient.Patch(ctx, patched, client.MergeFrom(host))).To(Succeed())
+
+		inspected := getHost("host-0")
+		inspected.Status.State = infrastructurev1beta1.StateInspecting
+		inspected.Status.InspectionPhase = infrastructurev1beta1.InspectionPhaseComplete
+		inspected.Status.InspectionReport = &infrastructurev1beta1.InspectionReport{
+			CPUs: []infrastructurev1beta1.CPUInfo{{ID: "0", Cores: 16}},
+		}
+		Expect(k8sClient.Status().Update(ctx, inspected)).To(Succeed())
+
+		result, err := reconciler.validateInspectionReport(ctx, reconciler.Log, b7machine, getHost("host-0"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Requeue).To(BeTrue())
+		Expect(getHost("host-0").Spec.ConsumerRef).To(BeNil())
+		Expect(conditions.GetReason(b7machine, infrastructurev1beta1.InfrastructureReadyCondition)).
+			To(Equal(infrastructurev1beta1.HardwareRequirementsNotMetReason))
+
+		// The released host is not selected for the machine again
+		Expect(selectHostCandidates(b7machine, []infrastructurev1beta1.PhysicalHost{*getHost("host-0")})).To(BeEmpty())
+	})
+
+	It("should only release hosts claimed by the machine", func() {
+		owner := newMachine("worker-0")
+		host := newAvailableHost("host-0")
+		patched := host.DeepCopy()
+		patched.Spec.ConsumerRef = consumerRefFor(owner)
+		Expect(k8sClient.Patch(ctx, patched, client.MergeFrom(host))).To(Succeed())
+
+		impostor := owner.DeepCopy()
+		impostor.UID = "another-uid"
+		Expect(reconciler.releaseHost(ctx, reconciler.Log, impostor, getHost("host-0"))).To(Succeed())
+		Expect(getHost("host-0").Spec.ConsumerRef).NotTo(BeNil())
+
+		Expect(reconciler.releaseHost(ctx, reconciler.Log, owner, getHost("host-0"))).To(Succeed())
+		Expect(getHost("host-0").Spec.ConsumerRef).To(BeNil())
+	})
+})
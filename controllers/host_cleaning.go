@@ -0,0 +1,298 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+	"github.com/wrkode/beskar7/internal/security"
+)
+
+// DefaultCleaningTimeout is how long the cleaning image may take to report back
+// before the host is moved to Error, unless the host sets spec.cleaningTimeout.
+const DefaultCleaningTimeout = time.Hour
+
+// cleaningModeFor returns the cleaning mode of the host, defaulting to MetadataOnly.
+func cleaningModeFor(host *infrastructurev1beta1.PhysicalHost) infrastructurev1beta1.CleaningMode {
+	if host.Spec.CleaningMode == "" {
+		return infrastructurev1beta1.CleaningModeMetadataOnly
+	}
+	return host.Spec.CleaningMode
+}
+
+// needsCleaning reports whether a released host has to be wiped before it becomes
+// Available. Hosts that were never handed the target image have nothing to wipe.
+func needsCleaning(host *infrastructurev1beta1.PhysicalHost) bool {
+	return cleaningModeFor(host) != infrastructurev1beta1.CleaningModeNone &&
+		host.Status.TargetImageServed
+}
+
+// cleaningFailed reports whether the host is in Error because cleaning failed.
+func cleaningFailed(host *infrastructurev1beta1.PhysicalHost) bool {
+	return host.Status.State == infrastructurev1beta1.StateError &&
+		(host.Status.CleaningPhase == infrastructurev1beta1.CleaningPhaseFailed ||
+			host.Status.CleaningPhase == infrastructurev1beta1.CleaningPhaseTimeout)
+}
+
+// cleaningImageInserted reports whether the cleaning ISO image is inserted into the host
+// while it is being wiped.
+func cleaningImageInserted(host *infrastructurev1beta1.PhysicalHost) bool {
+	return host.Status.State == infrastructurev1beta1.StateCleaning &&
+		host.Status.CleaningPhase == infrastructurev1beta1.CleaningPhaseWiping &&
+		host.Status.VirtualMediaImage != "" &&
+		host.Status.VirtualMediaImage == host.Spec.CleaningImageURL
+}
+
+// reconcileUnclaimed moves a host without a consumer towards Available, cleaning it
+// first if the previous consumer installed the target OS. Available hosts apply the
+// firmware update requested in their spec. The caller persists the status.
+func (r *PhysicalHostReconciler) reconcileUnclaimed(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
+	// Finish the power action in progress before moving the host on. One the host did
+	// not complete in time is started over by the step that needs it.
+	if physicalHost.Status.PowerAction != nil {
+		done, err := continuePowerAction(ctx, logger, rfClient, physicalHost, r.powerActionOptions())
+		if err != nil {
+			logger.Error(err, "Failed to continue power action of released host")
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+		}
+	}
+
+	// Never leave the previous consumer's ISO image inserted, the host would boot it
+	// again. Only the cleaning image stays inserted while it wipes the host.
+	if !cleaningImageInserted(physicalHost) {
+		if err := ejectHostVirtualMedia(ctx, logger, rfClient, physicalHost); err != nil {
+			logger.Error(err, "Failed to eject virtual media of released host")
+			return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+		}
+	}
+	// Nor its disk boot override, the host has to network boot for cleaning and the next
+	// consumer's inspection
+	if err := clearHostBootOverride(ctx, logger, rfClient, physicalHost); err != nil {
+		logger.Error(err, "Failed to clear boot override of released host")
+		return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+	}
+
+	switch {
+	case physicalHost.Status.State == infrastructurev1beta1.StateAvailable:
+		if firmwareUpdateRequested(physicalHost) {
+			return r.startFirmwareUpdate(logger, physicalHost), nil
+		}
+		if physicalHost.Spec.FirmwareUpdate == nil {
+			conditions.Delete(physicalHost, infrastructurev1beta1.FirmwareUpdatedCondition)
+		}
+		return ctrl.Result{}, nil
+
+	case physicalHost.Status.State == infrastructurev1beta1.StateCleaning:
+		return r.reconcileCleaning(ctx, logger, rfClient, physicalHost)
+
+	case physicalHost.Status.State == infrastructurev1beta1.StateUpdating:
+		return r.reconcileFirmwareUpdate(ctx, logger, rfClient, physicalHost)
+
+	case firmwareUpdateFailed(physicalHost):
+		if !retryDue(physicalHost) {
+			return waitForRetry(logger, physicalHost), nil
+		}
+		startRetry(physicalHost)
+		logger.Info("Retrying firmware update of host in Error", "retryCount", physicalHost.Status.RetryCount)
+		return r.startFirmwareUpdate(logger, physicalHost), nil
+
+	case cleaningFailed(physicalHost) && cleaningModeFor(physicalHost) != infrastructurev1beta1.CleaningModeNone:
+		// A host that could not be wiped is never handed to a new consumer, only
+		// cleaned again
+		if !retryDue(physicalHost) {
+			return waitForRetry(logger, physicalHost), nil
+		}
+		startRetry(physicalHost)
+		logger.Info("Retrying cleaning of host in Error", "retryCount", physicalHost.Status.RetryCount)
+		return r.startCleaning(ctx, physicalHost)
+
+	case needsCleaning(physicalHost):
+		mode := cleaningModeFor(physicalHost)
+		if physicalHost.Spec.CleaningImageURL == "" {
+			logger.Info("Host cannot be cleaned without a cleaning image", "cleaningMode", mode)
+			failHost(physicalHost, infrastructurev1beta1.MissingCleaningImageReason,
+				fmt.Sprintf("cleaningImageURL is required for cleaning mode %s", mode))
+			return ctrl.Result{}, nil
+		}
+		logger.Info("Host released, starting cleaning", "cleaningMode", mode)
+		return r.startCleaning(ctx, physicalHost)
+
+	default:
+		if physicalHost.Status.TargetImageServed {
+			// Do not leave the previous consumer's OS running
+			done, err := powerOffHost(ctx, logger, rfClient, physicalHost, r.powerActionOptions())
+			if err != nil {
+				logger.Error(err, "Failed to power off released host")
+			} else if !done {
+				return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+			}
+		}
+		logger.Info("Host available, transitioning to Available")
+		r.markAvailable(physicalHost)
+		return ctrl.Result{}, nil
+	}
+}
+
+// reconcileCleaning boots the cleaning image and waits for it to report back.
+func (r *PhysicalHostReconciler) reconcileCleaning(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
+	logger = logger.WithValues("cleaningPhase", physicalHost.Status.CleaningPhase)
+
+	switch physicalHost.Status.CleaningPhase {
+	case infrastructurev1beta1.CleaningPhaseComplete:
+		done, err := powerOffHost(ctx, logger, rfClient, physicalHost, r.powerActionOptions())
+		if err != nil {
+			logger.Error(err, "Failed to power off cleaned host")
+			return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+		}
+		logger.Info("Host cleaned and powered off, transitioning to Available")
+		r.markAvailable(physicalHost)
+		return ctrl.Result{}, nil
+
+	case infrastructurev1beta1.CleaningPhaseFailed:
+		logger.Info("Host cleaning failed", "errorMessage", physicalHost.Status.ErrorMessage)
+		failHost(physicalHost, infrastructurev1beta1.CleaningFailedReason, physicalHost.Status.ErrorMessage)
+		return waitForRetry(logger, physicalHost), nil
+	}
+
+	// Check for timeout
+	if physicalHost.Status.CleaningTimestamp != nil {
+		elapsed := time.Since(physicalHost.Status.CleaningTimestamp.Time)
+		if elapsed > cleaningTimeoutFor(physicalHost) {
+			logger.Info("Cleaning timeout", "elapsed", elapsed)
+			physicalHost.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseTimeout
+			physicalHost.Status.CleaningTokenHash = ""
+			failHost(physicalHost, infrastructurev1beta1.CleaningTimeoutReason,
+				fmt.Sprintf("Cleaning timeout after %v", elapsed.Round(time.Second)))
+			return waitForRetry(logger, physicalHost), nil
+		}
+	}
+
+	if physicalHost.Status.CleaningPhase == infrastructurev1beta1.CleaningPhaseBooting {
+		if err := r.bootCleaningImage(ctx, logger, rfClient, physicalHost); err != nil {
+			logger.Error(err, "Failed to boot cleaning image")
+			return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+		}
+		logger.Info("Booting cleaning image", "cleaningMode", cleaningModeFor(physicalHost), "bootMethod", cleaningBootMethodFor(physicalHost))
+		physicalHost.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseWiping
+	}
+
+	return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+}
+
+// startCleaning moves the host to Cleaning and mints the token the cleaning image
+// reports back with. The cleaning image is only booted once the Cleaning state has been
+// persisted, so the boot script handler serves it.
+func (r *PhysicalHostReconciler) startCleaning(ctx context.Context, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
+	if err := mintCleaningToken(ctx, r.Client, r.Scheme, physicalHost); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.updateStatus(physicalHost, infrastructurev1beta1.StateCleaning, false, "")
+	physicalHost.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseBooting
+	now := metav1.Now()
+	physicalHost.Status.CleaningTimestamp = &now
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// cleaningTokenKind names the handoff Secret of the cleaning token.
+const cleaningTokenKind = "cleaning"
+
+// mintCleaningToken generates the one-time token the cleaning image must present when
+// reporting the wipe result. The plain token is stored in a Secret owned by the host,
+// from which the boot script handler hands it out; only its hash is recorded in the
+// host status. The caller is responsible for persisting the host status.
+func mintCleaningToken(ctx context.Context, c client.Client, scheme *runtime.Scheme, host *infrastructurev1beta1.PhysicalHost) error {
+	token, hash, err := security.GenerateToken()
+	if err != nil {
+		return err
+	}
+	if err := storeHostToken(ctx, c, scheme, host, cleaningTokenKind, token); err != nil {
+		return err
+	}
+	host.Status.CleaningTokenHash = hash
+	return nil
+}
+
+// getCleaningToken returns the plain cleaning token of the host, or an empty string if
+// none has been minted or it has already been used.
+func getCleaningToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) (string, error) {
+	return getHostToken(ctx, c, host, cleaningTokenKind)
+}
+
+// takeCleaningToken returns the plain cleaning token of the host if it has not been
+// handed out yet, and removes it so it is not handed out again.
+func takeCleaningToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) (string, error) {
+	return takeHostToken(ctx, c, host, cleaningTokenKind)
+}
+
+// deleteCleaningToken removes the handoff Secret of a used cleaning token.
+func deleteCleaningToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) error {
+	return deleteHostToken(ctx, c, host, cleaningTokenKind)
+}
+
+// markAvailable moves the host to Available and resets the progress of the previous
+// consumer.
+func (r *PhysicalHostReconciler) markAvailable(physicalHost *infrastructurev1beta1.PhysicalHost) {
+	r.updateStatus(physicalHost, infrastructurev1beta1.StateAvailable, true, "")
+	conditions.MarkTrue(physicalHost, infrastructurev1beta1.HostAvailableCondition)
+	physicalHost.Status.ProvisioningPhase = ""
+	physicalHost.Status.ProvisioningTimestamp = nil
+	physicalHost.Status.TargetImageServed = false
+	physicalHost.Status.ProvisioningTokenHash = ""
+	physicalHost.Status.BootstrapTokenHash = ""
+	physicalHost.Status.InspectionToken = nil
+	physicalHost.Status.BootstrapDataTimestamp = nil
+	physicalHost.Status.CleaningPhase = ""
+	physicalHost.Status.CleaningTimestamp = nil
+	physicalHost.Status.CleaningTokenHash = ""
+	physicalHost.Status.BootMethod = ""
+	resetRetries(physicalHost)
+}
+
+// bootCleaningImage makes the host boot the cleaning image with the boot method of its
+// last consumer and starts restarting it, giving the previous consumer's OS the chance
+// to shut down gracefully. The caller persists the host status.
+func (r *PhysicalHostReconciler) bootCleaningImage(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost) error {
+	bootScriptURL := hostBootScriptURL(r.BootScriptURL, physicalHost)
+	if err := setHostBootImage(ctx, logger, rfClient, physicalHost, cleaningBootMethodFor(physicalHost), physicalHost.Spec.CleaningImageURL, bootScriptURL); err != nil {
+		return err
+	}
+	_, err := startPowerAction(ctx, logger, rfClient, physicalHost, internalredfish.PowerOperationRestart, r.powerActionOptions())
+	return err
+}
+
+// powerOffHost starts shutting the host down, it is forced off on a later reconcile if
+// it does not shut down gracefully in time. It reports whether the host is off. The
+// caller persists the host status.
+func powerOffHost(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost, opts internalredfish.PowerActionOptions) (bool, error) {
+	return startPowerAction(ctx, logger, rfClient, physicalHost, internalredfish.PowerOperationOff, opts)
+}
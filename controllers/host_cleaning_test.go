@@ -0,0 +1,290 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stmcginnis/gofish/redfish"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+	"github.com/wrkode/beskar7/internal/security"
+)
+
+var _ = Describe("Host cleaning", func() {
+	var (
+		host         *infrastructurev1beta1.PhysicalHost
+		mockRfClient *internalredfish.MockClient
+		reconciler   *PhysicalHostReconciler
+	)
+
+	reconcileUnclaimed := func() ctrl.Result {
+		result, err := reconciler.reconcileUnclaimed(ctx, reconciler.Log, mockRfClient, host)
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	// finishPowerAction reconciles the host until the power action in progress completes
+	finishPowerAction := func() {
+		for range 5 {
+			if host.Status.PowerAction == nil {
+				return
+			}
+			reconcileUnclaimed()
+		}
+		Expect(host.Status.PowerAction).To(BeNil())
+	}
+
+	BeforeEach(func() {
+		// A host whose consumer installed the target OS and then released it
+		host = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				CleaningImageURL: "http://boot-server/ipxe/clean.ipxe",
+			},
+			Status: infrastructurev1beta1.PhysicalHostStatus{
+				State:             infrastructurev1beta1.StateReady,
+				ProvisioningPhase: infrastructurev1beta1.ProvisioningPhaseProvisioned,
+				TargetImageServed: true,
+			},
+		}
+		mockRfClient = internalredfish.NewMockClient()
+		mockRfClient.PowerState = redfish.OnPowerState
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(infrastructurev1beta1.AddToScheme(scheme)).To(Succeed())
+		reconciler = &PhysicalHostReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme).Build(),
+			Scheme:   scheme,
+			Log:      ctrl.Log.WithName("host-cleaning-test"),
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	It("should clean a released host before it becomes Available", func() {
+		Expect(reconcileUnclaimed().Requeue).To(BeTrue())
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+		Expect(host.Status.CleaningPhase).To(Equal(infrastructurev1beta1.CleaningPhaseBooting))
+		Expect(mockRfClient.PowerActions).To(BeEmpty())
+
+		// The cleaning token is minted once, the boot script handler only hands it out
+		token, err := getCleaningToken(ctx, reconciler.Client, host)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(security.TokenMatchesHash(token, host.Status.CleaningTokenHash)).To(BeTrue())
+
+		Expect(reconcileUnclaimed().RequeueAfter).To(Equal(DefaultPollInterval))
+		Expect(host.Status.CleaningPhase).To(Equal(infrastructurev1beta1.CleaningPhaseWiping))
+		Expect(mockRfClient.BootSourceIsPXE).To(BeTrue())
+		// The previous consumer's OS is shut down gracefully before the cleaning image
+		// boots, the host is powered on again on a later reconcile
+		Expect(host.Status.PowerAction).NotTo(BeNil())
+		Expect(host.Status.PowerAction.Action).To(Equal(string(internalredfish.PowerOperationRestart)))
+		Expect(mockRfClient.PowerActions).To(Equal([]redfish.ResetType{redfish.GracefulShutdownResetType}))
+		finishPowerAction()
+		Expect(mockRfClient.PowerActions).To(Equal([]redfish.ResetType{
+			redfish.GracefulShutdownResetType, redfish.OnResetType,
+		}))
+
+		// Still wiping until the cleaning image reports back
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+
+		// The cleaned host is only Available once it is observed off
+		host.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseComplete
+		Expect(reconcileUnclaimed().RequeueAfter).To(Equal(DefaultPollInterval))
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+		finishPowerAction()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateAvailable))
+		Expect(host.Status.ProvisioningPhase).To(BeEmpty())
+		Expect(host.Status.TargetImageServed).To(BeFalse())
+		Expect(host.Status.CleaningPhase).To(BeEmpty())
+		Expect(mockRfClient.PowerState).To(Equal(redfish.OffPowerState))
+	})
+
+	It("should eject the previous consumer's virtual media before cleaning", func() {
+		host.Status.VirtualMediaImage = "http://boot-server/images/kairos.iso"
+		mockRfClient.VirtualMediaImage = host.Status.VirtualMediaImage
+
+		reconcileUnclaimed()
+		Expect(mockRfClient.EjectVirtualMediaCalled).To(BeTrue())
+		Expect(mockRfClient.VirtualMediaImage).To(BeEmpty())
+		Expect(host.Status.VirtualMediaImage).To(BeEmpty())
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+	})
+
+	It("should not release a host whose virtual media could not be ejected", func() {
+		host.Status.VirtualMediaImage = "http://boot-server/images/kairos.iso"
+		mockRfClient.ShouldFail["EjectVirtualMedia"] = fmt.Errorf("BMC busy")
+
+		Expect(reconcileUnclaimed().RequeueAfter).To(Equal(DefaultPollInterval))
+		Expect(host.Status.VirtualMediaImage).NotTo(BeEmpty())
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateReady))
+	})
+
+	It("should clear the previous consumer's disk boot override", func() {
+		host.Status.PersistentBootTarget = string(redfish.HddBootSourceOverrideTarget)
+		mockRfClient.BootOverrideTarget = redfish.HddBootSourceOverrideTarget
+		mockRfClient.BootOverrideEnabled = redfish.ContinuousBootSourceOverrideEnabled
+
+		reconcileUnclaimed()
+		Expect(mockRfClient.ClearBootOverrideCalled).To(BeTrue())
+		Expect(host.Status.PersistentBootTarget).To(BeEmpty())
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+
+		// The cleaning image is booted over PXE once
+		reconcileUnclaimed()
+		Expect(mockRfClient.BootOverrideTarget).To(Equal(redfish.PxeBootSourceOverrideTarget))
+		Expect(mockRfClient.BootOverrideEnabled).To(Equal(redfish.OnceBootSourceOverrideEnabled))
+	})
+
+	It("should boot the cleaning image with the boot method of the last consumer", func() {
+		host.Spec.CleaningImageURL = "http://boot-server/images/clean.iso"
+		host.Status.BootMethod = infrastructurev1beta1.BootMethodVirtualMedia
+		host.Status.VirtualMediaImage = "http://boot-server/images/kairos.iso"
+		mockRfClient.VirtualMediaImage = host.Status.VirtualMediaImage
+
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+		Expect(host.Status.VirtualMediaImage).To(BeEmpty())
+
+		reconcileUnclaimed()
+		Expect(host.Status.CleaningPhase).To(Equal(infrastructurev1beta1.CleaningPhaseWiping))
+		Expect(mockRfClient.VirtualMediaImage).To(Equal("http://boot-server/images/clean.iso"))
+		Expect(mockRfClient.BootSourceIsCD).To(BeTrue())
+		Expect(mockRfClient.SetBootSourcePXECalled).To(BeFalse())
+
+		// The cleaning image stays inserted while it wipes the host
+		finishPowerAction()
+		reconcileUnclaimed()
+		Expect(mockRfClient.VirtualMediaImage).To(Equal("http://boot-server/images/clean.iso"))
+
+		host.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseComplete
+		reconcileUnclaimed()
+		finishPowerAction()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateAvailable))
+		Expect(host.Status.VirtualMediaImage).To(BeEmpty())
+		Expect(host.Status.BootMethod).To(BeEmpty())
+		Expect(mockRfClient.VirtualMediaImage).To(BeEmpty())
+	})
+
+	It("should force off a released host that does not shut down gracefully", func() {
+		host.Spec.CleaningMode = infrastructurev1beta1.CleaningModeNone
+		mockRfClient.IgnoreGracefulShutdown = true
+
+		Expect(reconcileUnclaimed().RequeueAfter).To(Equal(DefaultPollInterval))
+		Expect(host.Status.PowerAction).NotTo(BeNil())
+		Expect(host.Status.PowerAction.ResetType).To(Equal(string(redfish.GracefulShutdownResetType)))
+
+		// The host is left alone until the graceful shutdown timeout expires
+		reconcileUnclaimed()
+		Expect(mockRfClient.PowerActions).To(Equal([]redfish.ResetType{redfish.GracefulShutdownResetType}))
+		Expect(host.Status.State).NotTo(Equal(infrastructurev1beta1.StateAvailable))
+
+		host.Status.PowerAction.Deadline = metav1.NewTime(time.Now().Add(-time.Second))
+		reconcileUnclaimed()
+		Expect(host.Status.PowerAction.ResetType).To(Equal(string(redfish.ForceOffResetType)))
+		finishPowerAction()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateAvailable))
+		Expect(mockRfClient.PowerState).To(Equal(redfish.OffPowerState))
+		Expect(mockRfClient.PowerActions).To(Equal([]redfish.ResetType{
+			redfish.GracefulShutdownResetType, redfish.ForceOffResetType,
+		}))
+	})
+
+	It("should only power off hosts with cleaning mode None", func() {
+		host.Spec.CleaningMode = infrastructurev1beta1.CleaningModeNone
+		reconcileUnclaimed()
+		finishPowerAction()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateAvailable))
+		Expect(host.Status.ObservedPowerState).To(Equal(string(redfish.OffPowerState)))
+		Expect(mockRfClient.PowerState).To(Equal(redfish.OffPowerState))
+	})
+
+	It("should not clean hosts that never received the target image", func() {
+		host.Status.ProvisioningPhase = ""
+		host.Status.TargetImageServed = false
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateAvailable))
+		Expect(mockRfClient.SetBootSourcePXECalled).To(BeFalse())
+	})
+
+	It("should clean hosts released before they reached the Provisioning phase", func() {
+		// The target image was handed out, but the host was released before the
+		// Provisioning phase was recorded
+		host.Status.ProvisioningPhase = ""
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+	})
+
+	It("should keep the host in Error without a cleaning image", func() {
+		host.Spec.CleaningImageURL = ""
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+		Expect(host.Status.ErrorMessage).To(ContainSubstring("cleaningImageURL"))
+
+		host.Spec.CleaningImageURL = "http://boot-server/ipxe/clean.ipxe"
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+	})
+
+	It("should move the host to Error when cleaning times out", func() {
+		started := metav1.NewTime(time.Now().Add(-DefaultCleaningTimeout - time.Minute))
+		host.Status.State = infrastructurev1beta1.StateCleaning
+		host.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseWiping
+		host.Status.CleaningTimestamp = &started
+
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+		Expect(host.Status.CleaningPhase).To(Equal(infrastructurev1beta1.CleaningPhaseTimeout))
+
+		// The host stays in Error rather than becoming Available
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+	})
+
+	It("should honour the cleaning timeout of the host", func() {
+		started := metav1.NewTime(time.Now().Add(-DefaultCleaningTimeout - time.Minute))
+		host.Spec.CleaningTimeout = &metav1.Duration{Duration: 8 * time.Hour}
+		host.Status.State = infrastructurev1beta1.StateCleaning
+		host.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseWiping
+		host.Status.CleaningTimestamp = &started
+
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+		Expect(host.Status.CleaningPhase).To(Equal(infrastructurev1beta1.CleaningPhaseWiping))
+	})
+
+	It("should move the host to Error when cleaning failed", func() {
+		host.Status.State = infrastructurev1beta1.StateCleaning
+		host.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseFailed
+		host.Status.ErrorMessage = "Cleaning failed: secure erase unsupported"
+
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+		Expect(host.Status.ErrorMessage).To(ContainSubstring("secure erase unsupported"))
+	})
+})
@@ -0,0 +1,184 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+// firmwareSettingsFor returns the BIOS attributes enforced on a host claimed by the
+// machine: those of the machine, overridden by those of the host.
+func firmwareSettingsFor(b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost) map[string]string {
+	if len(b7machine.Spec.FirmwareSettings) == 0 && len(physicalHost.Spec.FirmwareSettings) == 0 {
+		return nil
+	}
+	settings := make(map[string]string, len(b7machine.Spec.FirmwareSettings)+len(physicalHost.Spec.FirmwareSettings))
+	maps.Copy(settings, b7machine.Spec.FirmwareSettings)
+	maps.Copy(settings, physicalHost.Spec.FirmwareSettings)
+	return settings
+}
+
+// reconcileFirmwareSettings compares the BIOS attributes of the host with the desired
+// ones and stages those that differ, unless they are staged already. The BMC applies
+// staged attributes on the next reboot, which is up to the caller. The outcome is
+// reflected on the FirmwareSettingsApplied condition, where attributes that changed
+// after they were applied are reported as drifted. It returns the names of the
+// attributes that are not in effect yet; errors wrapping
+// internalredfish.ErrInvalidBIOSAttribute need a spec change. The caller persists the
+// host status.
+func reconcileFirmwareSettings(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost, desired map[string]string) ([]string, error) {
+	if len(desired) == 0 {
+		conditions.Delete(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition)
+		return nil, nil
+	}
+
+	settings, err := rfClient.GetBIOSSettings(ctx)
+	if err != nil {
+		conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition,
+			infrastructurev1beta1.FirmwareSettingsFailedReason, clusterv1.ConditionSeverityWarning,
+			"Failed to read BIOS settings: %v", err)
+		return nil, fmt.Errorf("failed to get BIOS settings: %w", err)
+	}
+
+	changes, err := settings.Changes(desired)
+	if err != nil {
+		conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition,
+			infrastructurev1beta1.InvalidFirmwareSettingsReason, clusterv1.ConditionSeverityError,
+			"%v", err)
+		return nil, err
+	}
+	if len(changes) == 0 {
+		if !conditions.IsTrue(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition) {
+			logger.Info("BIOS settings applied", "count", len(desired))
+		}
+		conditions.MarkTrue(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition)
+		return nil, nil
+	}
+
+	notApplied := slices.Sorted(maps.Keys(changes))
+	names := strings.Join(notApplied, ", ")
+	if !settings.IsPending(changes) {
+		if err := rfClient.SetBIOSAttributes(ctx, changes); err != nil {
+			conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition,
+				infrastructurev1beta1.FirmwareSettingsFailedReason, clusterv1.ConditionSeverityWarning,
+				"Failed to stage BIOS settings %s: %v", names, err)
+			return nil, fmt.Errorf("failed to stage BIOS settings: %w", err)
+		}
+		logger.Info("Staged BIOS settings for the next reboot", "attributes", names)
+	}
+
+	if conditions.IsTrue(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition) ||
+		conditions.GetReason(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition) == infrastructurev1beta1.FirmwareSettingsDriftedReason {
+		conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition,
+			infrastructurev1beta1.FirmwareSettingsDriftedReason, clusterv1.ConditionSeverityWarning,
+			"BIOS settings %s changed after they were applied, they are restored on the next reboot", names)
+	} else {
+		conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition,
+			infrastructurev1beta1.FirmwareSettingsPendingRebootReason, clusterv1.ConditionSeverityInfo,
+			"BIOS settings %s are applied on the next reboot", names)
+	}
+	return notApplied, nil
+}
+
+// reconcileClaimedFirmwareSettings keeps enforcing the firmware settings of the consumer
+// on a claimed host, so settings changed behind Beskar7's back, e.g. from the BIOS setup
+// or by a firmware update, are detected and staged again. The host is never rebooted for
+// it. Failures only show on the FirmwareSettingsApplied condition; the Beskar7Machine
+// controller decides whether they block provisioning. The caller persists the status.
+func (r *PhysicalHostReconciler) reconcileClaimedFirmwareSettings(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost) {
+	b7machine, err := getConsumerBeskar7Machine(ctx, r.Client, physicalHost)
+	if err != nil {
+		logger.Error(err, "Failed to get consumer to check BIOS settings")
+		return
+	}
+	if b7machine == nil {
+		return
+	}
+
+	wasApplied := conditions.IsTrue(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition)
+	notApplied, err := reconcileFirmwareSettings(ctx, logger, rfClient, physicalHost, firmwareSettingsFor(b7machine, physicalHost))
+	if err != nil {
+		logger.Error(err, "Failed to reconcile BIOS settings")
+		return
+	}
+	if wasApplied && len(notApplied) > 0 {
+		message := conditions.GetMessage(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition)
+		logger.Info("BIOS settings drifted", "message", message)
+		r.Recorder.Event(physicalHost, corev1.EventTypeWarning, infrastructurev1beta1.FirmwareSettingsDriftedReason, message)
+	}
+}
+
+// verifyFirmwareSettings checks that the inspection boot applied the firmware settings
+// staged before it, so the OS is never installed on a host without them. A host whose
+// settings are not in effect is moved to Error and retried with another inspection
+// boot, unless the settings are invalid. It reports whether provisioning may start.
+func (r *Beskar7MachineReconciler) verifyFirmwareSettings(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost) (bool, error) {
+	desired := firmwareSettingsFor(b7machine, physicalHost)
+	if len(desired) == 0 {
+		return true, nil
+	}
+
+	rfClient, err := r.getRedfishClientForHost(ctx, logger, physicalHost)
+	if err != nil {
+		return false, err
+	}
+	defer rfClient.Close(ctx)
+
+	notApplied, err := reconcileFirmwareSettings(ctx, logger, rfClient, physicalHost, desired)
+	if errors.Is(err, internalredfish.ErrInvalidBIOSAttribute) {
+		return false, r.failFirmwareSettings(ctx, logger, physicalHost, infrastructurev1beta1.InvalidFirmwareSettingsReason, err.Error())
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(notApplied) > 0 {
+		return false, r.failFirmwareSettings(ctx, logger, physicalHost, infrastructurev1beta1.FirmwareSettingsFailedReason,
+			fmt.Sprintf("BIOS settings %s were not applied by the inspection boot", strings.Join(notApplied, ", ")))
+	}
+	return true, nil
+}
+
+// failFirmwareSettings moves a host whose firmware settings cannot be applied to Error
+// and persists its status. Invalid settings are not retried automatically, since they
+// need a spec change.
+func (r *Beskar7MachineReconciler) failFirmwareSettings(ctx context.Context, logger logr.Logger, physicalHost *infrastructurev1beta1.PhysicalHost, reason, message string) error {
+	logger.Error(nil, "Firmware settings not applied", "reason", reason, "message", message)
+	severity := clusterv1.ConditionSeverityWarning
+	if reason == infrastructurev1beta1.InvalidFirmwareSettingsReason {
+		severity = clusterv1.ConditionSeverityError
+	}
+	conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition, reason, severity, "%s", message)
+	failHost(physicalHost, reason, message)
+	if err := r.Status().Update(ctx, physicalHost); err != nil {
+		logger.Error(err, "Failed to update PhysicalHost after firmware settings failure")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stmcginnis/gofish/redfish"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+var _ = Describe("Host firmware settings", func() {
+	var (
+		host         *infrastructurev1beta1.PhysicalHost
+		mockRfClient *internalredfish.MockClient
+		desired      map[string]string
+	)
+
+	logger := ctrl.Log.WithName("host-firmware-test")
+
+	BeforeEach(func() {
+		host = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"},
+		}
+		mockRfClient = internalredfish.NewMockClient()
+		mockRfClient.BIOSAttributes = map[string]interface{}{
+			"SriovGlobalEnable":  "Disabled",
+			"ProcVirtualization": "Enabled",
+			"IntelTxt":           false,
+		}
+		desired = map[string]string{"SriovGlobalEnable": "Enabled", "ProcVirtualization": "Enabled"}
+	})
+
+	It("should let host settings override those of the machine", func() {
+		b7machine := &infrastructurev1beta1.Beskar7Machine{}
+		Expect(firmwareSettingsFor(b7machine, host)).To(BeNil())
+
+		b7machine.Spec.FirmwareSettings = map[string]string{"SriovGlobalEnable": "Enabled", "SysProfile": "PerfOptimized"}
+		host.Spec.FirmwareSettings = map[string]string{"SysProfile": "Custom"}
+		Expect(firmwareSettingsFor(b7machine, host)).To(Equal(map[string]string{
+			"SriovGlobalEnable": "Enabled",
+			"SysProfile":        "Custom",
+		}))
+		Expect(b7machine.Spec.FirmwareSettings).To(HaveKeyWithValue("SysProfile", "PerfOptimized"))
+	})
+
+	It("should stage changed settings and report them applied after a reboot", func() {
+		notApplied, err := reconcileFirmwareSettings(ctx, logger, mockRfClient, host, desired)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notApplied).To(Equal([]string{"SriovGlobalEnable"}))
+		Expect(mockRfClient.PendingBIOSAttributes).To(Equal(map[string]interface{}{"SriovGlobalEnable": "Enabled"}))
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).
+			To(Equal(infrastructurev1beta1.FirmwareSettingsPendingRebootReason))
+
+		Expect(mockRfClient.PowerAction(ctx, redfish.OnResetType)).To(Succeed())
+
+		notApplied, err = reconcileFirmwareSettings(ctx, logger, mockRfClient, host, desired)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notApplied).To(BeEmpty())
+		Expect(conditions.IsTrue(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).To(BeTrue())
+	})
+
+	It("should not stage settings again while they are pending", func() {
+		mockRfClient.PendingBIOSAttributes = map[string]interface{}{"SriovGlobalEnable": "Enabled"}
+
+		notApplied, err := reconcileFirmwareSettings(ctx, logger, mockRfClient, host, desired)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notApplied).To(Equal([]string{"SriovGlobalEnable"}))
+		Expect(mockRfClient.SetBIOSAttributesCalled).To(BeFalse())
+	})
+
+	It("should report settings changed after they were applied as drifted", func() {
+		mockRfClient.BIOSAttributes["SriovGlobalEnable"] = "Enabled"
+		_, err := reconcileFirmwareSettings(ctx, logger, mockRfClient, host, desired)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conditions.IsTrue(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).To(BeTrue())
+
+		// Changed from the BIOS setup
+		mockRfClient.BIOSAttributes["SriovGlobalEnable"] = "Disabled"
+		notApplied, err := reconcileFirmwareSettings(ctx, logger, mockRfClient, host, desired)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notApplied).To(Equal([]string{"SriovGlobalEnable"}))
+		Expect(mockRfClient.PendingBIOSAttributes).To(HaveKeyWithValue("SriovGlobalEnable", "Enabled"))
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).
+			To(Equal(infrastructurev1beta1.FirmwareSettingsDriftedReason))
+
+		// Still drifted until the next reboot restores them
+		_, err = reconcileFirmwareSettings(ctx, logger, mockRfClient, host, desired)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).
+			To(Equal(infrastructurev1beta1.FirmwareSettingsDriftedReason))
+	})
+
+	It("should record drift of a claimed host with the reconciler the manager runs", func() {
+		testNs := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "host-firmware-test-"}}
+		Expect(k8sClient.Create(ctx, testNs)).To(Succeed())
+		DeferCleanup(func() { Expect(k8sClient.Delete(ctx, testNs)).To(Succeed()) })
+		b7machine := &infrastructurev1beta1.Beskar7Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: testNs.Name},
+			Spec:       infrastructurev1beta1.Beskar7MachineSpec{FirmwareSettings: desired},
+		}
+		Expect(k8sClient.Create(ctx, b7machine)).To(Succeed())
+		host.Namespace = testNs.Name
+		host.Spec.ConsumerRef = consumerRefFor(b7machine)
+
+		reconciler := newManagedPhysicalHostReconciler()
+		// Read the consumer through the test client, the manager's cache is never started
+		reconciler.Client = k8sClient
+
+		mockRfClient.BIOSAttributes["SriovGlobalEnable"] = "Enabled"
+		reconciler.reconcileClaimedFirmwareSettings(ctx, logger, mockRfClient, host)
+		Expect(conditions.IsTrue(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).To(BeTrue())
+
+		mockRfClient.BIOSAttributes["SriovGlobalEnable"] = "Disabled"
+		reconciler.reconcileClaimedFirmwareSettings(ctx, logger, mockRfClient, host)
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).
+			To(Equal(infrastructurev1beta1.FirmwareSettingsDriftedReason))
+	})
+
+	It("should reject settings the host does not have", func() {
+		desired["IntelVtd"] = "Enabled"
+
+		_, err := reconcileFirmwareSettings(ctx, logger, mockRfClient, host, desired)
+		Expect(err).To(MatchError(internalredfish.ErrInvalidBIOSAttribute))
+		Expect(mockRfClient.SetBIOSAttributesCalled).To(BeFalse())
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).
+			To(Equal(infrastructurev1beta1.InvalidFirmwareSettingsReason))
+		Expect(isRetryableFailure(infrastructurev1beta1.InvalidFirmwareSettingsReason)).To(BeFalse())
+	})
+
+	It("should report settings that could not be staged", func() {
+		mockRfClient.ShouldFail["SetBIOSAttributes"] = fmt.Errorf("settings object locked by a running job")
+
+		_, err := reconcileFirmwareSettings(ctx, logger, mockRfClient, host, desired)
+		Expect(err).To(HaveOccurred())
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).
+			To(Equal(infrastructurev1beta1.FirmwareSettingsFailedReason))
+	})
+
+	It("should drop the condition when no settings are enforced", func() {
+		conditions.MarkTrue(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)
+
+		notApplied, err := reconcileFirmwareSettings(ctx, logger, mockRfClient, host, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notApplied).To(BeEmpty())
+		Expect(conditions.Has(host, infrastructurev1beta1.FirmwareSettingsAppliedCondition)).To(BeFalse())
+		Expect(mockRfClient.GetBIOSSettingsCalled).To(BeFalse())
+	})
+})
@@ -0,0 +1,237 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+// DefaultFirmwareUpdateTimeout is how long the BMC may take to apply a firmware update
+// before the host is moved to Error.
+const DefaultFirmwareUpdateTimeout = 2 * time.Hour
+
+// firmwareInventoryFor converts the firmware inventory reported by the BMC to its API
+// representation.
+func firmwareInventoryFor(inventory []internalredfish.FirmwareComponent) []infrastructurev1beta1.FirmwareComponent {
+	if len(inventory) == 0 {
+		return nil
+	}
+	components := make([]infrastructurev1beta1.FirmwareComponent, 0, len(inventory))
+	for _, component := range inventory {
+		components = append(components, infrastructurev1beta1.FirmwareComponent{
+			ID:         component.ID,
+			Name:       component.Name,
+			Version:    component.Version,
+			Updateable: component.Updateable,
+		})
+	}
+	return components
+}
+
+// firmwareUpdateRequested reports whether the host has a firmware update in its spec
+// that was not started yet. An update is only started once per image and target.
+func firmwareUpdateRequested(host *infrastructurev1beta1.PhysicalHost) bool {
+	update := host.Spec.FirmwareUpdate
+	if update == nil {
+		return false
+	}
+	status := host.Status.FirmwareUpdate
+	return status == nil || status.ImageURI != update.ImageURI || status.Target != update.Target
+}
+
+// firmwareUpdateFailed reports whether the host is in Error because its firmware update
+// failed and the update is still requested.
+func firmwareUpdateFailed(host *infrastructurev1beta1.PhysicalHost) bool {
+	last := lastHostFailure(host)
+	return last != nil && host.Spec.FirmwareUpdate != nil &&
+		(last.Reason == infrastructurev1beta1.FirmwareUpdateFailedReason ||
+			last.Reason == infrastructurev1beta1.InvalidFirmwareUpdateReason)
+}
+
+// deferFirmwareUpdate reports a firmware update requested for a claimed host as waiting
+// for the host to be released; firmware is never updated under a consumer.
+func deferFirmwareUpdate(physicalHost *infrastructurev1beta1.PhysicalHost) {
+	if !firmwareUpdateRequested(physicalHost) {
+		return
+	}
+	conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareUpdatedCondition,
+		infrastructurev1beta1.FirmwareUpdateDeferredReason, clusterv1.ConditionSeverityInfo,
+		"Firmware update waits until the host is released")
+}
+
+// startFirmwareUpdate moves the host to Updating for the firmware update in its spec.
+// The update is only handed to the BMC once the Updating state has been persisted, so
+// the host cannot be claimed while it runs.
+func (r *PhysicalHostReconciler) startFirmwareUpdate(logger logr.Logger, physicalHost *infrastructurev1beta1.PhysicalHost) ctrl.Result {
+	update := physicalHost.Spec.FirmwareUpdate
+	logger.Info("Starting firmware update", "imageURI", update.ImageURI, "target", update.Target)
+	r.updateStatus(physicalHost, infrastructurev1beta1.StateUpdating, false, "")
+	now := metav1.Now()
+	physicalHost.Status.FirmwareUpdate = &infrastructurev1beta1.FirmwareUpdateStatus{
+		ImageURI:  update.ImageURI,
+		Target:    update.Target,
+		Phase:     infrastructurev1beta1.FirmwareUpdatePhasePending,
+		StartTime: &now,
+	}
+	conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareUpdatedCondition,
+		infrastructurev1beta1.FirmwareUpdateInProgressReason, clusterv1.ConditionSeverityInfo,
+		"Updating firmware from %s", update.ImageURI)
+	return ctrl.Result{Requeue: true}
+}
+
+// reconcileFirmwareUpdate hands the firmware update to the BMC and follows its task to
+// completion. The host becomes Available again once the update completed, or moves to
+// Error if it failed. The caller persists the status.
+func (r *PhysicalHostReconciler) reconcileFirmwareUpdate(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost) (ctrl.Result, error) {
+	status := physicalHost.Status.FirmwareUpdate
+	if status == nil {
+		// Nothing to track, e.g. the status was reset by hand
+		logger.Info("No firmware update to track, transitioning to Available")
+		r.markAvailable(physicalHost)
+		return ctrl.Result{}, nil
+	}
+	logger = logger.WithValues("imageURI", status.ImageURI, "target", status.Target)
+
+	if status.StartTime != nil {
+		elapsed := time.Since(status.StartTime.Time)
+		if elapsed > DefaultFirmwareUpdateTimeout {
+			r.failFirmwareUpdate(logger, physicalHost, infrastructurev1beta1.FirmwareUpdateFailedReason,
+				fmt.Sprintf("Firmware update timeout after %v", elapsed.Round(time.Second)))
+			return waitForRetry(logger, physicalHost), nil
+		}
+	}
+
+	if status.Phase == infrastructurev1beta1.FirmwareUpdatePhasePending {
+		var targets []string
+		if status.Target != "" {
+			inventory, err := rfClient.GetFirmwareInventory(ctx)
+			if err != nil {
+				logger.Error(err, "Failed to get firmware inventory for update")
+				return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+			}
+			component := internalredfish.FindFirmwareComponent(inventory, status.Target)
+			if component == nil || !component.Updateable {
+				r.failFirmwareUpdate(logger, physicalHost, infrastructurev1beta1.InvalidFirmwareUpdateReason,
+					fmt.Sprintf("Firmware component %s does not exist or cannot be updated", status.Target))
+				return waitForRetry(logger, physicalHost), nil
+			}
+			targets = []string{component.URI}
+		}
+
+		taskURI, err := rfClient.SimpleUpdate(ctx, status.ImageURI, targets)
+		if err != nil {
+			r.failFirmwareUpdate(logger, physicalHost, infrastructurev1beta1.FirmwareUpdateFailedReason,
+				fmt.Sprintf("Failed to start firmware update: %v", err))
+			return waitForRetry(logger, physicalHost), nil
+		}
+		r.Recorder.Eventf(physicalHost, corev1.EventTypeNormal, "FirmwareUpdateStarted",
+			"Started firmware update from %s", status.ImageURI)
+		if taskURI == "" {
+			// Without a task there is nothing to follow, trust the BMC
+			r.completeFirmwareUpdate(ctx, logger, rfClient, physicalHost, "")
+			return ctrl.Result{}, nil
+		}
+		logger.Info("Firmware update handed to the BMC", "task", taskURI)
+		status.Phase = infrastructurev1beta1.FirmwareUpdatePhaseRunning
+		status.TaskURI = taskURI
+		return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+	}
+
+	task, err := rfClient.GetTask(ctx, status.TaskURI)
+	if err != nil {
+		logger.Error(err, "Failed to get firmware update task", "task", status.TaskURI)
+		return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+	}
+	status.PercentComplete = int32(task.PercentComplete)
+	status.Message = task.Message()
+
+	switch {
+	case task.Failed():
+		message := fmt.Sprintf("Firmware update task ended in state %s", task.State)
+		if task.Message() != "" {
+			message = fmt.Sprintf("%s: %s", message, task.Message())
+		}
+		r.failFirmwareUpdate(logger, physicalHost, infrastructurev1beta1.FirmwareUpdateFailedReason, message)
+		return waitForRetry(logger, physicalHost), nil
+	case task.Done():
+		r.completeFirmwareUpdate(ctx, logger, rfClient, physicalHost, task.Message())
+		return ctrl.Result{}, nil
+	}
+
+	logger.Info("Firmware update in progress", "taskState", task.State, "percentComplete", task.PercentComplete)
+	conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareUpdatedCondition,
+		infrastructurev1beta1.FirmwareUpdateInProgressReason, clusterv1.ConditionSeverityInfo,
+		"Updating firmware from %s, %d%% complete", status.ImageURI, task.PercentComplete)
+	return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+}
+
+// completeFirmwareUpdate records the completed update, refreshes the firmware inventory
+// and makes the host Available again. Components the BMC updates on the next boot, such
+// as the BIOS of some vendors, only report their new version after it.
+func (r *PhysicalHostReconciler) completeFirmwareUpdate(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost, message string) {
+	status := physicalHost.Status.FirmwareUpdate
+	now := metav1.Now()
+	status.Phase = infrastructurev1beta1.FirmwareUpdatePhaseCompleted
+	status.PercentComplete = 100
+	status.Message = message
+	status.CompletionTime = &now
+
+	inventory, err := rfClient.GetFirmwareInventory(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to refresh firmware inventory after update")
+	} else {
+		physicalHost.Status.FirmwareInventory = firmwareInventoryFor(inventory)
+	}
+
+	logger.Info("Firmware update completed, transitioning to Available")
+	conditions.MarkTrue(physicalHost, infrastructurev1beta1.FirmwareUpdatedCondition)
+	r.Recorder.Eventf(physicalHost, corev1.EventTypeNormal, "FirmwareUpdateCompleted",
+		"Completed firmware update from %s", status.ImageURI)
+	r.markAvailable(physicalHost)
+}
+
+// failFirmwareUpdate records the failed update and moves the host to Error. Updates
+// targeting an unknown component are not retried automatically, since they need a spec
+// change.
+func (r *PhysicalHostReconciler) failFirmwareUpdate(logger logr.Logger, physicalHost *infrastructurev1beta1.PhysicalHost, reason, message string) {
+	logger.Info("Firmware update failed", "reason", reason, "message", message)
+	status := physicalHost.Status.FirmwareUpdate
+	now := metav1.Now()
+	status.Phase = infrastructurev1beta1.FirmwareUpdatePhaseFailed
+	status.Message = message
+	status.CompletionTime = &now
+
+	severity := clusterv1.ConditionSeverityWarning
+	if reason == infrastructurev1beta1.InvalidFirmwareUpdateReason {
+		severity = clusterv1.ConditionSeverityError
+	}
+	conditions.MarkFalse(physicalHost, infrastructurev1beta1.FirmwareUpdatedCondition, reason, severity, "%s", message)
+	r.Recorder.Event(physicalHost, corev1.EventTypeWarning, reason, message)
+	failHost(physicalHost, reason, message)
+}
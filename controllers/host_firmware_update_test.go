@@ -0,0 +1,201 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stmcginnis/gofish/common"
+	"github.com/stmcginnis/gofish/redfish"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+var _ = Describe("Host firmware update", func() {
+	var (
+		host         *infrastructurev1beta1.PhysicalHost
+		mockRfClient *internalredfish.MockClient
+		reconciler   *PhysicalHostReconciler
+	)
+
+	reconcileUnclaimed := func() ctrl.Result {
+		result, err := reconciler.reconcileUnclaimed(ctx, reconciler.Log, mockRfClient, host)
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	BeforeEach(func() {
+		host = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				FirmwareUpdate: &infrastructurev1beta1.FirmwareUpdate{
+					ImageURI: "http://firmware-server/bmc-2.0.0.bin",
+					Target:   "BMC",
+				},
+			},
+			Status: infrastructurev1beta1.PhysicalHostStatus{
+				State: infrastructurev1beta1.StateAvailable,
+				Ready: true,
+			},
+		}
+		mockRfClient = internalredfish.NewMockClient()
+		mockRfClient.FirmwareInventory = []internalredfish.FirmwareComponent{
+			{ID: "BMC", Version: "1.0.0", Updateable: true, URI: "/redfish/v1/UpdateService/FirmwareInventory/BMC"},
+			{ID: "CPLD", Version: "0.9", URI: "/redfish/v1/UpdateService/FirmwareInventory/CPLD"},
+		}
+		reconciler = &PhysicalHostReconciler{
+			Log:      ctrl.Log.WithName("host-firmware-update-test"),
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	It("should update the firmware of an available host and follow the task", func() {
+		Expect(reconcileUnclaimed().Requeue).To(BeTrue())
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateUpdating))
+		Expect(host.Status.Ready).To(BeFalse())
+		Expect(host.Status.FirmwareUpdate.Phase).To(Equal(infrastructurev1beta1.FirmwareUpdatePhasePending))
+		// Only handed to the BMC once the Updating state is persisted
+		Expect(mockRfClient.SimpleUpdateCalled).To(BeFalse())
+
+		Expect(reconcileUnclaimed().RequeueAfter).To(Equal(DefaultPollInterval))
+		Expect(mockRfClient.UpdateImageURI).To(Equal("http://firmware-server/bmc-2.0.0.bin"))
+		Expect(mockRfClient.UpdateTargets).To(Equal([]string{"/redfish/v1/UpdateService/FirmwareInventory/BMC"}))
+		Expect(host.Status.FirmwareUpdate.Phase).To(Equal(infrastructurev1beta1.FirmwareUpdatePhaseRunning))
+		taskURI := host.Status.FirmwareUpdate.TaskURI
+		Expect(taskURI).NotTo(BeEmpty())
+
+		mockRfClient.Tasks[taskURI].PercentComplete = 60
+		reconcileUnclaimed()
+		Expect(host.Status.FirmwareUpdate.PercentComplete).To(Equal(int32(60)))
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareUpdatedCondition)).
+			To(Equal(infrastructurev1beta1.FirmwareUpdateInProgressReason))
+		Expect(conditions.GetMessage(host, infrastructurev1beta1.FirmwareUpdatedCondition)).To(ContainSubstring("60%"))
+
+		mockRfClient.Tasks[taskURI].State = redfish.CompletedTaskState
+		mockRfClient.FirmwareInventory[0].Version = "2.0.0"
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateAvailable))
+		Expect(host.Status.FirmwareUpdate.Phase).To(Equal(infrastructurev1beta1.FirmwareUpdatePhaseCompleted))
+		Expect(host.Status.FirmwareUpdate.CompletionTime).NotTo(BeNil())
+		Expect(host.Status.FirmwareInventory).To(ContainElement(infrastructurev1beta1.FirmwareComponent{
+			ID: "BMC", Version: "2.0.0", Updateable: true,
+		}))
+		Expect(conditions.IsTrue(host, infrastructurev1beta1.FirmwareUpdatedCondition)).To(BeTrue())
+
+		// The same update is not applied again
+		mockRfClient.SimpleUpdateCalled = false
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateAvailable))
+		Expect(mockRfClient.SimpleUpdateCalled).To(BeFalse())
+	})
+
+	It("should update the firmware with the reconciler the manager runs", func() {
+		reconciler = newManagedPhysicalHostReconciler()
+		Expect(reconciler.Recorder).NotTo(BeNil())
+
+		reconcileUnclaimed()
+		reconcileUnclaimed()
+		Expect(host.Status.FirmwareUpdate.Phase).To(Equal(infrastructurev1beta1.FirmwareUpdatePhaseRunning))
+
+		mockRfClient.Tasks[host.Status.FirmwareUpdate.TaskURI].State = redfish.CompletedTaskState
+		mockRfClient.FirmwareInventory[0].Version = "2.0.0"
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateAvailable))
+		Expect(host.Status.FirmwareUpdate.Phase).To(Equal(infrastructurev1beta1.FirmwareUpdatePhaseCompleted))
+	})
+
+	It("should move the host to Error when the task fails", func() {
+		reconcileUnclaimed()
+		reconcileUnclaimed()
+		task := mockRfClient.Tasks[host.Status.FirmwareUpdate.TaskURI]
+		task.State = redfish.ExceptionTaskState
+		task.Health = common.CriticalHealth
+		task.Messages = []string{"Image signature verification failed"}
+
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+		Expect(host.Status.NextRetryTime).NotTo(BeNil())
+		Expect(host.Status.FirmwareUpdate.Phase).To(Equal(infrastructurev1beta1.FirmwareUpdatePhaseFailed))
+		Expect(host.Status.ErrorMessage).To(ContainSubstring("Image signature verification failed"))
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareUpdatedCondition)).
+			To(Equal(infrastructurev1beta1.FirmwareUpdateFailedReason))
+
+		// Stays in Error until the retry is due, then updates again
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+		past := metav1.NewTime(time.Now().Add(-time.Second))
+		host.Status.NextRetryTime = &past
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateUpdating))
+		Expect(host.Status.RetryCount).To(Equal(int32(1)))
+		Expect(host.Status.FirmwareUpdate.Phase).To(Equal(infrastructurev1beta1.FirmwareUpdatePhasePending))
+	})
+
+	It("should not retry updates of components that cannot be updated", func() {
+		host.Spec.FirmwareUpdate.Target = "CPLD"
+
+		reconcileUnclaimed()
+		reconcileUnclaimed()
+		Expect(mockRfClient.SimpleUpdateCalled).To(BeFalse())
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+		Expect(host.Status.NextRetryTime).To(BeNil())
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareUpdatedCondition)).
+			To(Equal(infrastructurev1beta1.InvalidFirmwareUpdateReason))
+	})
+
+	It("should fail the update when the BMC rejects it", func() {
+		mockRfClient.ShouldFail["SimpleUpdate"] = fmt.Errorf("image URI unreachable")
+
+		reconcileUnclaimed()
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+		Expect(host.Status.FirmwareUpdate.Message).To(ContainSubstring("image URI unreachable"))
+	})
+
+	It("should let the host become Available once the update is no longer requested", func() {
+		reconcileUnclaimed()
+		reconcileUnclaimed()
+		mockRfClient.Tasks[host.Status.FirmwareUpdate.TaskURI].State = redfish.KilledTaskState
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+
+		host.Spec.FirmwareUpdate = nil
+		reconcileUnclaimed()
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateAvailable))
+		reconcileUnclaimed()
+		Expect(conditions.Has(host, infrastructurev1beta1.FirmwareUpdatedCondition)).To(BeFalse())
+	})
+
+	It("should defer updates of claimed hosts", func() {
+		host.Spec.ConsumerRef = &corev1.ObjectReference{Name: "machine-01", Namespace: "default"}
+		host.Status.State = infrastructurev1beta1.StateInUse
+
+		deferFirmwareUpdate(host)
+		Expect(conditions.GetReason(host, infrastructurev1beta1.FirmwareUpdatedCondition)).
+			To(Equal(infrastructurev1beta1.FirmwareUpdateDeferredReason))
+		Expect(host.Status.FirmwareUpdate).To(BeNil())
+	})
+})
@@ -0,0 +1,64 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+// verifyHostIdentity checks that the inspection report was posted by the machine the
+// BMC manages. The serial number must match the one reported by the BMC, the boot NIC
+// must be present, and at least one reported NIC must be known to the BMC. Checks are
+// skipped for identifiers the BMC does not expose.
+func verifyHostIdentity(host *infrastructurev1beta1.PhysicalHost) error {
+	report := host.Status.InspectionReport
+	if report == nil {
+		return fmt.Errorf("no inspection report")
+	}
+
+	if expected := strings.TrimSpace(host.Status.HardwareDetails.SerialNumber); expected != "" {
+		if reported := strings.TrimSpace(report.SerialNumber); !strings.EqualFold(expected, reported) {
+			return fmt.Errorf("serial number %q does not match %q reported by the BMC", reported, expected)
+		}
+	}
+
+	reportedMACs := make(map[string]bool, len(report.NICs))
+	for _, nic := range report.NICs {
+		if nic.MACAddress != "" {
+			reportedMACs[normalizeMACAddress(nic.MACAddress)] = true
+		}
+	}
+
+	if bootMAC := host.Spec.BootMACAddress; bootMAC != "" && !reportedMACs[normalizeMACAddress(bootMAC)] {
+		return fmt.Errorf("boot MAC address %s was not found in the inspection report", bootMAC)
+	}
+
+	if len(host.Status.HardwareDetails.MACAddresses) > 0 {
+		for _, mac := range host.Status.HardwareDetails.MACAddresses {
+			if reportedMACs[normalizeMACAddress(mac)] {
+				return nil
+			}
+		}
+		return fmt.Errorf("none of the reported MAC addresses match the %d reported by the BMC",
+			len(host.Status.HardwareDetails.MACAddresses))
+	}
+
+	return nil
+}
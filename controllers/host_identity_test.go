@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+var _ = Describe("verifyHostIdentity", func() {
+	var host *infrastructurev1beta1.PhysicalHost
+
+	BeforeEach(func() {
+		host = &infrastructurev1beta1.PhysicalHost{
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				BootMACAddress: "AA-BB-CC-DD-EE-01",
+			},
+			Status: infrastructurev1beta1.PhysicalHostStatus{
+				HardwareDetails: infrastructurev1beta1.HardwareDetails{
+					SerialNumber: "ABC123",
+					MACAddresses: []string{"aa:bb:cc:dd:ee:01", "aa:bb:cc:dd:ee:02"},
+				},
+				InspectionReport: &infrastructurev1beta1.InspectionReport{
+					SerialNumber: "abc123",
+					NICs: []infrastructurev1beta1.NICInfo{
+						{Name: "eth0", MACAddress: "AA:BB:CC:DD:EE:01"},
+						{Name: "usb0", MACAddress: "02:00:00:00:00:01"},
+					},
+				},
+			},
+		}
+	})
+
+	It("should accept a report matching the BMC identity", func() {
+		Expect(verifyHostIdentity(host)).To(Succeed())
+	})
+
+	It("should reject a report with a different serial number", func() {
+		host.Status.InspectionReport.SerialNumber = "XYZ789"
+		Expect(verifyHostIdentity(host)).To(MatchError(ContainSubstring("serial number")))
+	})
+
+	It("should reject a report without the boot NIC", func() {
+		host.Spec.BootMACAddress = "aa:bb:cc:dd:ee:02"
+		Expect(verifyHostIdentity(host)).To(MatchError(ContainSubstring("boot MAC address")))
+	})
+
+	It("should reject a report without any NIC known to the BMC", func() {
+		host.Spec.BootMACAddress = ""
+		host.Status.InspectionReport.NICs = []infrastructurev1beta1.NICInfo{{Name: "eth0", MACAddress: "11:22:33:44:55:66"}}
+		Expect(verifyHostIdentity(host)).To(MatchError(ContainSubstring("MAC addresses")))
+	})
+
+	It("should skip checks for identifiers the BMC does not expose", func() {
+		host.Spec.BootMACAddress = ""
+		host.Status.HardwareDetails = infrastructurev1beta1.HardwareDetails{}
+		host.Status.InspectionReport.SerialNumber = "XYZ789"
+		Expect(verifyHostIdentity(host)).To(Succeed())
+	})
+})
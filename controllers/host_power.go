@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-logr/logr"
+	"github.com/stmcginnis/gofish/redfish"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+// startPowerAction sends the first reset of the power action to the host and records
+// the action in the host status, so it is continued on later reconciles rather than
+// waited for. It reports whether the host already is in the requested power state. The
+// caller persists the host status.
+func startPowerAction(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, host *infrastructurev1beta1.PhysicalHost, op internalredfish.PowerOperation, opts internalredfish.PowerActionOptions) (bool, error) {
+	progress, err := internalredfish.StepPowerAction(ctx, rfClient, op, nil, opts)
+	if err != nil {
+		return false, err
+	}
+	return recordPowerAction(logger, host, op, progress), nil
+}
+
+// continuePowerAction advances the power action recorded on the host by at most one
+// reset, forcing off a host that did not shut down gracefully in time. It reports
+// whether the action is complete, which it is if none is recorded. An action the host
+// does not complete in time is given up and ErrPowerStateTimeout returned; after other
+// errors it is continued on the next call. The caller persists the host status.
+func continuePowerAction(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, host *infrastructurev1beta1.PhysicalHost, opts internalredfish.PowerActionOptions) (bool, error) {
+	action := host.Status.PowerAction
+	if action == nil {
+		return true, nil
+	}
+	op := internalredfish.PowerOperation(action.Action)
+	progress, err := internalredfish.StepPowerAction(ctx, rfClient, op, &internalredfish.PowerActionProgress{
+		Operation: op,
+		ResetType: redfish.ResetType(action.ResetType),
+		Deadline:  action.Deadline.Time,
+	}, opts)
+	if err != nil {
+		if errors.Is(err, internalredfish.ErrPowerStateTimeout) {
+			host.Status.PowerAction = nil
+		}
+		return false, err
+	}
+	return recordPowerAction(logger, host, op, progress), nil
+}
+
+// recordPowerAction records the progress of the power action in the host status and
+// reports whether the action is complete.
+func recordPowerAction(logger logr.Logger, host *infrastructurev1beta1.PhysicalHost, op internalredfish.PowerOperation, progress *internalredfish.PowerActionProgress) bool {
+	if progress == nil {
+		if host.Status.PowerAction != nil {
+			logger.Info("Power action complete", "powerAction", op)
+		}
+		host.Status.PowerAction = nil
+		host.Status.ObservedPowerState = string(redfish.OnPowerState)
+		if op == internalredfish.PowerOperationOff {
+			host.Status.ObservedPowerState = string(redfish.OffPowerState)
+		}
+		return true
+	}
+
+	if host.Status.PowerAction == nil || host.Status.PowerAction.ResetType != string(progress.ResetType) {
+		logger.Info("Sent reset to host", "powerAction", op, "resetType", progress.ResetType, "deadline", progress.Deadline)
+	}
+	host.Status.PowerAction = &infrastructurev1beta1.PowerActionStatus{
+		Action:    string(op),
+		ResetType: string(progress.ResetType),
+		Deadline:  metav1.NewTime(progress.Deadline),
+	}
+	return false
+}
+
+// reconcileHostPowerAction continues the power action in progress on a host claimed by
+// the machine and persists the host status. It reports whether the action is complete.
+func (r *Beskar7MachineReconciler) reconcileHostPowerAction(ctx context.Context, logger logr.Logger, physicalHost *infrastructurev1beta1.PhysicalHost) (bool, error) {
+	rfClient, err := r.getRedfishClientForHost(ctx, logger, physicalHost)
+	if err != nil {
+		return false, err
+	}
+	defer rfClient.Close(ctx)
+
+	done, err := continuePowerAction(ctx, logger, rfClient, physicalHost, r.powerActionOptions())
+	if updateErr := r.Status().Update(ctx, physicalHost); updateErr != nil {
+		return false, updateErr
+	}
+	return done, err
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stmcginnis/gofish/redfish"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+var _ = Describe("Host power actions", func() {
+	var (
+		host         *infrastructurev1beta1.PhysicalHost
+		mockRfClient *internalredfish.MockClient
+		opts         internalredfish.PowerActionOptions
+	)
+
+	logger := ctrl.Log.WithName("host-power-test")
+
+	BeforeEach(func() {
+		host = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"},
+		}
+		mockRfClient = internalredfish.NewMockClient()
+		mockRfClient.PowerState = redfish.OnPowerState
+		opts = internalredfish.PowerActionOptions{}
+	})
+
+	It("should record a restart and continue it on later calls", func() {
+		done, err := startPowerAction(ctx, logger, mockRfClient, host, internalredfish.PowerOperationRestart, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeFalse())
+		Expect(host.Status.PowerAction).NotTo(BeNil())
+		Expect(host.Status.PowerAction.Action).To(Equal(string(internalredfish.PowerOperationRestart)))
+		Expect(host.Status.PowerAction.ResetType).To(Equal(string(redfish.GracefulShutdownResetType)))
+
+		done, err = continuePowerAction(ctx, logger, mockRfClient, host, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeFalse())
+		Expect(host.Status.PowerAction.ResetType).To(Equal(string(redfish.OnResetType)))
+
+		done, err = continuePowerAction(ctx, logger, mockRfClient, host, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeTrue())
+		Expect(host.Status.PowerAction).To(BeNil())
+		Expect(host.Status.ObservedPowerState).To(Equal(string(redfish.OnPowerState)))
+		Expect(mockRfClient.PowerActions).To(Equal([]redfish.ResetType{
+			redfish.GracefulShutdownResetType, redfish.OnResetType,
+		}))
+	})
+
+	It("should not send a reset to a host already in the requested power state", func() {
+		mockRfClient.PowerState = redfish.OffPowerState
+
+		done, err := startPowerAction(ctx, logger, mockRfClient, host, internalredfish.PowerOperationOff, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeTrue())
+		Expect(host.Status.PowerAction).To(BeNil())
+		Expect(mockRfClient.PowerActions).To(BeEmpty())
+	})
+
+	It("should give up a power action the host does not complete in time", func() {
+		host.Status.PowerAction = &infrastructurev1beta1.PowerActionStatus{
+			Action:    string(internalredfish.PowerOperationOff),
+			ResetType: string(redfish.ForceOffResetType),
+			Deadline:  metav1.NewTime(time.Now().Add(-time.Second)),
+		}
+
+		done, err := continuePowerAction(ctx, logger, mockRfClient, host, opts)
+		Expect(err).To(MatchError(internalredfish.ErrPowerStateTimeout))
+		Expect(done).To(BeFalse())
+		Expect(host.Status.PowerAction).To(BeNil())
+	})
+
+	It("should keep the power action when the BMC cannot be reached", func() {
+		host.Status.PowerAction = &infrastructurev1beta1.PowerActionStatus{
+			Action:    string(internalredfish.PowerOperationOff),
+			ResetType: string(redfish.GracefulShutdownResetType),
+			Deadline:  metav1.NewTime(time.Now().Add(time.Minute)),
+		}
+		mockRfClient.ShouldFail["GetPowerState"] = fmt.Errorf("BMC unreachable")
+
+		_, err := continuePowerAction(ctx, logger, mockRfClient, host, opts)
+		Expect(err).To(HaveOccurred())
+		Expect(host.Status.PowerAction).NotTo(BeNil())
+		Expect(host.Status.PowerAction.ResetType).To(Equal(string(redfish.GracefulShutdownResetType)))
+	})
+})
@@ -0,0 +1,210 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+const (
+	// DefaultMaxRetryAttempts is how many times a host in Error is retried
+	// automatically before it waits for an operator to set the retry annotation.
+	DefaultMaxRetryAttempts = 5
+
+	// retryBaseDelay is the delay before the first automatic retry. It doubles with
+	// every attempt up to retryMaxDelay.
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = 30 * time.Minute
+
+	// maxFailureHistory is how many failures are kept in the host status.
+	maxFailureHistory = 10
+)
+
+// retryBackoff returns the delay before the given retry attempt, counting from zero.
+func retryBackoff(attempt int32) time.Duration {
+	delay := retryBaseDelay
+	for i := int32(0); i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+// isRetryableFailure reports whether hosts failing for the given reason are retried
+// automatically. Identity mismatches point at miswired hosts, while a missing cleaning
+// image, invalid firmware settings, firmware updates of unknown components and storage
+// configurations the host cannot satisfy need a spec change, so none of them goes away
+// by trying again.
+func isRetryableFailure(reason string) bool {
+	return reason != infrastructurev1beta1.IdentityMismatchReason &&
+		reason != infrastructurev1beta1.MissingCleaningImageReason &&
+		reason != infrastructurev1beta1.InvalidFirmwareSettingsReason &&
+		reason != infrastructurev1beta1.InvalidFirmwareUpdateReason &&
+		reason != infrastructurev1beta1.InvalidStorageConfigurationReason
+}
+
+// isBMCFailure reports whether the failure was raised while talking to the BMC rather
+// than by the inspection or cleaning of the host.
+func isBMCFailure(reason string) bool {
+	switch reason {
+	case infrastructurev1beta1.MissingCredentialsReason,
+		infrastructurev1beta1.RedfishConnectionFailedReason,
+		infrastructurev1beta1.RedfishQueryFailedReason:
+		return true
+	}
+	return false
+}
+
+// lastHostFailure returns the failure that moved the host to Error, if any.
+func lastHostFailure(host *infrastructurev1beta1.PhysicalHost) *infrastructurev1beta1.HostFailure {
+	if host.Status.State != infrastructurev1beta1.StateError || len(host.Status.FailureHistory) == 0 {
+		return nil
+	}
+	return &host.Status.FailureHistory[len(host.Status.FailureHistory)-1]
+}
+
+// failHost moves the host to Error, records the failure in its history and schedules
+// the next automatic retry. A failure repeating the current error is not recorded
+// again, but counts as a failed retry if one was due. The caller persists the status.
+func failHost(host *infrastructurev1beta1.PhysicalHost, reason, message string) {
+	now := metav1.Now()
+	if host.Status.State == infrastructurev1beta1.StateError && retryDue(host) {
+		startRetry(host)
+	}
+	last := lastHostFailure(host)
+	if last == nil || last.Reason != reason || last.Message != message {
+		previousState := host.Status.State
+		if last != nil {
+			previousState = last.State
+		}
+		host.Status.FailureHistory = append(host.Status.FailureHistory, infrastructurev1beta1.HostFailure{
+			Timestamp: now,
+			State:     previousState,
+			Reason:    reason,
+			Message:   message,
+		})
+		if len(host.Status.FailureHistory) > maxFailureHistory {
+			host.Status.FailureHistory = host.Status.FailureHistory[len(host.Status.FailureHistory)-maxFailureHistory:]
+		}
+	}
+
+	host.Status.State = infrastructurev1beta1.StateError
+	host.Status.Ready = false
+	host.Status.ErrorMessage = message
+
+	host.Status.NextRetryTime = nil
+	if isRetryableFailure(reason) && host.Status.RetryCount < DefaultMaxRetryAttempts {
+		next := metav1.NewTime(now.Add(retryBackoff(host.Status.RetryCount)))
+		host.Status.NextRetryTime = &next
+	}
+}
+
+// retryDue reports whether the host in Error is due for its next retry.
+func retryDue(host *infrastructurev1beta1.PhysicalHost) bool {
+	return host.Status.NextRetryTime != nil && !time.Now().Before(host.Status.NextRetryTime.Time)
+}
+
+// startRetry counts a retry of the host out of Error.
+func startRetry(host *infrastructurev1beta1.PhysicalHost) {
+	host.Status.RetryCount++
+	host.Status.NextRetryTime = nil
+}
+
+// resetRetries clears the retry budget once the host recovered. The failure history
+// is kept.
+func resetRetries(host *infrastructurev1beta1.PhysicalHost) {
+	host.Status.RetryCount = 0
+	host.Status.NextRetryTime = nil
+}
+
+// waitForRetry returns the result of a reconcile that leaves the host in Error until
+// its next retry. Hosts without a scheduled retry wait for the retry annotation.
+func waitForRetry(logger logr.Logger, host *infrastructurev1beta1.PhysicalHost) ctrl.Result {
+	if host.Status.NextRetryTime == nil {
+		logger.Info("Host in Error is not retried automatically, set the retry annotation to retry it",
+			"annotation", infrastructurev1beta1.RetryAnnotation, "retryCount", host.Status.RetryCount)
+		return ctrl.Result{}
+	}
+	logger.Info("Host in Error, waiting for the next retry",
+		"nextRetryTime", host.Status.NextRetryTime.Time, "retryCount", host.Status.RetryCount)
+	return ctrl.Result{RequeueAfter: time.Until(host.Status.NextRetryTime.Time)}
+}
+
+// acknowledgeRetryRequest handles the retry annotation. A host in Error is scheduled
+// for an immediate retry with a fresh retry budget before the annotation is removed,
+// so the request is not lost if the reconcile fails halfway.
+func (r *PhysicalHostReconciler) acknowledgeRetryRequest(ctx context.Context, logger logr.Logger, physicalHost *infrastructurev1beta1.PhysicalHost) error {
+	if physicalHost.Status.State == infrastructurev1beta1.StateError {
+		logger.Info("Retry requested by annotation", "retryCount", physicalHost.Status.RetryCount)
+		now := metav1.Now()
+		physicalHost.Status.RetryCount = 0
+		physicalHost.Status.NextRetryTime = &now
+		if err := r.Status().Update(ctx, physicalHost); err != nil {
+			return err
+		}
+	}
+
+	original := physicalHost.DeepCopy()
+	delete(physicalHost.Annotations, infrastructurev1beta1.RetryAnnotation)
+	return r.Patch(ctx, physicalHost, client.MergeFrom(original))
+}
+
+// recoverFromBMCFailure returns a host that failed because its BMC could not be reached
+// to the state it was in before, now that the BMC answers again. The caller persists
+// the status.
+func (r *PhysicalHostReconciler) recoverFromBMCFailure(logger logr.Logger, physicalHost *infrastructurev1beta1.PhysicalHost) {
+	last := lastHostFailure(physicalHost)
+	if last == nil || !isBMCFailure(last.Reason) {
+		return
+	}
+	state := last.State
+	if state == infrastructurev1beta1.StateError {
+		// Hosts that were already in Error before their failure was recorded start over
+		state = infrastructurev1beta1.StateNone
+	}
+	logger.Info("BMC reachable again, restoring previous state", "state", state, "retryCount", physicalHost.Status.RetryCount)
+	ready := state != infrastructurev1beta1.StateNone && state != infrastructurev1beta1.StateCleaning &&
+		state != infrastructurev1beta1.StateUpdating
+	r.updateStatus(physicalHost, state, ready, "")
+	resetRetries(physicalHost)
+}
+
+// retryClaimedHost retries the inspection of a claimed host in Error once its retry is
+// due. The Beskar7Machine controller boots the inspection image again as soon as the
+// host is back InUse. The caller persists the status.
+func (r *PhysicalHostReconciler) retryClaimedHost(logger logr.Logger, physicalHost *infrastructurev1beta1.PhysicalHost) ctrl.Result {
+	if !retryDue(physicalHost) {
+		return waitForRetry(logger, physicalHost)
+	}
+	startRetry(physicalHost)
+	logger.Info("Retrying inspection of host in Error", "retryCount", physicalHost.Status.RetryCount)
+	r.updateStatus(physicalHost, infrastructurev1beta1.StateInUse, true, "")
+	physicalHost.Status.InspectionPhase = ""
+	physicalHost.Status.InspectionTimestamp = nil
+	physicalHost.Status.InspectionToken = nil
+	return ctrl.Result{}
+}
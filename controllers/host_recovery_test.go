@@ -0,0 +1,206 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+var _ = Describe("Host recovery", func() {
+	var (
+		host       *infrastructurev1beta1.PhysicalHost
+		reconciler *PhysicalHostReconciler
+	)
+
+	// makeRetryDue moves the scheduled retry of the host into the past
+	makeRetryDue := func() {
+		Expect(host.Status.NextRetryTime).NotTo(BeNil())
+		past := metav1.NewTime(time.Now().Add(-time.Second))
+		host.Status.NextRetryTime = &past
+	}
+
+	BeforeEach(func() {
+		host = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				CleaningImageURL: "http://boot-server/ipxe/clean.ipxe",
+			},
+			Status: infrastructurev1beta1.PhysicalHostStatus{
+				State:           infrastructurev1beta1.StateInspecting,
+				InspectionPhase: infrastructurev1beta1.InspectionPhaseTimeout,
+			},
+		}
+		reconciler = &PhysicalHostReconciler{
+			Log:      ctrl.Log.WithName("host-recovery-test"),
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	It("should double the retry delay up to the maximum", func() {
+		Expect(retryBackoff(0)).To(Equal(retryBaseDelay))
+		Expect(retryBackoff(1)).To(Equal(2 * retryBaseDelay))
+		Expect(retryBackoff(3)).To(Equal(8 * retryBaseDelay))
+		Expect(retryBackoff(100)).To(Equal(retryMaxDelay))
+	})
+
+	It("should record failures with the state the host failed in", func() {
+		failHost(host, infrastructurev1beta1.InspectionTimeoutReason, "Inspection timeout after 10m0s")
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+		Expect(host.Status.FailureHistory).To(HaveLen(1))
+		Expect(host.Status.FailureHistory[0].State).To(Equal(infrastructurev1beta1.StateInspecting))
+		Expect(host.Status.FailureHistory[0].Reason).To(Equal(infrastructurev1beta1.InspectionTimeoutReason))
+		Expect(host.Status.NextRetryTime).NotTo(BeNil())
+
+		// The same failure is not recorded twice
+		failHost(host, infrastructurev1beta1.InspectionTimeoutReason, "Inspection timeout after 10m0s")
+		Expect(host.Status.FailureHistory).To(HaveLen(1))
+	})
+
+	It("should only keep the most recent failures", func() {
+		for i := 0; i < maxFailureHistory+3; i++ {
+			failHost(host, infrastructurev1beta1.RedfishConnectionFailedReason, fmt.Sprintf("attempt %d", i))
+		}
+		Expect(host.Status.FailureHistory).To(HaveLen(maxFailureHistory))
+		Expect(host.Status.FailureHistory[maxFailureHistory-1].Message).To(Equal(fmt.Sprintf("attempt %d", maxFailureHistory+2)))
+	})
+
+	It("should retry the inspection of a claimed host with backoff", func() {
+		failHost(host, infrastructurev1beta1.InspectionTimeoutReason, "Inspection timeout after 10m0s")
+
+		// Not due yet
+		result := reconciler.retryClaimedHost(reconciler.Log, host)
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+
+		makeRetryDue()
+		reconciler.retryClaimedHost(reconciler.Log, host)
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateInUse))
+		Expect(host.Status.InspectionPhase).To(BeEmpty())
+		Expect(host.Status.RetryCount).To(Equal(int32(1)))
+
+		// The next failure waits twice as long
+		host.Status.State = infrastructurev1beta1.StateInspecting
+		failHost(host, infrastructurev1beta1.InspectionTimeoutReason, "Inspection timeout after 10m0s")
+		Expect(time.Until(host.Status.NextRetryTime.Time)).To(BeNumerically(">", retryBaseDelay))
+	})
+
+	It("should stop retrying once the retries are exhausted", func() {
+		host.Status.RetryCount = DefaultMaxRetryAttempts
+		failHost(host, infrastructurev1beta1.InspectionTimeoutReason, "Inspection timeout after 10m0s")
+		Expect(host.Status.NextRetryTime).To(BeNil())
+
+		result := reconciler.retryClaimedHost(reconciler.Log, host)
+		Expect(result.IsZero()).To(BeTrue())
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+	})
+
+	It("should never retry identity mismatches automatically", func() {
+		failHost(host, infrastructurev1beta1.IdentityMismatchReason, "Identity mismatch: serial number differs")
+		Expect(host.Status.NextRetryTime).To(BeNil())
+
+		reconciler.retryClaimedHost(reconciler.Log, host)
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+	})
+
+	It("should count a failing BMC as failed retries", func() {
+		host.Status.State = infrastructurev1beta1.StateReady
+		failHost(host, infrastructurev1beta1.RedfishConnectionFailedReason, "Redfish connection failed: timeout")
+		makeRetryDue()
+		failHost(host, infrastructurev1beta1.RedfishConnectionFailedReason, "Redfish connection failed: timeout")
+		Expect(host.Status.RetryCount).To(Equal(int32(1)))
+		Expect(host.Status.FailureHistory).To(HaveLen(1))
+
+		// Once the BMC answers again the host continues where it was
+		reconciler.recoverFromBMCFailure(reconciler.Log, host)
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateReady))
+		Expect(host.Status.ErrorMessage).To(BeEmpty())
+		Expect(host.Status.RetryCount).To(BeZero())
+		Expect(host.Status.FailureHistory).To(HaveLen(1))
+	})
+
+	It("should clean a host again once its retry is due", func() {
+		host.Status.State = infrastructurev1beta1.StateCleaning
+		host.Status.CleaningPhase = infrastructurev1beta1.CleaningPhaseFailed
+		host.Status.ProvisioningPhase = infrastructurev1beta1.ProvisioningPhaseProvisioned
+		host.Status.ErrorMessage = "Cleaning failed: secure erase unsupported"
+		mockRfClient := internalredfish.NewMockClient()
+		// Cleaning mints the token of the cleaning image
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(infrastructurev1beta1.AddToScheme(scheme)).To(Succeed())
+		reconciler.Client = fake.NewClientBuilder().WithScheme(scheme).Build()
+		reconciler.Scheme = scheme
+
+		_, err := reconciler.reconcileUnclaimed(ctx, reconciler.Log, mockRfClient, host)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateError))
+		Expect(host.Status.FailureHistory[0].Reason).To(Equal(infrastructurev1beta1.CleaningFailedReason))
+
+		makeRetryDue()
+		_, err = reconciler.reconcileUnclaimed(ctx, reconciler.Log, mockRfClient, host)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(host.Status.State).To(Equal(infrastructurev1beta1.StateCleaning))
+		Expect(host.Status.CleaningPhase).To(Equal(infrastructurev1beta1.CleaningPhaseBooting))
+		Expect(host.Status.RetryCount).To(Equal(int32(1)))
+	})
+
+	It("should schedule an immediate retry when the retry annotation is set", func() {
+		annotated := &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "annotated-host",
+				Namespace:   "default",
+				Annotations: map[string]string{infrastructurev1beta1.RetryAnnotation: ""},
+			},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				RedfishConnection: infrastructurev1beta1.RedfishConnection{
+					Address:              "https://192.168.1.100",
+					CredentialsSecretRef: "test-bmc-creds",
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, annotated)).To(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, annotated)).To(Succeed()) }()
+
+		annotated.Status.State = infrastructurev1beta1.StateInspecting
+		annotated.Status.RetryCount = DefaultMaxRetryAttempts
+		failHost(annotated, infrastructurev1beta1.InspectionTimeoutReason, "Inspection timeout after 10m0s")
+		Expect(k8sClient.Status().Update(ctx, annotated)).To(Succeed())
+
+		reconciler.Client = k8sClient
+		Expect(reconciler.acknowledgeRetryRequest(ctx, reconciler.Log, annotated)).To(Succeed())
+
+		updated := &infrastructurev1beta1.PhysicalHost{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "annotated-host"}, updated)).To(Succeed())
+		Expect(updated.Annotations).NotTo(HaveKey(infrastructurev1beta1.RetryAnnotation))
+		Expect(updated.Status.RetryCount).To(BeZero())
+		Expect(retryDue(updated)).To(BeTrue())
+	})
+})
@@ -0,0 +1,428 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+// hostCapacity summarizes the hardware found by an inspection.
+type hostCapacity struct {
+	CPUCores int
+	MemoryGB int
+	DiskGB   int
+}
+
+// memoryUnits maps the units memory capacities are reported in to quantity suffixes,
+// longest first.
+var memoryUnits = []struct{ unit, suffix string }{
+	{"KIB", "Ki"}, {"MIB", "Mi"}, {"GIB", "Gi"}, {"TIB", "Ti"},
+	{"KI", "Ki"}, {"MI", "Mi"}, {"GI", "Gi"}, {"TI", "Ti"},
+	{"KB", "k"}, {"MB", "M"}, {"GB", "G"}, {"TB", "T"},
+	{"K", "k"}, {"M", "M"}, {"G", "G"}, {"T", "T"},
+	{"B", ""},
+}
+
+// parseMemoryCapacity parses a memory capacity as reported by an inspection image,
+// such as "32GB", "16384 MB" or "32Gi", with the units of a resource.Quantity: K, M,
+// G and T are decimal units whether or not a B follows, Ki, Mi, Gi and Ti are binary
+// ones. Units are not case sensitive.
+func parseMemoryCapacity(capacity string) (resource.Quantity, error) {
+	value := strings.ReplaceAll(capacity, " ", "")
+	upper := strings.ToUpper(value)
+	for _, unit := range memoryUnits {
+		if number, ok := strings.CutSuffix(upper, unit.unit); ok {
+			value = value[:len(number)] + unit.suffix
+			break
+		}
+	}
+	return resource.ParseQuantity(value)
+}
+
+// memorySize returns the size of a memory module, parsing its capacity for reports
+// that carry no size. ok is false if neither is known.
+func memorySize(mem infrastructurev1beta1.MemoryInfo) (size resource.Quantity, ok bool) {
+	if mem.Size != nil {
+		return *mem.Size, true
+	}
+	size, err := parseMemoryCapacity(mem.Capacity)
+	return size, err == nil
+}
+
+// parseLinkSpeed parses a link speed as reported by an inspection image, such as
+// "10Gbps", "25 Gb/s" or "1000Mb/s", into Mbit/s. Plain numbers are Mbit/s, as
+// reported by ethtool. Zero is returned for unknown speeds.
+func parseLinkSpeed(speed string) int {
+	value := strings.ToLower(strings.ReplaceAll(speed, " ", ""))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "bps"), "b/s")
+	factor := 1.0
+	switch {
+	case strings.HasSuffix(value, "t"):
+		factor = 1000 * 1000
+	case strings.HasSuffix(value, "g"):
+		factor = 1000
+	case strings.HasSuffix(value, "k"):
+		factor = 1.0 / 1000
+	}
+	value = strings.TrimRight(value, "tgmk")
+	mbps, err := strconv.ParseFloat(value, 64)
+	if err != nil || mbps < 0 {
+		return 0
+	}
+	return int(mbps * factor)
+}
+
+// nicSpeedMbps returns the link speed of a network interface in Mbit/s, parsing its
+// speed for reports that carry none.
+func nicSpeedMbps(nic infrastructurev1beta1.NICInfo) int {
+	if nic.SpeedMbps > 0 {
+		return nic.SpeedMbps
+	}
+	return parseLinkSpeed(nic.Speed)
+}
+
+// diskTypeOf returns the type of a disk, from the reported type or, if missing, its
+// device name and whether it spins. An empty type means it is unknown.
+func diskTypeOf(disk infrastructurev1beta1.DiskInfo) infrastructurev1beta1.DiskType {
+	for _, diskType := range []infrastructurev1beta1.DiskType{
+		infrastructurev1beta1.DiskTypeNVMe, infrastructurev1beta1.DiskTypeSSD, infrastructurev1beta1.DiskTypeHDD,
+	} {
+		if strings.EqualFold(disk.Type, string(diskType)) {
+			return diskType
+		}
+	}
+	switch {
+	case disk.Rotational:
+		return infrastructurev1beta1.DiskTypeHDD
+	case strings.HasPrefix(disk.Name, "/dev/nvme"):
+		return infrastructurev1beta1.DiskTypeNVMe
+	}
+	return ""
+}
+
+// capacityFromReport totals CPU cores, memory and disk space of an inspection report.
+// Memory modules whose size is unknown are ignored.
+func capacityFromReport(report *infrastructurev1beta1.InspectionReport) hostCapacity {
+	var capacity hostCapacity
+	for _, cpu := range report.CPUs {
+		capacity.CPUCores += cpu.Cores
+	}
+	var memoryBytes int64
+	for _, mem := range report.Memory {
+		if size, ok := memorySize(mem); ok {
+			memoryBytes += size.Value()
+		}
+	}
+	capacity.MemoryGB = int(memoryBytes / bytesPerGB)
+	for _, disk := range report.Disks {
+		capacity.DiskGB += disk.SizeGB
+	}
+	return capacity
+}
+
+// hardwareFacts returns the facts of an inspection report hardware expressions are
+// matched against. Facts that were not reported are left out.
+func hardwareFacts(report *infrastructurev1beta1.InspectionReport) map[string]string {
+	capacity := capacityFromReport(report)
+	threads := 0
+	for _, cpu := range report.CPUs {
+		threads += cpu.Threads
+	}
+	facts := map[string]string{
+		infrastructurev1beta1.HardwareFactCPUCount:   strconv.Itoa(len(report.CPUs)),
+		infrastructurev1beta1.HardwareFactCPUCores:   strconv.Itoa(capacity.CPUCores),
+		infrastructurev1beta1.HardwareFactCPUThreads: strconv.Itoa(threads),
+		infrastructurev1beta1.HardwareFactMemoryGB:   strconv.Itoa(capacity.MemoryGB),
+		infrastructurev1beta1.HardwareFactDiskCount:  strconv.Itoa(len(report.Disks)),
+		infrastructurev1beta1.HardwareFactDiskGB:     strconv.Itoa(capacity.DiskGB),
+		infrastructurev1beta1.HardwareFactNICCount:   strconv.Itoa(len(report.NICs)),
+		infrastructurev1beta1.HardwareFactGPUCount:   strconv.Itoa(len(report.GPUs)),
+	}
+	setFact := func(key, value string) {
+		if value != "" {
+			facts[key] = value
+		}
+	}
+	setFact(infrastructurev1beta1.HardwareFactSystemManufacturer, report.Manufacturer)
+	setFact(infrastructurev1beta1.HardwareFactSystemModel, report.Model)
+	setFact(infrastructurev1beta1.HardwareFactSystemBootMode, report.BootModeDetected)
+
+	if len(report.CPUs) > 0 {
+		setFact(infrastructurev1beta1.HardwareFactCPUVendor, report.CPUs[0].Vendor)
+		setFact(infrastructurev1beta1.HardwareFactCPUModel, report.CPUs[0].Model)
+	}
+
+	diskCounts := map[infrastructurev1beta1.DiskType]int{}
+	for _, disk := range report.Disks {
+		diskCounts[diskTypeOf(disk)]++
+	}
+	facts[infrastructurev1beta1.HardwareFactDiskNVMeCount] = strconv.Itoa(diskCounts[infrastructurev1beta1.DiskTypeNVMe])
+	facts[infrastructurev1beta1.HardwareFactDiskSSDCount] = strconv.Itoa(diskCounts[infrastructurev1beta1.DiskTypeSSD])
+	facts[infrastructurev1beta1.HardwareFactDiskHDDCount] = strconv.Itoa(diskCounts[infrastructurev1beta1.DiskTypeHDD])
+
+	maxSpeed := 0
+	for _, nic := range report.NICs {
+		maxSpeed = max(maxSpeed, nicSpeedMbps(nic))
+	}
+	if maxSpeed > 0 {
+		facts[infrastructurev1beta1.HardwareFactNICMaxSpeedMbps] = strconv.Itoa(maxSpeed)
+	}
+
+	if len(report.GPUs) > 0 {
+		setFact(infrastructurev1beta1.HardwareFactGPUVendor, report.GPUs[0].Vendor)
+		setFact(infrastructurev1beta1.HardwareFactGPUModel, report.GPUs[0].Model)
+	}
+	return facts
+}
+
+// matchHardwareExpression reports whether the facts meet a hardware expression. Values
+// are compared to the facts as plain, case sensitive strings rather than label values,
+// since facts such as system.model may contain spaces or parentheses. Gt and Lt compare
+// integers, and are not met by facts that were not reported.
+func matchHardwareExpression(expression infrastructurev1beta1.HardwareExpression, facts map[string]string) (bool, error) {
+	fact, reported := facts[expression.Key]
+	switch expression.Operator {
+	case infrastructurev1beta1.HardwareExpressionOpIn:
+		return reported && slices.Contains(expression.Values, fact), nil
+	case infrastructurev1beta1.HardwareExpressionOpNotIn:
+		return !reported || !slices.Contains(expression.Values, fact), nil
+	case infrastructurev1beta1.HardwareExpressionOpExists:
+		return reported, nil
+	case infrastructurev1beta1.HardwareExpressionOpDoesNotExist:
+		return !reported, nil
+	case infrastructurev1beta1.HardwareExpressionOpGt, infrastructurev1beta1.HardwareExpressionOpLt:
+		if len(expression.Values) != 1 {
+			return false, fmt.Errorf("operator %s requires a single value", expression.Operator)
+		}
+		value, err := strconv.ParseInt(expression.Values[0], 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("value %q is not an integer", expression.Values[0])
+		}
+		number, err := strconv.ParseInt(fact, 10, 64)
+		if !reported || err != nil {
+			return false, nil
+		}
+		if expression.Operator == infrastructurev1beta1.HardwareExpressionOpGt {
+			return number > value, nil
+		}
+		return number < value, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", expression.Operator)
+}
+
+// checkHardwareRequirements returns an error describing the first requirement the
+// inspection report does not meet.
+func checkHardwareRequirements(reqs *infrastructurev1beta1.HardwareRequirements, report *infrastructurev1beta1.InspectionReport) error {
+	if reqs == nil {
+		return nil
+	}
+	capacity := capacityFromReport(report)
+	if reqs.MinCPUCores > 0 && capacity.CPUCores < reqs.MinCPUCores {
+		return fmt.Errorf("insufficient CPU cores: found %d, required %d", capacity.CPUCores, reqs.MinCPUCores)
+	}
+	if reqs.MinMemoryGB > 0 && capacity.MemoryGB < reqs.MinMemoryGB {
+		return fmt.Errorf("insufficient memory: found %d GB, required %d GB", capacity.MemoryGB, reqs.MinMemoryGB)
+	}
+	if reqs.MinDiskGB > 0 && capacity.DiskGB < reqs.MinDiskGB {
+		return fmt.Errorf("insufficient disk space: found %d GB, required %d GB", capacity.DiskGB, reqs.MinDiskGB)
+	}
+
+	if err := checkCPUs(report.CPUs, "vendor", reqs.CPUVendor, func(cpu infrastructurev1beta1.CPUInfo) string { return cpu.Vendor }); err != nil {
+		return err
+	}
+	if err := checkCPUs(report.CPUs, "model", reqs.CPUModel, func(cpu infrastructurev1beta1.CPUInfo) string { return cpu.Model }); err != nil {
+		return err
+	}
+
+	if reqs.MinNICs > 0 || reqs.MinNICSpeedMbps > 0 {
+		nics := 0
+		for _, nic := range report.NICs {
+			if nicSpeedMbps(nic) >= reqs.MinNICSpeedMbps {
+				nics++
+			}
+		}
+		required := max(reqs.MinNICs, 1)
+		if nics < required {
+			if reqs.MinNICSpeedMbps > 0 {
+				return fmt.Errorf("insufficient network interfaces of at least %d Mbps: found %d, required %d", reqs.MinNICSpeedMbps, nics, required)
+			}
+			return fmt.Errorf("insufficient network interfaces: found %d, required %d", nics, required)
+		}
+	}
+
+	for _, requirement := range reqs.Disks {
+		disks := 0
+		for _, disk := range report.Disks {
+			if diskTypeOf(disk) == requirement.Type && disk.SizeGB >= requirement.MinSizeGB {
+				disks++
+			}
+		}
+		if disks < requirement.Count {
+			if requirement.MinSizeGB > 0 {
+				return fmt.Errorf("insufficient %s disks of at least %d GB: found %d, required %d", requirement.Type, requirement.MinSizeGB, disks, requirement.Count)
+			}
+			return fmt.Errorf("insufficient %s disks: found %d, required %d", requirement.Type, disks, requirement.Count)
+		}
+	}
+
+	if reqs.MinGPUs > 0 && len(report.GPUs) < reqs.MinGPUs {
+		return fmt.Errorf("insufficient GPUs: found %d, required %d", len(report.GPUs), reqs.MinGPUs)
+	}
+
+	if len(reqs.Expressions) > 0 {
+		facts := hardwareFacts(report)
+		for _, expression := range reqs.Expressions {
+			met, err := matchHardwareExpression(expression, facts)
+			if err != nil {
+				return fmt.Errorf("invalid hardware expression on %q: %w", expression.Key, err)
+			}
+			if !met {
+				return fmt.Errorf("hardware expression %s %s %q not met: %s is %q",
+					expression.Key, expression.Operator, expression.Values, expression.Key, facts[expression.Key])
+			}
+		}
+	}
+	return nil
+}
+
+// checkCPUs returns an error if a CPU's vendor or model, as returned by value, does not
+// match the regular expression pattern. An empty pattern matches any CPU.
+func checkCPUs(cpus []infrastructurev1beta1.CPUInfo, name, pattern string, value func(infrastructurev1beta1.CPUInfo) string) error {
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid CPU %s pattern: %w", name, err)
+	}
+	if len(cpus) == 0 {
+		return fmt.Errorf("no CPU found to match CPU %s %q", name, pattern)
+	}
+	for _, cpu := range cpus {
+		if !re.MatchString(value(cpu)) {
+			return fmt.Errorf("CPU %s %q does not match %q", name, value(cpu), pattern)
+		}
+	}
+	return nil
+}
+
+// hostSelectorFor returns the label selector restricting the hosts a machine may claim:
+// those matching its host selector and, if the Machine has a failure domain, carrying
+// that zone label.
+func hostSelectorFor(b7machine *infrastructurev1beta1.Beskar7Machine, machine *clusterv1.Machine) (labels.Selector, error) {
+	selector := labels.Everything()
+	if b7machine.Spec.HostSelector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(b7machine.Spec.HostSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hostSelector: %w", err)
+		}
+	}
+	if failureDomain := machineFailureDomain(machine); failureDomain != "" {
+		requirement, err := labels.NewRequirement(zoneLabelKey, selection.Equals, []string{failureDomain})
+		if err != nil {
+			return nil, fmt.Errorf("invalid failure domain %q: %w", failureDomain, err)
+		}
+		selector = selector.Add(*requirement)
+	}
+	return selector, nil
+}
+
+// machineFailureDomain returns the failure domain the Machine was placed in, if any.
+func machineFailureDomain(machine *clusterv1.Machine) string {
+	if machine == nil || machine.Spec.FailureDomain == nil {
+		return ""
+	}
+	return *machine.Spec.FailureDomain
+}
+
+// hostCandidate is an Available host that may be claimed.
+type hostCandidate struct {
+	host *infrastructurev1beta1.PhysicalHost
+	// capacity is nil if the host has not been inspected yet
+	capacity *hostCapacity
+}
+
+// selectHostCandidates filters hosts down to the unclaimed Available ones that are not
+// known to be too small for the machine, ranked by the machine's host selection policy.
+// Hosts with a pending firmware update are left to the PhysicalHost controller.
+func selectHostCandidates(b7machine *infrastructurev1beta1.Beskar7Machine, hosts []infrastructurev1beta1.PhysicalHost) []hostCandidate {
+	var candidates []hostCandidate
+	for i := range hosts {
+		host := &hosts[i]
+		if host.Status.State != infrastructurev1beta1.StateAvailable || host.Spec.ConsumerRef != nil {
+			continue
+		}
+		if firmwareUpdateRequested(host) {
+			continue
+		}
+		candidate := hostCandidate{host: host}
+		if host.Status.InspectionReport != nil {
+			if checkHardwareRequirements(b7machine.Spec.HardwareRequirements, host.Status.InspectionReport) != nil {
+				continue
+			}
+			capacity := capacityFromReport(host.Status.InspectionReport)
+			candidate.capacity = &capacity
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	switch b7machine.Spec.HostSelectionPolicy {
+	case infrastructurev1beta1.HostSelectionPolicyFirstAvailable:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].host.Name < candidates[j].host.Name
+		})
+	default:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return bestFitLess(candidates[i], candidates[j])
+		})
+	}
+	return candidates
+}
+
+// bestFitLess orders inspected hosts before uninspected ones and smaller hosts before
+// larger ones, comparing memory, then CPU cores, then disk space.
+func bestFitLess(a, b hostCandidate) bool {
+	if (a.capacity == nil) != (b.capacity == nil) {
+		return a.capacity != nil
+	}
+	if a.capacity != nil {
+		if a.capacity.MemoryGB != b.capacity.MemoryGB {
+			return a.capacity.MemoryGB < b.capacity.MemoryGB
+		}
+		if a.capacity.CPUCores != b.capacity.CPUCores {
+			return a.capacity.CPUCores < b.capacity.CPUCores
+		}
+		if a.capacity.DiskGB != b.capacity.DiskGB {
+			return a.capacity.DiskGB < b.capacity.DiskGB
+		}
+	}
+	return a.host.Name < b.host.Name
+}
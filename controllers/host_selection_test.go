@@ -0,0 +1,285 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+var _ = Describe("Host selection", func() {
+	newHost := func(name string, cores, memoryGB int) infrastructurev1beta1.PhysicalHost {
+		host := infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     infrastructurev1beta1.PhysicalHostStatus{State: infrastructurev1beta1.StateAvailable},
+		}
+		if cores > 0 {
+			host.Status.InspectionReport = &infrastructurev1beta1.InspectionReport{
+				CPUs:   []infrastructurev1beta1.CPUInfo{{Cores: cores}},
+				Memory: []infrastructurev1beta1.MemoryInfo{{Capacity: fmt.Sprintf("%dGB", memoryGB)}},
+			}
+		}
+		return host
+	}
+
+	names := func(candidates []hostCandidate) []string {
+		var result []string
+		for _, candidate := range candidates {
+			result = append(result, candidate.host.Name)
+		}
+		return result
+	}
+
+	var b7machine *infrastructurev1beta1.Beskar7Machine
+
+	BeforeEach(func() {
+		b7machine = &infrastructurev1beta1.Beskar7Machine{
+			Spec: infrastructurev1beta1.Beskar7MachineSpec{
+				HardwareRequirements: &infrastructurev1beta1.HardwareRequirements{MinCPUCores: 8, MinMemoryGB: 16},
+			},
+		}
+	})
+
+	It("should never select hosts known to be too small", func() {
+		hosts := []infrastructurev1beta1.PhysicalHost{
+			newHost("small", 4, 32),
+			newHost("fits", 8, 16),
+			newHost("uninspected", 0, 0),
+		}
+		Expect(names(selectHostCandidates(b7machine, hosts))).To(Equal([]string{"fits", "uninspected"}))
+	})
+
+	It("should skip claimed and unavailable hosts", func() {
+		claimed := newHost("claimed", 8, 16)
+		claimed.Spec.ConsumerRef = &corev1.ObjectReference{Name: "other"}
+		inspecting := newHost("inspecting", 8, 16)
+		inspecting.Status.State = infrastructurev1beta1.StateInspecting
+		Expect(selectHostCandidates(b7machine, []infrastructurev1beta1.PhysicalHost{claimed, inspecting})).To(BeEmpty())
+	})
+
+	It("should skip hosts with a pending firmware update", func() {
+		pending := newHost("pending", 8, 16)
+		pending.Spec.FirmwareUpdate = &infrastructurev1beta1.FirmwareUpdate{ImageURI: "http://images.example.com/bios.bin"}
+		applied := newHost("applied", 8, 16)
+		applied.Spec.FirmwareUpdate = &infrastructurev1beta1.FirmwareUpdate{ImageURI: "http://images.example.com/bios.bin"}
+		applied.Status.FirmwareUpdate = &infrastructurev1beta1.FirmwareUpdateStatus{ImageURI: "http://images.example.com/bios.bin"}
+		Expect(names(selectHostCandidates(b7machine, []infrastructurev1beta1.PhysicalHost{pending, applied}))).To(Equal([]string{"applied"}))
+	})
+
+	It("should prefer the smallest inspected host by default", func() {
+		hosts := []infrastructurev1beta1.PhysicalHost{
+			newHost("a-uninspected", 0, 0),
+			newHost("b-large", 32, 32),
+			newHost("c-small", 8, 16),
+		}
+		Expect(names(selectHostCandidates(b7machine, hosts))).To(Equal([]string{"c-small", "b-large", "a-uninspected"}))
+	})
+
+	It("should select by name with the FirstAvailable policy", func() {
+		b7machine.Spec.HostSelectionPolicy = infrastructurev1beta1.HostSelectionPolicyFirstAvailable
+		hosts := []infrastructurev1beta1.PhysicalHost{
+			newHost("c-small", 8, 16),
+			newHost("a-uninspected", 0, 0),
+			newHost("b-large", 32, 32),
+		}
+		Expect(names(selectHostCandidates(b7machine, hosts))).To(Equal([]string{"a-uninspected", "b-large", "c-small"}))
+	})
+
+	It("should parse memory capacities with the units of a quantity", func() {
+		const gi = 1 << 30
+		for capacity, bytes := range map[string]int64{
+			"32G":      32 * bytesPerGB,
+			"32GB":     32 * bytesPerGB,
+			"32 GB":    32 * bytesPerGB,
+			"32gb":     32 * bytesPerGB,
+			"32Gi":     32 * gi,
+			"32GiB":    32 * gi,
+			"32 GIB":   32 * gi,
+			"16384 MB": 16384 * 1000 * 1000,
+			"16384Mi":  16 * gi,
+			"1TB":      1000 * bytesPerGB,
+			"1T":       1000 * bytesPerGB,
+			"512K":     512 * 1000,
+			"1024":     1024,
+		} {
+			size, err := parseMemoryCapacity(capacity)
+			Expect(err).NotTo(HaveOccurred(), capacity)
+			Expect(size.Value()).To(Equal(bytes), capacity)
+		}
+		_, err := parseMemoryCapacity("No Module Installed")
+		Expect(err).To(HaveOccurred())
+
+		Expect(parseLinkSpeed("10Gbps")).To(Equal(10000))
+		Expect(parseLinkSpeed("25 Gb/s")).To(Equal(25000))
+		Expect(parseLinkSpeed("1000Mb/s")).To(Equal(1000))
+		Expect(parseLinkSpeed("1000")).To(Equal(1000))
+		Expect(parseLinkSpeed("Unknown!")).To(BeZero())
+	})
+
+	It("should not misread memory in MB or TB", func() {
+		host := newHost("mixed", 8, 0)
+		host.Status.InspectionReport.Memory = []infrastructurev1beta1.MemoryInfo{
+			{Capacity: "512MB"}, {Capacity: "1TB"},
+		}
+		Expect(capacityFromReport(host.Status.InspectionReport).MemoryGB).To(Equal(1000))
+	})
+
+	Describe("rich hardware requirements", func() {
+		var report *infrastructurev1beta1.InspectionReport
+
+		BeforeEach(func() {
+			report = &infrastructurev1beta1.InspectionReport{
+				Manufacturer: "Dell Inc.",
+				CPUs: []infrastructurev1beta1.CPUInfo{
+					{Vendor: "AuthenticAMD", Model: "AMD EPYC 9354 32-Core Processor", Cores: 32, Threads: 64},
+					{Vendor: "AuthenticAMD", Model: "AMD EPYC 9354 32-Core Processor", Cores: 32, Threads: 64},
+				},
+				Memory: []infrastructurev1beta1.MemoryInfo{{Capacity: "512GB"}},
+				Disks: []infrastructurev1beta1.DiskInfo{
+					{Name: "/dev/nvme0n1", SizeGB: 960},
+					{Name: "/dev/nvme1n1", SizeGB: 3840, Type: "NVMe"},
+					{Name: "/dev/sda", SizeGB: 4000, Rotational: true},
+				},
+				NICs: []infrastructurev1beta1.NICInfo{
+					{Name: "eno1", Speed: "1Gbps"},
+					{Name: "ens1f0", SpeedMbps: 25000},
+					{Name: "ens1f1", Speed: "25Gbps"},
+				},
+				GPUs: []infrastructurev1beta1.GPUInfo{{Vendor: "NVIDIA", Model: "L40S"}},
+			}
+		})
+
+		It("should match CPUs, NICs, disks and GPUs", func() {
+			reqs := &infrastructurev1beta1.HardwareRequirements{
+				CPUVendor:       "^AuthenticAMD$",
+				CPUModel:        "EPYC 9[0-9]{3}",
+				MinNICs:         2,
+				MinNICSpeedMbps: 25000,
+				Disks: []infrastructurev1beta1.DiskRequirement{
+					{Type: infrastructurev1beta1.DiskTypeNVMe, Count: 2, MinSizeGB: 900},
+					{Type: infrastructurev1beta1.DiskTypeHDD, Count: 1},
+				},
+				MinGPUs: 1,
+			}
+			Expect(checkHardwareRequirements(reqs, report)).To(Succeed())
+
+			reqs.CPUVendor = "GenuineIntel"
+			Expect(checkHardwareRequirements(reqs, report)).To(MatchError(ContainSubstring("CPU vendor")))
+
+			reqs.CPUVendor = ""
+			reqs.MinNICs = 3
+			Expect(checkHardwareRequirements(reqs, report)).To(MatchError(ContainSubstring("network interfaces of at least 25000 Mbps")))
+
+			reqs.MinNICs = 0
+			reqs.Disks[0].MinSizeGB = 1000
+			Expect(checkHardwareRequirements(reqs, report)).To(MatchError(ContainSubstring("NVMe disks")))
+
+			reqs.Disks = nil
+			reqs.MinGPUs = 2
+			Expect(checkHardwareRequirements(reqs, report)).To(MatchError(ContainSubstring("insufficient GPUs")))
+		})
+
+		It("should match expressions over the inspected facts", func() {
+			facts := hardwareFacts(report)
+			Expect(facts).To(HaveKeyWithValue(infrastructurev1beta1.HardwareFactMemoryGB, "512"))
+			Expect(facts).To(HaveKeyWithValue(infrastructurev1beta1.HardwareFactCPUCores, "64"))
+			Expect(facts).To(HaveKeyWithValue(infrastructurev1beta1.HardwareFactDiskNVMeCount, "2"))
+			Expect(facts).To(HaveKeyWithValue(infrastructurev1beta1.HardwareFactDiskHDDCount, "1"))
+			Expect(facts).To(HaveKeyWithValue(infrastructurev1beta1.HardwareFactNICMaxSpeedMbps, "25000"))
+			Expect(facts).NotTo(HaveKey(infrastructurev1beta1.HardwareFactSystemModel))
+
+			reqs := &infrastructurev1beta1.HardwareRequirements{
+				Expressions: []infrastructurev1beta1.HardwareExpression{
+					{Key: infrastructurev1beta1.HardwareFactGPUVendor, Operator: infrastructurev1beta1.HardwareExpressionOpIn, Values: []string{"NVIDIA"}},
+					{Key: infrastructurev1beta1.HardwareFactMemoryGB, Operator: infrastructurev1beta1.HardwareExpressionOpGt, Values: []string{"256"}},
+					{Key: infrastructurev1beta1.HardwareFactSystemModel, Operator: infrastructurev1beta1.HardwareExpressionOpDoesNotExist},
+				},
+			}
+			Expect(checkHardwareRequirements(reqs, report)).To(Succeed())
+
+			reqs.Expressions[1].Operator = infrastructurev1beta1.HardwareExpressionOpLt
+			Expect(checkHardwareRequirements(reqs, report)).To(MatchError(ContainSubstring("memory.gb")))
+		})
+
+		It("should compare models with spaces and parentheses as plain strings", func() {
+			report.Model = "PowerEdge R650 (SKU=0A1B)"
+			reqs := &infrastructurev1beta1.HardwareRequirements{
+				Expressions: []infrastructurev1beta1.HardwareExpression{
+					{Key: infrastructurev1beta1.HardwareFactSystemModel, Operator: infrastructurev1beta1.HardwareExpressionOpIn, Values: []string{"PowerEdge R650 (SKU=0A1B)"}},
+					{Key: infrastructurev1beta1.HardwareFactCPUModel, Operator: infrastructurev1beta1.HardwareExpressionOpIn, Values: []string{"AMD EPYC 9354 32-Core Processor"}},
+					{Key: infrastructurev1beta1.HardwareFactGPUModel, Operator: infrastructurev1beta1.HardwareExpressionOpNotIn, Values: []string{"Tesla T4 (PCIe)"}},
+				},
+			}
+			Expect(checkHardwareRequirements(reqs, report)).To(Succeed())
+
+			reqs.Expressions[0].Values = []string{"poweredge r650 (sku=0a1b)"}
+			Expect(checkHardwareRequirements(reqs, report)).To(MatchError(ContainSubstring("system.model")))
+		})
+
+		It("should never select hosts that do not meet them", func() {
+			b7machine.Spec.HardwareRequirements = &infrastructurev1beta1.HardwareRequirements{
+				Disks: []infrastructurev1beta1.DiskRequirement{{Type: infrastructurev1beta1.DiskTypeNVMe, Count: 1}},
+			}
+			hosts := []infrastructurev1beta1.PhysicalHost{newHost("without-nvme", 8, 16), newHost("with-nvme", 8, 16)}
+			hosts[1].Status.InspectionReport = report
+			Expect(names(selectHostCandidates(b7machine, hosts))).To(Equal([]string{"with-nvme"}))
+		})
+	})
+
+	It("should build the host selector from the machine spec", func() {
+		selector, err := hostSelectorFor(b7machine, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selector.Empty()).To(BeTrue())
+
+		b7machine.Spec.HostSelector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{"beskar7.io/pool": "control-plane"},
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "rack", Operator: metav1.LabelSelectorOpIn, Values: []string{"r1", "r2"}},
+			},
+		}
+		selector, err = hostSelectorFor(b7machine, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selector.Matches(labels.Set{"beskar7.io/pool": "control-plane", "rack": "r2"})).To(BeTrue())
+		Expect(selector.Matches(labels.Set{"beskar7.io/pool": "worker", "rack": "r2"})).To(BeFalse())
+
+		b7machine.Spec.HostSelector.MatchExpressions[0].Operator = "Bogus"
+		_, err = hostSelectorFor(b7machine, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should restrict the host selector to the Machine's failure domain", func() {
+		failureDomain := "zone-a"
+		machine := &clusterv1.Machine{Spec: clusterv1.MachineSpec{FailureDomain: &failureDomain}}
+		b7machine.Spec.HostSelector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{"beskar7.io/pool": "control-plane"},
+		}
+
+		selector, err := hostSelectorFor(b7machine, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selector.Matches(labels.Set{"beskar7.io/pool": "control-plane", zoneLabelKey: "zone-a"})).To(BeTrue())
+		Expect(selector.Matches(labels.Set{"beskar7.io/pool": "control-plane", zoneLabelKey: "zone-b"})).To(BeFalse())
+		Expect(selector.Matches(labels.Set{"beskar7.io/pool": "control-plane"})).To(BeFalse())
+	})
+})
@@ -0,0 +1,296 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/stmcginnis/gofish/redfish"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+// DefaultRAIDVolumeName is the name of the RAID volume built for a machine, unless set.
+const DefaultRAIDVolumeName = "beskar7-root"
+
+// bytesPerGB converts disk and memory sizes in bytes to the GB used by disk hints and
+// hardware requirements, which like the G of a resource.Quantity are decimal units.
+const bytesPerGB = 1000 * 1000 * 1000
+
+// errInvalidStorageConfiguration is returned when the host has no drives for the RAID
+// volume or no disk matching the root device hints, which needs a spec change.
+var errInvalidStorageConfiguration = errors.New("invalid storage configuration")
+
+// raidMinimumDisks is the number of member drives each RAID level needs.
+var raidMinimumDisks = map[infrastructurev1beta1.RAIDLevel]int{
+	infrastructurev1beta1.RAIDLevel0:  1,
+	infrastructurev1beta1.RAIDLevel1:  2,
+	infrastructurev1beta1.RAIDLevel5:  3,
+	infrastructurev1beta1.RAIDLevel6:  4,
+	infrastructurev1beta1.RAIDLevel10: 4,
+}
+
+// raidVolumeNameFor returns the name of the RAID volume.
+func raidVolumeNameFor(raid *infrastructurev1beta1.RAIDConfig) string {
+	if raid.VolumeName != "" {
+		return raid.VolumeName
+	}
+	return DefaultRAIDVolumeName
+}
+
+// raidDiskCountFor returns the number of member drives of the RAID volume.
+func raidDiskCountFor(raid *infrastructurev1beta1.RAIDConfig) int {
+	if raid.DiskCount > 0 {
+		return int(raid.DiskCount)
+	}
+	return raidMinimumDisks[raid.Level]
+}
+
+// diskHintsMatch reports whether a disk matches all hints that are set.
+func diskHintsMatch(hints *infrastructurev1beta1.DiskHints, model, serialNumber string, sizeBytes int64) bool {
+	if hints == nil {
+		return true
+	}
+	if hints.Model != "" && !strings.Contains(strings.ToLower(model), strings.ToLower(hints.Model)) {
+		return false
+	}
+	if hints.SerialNumber != "" && !strings.EqualFold(serialNumber, hints.SerialNumber) {
+		return false
+	}
+	if hints.MinSizeGB > 0 && sizeBytes < int64(hints.MinSizeGB)*bytesPerGB {
+		return false
+	}
+	return true
+}
+
+// rootDeviceHintsMatch reports whether an inspected disk matches all root device hints
+// that are set. Disks whose inspection did not report them rotational are taken to be
+// spinning disks if their type is HDD.
+func rootDeviceHintsMatch(hints *infrastructurev1beta1.RootDeviceHints, disk infrastructurev1beta1.DiskInfo) bool {
+	if !diskHintsMatch(&hints.DiskHints, disk.Model, disk.SerialNumber, int64(disk.SizeGB)*bytesPerGB) {
+		return false
+	}
+	if hints.Name != "" && disk.Name != hints.Name {
+		return false
+	}
+	if hints.WWN != "" && !strings.EqualFold(disk.WWN, hints.WWN) {
+		return false
+	}
+	if hints.Rotational != nil && *hints.Rotational != (disk.Rotational || strings.EqualFold(disk.Type, "HDD")) {
+		return false
+	}
+	return true
+}
+
+// reconcileRAIDVolume returns the RAID volume of the storage configuration if it exists.
+// Otherwise it requests the volume from the BMC, built from the first unused drives
+// matching the member disk hints, and returns nil; the volume may only be created by the
+// next reboot. A volume that was requested already is not requested again. Errors
+// wrapping errInvalidStorageConfiguration need a spec change. The outcome is reflected
+// on the StorageConfigured condition, which the caller persists.
+func reconcileRAIDVolume(ctx context.Context, logger logr.Logger, rfClient internalredfish.Client, physicalHost *infrastructurev1beta1.PhysicalHost, raid *infrastructurev1beta1.RAIDConfig) (*internalredfish.Volume, error) {
+	name := raidVolumeNameFor(raid)
+	storage, err := rfClient.GetStorage(ctx)
+	if err != nil {
+		conditions.MarkFalse(physicalHost, infrastructurev1beta1.StorageConfiguredCondition,
+			infrastructurev1beta1.StorageConfigurationFailedReason, clusterv1.ConditionSeverityWarning,
+			"Failed to read storage: %v", err)
+		return nil, fmt.Errorf("failed to get storage: %w", err)
+	}
+
+	for i := range storage {
+		if volume := storage[i].FindVolume(name); volume != nil {
+			if volume.RAIDType != redfish.RAIDType(raid.Level) {
+				return nil, fmt.Errorf("%w: volume %s already exists as %s instead of %s",
+					errInvalidStorageConfiguration, name, volume.RAIDType, raid.Level)
+			}
+			return volume, nil
+		}
+	}
+	if conditions.GetReason(physicalHost, infrastructurev1beta1.StorageConfiguredCondition) == infrastructurev1beta1.StorageConfigurationPendingReason {
+		return nil, nil
+	}
+
+	count := raidDiskCountFor(raid)
+	for _, subsystem := range storage {
+		if !subsystem.SupportsRAIDType(redfish.RAIDType(raid.Level)) {
+			continue
+		}
+		var members []internalredfish.Drive
+		for _, drive := range subsystem.UnusedDrives() {
+			if diskHintsMatch(raid.MemberDiskHints, drive.Model, drive.SerialNumber, drive.CapacityBytes) {
+				members = append(members, drive)
+			}
+		}
+		if len(members) < count {
+			continue
+		}
+
+		members = members[:count]
+		driveURIs := make([]string, 0, count)
+		driveIDs := make([]string, 0, count)
+		for _, drive := range members {
+			driveURIs = append(driveURIs, drive.URI)
+			driveIDs = append(driveIDs, drive.ID)
+		}
+		if err := rfClient.CreateVolume(ctx, subsystem.URI, name, redfish.RAIDType(raid.Level), driveURIs); err != nil {
+			conditions.MarkFalse(physicalHost, infrastructurev1beta1.StorageConfiguredCondition,
+				infrastructurev1beta1.StorageConfigurationFailedReason, clusterv1.ConditionSeverityWarning,
+				"Failed to create %s volume %s: %v", raid.Level, name, err)
+			return nil, fmt.Errorf("failed to create RAID volume: %w", err)
+		}
+		logger.Info("Requested RAID volume", "name", name, "level", raid.Level, "storage", subsystem.ID, "drives", driveIDs)
+		conditions.MarkFalse(physicalHost, infrastructurev1beta1.StorageConfiguredCondition,
+			infrastructurev1beta1.StorageConfigurationPendingReason, clusterv1.ConditionSeverityInfo,
+			"%s volume %s is created from drives %s of %s on the next reboot", raid.Level, name, strings.Join(driveIDs, ", "), subsystem.ID)
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("%w: no storage controller supporting %s has %d unused drives matching the member disk hints",
+		errInvalidStorageConfiguration, raid.Level, count)
+}
+
+// rootDeviceFor selects the disk of the inspection report the target image is installed
+// to: the smallest disk matching the root device hints, or the disk with the size of the
+// RAID volume if there are no hints. It returns nil if neither is configured, leaving
+// the choice to the target image.
+func rootDeviceFor(report *infrastructurev1beta1.InspectionReport, storage *infrastructurev1beta1.StorageConfig, volume *internalredfish.Volume) (*infrastructurev1beta1.DiskInfo, error) {
+	var candidates []infrastructurev1beta1.DiskInfo
+	switch {
+	case storage.RootDeviceHints != nil:
+		for _, disk := range report.Disks {
+			if disk.Name != "" && rootDeviceHintsMatch(storage.RootDeviceHints, disk) {
+				candidates = append(candidates, disk)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("%w: no inspected disk matches the root device hints", errInvalidStorageConfiguration)
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].SizeGB != candidates[j].SizeGB {
+				return candidates[i].SizeGB < candidates[j].SizeGB
+			}
+			return candidates[i].Name < candidates[j].Name
+		})
+		return &candidates[0], nil
+
+	case volume != nil:
+		for _, disk := range report.Disks {
+			if disk.Name != "" && diskSizeMatches(disk.SizeGB, volume.CapacityBytes) {
+				candidates = append(candidates, disk)
+			}
+		}
+		if len(candidates) != 1 {
+			return nil, fmt.Errorf("%w: %d inspected disks have the size of RAID volume %s, set root device hints",
+				errInvalidStorageConfiguration, len(candidates), volume.Name)
+		}
+		return &candidates[0], nil
+	}
+	return nil, nil
+}
+
+// diskSizeMatches reports whether a disk size reported by the inspection image matches
+// a capacity reported by the BMC. Inspection images may report GB or GiB, and RAID
+// controllers reserve some space for metadata, so sizes match within 1%.
+func diskSizeMatches(sizeGB int, capacityBytes int64) bool {
+	if sizeGB <= 0 || capacityBytes <= 0 {
+		return false
+	}
+	for _, unit := range []int64{bytesPerGB, 1 << 30} {
+		capacity := float64(capacityBytes) / float64(unit)
+		if diff := float64(sizeGB) - capacity; diff <= capacity/100+1 && -diff <= capacity/100+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyStorage checks that the inspection boot created the RAID volume requested before
+// it and resolves the root device from the inspection report, so the OS is only
+// installed to the intended disk. The root device is recorded on the machine and the
+// host, which the caller persists. A host whose volume is missing is moved to Error and retried with
+// another inspection boot; hosts without a matching disk are not retried. It reports
+// whether the host may become Ready.
+func (r *Beskar7MachineReconciler) verifyStorage(ctx context.Context, logger logr.Logger, b7machine *infrastructurev1beta1.Beskar7Machine, physicalHost *infrastructurev1beta1.PhysicalHost) (bool, error) {
+	storage := b7machine.Spec.Storage
+	if storage == nil {
+		b7machine.Status.RootDevice = ""
+		physicalHost.Status.RootDevice = ""
+		conditions.Delete(physicalHost, infrastructurev1beta1.StorageConfiguredCondition)
+		return true, nil
+	}
+
+	var volume *internalredfish.Volume
+	if storage.RAID != nil {
+		rfClient, err := r.getRedfishClientForHost(ctx, logger, physicalHost)
+		if err != nil {
+			return false, err
+		}
+		defer rfClient.Close(ctx)
+
+		volume, err = reconcileRAIDVolume(ctx, logger, rfClient, physicalHost, storage.RAID)
+		if errors.Is(err, errInvalidStorageConfiguration) {
+			return false, r.failStorage(ctx, logger, physicalHost, infrastructurev1beta1.InvalidStorageConfigurationReason, err.Error())
+		}
+		if err != nil {
+			return false, err
+		}
+		if volume == nil {
+			return false, r.failStorage(ctx, logger, physicalHost, infrastructurev1beta1.StorageConfigurationFailedReason,
+				fmt.Sprintf("RAID volume %s was not created by the inspection boot", raidVolumeNameFor(storage.RAID)))
+		}
+	}
+
+	disk, err := rootDeviceFor(physicalHost.Status.InspectionReport, storage, volume)
+	if err != nil {
+		return false, r.failStorage(ctx, logger, physicalHost, infrastructurev1beta1.InvalidStorageConfigurationReason, err.Error())
+	}
+	physicalHost.Status.RootDevice = ""
+	if disk != nil {
+		logger.Info("Resolved root device", "device", disk.Name, "model", disk.Model, "serialNumber", disk.SerialNumber, "sizeGB", disk.SizeGB)
+		physicalHost.Status.RootDevice = disk.Name
+	}
+	b7machine.Status.RootDevice = physicalHost.Status.RootDevice
+	conditions.MarkTrue(physicalHost, infrastructurev1beta1.StorageConfiguredCondition)
+	return true, nil
+}
+
+// failStorage moves a host whose storage cannot be configured to Error and persists its
+// status. Invalid storage configurations are not retried automatically, since they need
+// a spec change.
+func (r *Beskar7MachineReconciler) failStorage(ctx context.Context, logger logr.Logger, physicalHost *infrastructurev1beta1.PhysicalHost, reason, message string) error {
+	logger.Error(nil, "Storage not configured", "reason", reason, "message", message)
+	severity := clusterv1.ConditionSeverityWarning
+	if reason == infrastructurev1beta1.InvalidStorageConfigurationReason {
+		severity = clusterv1.ConditionSeverityError
+	}
+	conditions.MarkFalse(physicalHost, infrastructurev1beta1.StorageConfiguredCondition, reason, severity, "%s", message)
+	failHost(physicalHost, reason, message)
+	if err := r.Status().Update(ctx, physicalHost); err != nil {
+		logger.Error(err, "Failed to update PhysicalHost after storage failure")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stmcginnis/gofish/redfish"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+var _ = Describe("Host storage", func() {
+	const storageURI = "/redfish/v1/Systems/1/Storage/RAID.Integrated.1-1"
+
+	var (
+		host         *infrastructurev1beta1.PhysicalHost
+		mockRfClient *internalredfish.MockClient
+		raid         *infrastructurev1beta1.RAIDConfig
+	)
+
+	logger := ctrl.Log.WithName("host-storage-test")
+
+	drive := func(id, model string, sizeGB int64) internalredfish.Drive {
+		return internalredfish.Drive{
+			ID:            id,
+			Model:         model,
+			SerialNumber:  "SN-" + id,
+			CapacityBytes: sizeGB * bytesPerGB,
+			URI:           storageURI + "/Drives/" + id,
+		}
+	}
+
+	BeforeEach(func() {
+		host = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"},
+		}
+		mockRfClient = internalredfish.NewMockClient()
+		mockRfClient.Storage = []internalredfish.Storage{{
+			ID:                 "RAID.Integrated.1-1",
+			URI:                storageURI,
+			SupportedRAIDTypes: []redfish.RAIDType{redfish.RAID0RAIDType, redfish.RAID1RAIDType},
+			Drives: []internalredfish.Drive{
+				drive("Disk.0", "MZ7LH480 SSD", 480),
+				drive("Disk.1", "ST2000NM HDD", 2000),
+				drive("Disk.2", "MZ7LH480 SSD", 480),
+			},
+		}}
+		raid = &infrastructurev1beta1.RAIDConfig{
+			Level:           infrastructurev1beta1.RAIDLevel1,
+			MemberDiskHints: &infrastructurev1beta1.DiskHints{Model: "ssd"},
+		}
+	})
+
+	It("should request the volume from matching drives and find it after a reboot", func() {
+		volume, err := reconcileRAIDVolume(ctx, logger, mockRfClient, host, raid)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volume).To(BeNil())
+		Expect(mockRfClient.PendingVolumes[storageURI]).To(HaveLen(1))
+		Expect(mockRfClient.PendingVolumes[storageURI][0].Name).To(Equal(DefaultRAIDVolumeName))
+		Expect(mockRfClient.PendingVolumes[storageURI][0].Drives).To(Equal([]string{
+			storageURI + "/Drives/Disk.0", storageURI + "/Drives/Disk.2",
+		}))
+		Expect(conditions.GetReason(host, infrastructurev1beta1.StorageConfiguredCondition)).
+			To(Equal(infrastructurev1beta1.StorageConfigurationPendingReason))
+
+		// Not requested again while pending
+		mockRfClient.CreateVolumeCalled = false
+		_, err = reconcileRAIDVolume(ctx, logger, mockRfClient, host, raid)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mockRfClient.CreateVolumeCalled).To(BeFalse())
+
+		Expect(mockRfClient.PowerAction(ctx, redfish.OnResetType)).To(Succeed())
+
+		volume, err = reconcileRAIDVolume(ctx, logger, mockRfClient, host, raid)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volume).NotTo(BeNil())
+		Expect(volume.RAIDType).To(Equal(redfish.RAID1RAIDType))
+		Expect(volume.CapacityBytes).To(Equal(int64(480 * bytesPerGB)))
+	})
+
+	It("should reject levels the controller cannot build", func() {
+		raid.Level = infrastructurev1beta1.RAIDLevel5
+
+		_, err := reconcileRAIDVolume(ctx, logger, mockRfClient, host, raid)
+		Expect(err).To(MatchError(errInvalidStorageConfiguration))
+		Expect(mockRfClient.CreateVolumeCalled).To(BeFalse())
+	})
+
+	It("should reject a configuration without enough matching drives", func() {
+		raid.DiskCount = 3
+
+		_, err := reconcileRAIDVolume(ctx, logger, mockRfClient, host, raid)
+		Expect(err).To(MatchError(errInvalidStorageConfiguration))
+	})
+
+	It("should reject an existing volume of another level", func() {
+		mockRfClient.Storage[0].Volumes = []internalredfish.Volume{{
+			Name: DefaultRAIDVolumeName, RAIDType: redfish.RAID0RAIDType, Drives: []string{storageURI + "/Drives/Disk.1"},
+		}}
+
+		_, err := reconcileRAIDVolume(ctx, logger, mockRfClient, host, raid)
+		Expect(err).To(MatchError(errInvalidStorageConfiguration))
+	})
+
+	It("should mark the condition failed when the storage cannot be read", func() {
+		mockRfClient.ShouldFail["GetStorage"] = fmt.Errorf("storage unavailable")
+
+		_, err := reconcileRAIDVolume(ctx, logger, mockRfClient, host, raid)
+		Expect(err).To(HaveOccurred())
+		Expect(conditions.GetReason(host, infrastructurev1beta1.StorageConfiguredCondition)).
+			To(Equal(infrastructurev1beta1.StorageConfigurationFailedReason))
+	})
+
+	Describe("root device", func() {
+		var report *infrastructurev1beta1.InspectionReport
+
+		BeforeEach(func() {
+			report = &infrastructurev1beta1.InspectionReport{
+				Disks: []infrastructurev1beta1.DiskInfo{
+					{Name: "/dev/sda", Model: "PERC H755", SizeGB: 479},
+					{Name: "/dev/sdb", Model: "ST2000NM HDD", SizeGB: 2000, Type: "HDD", SerialNumber: "SN-Disk.1"},
+					{Name: "/dev/nvme0n1", Model: "PM1733 NVMe", SizeGB: 960, Type: "NVMe"},
+				},
+			}
+		})
+
+		It("should pick the smallest disk matching the hints", func() {
+			storage := &infrastructurev1beta1.StorageConfig{
+				RootDeviceHints: &infrastructurev1beta1.RootDeviceHints{DiskHints: infrastructurev1beta1.DiskHints{MinSizeGB: 900}},
+			}
+
+			disk, err := rootDeviceFor(report, storage, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disk.Name).To(Equal("/dev/nvme0n1"))
+
+			storage.RootDeviceHints = &infrastructurev1beta1.RootDeviceHints{DiskHints: infrastructurev1beta1.DiskHints{SerialNumber: "sn-disk.1"}}
+			disk, err = rootDeviceFor(report, storage, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disk.Name).To(Equal("/dev/sdb"))
+
+			storage.RootDeviceHints = &infrastructurev1beta1.RootDeviceHints{DiskHints: infrastructurev1beta1.DiskHints{Model: "Micron"}}
+			_, err = rootDeviceFor(report, storage, nil)
+			Expect(err).To(MatchError(errInvalidStorageConfiguration))
+		})
+
+		It("should match the device name, WWN and rotational hints", func() {
+			report.Disks[2].WWN = "eui.0025385B71B0C9A1"
+			rotational := true
+			storage := &infrastructurev1beta1.StorageConfig{
+				RootDeviceHints: &infrastructurev1beta1.RootDeviceHints{Rotational: &rotational},
+			}
+
+			// Spinning disks are recognized by their type if not reported rotational
+			disk, err := rootDeviceFor(report, storage, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disk.Name).To(Equal("/dev/sdb"))
+
+			rotational = false
+			storage.RootDeviceHints.WWN = "EUI.0025385b71b0c9a1"
+			disk, err = rootDeviceFor(report, storage, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disk.Name).To(Equal("/dev/nvme0n1"))
+
+			storage.RootDeviceHints = &infrastructurev1beta1.RootDeviceHints{Name: "/dev/sda"}
+			disk, err = rootDeviceFor(report, storage, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disk.Model).To(Equal("PERC H755"))
+
+			storage.RootDeviceHints.Name = "/dev/sdc"
+			_, err = rootDeviceFor(report, storage, nil)
+			Expect(err).To(MatchError(errInvalidStorageConfiguration))
+		})
+
+		It("should pick the disk with the size of the RAID volume", func() {
+			storage := &infrastructurev1beta1.StorageConfig{RAID: raid}
+			volume := &internalredfish.Volume{Name: DefaultRAIDVolumeName, CapacityBytes: 480 * bytesPerGB}
+
+			disk, err := rootDeviceFor(report, storage, volume)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disk.Name).To(Equal("/dev/sda"))
+
+			// Ambiguous without hints
+			report.Disks = append(report.Disks, infrastructurev1beta1.DiskInfo{Name: "/dev/sdc", SizeGB: 480})
+			_, err = rootDeviceFor(report, storage, volume)
+			Expect(err).To(MatchError(errInvalidStorageConfiguration))
+		})
+
+		It("should leave the choice to the target image without hints or volume", func() {
+			disk, err := rootDeviceFor(report, &infrastructurev1beta1.StorageConfig{}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(disk).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+// TokenSecretKey is the key holding the plain token in the handoff Secrets read by
+// the boot script and provisioning handlers.
+const TokenSecretKey = "token"
+
+// hostTokenSecretName returns the name of the Secret handing the host's token of the
+// given kind, e.g. "inspection", to the boot script handler.
+func hostTokenSecretName(host *infrastructurev1beta1.PhysicalHost, kind string) string {
+	return fmt.Sprintf("%s-%s-token", host.Name, kind)
+}
+
+// storeHostToken stores a plain token in a Secret owned by the host, so the handlers
+// serving the host can hand it out without being able to mint tokens themselves.
+func storeHostToken(ctx context.Context, c client.Client, scheme *runtime.Scheme, host *infrastructurev1beta1.PhysicalHost, kind, token string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hostTokenSecretName(host, kind),
+			Namespace: host.Namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, c, secret, func() error {
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{TokenSecretKey: []byte(token)}
+		return controllerutil.SetOwnerReference(host, secret, scheme)
+	}); err != nil {
+		return fmt.Errorf("failed to store %s token: %w", kind, err)
+	}
+	return nil
+}
+
+// getHostToken returns the plain token of the given kind stored for the host, or an
+// empty string if none is stored.
+func getHostToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost, kind string) (string, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: host.Namespace, Name: hostTokenSecretName(host, kind)}
+	if err := c.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get %s token: %w", kind, err)
+	}
+	return string(secret.Data[TokenSecretKey]), nil
+}
+
+// takeHostToken returns the plain token of the given kind stored for the host and
+// removes its handoff Secret, so the token is only handed out once. It returns an empty
+// string if none is stored or another request took it first.
+func takeHostToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost, kind string) (string, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: host.Namespace, Name: hostTokenSecretName(host, kind)}
+	if err := c.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get %s token: %w", kind, err)
+	}
+
+	// Only the request that deletes the Secret it read hands out the token
+	if err := c.Delete(ctx, secret, client.Preconditions{UID: &secret.UID, ResourceVersion: &secret.ResourceVersion}); err != nil {
+		if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to take %s token: %w", kind, err)
+	}
+	return string(secret.Data[TokenSecretKey]), nil
+}
+
+// deleteHostToken removes the handoff Secret of the host's token of the given kind.
+func deleteHostToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost, kind string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hostTokenSecretName(host, kind),
+			Namespace: host.Namespace,
+		},
+	}
+	if err := c.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s token: %w", kind, err)
+	}
+	return nil
+}
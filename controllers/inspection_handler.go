@@ -8,19 +8,25 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	"github.com/wrkode/beskar7/internal/metrics"
 )
 
-// InspectionHandler handles HTTP requests from inspection images
+// InspectionHandler handles HTTP requests from inspection images. Reports must
+// carry the one-time token minted for the current inspection, either as a bearer
+// token, the "token" query parameter or the "token" field of the report.
 type InspectionHandler struct {
-	Client client.Client
-	Log    logr.Logger
+	Client   client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
 }
 
 // InspectionReportRequest represents the JSON payload from inspection image
@@ -29,6 +35,9 @@ type InspectionReportRequest struct {
 	Namespace string `json:"namespace"`
 	HostName  string `json:"hostName"`
 
+	// Token is the one-time inspection token passed via kernel parameters
+	Token string `json:"token,omitempty"`
+
 	// Hardware information from inspection
 	Manufacturer string     `json:"manufacturer,omitempty"`
 	Model        string     `json:"model,omitempty"`
@@ -37,6 +46,7 @@ type InspectionReportRequest struct {
 	Memory       []MemData  `json:"memory,omitempty"`
 	Disks        []DiskData `json:"disks,omitempty"`
 	NICs         []NICData  `json:"nics,omitempty"`
+	GPUs         []GPUData  `json:"gpus,omitempty"`
 
 	// Additional metadata
 	BootModeDetected string `json:"bootModeDetected,omitempty"`
@@ -53,10 +63,11 @@ type CPUData struct {
 }
 
 type MemData struct {
-	ID       string `json:"id,omitempty"`
-	Type     string `json:"type,omitempty"`
-	Capacity string `json:"capacity,omitempty"`
-	Speed    string `json:"speed,omitempty"`
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Capacity string             `json:"capacity,omitempty"`
+	Size     *resource.Quantity `json:"size,omitempty"`
+	Speed    string             `json:"speed,omitempty"`
 }
 
 type DiskData struct {
@@ -65,6 +76,8 @@ type DiskData struct {
 	SizeGB       int    `json:"sizeGB,omitempty"`
 	Type         string `json:"type,omitempty"`
 	SerialNumber string `json:"serialNumber,omitempty"`
+	WWN          string `json:"wwn,omitempty"`
+	Rotational   bool   `json:"rotational,omitempty"`
 }
 
 type NICData struct {
@@ -72,9 +85,16 @@ type NICData struct {
 	MACAddress  string   `json:"macAddress,omitempty"`
 	Driver      string   `json:"driver,omitempty"`
 	Speed       string   `json:"speed,omitempty"`
+	SpeedMbps   int      `json:"speedMbps,omitempty"`
 	IPAddresses []string `json:"ipAddresses,omitempty"`
 }
 
+type GPUData struct {
+	ID     string `json:"id,omitempty"`
+	Vendor string `json:"vendor,omitempty"`
+	Model  string `json:"model,omitempty"`
+}
+
 // ServeHTTP handles inspection report submissions
 func (h *InspectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log := h.Log.WithValues("method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
@@ -104,14 +124,46 @@ func (h *InspectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := r.Context()
+	physicalHost := &infrastructurev1beta1.PhysicalHost{}
+	if err := h.Client.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: req.HostName}, physicalHost); err != nil {
+		if errors.IsNotFound(err) {
+			http.Error(w, fmt.Sprintf("PhysicalHost %s/%s not found", req.Namespace, req.HostName), http.StatusNotFound)
+			return
+		}
+		log.Error(err, "Failed to get PhysicalHost")
+		http.Error(w, fmt.Sprintf("Failed to get PhysicalHost: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Authenticate the report against the token minted for this inspection
+	token := requestToken(r)
+	if token == "" {
+		token = req.Token
+	}
+	if reason := validateInspectionToken(physicalHost, token, time.Now()); reason != "" {
+		log.Info("Rejected inspection report", "reason", reason)
+		metrics.RecordInspectionReportRejection(req.Namespace, reason)
+		if h.Recorder != nil {
+			h.Recorder.Eventf(physicalHost, corev1.EventTypeWarning, "InspectionReportRejected",
+				"Rejected inspection report from %s: %s", r.RemoteAddr, reason)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	// Update PhysicalHost with inspection report
-	ctx := context.Background()
-	if err := h.updatePhysicalHost(ctx, req); err != nil {
+	if err := h.updatePhysicalHost(ctx, physicalHost, req); err != nil {
 		log.Error(err, "Failed to update PhysicalHost")
 		http.Error(w, fmt.Sprintf("Failed to update PhysicalHost: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// The token is spent, drop the copy handed to the boot script handler
+	if err := deleteInspectionToken(ctx, h.Client, physicalHost); err != nil {
+		log.Error(err, "Failed to delete used inspection token")
+	}
+
 	log.Info("Successfully updated PhysicalHost with inspection report")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(map[string]string{
@@ -122,22 +174,9 @@ func (h *InspectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// updatePhysicalHost updates the PhysicalHost with inspection report data
-func (h *InspectionHandler) updatePhysicalHost(ctx context.Context, req InspectionReportRequest) error {
-	// Get PhysicalHost
-	physicalHost := &infrastructurev1beta1.PhysicalHost{}
-	key := types.NamespacedName{
-		Namespace: req.Namespace,
-		Name:      req.HostName,
-	}
-
-	if err := h.Client.Get(ctx, key, physicalHost); err != nil {
-		if errors.IsNotFound(err) {
-			return fmt.Errorf("PhysicalHost %s/%s not found", req.Namespace, req.HostName)
-		}
-		return fmt.Errorf("failed to get PhysicalHost: %w", err)
-	}
-
+// updatePhysicalHost updates the PhysicalHost with inspection report data and marks
+// the inspection token as used
+func (h *InspectionHandler) updatePhysicalHost(ctx context.Context, physicalHost *infrastructurev1beta1.PhysicalHost, req InspectionReportRequest) error {
 	// Convert request data to InspectionReport
 	report := &infrastructurev1beta1.InspectionReport{
 		Timestamp:        metav1.Now(),
@@ -160,14 +199,19 @@ func (h *InspectionHandler) updatePhysicalHost(ctx context.Context, req Inspecti
 		})
 	}
 
-	// Convert Memory
+	// Convert Memory, keeping modules whose capacity cannot be parsed without a size
 	for _, mem := range req.Memory {
-		report.Memory = append(report.Memory, infrastructurev1beta1.MemoryInfo{
+		info := infrastructurev1beta1.MemoryInfo{
 			ID:       mem.ID,
 			Type:     mem.Type,
 			Capacity: mem.Capacity,
+			Size:     mem.Size,
 			Speed:    mem.Speed,
-		})
+		}
+		if size, ok := memorySize(info); ok {
+			info.Size = &size
+		}
+		report.Memory = append(report.Memory, info)
 	}
 
 	// Convert Disks
@@ -178,23 +222,39 @@ func (h *InspectionHandler) updatePhysicalHost(ctx context.Context, req Inspecti
 			SizeGB:       disk.SizeGB,
 			Type:         disk.Type,
 			SerialNumber: disk.SerialNumber,
+			WWN:          disk.WWN,
+			Rotational:   disk.Rotational,
 		})
 	}
 
 	// Convert NICs
 	for _, nic := range req.NICs {
-		report.NICs = append(report.NICs, infrastructurev1beta1.NICInfo{
+		info := infrastructurev1beta1.NICInfo{
 			Name:        nic.Name,
 			MACAddress:  nic.MACAddress,
 			Driver:      nic.Driver,
 			Speed:       nic.Speed,
+			SpeedMbps:   nic.SpeedMbps,
 			IPAddresses: nic.IPAddresses,
+		}
+		info.SpeedMbps = nicSpeedMbps(info)
+		report.NICs = append(report.NICs, info)
+	}
+
+	// Convert GPUs
+	for _, gpu := range req.GPUs {
+		report.GPUs = append(report.GPUs, infrastructurev1beta1.GPUInfo{
+			ID:     gpu.ID,
+			Vendor: gpu.Vendor,
+			Model:  gpu.Model,
 		})
 	}
 
 	// Update PhysicalHost status
 	physicalHost.Status.InspectionReport = report
 	physicalHost.Status.InspectionPhase = infrastructurev1beta1.InspectionComplete
+	now := metav1.Now()
+	physicalHost.Status.InspectionToken.UsedAt = &now
 
 	if err := h.Client.Status().Update(ctx, physicalHost); err != nil {
 		return fmt.Errorf("failed to update PhysicalHost status: %w", err)
@@ -202,56 +262,3 @@ func (h *InspectionHandler) updatePhysicalHost(ctx context.Context, req Inspecti
 
 	return nil
 }
-
-// SetupInspectionServer sets up the HTTP server for inspection reports
-func SetupInspectionServer(mgr ctrl.Manager, port int) error {
-	handler := &InspectionHandler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("inspection-handler"),
-	}
-
-	mux := http.NewServeMux()
-	mux.Handle("/api/v1/inspection", handler)
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("ok")); err != nil {
-			ctrl.Log.WithName("inspection-server").Error(err, "Failed to write health check response")
-		}
-	})
-
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
-		Handler:      mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
-
-	// Start server in goroutine
-	go func() {
-		ctrl.Log.WithName("inspection-server").Info("Starting inspection HTTP server", "port", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			ctrl.Log.WithName("inspection-server").Error(err, "Failed to start inspection HTTP server")
-		}
-	}()
-
-	// Register shutdown with manager
-	if err := mgr.Add(&inspectionServerRunnable{server: server}); err != nil {
-		return fmt.Errorf("failed to add inspection server to manager: %w", err)
-	}
-
-	return nil
-}
-
-// inspectionServerRunnable implements manager.Runnable for graceful shutdown
-type inspectionServerRunnable struct {
-	server *http.Server
-}
-
-func (r *inspectionServerRunnable) Start(ctx context.Context) error {
-	<-ctx.Done()
-	ctrl.Log.WithName("inspection-server").Info("Shutting down inspection HTTP server")
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	return r.server.Shutdown(shutdownCtx)
-}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+var _ = Describe("InspectionHandler", func() {
+	var (
+		testNs       *corev1.Namespace
+		physicalHost *infrastructurev1beta1.PhysicalHost
+		recorder     *record.FakeRecorder
+		handler      *InspectionHandler
+		token        string
+	)
+
+	report := func(token string) int {
+		body, err := json.Marshal(InspectionReportRequest{
+			Namespace:    testNs.Name,
+			HostName:     physicalHost.Name,
+			Manufacturer: "Dell Inc.",
+			SerialNumber: "ABC123",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, InspectionPath, bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	getHost := func() *infrastructurev1beta1.PhysicalHost {
+		host := &infrastructurev1beta1.PhysicalHost{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: testNs.Name, Name: physicalHost.Name}, host)).To(Succeed())
+		return host
+	}
+
+	BeforeEach(func() {
+		testNs = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "inspection-test-"},
+		}
+		Expect(k8sClient.Create(ctx, testNs)).To(Succeed())
+
+		physicalHost = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				RedfishConnection: infrastructurev1beta1.RedfishConnection{
+					Address:              "https://192.168.1.100",
+					CredentialsSecretRef: "test-bmc-creds",
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, physicalHost)).To(Succeed())
+		Expect(mintInspectionToken(ctx, k8sClient, k8sClient.Scheme(), physicalHost, time.Minute)).To(Succeed())
+		physicalHost.Status.State = infrastructurev1beta1.StateInspecting
+		Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+
+		var err error
+		token, err = getInspectionToken(ctx, k8sClient, physicalHost)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).NotTo(BeEmpty())
+
+		recorder = record.NewFakeRecorder(10)
+		handler = &InspectionHandler{
+			Client:   k8sClient,
+			Log:      ctrl.Log.WithName("inspection-handler-test"),
+			Recorder: recorder,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, testNs)).To(Succeed())
+	})
+
+	It("should store only the hash of the token", func() {
+		Expect(physicalHost.Status.InspectionToken.Hash).NotTo(BeEmpty())
+		Expect(physicalHost.Status.InspectionToken.Hash).NotTo(Equal(token))
+	})
+
+	It("should accept a report with the minted token once", func() {
+		Expect(report(token)).To(Equal(http.StatusOK))
+
+		host := getHost()
+		Expect(host.Status.InspectionPhase).To(Equal(infrastructurev1beta1.InspectionPhaseComplete))
+		Expect(host.Status.InspectionReport.SerialNumber).To(Equal("ABC123"))
+		Expect(host.Status.InspectionToken.UsedAt).NotTo(BeNil())
+
+		remaining, err := getInspectionToken(ctx, k8sClient, host)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(BeEmpty())
+
+		By("rejecting the same token again")
+		Expect(report(token)).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Events).To(Receive(ContainSubstring("reused_token")))
+	})
+
+	It("should reject reports without a token", func() {
+		Expect(report("")).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Events).To(Receive(ContainSubstring("missing_token")))
+		Expect(getHost().Status.InspectionReport).To(BeNil())
+	})
+
+	It("should reject reports with a wrong token", func() {
+		Expect(report("not-the-token")).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Events).To(Receive(ContainSubstring("invalid_token")))
+	})
+
+	It("should reject reports with an expired token", func() {
+		physicalHost.Status.InspectionToken.ExpiresAt = metav1.NewTime(time.Now().Add(-time.Minute))
+		Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+
+		Expect(report(token)).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Events).To(Receive(ContainSubstring("expired_token")))
+	})
+})
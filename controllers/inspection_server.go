@@ -0,0 +1,263 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+)
+
+// DefaultInspectionServerBindAddress is the default address the inspection server listens on
+const DefaultInspectionServerBindAddress = ":8082"
+
+// InspectionServerOptions configures the inspection server.
+type InspectionServerOptions struct {
+	// BindAddress is the address the server listens on, e.g. ":8082".
+	BindAddress string
+
+	// CallbackURL is the externally reachable inspection report URL injected into
+	// boot scripts. When empty it is derived from each boot script request.
+	CallbackURL string
+
+	// CertFile and KeyFile enable TLS when both are set. Rotated certificates are
+	// picked up without a restart.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile enables client certificate verification. Inspection, wipe and
+	// provisioning requests must then present a certificate signed by one of these
+	// CAs, while boot scripts and bootstrap requests remain available to firmware
+	// without one.
+	ClientCAFile string
+}
+
+// SetupInspectionServer sets up the HTTP server for inspection and wipe reports, boot
+// scripts, provisioning and bootstrap data.
+func SetupInspectionServer(mgr ctrl.Manager, opts InspectionServerOptions) error {
+	log := ctrl.Log.WithName("inspection-server")
+
+	if opts.BindAddress == "" {
+		opts.BindAddress = DefaultInspectionServerBindAddress
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return fmt.Errorf("both a certificate and a key file are required to enable TLS")
+	}
+	if opts.ClientCAFile != "" && opts.CertFile == "" {
+		return fmt.Errorf("client certificate verification requires TLS")
+	}
+
+	var inspectionHandler http.Handler = &InspectionHandler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("inspection-handler"),
+		Recorder: mgr.GetEventRecorderFor("inspection-handler"),
+	}
+	var cleaningHandler http.Handler = &CleaningHandler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("cleaning-handler"),
+	}
+	var provisioningHandler http.Handler = &ProvisioningHandler{
+		Client:      mgr.GetClient(),
+		Log:         ctrl.Log.WithName("provisioning-handler"),
+		CallbackURL: opts.CallbackURL,
+	}
+	if opts.ClientCAFile != "" {
+		inspectionHandler = requireClientCertificate(inspectionHandler, log)
+		cleaningHandler = requireClientCertificate(cleaningHandler, log)
+		provisioningHandler = requireClientCertificate(provisioningHandler, log)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(InspectionPath, inspectionHandler)
+	mux.Handle(CleaningPath, cleaningHandler)
+	mux.Handle(BootScriptPath, &BootScriptHandler{
+		Client:      mgr.GetClient(),
+		Log:         ctrl.Log.WithName("boot-script-handler"),
+		CallbackURL: opts.CallbackURL,
+	})
+	mux.Handle(ProvisioningPath, provisioningHandler)
+	mux.Handle(BootstrapPath+"/", &BootstrapHandler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("bootstrap-handler"),
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("ok")); err != nil {
+			log.Error(err, "Failed to write health check response")
+		}
+	})
+
+	runnable := &inspectionServerRunnable{
+		log: log,
+		server: &http.Server{
+			Addr:         opts.BindAddress,
+			Handler:      mux,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		},
+	}
+
+	if opts.CertFile != "" {
+		watcher, err := certwatcher.New(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load inspection server certificate: %w", err)
+		}
+		runnable.certWatcher = watcher
+		runnable.server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: watcher.GetCertificate,
+		}
+
+		if opts.ClientCAFile != "" {
+			clientCAs := &reloadingCertPool{path: opts.ClientCAFile}
+			if _, err := clientCAs.get(); err != nil {
+				return err
+			}
+			baseConfig := runnable.server.TLSConfig
+			runnable.server.TLSConfig = &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				// Pick up rotated client CAs for every new connection
+				GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+					pool, err := clientCAs.get()
+					if err != nil {
+						return nil, err
+					}
+					config := baseConfig.Clone()
+					config.ClientCAs = pool
+					config.ClientAuth = tls.VerifyClientCertIfGiven
+					return config, nil
+				},
+			}
+		}
+	}
+
+	if err := mgr.Add(runnable); err != nil {
+		return fmt.Errorf("failed to add inspection server to manager: %w", err)
+	}
+
+	return nil
+}
+
+// requireClientCertificate rejects requests without a verified client certificate.
+func requireClientCertificate(next http.Handler, log logr.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			log.Info("Rejected request without verified client certificate", "path", r.URL.Path, "remote", r.RemoteAddr)
+			http.Error(w, "Client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reloadingCertPool loads a PEM CA bundle and reloads it when the file changes.
+type reloadingCertPool struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	pool    *x509.CertPool
+}
+
+// get returns the current CA pool, reloading the bundle if it was modified.
+func (p *reloadingCertPool) get() (*x509.CertPool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat client CA file: %w", err)
+	}
+	if p.pool != nil && info.ModTime().Equal(p.modTime) {
+		return p.pool, nil
+	}
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", p.path)
+	}
+	p.pool = pool
+	p.modTime = info.ModTime()
+	return pool, nil
+}
+
+// inspectionServerRunnable runs the inspection server as part of the manager. It does
+// not need leader election, so every replica serves boot scripts and reports.
+type inspectionServerRunnable struct {
+	log         logr.Logger
+	server      *http.Server
+	certWatcher *certwatcher.CertWatcher
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (r *inspectionServerRunnable) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves until the context is cancelled and then shuts the server down gracefully
+func (r *inspectionServerRunnable) Start(ctx context.Context) error {
+	if r.certWatcher != nil {
+		go func() {
+			if err := r.certWatcher.Start(ctx); err != nil {
+				r.log.Error(err, "Certificate watcher stopped")
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		r.log.Info("Starting inspection server", "address", r.server.Addr, "tls", r.server.TLSConfig != nil)
+		var err error
+		if r.server.TLSConfig != nil {
+			err = r.server.ListenAndServeTLS("", "")
+		} else {
+			err = r.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	select {
+	case err, ok := <-serveErr:
+		if ok {
+			return fmt.Errorf("inspection server failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	r.log.Info("Shutting down inspection server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return r.server.Shutdown(shutdownCtx)
+}
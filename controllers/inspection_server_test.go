@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("Inspection server", func() {
+	writeCA := func(path, commonName string, modTime time.Time) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: commonName},
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)).To(Succeed())
+		Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+	}
+
+	It("should reload the client CA bundle when it changes", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "ca.crt")
+		writeCA(path, "first-ca", time.Now().Add(-time.Hour))
+
+		pool := &reloadingCertPool{path: path}
+		first, err := pool.get()
+		Expect(err).NotTo(HaveOccurred())
+
+		same, err := pool.get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(same).To(BeIdenticalTo(first))
+
+		writeCA(path, "second-ca", time.Now())
+		second, err := pool.get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).NotTo(BeIdenticalTo(first))
+	})
+
+	It("should reject a client CA file without certificates", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "ca.crt")
+		Expect(os.WriteFile(path, []byte("not a certificate"), 0o600)).To(Succeed())
+
+		_, err := (&reloadingCertPool{path: path}).get()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should require a verified client certificate for protected handlers", func() {
+		handler := requireClientCertificate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), ctrl.Log.WithName("inspection-server-test"))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, InspectionPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+
+		req := httptest.NewRequest(http.MethodPost, InspectionPath, nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	"github.com/wrkode/beskar7/internal/metrics"
+	"github.com/wrkode/beskar7/internal/security"
+)
+
+// InspectionTokenSecretKey is the key holding the plain inspection token in the
+// handoff Secret read by the boot script handler.
+const InspectionTokenSecretKey = TokenSecretKey
+
+// inspectionTokenKind names the handoff Secret of the inspection token.
+const inspectionTokenKind = "inspection"
+
+// mintInspectionToken generates a one-time inspection token for the host. The plain
+// token is stored in a Secret owned by the host so the boot script handler can inject
+// it into the kernel arguments; only its hash is recorded in the host status.
+// The caller is responsible for persisting the host status.
+func mintInspectionToken(ctx context.Context, c client.Client, scheme *runtime.Scheme, host *infrastructurev1beta1.PhysicalHost, lifetime time.Duration) error {
+	token, hash, err := security.GenerateToken()
+	if err != nil {
+		return err
+	}
+	if err := storeHostToken(ctx, c, scheme, host, inspectionTokenKind, token); err != nil {
+		return err
+	}
+
+	host.Status.InspectionToken = &infrastructurev1beta1.InspectionToken{
+		Hash:      hash,
+		ExpiresAt: metav1.NewTime(time.Now().Add(lifetime)),
+	}
+	return nil
+}
+
+// getInspectionToken returns the plain inspection token of the host, or an empty
+// string if none has been minted or it has already been used.
+func getInspectionToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) (string, error) {
+	return getHostToken(ctx, c, host, inspectionTokenKind)
+}
+
+// takeInspectionToken returns the plain inspection token of the host if it has not
+// been handed out yet, and removes it so it is not handed out again.
+func takeInspectionToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) (string, error) {
+	return takeHostToken(ctx, c, host, inspectionTokenKind)
+}
+
+// deleteInspectionToken removes the handoff Secret of a used inspection token.
+func deleteInspectionToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) error {
+	return deleteHostToken(ctx, c, host, inspectionTokenKind)
+}
+
+// validateInspectionToken checks a presented token against the one minted for the
+// current inspection. It returns an empty reason if the token is accepted.
+func validateInspectionToken(host *infrastructurev1beta1.PhysicalHost, token string, now time.Time) metrics.InspectionRejectionReason {
+	if token == "" {
+		return metrics.InspectionRejectionMissingToken
+	}
+	stored := host.Status.InspectionToken
+	if stored == nil || !security.TokenMatchesHash(token, stored.Hash) {
+		return metrics.InspectionRejectionInvalidToken
+	}
+	if stored.UsedAt != nil {
+		return metrics.InspectionRejectionReusedToken
+	}
+	if now.After(stored.ExpiresAt.Time) {
+		return metrics.InspectionRejectionExpiredToken
+	}
+	return ""
+}
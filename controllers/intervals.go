@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	internalredfish "github.com/wrkode/beskar7/internal/redfish"
+)
+
+const (
+	// DefaultPollInterval is how often the controllers check on a host that is being
+	// inspected, provisioned, cleaned or updated.
+	DefaultPollInterval = 30 * time.Second
+
+	// DefaultHostWaitInterval is how long a Beskar7Machine waits before looking for an
+	// available PhysicalHost again, or checking on a host in Error.
+	DefaultHostWaitInterval = time.Minute
+
+	// DefaultPhysicalHostResyncPeriod is how often a PhysicalHost is reconciled to
+	// refresh its power state and hardware details from the BMC.
+	DefaultPhysicalHostResyncPeriod = 5 * time.Minute
+)
+
+// durationOrDefault returns d, or def if d is not set.
+func durationOrDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// inspectionTimeoutFor returns how long the machine waits for an inspection report,
+// defaulting to DefaultInspectionTimeout.
+func inspectionTimeoutFor(b7machine *infrastructurev1beta1.Beskar7Machine) time.Duration {
+	if b7machine.Spec.InspectionTimeout == nil {
+		return DefaultInspectionTimeout
+	}
+	return durationOrDefault(b7machine.Spec.InspectionTimeout.Duration, DefaultInspectionTimeout)
+}
+
+// provisioningTimeoutFor returns how long the machine waits for the installed OS to
+// report back, defaulting to DefaultProvisioningTimeout.
+func provisioningTimeoutFor(b7machine *infrastructurev1beta1.Beskar7Machine) time.Duration {
+	if b7machine.Spec.ProvisioningTimeout == nil {
+		return DefaultProvisioningTimeout
+	}
+	return durationOrDefault(b7machine.Spec.ProvisioningTimeout.Duration, DefaultProvisioningTimeout)
+}
+
+// cleaningTimeoutFor returns how long the cleaning image of the host may run,
+// defaulting to DefaultCleaningTimeout.
+func cleaningTimeoutFor(host *infrastructurev1beta1.PhysicalHost) time.Duration {
+	if host.Spec.CleaningTimeout == nil {
+		return DefaultCleaningTimeout
+	}
+	return durationOrDefault(host.Spec.CleaningTimeout.Duration, DefaultCleaningTimeout)
+}
+
+// pollInterval returns how often the machine checks on its host while it progresses.
+func (r *Beskar7MachineReconciler) pollInterval() time.Duration {
+	return durationOrDefault(r.PollInterval, DefaultPollInterval)
+}
+
+// hostWaitInterval returns how long the machine waits for a host to become usable.
+func (r *Beskar7MachineReconciler) hostWaitInterval() time.Duration {
+	return durationOrDefault(r.HostWaitInterval, DefaultHostWaitInterval)
+}
+
+// powerActionOptions returns how long the machine waits for its host to power off or on.
+func (r *Beskar7MachineReconciler) powerActionOptions() internalredfish.PowerActionOptions {
+	return internalredfish.PowerActionOptions{GracefulTimeout: r.GracefulShutdownTimeout}
+}
+
+// pollInterval returns how often the host is checked on while it is being cleaned or
+// its firmware is updated.
+func (r *PhysicalHostReconciler) pollInterval() time.Duration {
+	return durationOrDefault(r.PollInterval, DefaultPollInterval)
+}
+
+// resyncPeriod returns how often an idle host is reconciled.
+func (r *PhysicalHostReconciler) resyncPeriod() time.Duration {
+	return durationOrDefault(r.ResyncPeriod, DefaultPhysicalHostResyncPeriod)
+}
+
+// powerActionOptions returns how long the host waits to power off or on.
+func (r *PhysicalHostReconciler) powerActionOptions() internalredfish.PowerActionOptions {
+	return internalredfish.PowerActionOptions{GracefulTimeout: r.GracefulShutdownTimeout}
+}
@@ -52,6 +52,20 @@ type PhysicalHostReconciler struct {
 	Scheme               *runtime.Scheme
 	Recorder             record.EventRecorder
 	RedfishClientFactory internalredfish.RedfishClientFactory
+
+	// PollInterval is how often a host is checked on while it is being cleaned or its
+	// firmware is updated. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// ResyncPeriod is how often an idle host is reconciled to refresh its state from
+	// the BMC. Defaults to DefaultPhysicalHostResyncPeriod.
+	ResyncPeriod time.Duration
+	// GracefulShutdownTimeout is how long a released host may take to shut down
+	// gracefully before it is forced off. Defaults to
+	// internalredfish.DefaultGracefulShutdownTimeout.
+	GracefulShutdownTimeout time.Duration
+	// BootScriptURL is the externally reachable boot script URL released hosts of
+	// UEFIHTTP machines are pointed at for cleaning. When empty, they are PXE booted.
+	BootScriptURL string
 }
 
 // NewPhysicalHostReconciler creates a new PhysicalHostReconciler
@@ -74,7 +88,7 @@ func NewPhysicalHostReconciler(
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=physicalhosts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=physicalhosts/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=physicalhosts/finalizers,verbs=update
-//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile handles PhysicalHost reconciliation.
@@ -109,6 +123,14 @@ func (r *PhysicalHostReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{Requeue: true}, nil
 	}
 
+	// Handle a retry requested by an operator
+	if _, ok := physicalHost.Annotations[infrastructurev1beta1.RetryAnnotation]; ok {
+		if err := r.acknowledgeRetryRequest(ctx, logger, physicalHost); err != nil {
+			logger.Error(err, "Failed to acknowledge retry request")
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Reconcile normal operation
 	return r.reconcileNormal(ctx, logger, physicalHost)
 }
@@ -121,7 +143,7 @@ func (r *PhysicalHostReconciler) reconcileNormal(ctx context.Context, logger log
 	username, password, err := r.getRedfishCredentials(ctx, physicalHost)
 	if err != nil {
 		logger.Error(err, "Failed to get Redfish credentials")
-		r.updateStatus(physicalHost, infrastructurev1beta1.StateError, false, err.Error())
+		failHost(physicalHost, infrastructurev1beta1.MissingCredentialsReason, err.Error())
 		conditions.MarkFalse(physicalHost, infrastructurev1beta1.RedfishConnectionReadyCondition,
 			infrastructurev1beta1.MissingCredentialsReason, clusterv1.ConditionSeverityError,
 			"Failed to retrieve credentials: %v", err)
@@ -129,7 +151,7 @@ func (r *PhysicalHostReconciler) reconcileNormal(ctx context.Context, logger log
 			logger.Error(updateErr, "Failed to update status")
 			return ctrl.Result{}, updateErr
 		}
-		return ctrl.Result{RequeueAfter: 1 * time.Minute}, err
+		return waitForRetry(logger, physicalHost), nil
 	}
 
 	// Determine insecure setting
@@ -147,14 +169,15 @@ func (r *PhysicalHostReconciler) reconcileNormal(ctx context.Context, logger log
 	)
 	if err != nil {
 		logger.Error(err, "Failed to create Redfish client")
-		r.updateStatus(physicalHost, infrastructurev1beta1.StateError, false, fmt.Sprintf("Redfish connection failed: %v", err))
+		failHost(physicalHost, infrastructurev1beta1.RedfishConnectionFailedReason, fmt.Sprintf("Redfish connection failed: %v", err))
 		conditions.MarkFalse(physicalHost, infrastructurev1beta1.RedfishConnectionReadyCondition,
 			infrastructurev1beta1.RedfishConnectionFailedReason, clusterv1.ConditionSeverityError,
 			"Connection failed: %v", err)
 		if updateErr := r.Status().Update(ctx, physicalHost); updateErr != nil {
 			logger.Error(updateErr, "Failed to update status")
+			return ctrl.Result{}, updateErr
 		}
-		return ctrl.Result{RequeueAfter: 1 * time.Minute}, err
+		return waitForRetry(logger, physicalHost), nil
 	}
 	defer rfClient.Close(ctx)
 
@@ -162,14 +185,15 @@ func (r *PhysicalHostReconciler) reconcileNormal(ctx context.Context, logger log
 	sysInfo, err := rfClient.GetSystemInfo(ctx)
 	if err != nil {
 		logger.Error(err, "Failed to get system info from Redfish")
-		r.updateStatus(physicalHost, infrastructurev1beta1.StateError, false, fmt.Sprintf("Failed to query system: %v", err))
+		failHost(physicalHost, infrastructurev1beta1.RedfishQueryFailedReason, fmt.Sprintf("Failed to query system: %v", err))
 		conditions.MarkFalse(physicalHost, infrastructurev1beta1.RedfishConnectionReadyCondition,
 			infrastructurev1beta1.RedfishQueryFailedReason, clusterv1.ConditionSeverityError,
 			"Query failed: %v", err)
 		if updateErr := r.Status().Update(ctx, physicalHost); updateErr != nil {
 			logger.Error(updateErr, "Failed to update status")
+			return ctrl.Result{}, updateErr
 		}
-		return ctrl.Result{RequeueAfter: 1 * time.Minute}, err
+		return waitForRetry(logger, physicalHost), nil
 	}
 
 	// Update hardware details
@@ -177,6 +201,7 @@ func (r *PhysicalHostReconciler) reconcileNormal(ctx context.Context, logger log
 		Manufacturer: sysInfo.Manufacturer,
 		Model:        sysInfo.Model,
 		SerialNumber: sysInfo.SerialNumber,
+		MACAddresses: sysInfo.MACAddresses,
 		Status: infrastructurev1beta1.HardwareStatus{
 			Health:       string(sysInfo.Status.Health),
 			HealthRollup: string(sysInfo.Status.HealthRollup),
@@ -204,24 +229,46 @@ func (r *PhysicalHostReconciler) reconcileNormal(ctx context.Context, logger log
 		logger.Info("Retrieved network addresses", "count", len(addresses))
 	}
 
+	// Read the firmware versions
+	inventory, err := rfClient.GetFirmwareInventory(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to get firmware inventory")
+		// Non-fatal, not every BMC has an update service
+	} else {
+		physicalHost.Status.FirmwareInventory = firmwareInventoryFor(inventory)
+	}
+
 	// Connection successful - mark as ready
 	conditions.MarkTrue(physicalHost, infrastructurev1beta1.RedfishConnectionReadyCondition)
+	r.recoverFromBMCFailure(logger, physicalHost)
 
 	// Determine state based on ConsumerRef
+	var result ctrl.Result
 	if physicalHost.Spec.ConsumerRef != nil {
-		// Host is claimed
-		if physicalHost.Status.State != infrastructurev1beta1.StateInUse &&
-			physicalHost.Status.State != infrastructurev1beta1.StateInspecting &&
-			physicalHost.Status.State != infrastructurev1beta1.StateReady {
+		// Host is claimed. A failed inspection keeps the host in Error until its retry
+		// is due; identity mismatches are only retried on request, so a miswired host
+		// is not inspected again for the same consumer by accident.
+		deferFirmwareUpdate(physicalHost)
+		switch physicalHost.Status.State {
+		case infrastructurev1beta1.StateError:
+			result = r.retryClaimedHost(logger, physicalHost)
+		case infrastructurev1beta1.StateInUse, infrastructurev1beta1.StateInspecting, infrastructurev1beta1.StateReady:
+			// Driven by the Beskar7Machine controller, only the firmware settings of the
+			// consumer are kept in place
+			r.reconcileClaimedFirmwareSettings(ctx, logger, rfClient, physicalHost)
+		default:
 			logger.Info("Host claimed, transitioning to InUse", "consumer", physicalHost.Spec.ConsumerRef.Name)
 			r.updateStatus(physicalHost, infrastructurev1beta1.StateInUse, true, "")
 		}
 	} else {
-		// Host is available
-		if physicalHost.Status.State != infrastructurev1beta1.StateAvailable {
-			logger.Info("Host available, transitioning to Available")
-			r.updateStatus(physicalHost, infrastructurev1beta1.StateAvailable, true, "")
-			conditions.MarkTrue(physicalHost, infrastructurev1beta1.HostAvailableCondition)
+		// Host is released, clean it before it becomes available again. The firmware
+		// settings and root device of the previous consumer no longer apply.
+		conditions.Delete(physicalHost, infrastructurev1beta1.FirmwareSettingsAppliedCondition)
+		conditions.Delete(physicalHost, infrastructurev1beta1.StorageConfiguredCondition)
+		physicalHost.Status.RootDevice = ""
+		result, err = r.reconcileUnclaimed(ctx, logger, rfClient, physicalHost)
+		if err != nil {
+			return ctrl.Result{}, err
 		}
 	}
 
@@ -232,7 +279,10 @@ func (r *PhysicalHostReconciler) reconcileNormal(ctx context.Context, logger log
 	}
 
 	logger.Info("Reconciliation complete", "state", physicalHost.Status.State, "ready", physicalHost.Status.Ready)
-	return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+	if !result.IsZero() {
+		return result, nil
+	}
+	return ctrl.Result{RequeueAfter: r.resyncPeriod()}, nil
 }
 
 // reconcileDelete handles PhysicalHost deletion.
@@ -299,8 +349,12 @@ func (r *PhysicalHostReconciler) updateStatus(ph *infrastructurev1beta1.Physical
 	ph.Status.ErrorMessage = errorMsg
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. Without a Recorder, events
+// are recorded through the Manager.
 func (r *PhysicalHostReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("physicalhost-controller")
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1beta1.PhysicalHost{}).
 		Watches(
@@ -11,11 +11,14 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	conditions "sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
 	internalredfish "github.com/wrkode/beskar7/internal/redfish"
@@ -182,9 +185,10 @@ var _ = Describe("PhysicalHost Controller", func() {
 			_, err := failedReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: phLookupKey})
 			Expect(err).NotTo(HaveOccurred()) // First reconcile adds finalizer
 
-			_, err = failedReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: phLookupKey})
-			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("connection timeout"))
+			result, err := failedReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: phLookupKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(result.RequeueAfter).To(BeNumerically("<=", retryBackoff(0)))
 
 			By("Checking error conditions")
 			Eventually(func(g Gomega) {
@@ -193,6 +197,10 @@ var _ = Describe("PhysicalHost Controller", func() {
 				g.Expect(cond).NotTo(BeNil())
 				g.Expect(cond.Status).To(Equal(corev1.ConditionFalse))
 				g.Expect(failedPh.Status.State).To(Equal(infrastructurev1beta1.StateError))
+				g.Expect(failedPh.Status.ErrorMessage).To(ContainSubstring("connection timeout"))
+				g.Expect(failedPh.Status.NextRetryTime).NotTo(BeNil())
+				g.Expect(failedPh.Status.FailureHistory).To(HaveLen(1))
+				g.Expect(failedPh.Status.FailureHistory[0].Reason).To(Equal(infrastructurev1beta1.RedfishConnectionFailedReason))
 			}, Timeout, Interval).Should(Succeed())
 		})
 
@@ -397,3 +405,26 @@ var _ = Describe("PhysicalHost Controller", func() {
 		})
 	})
 })
+
+// newManagedPhysicalHostReconciler builds a PhysicalHostReconciler like
+// cmd/manager/main.go and sets it up with a manager that is never started. The event
+// recorder is left to SetupWithManager, so specs catch dependencies only tests provide.
+func newManagedPhysicalHostReconciler() *PhysicalHostReconciler {
+	skipNameValidation := true
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:                 scheme.Scheme,
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+		Controller:             config.Controller{SkipNameValidation: &skipNameValidation},
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	reconciler := &PhysicalHostReconciler{
+		Client:               mgr.GetClient(),
+		Scheme:               mgr.GetScheme(),
+		RedfishClientFactory: nil,
+		Log:                  ctrl.Log.WithName("controllers").WithName("PhysicalHost"),
+	}
+	Expect(reconciler.SetupWithManager(mgr)).To(Succeed())
+	return reconciler
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	"github.com/wrkode/beskar7/internal/security"
+)
+
+const (
+	// ProvisioningPath is the path used to fetch provisioning instructions and
+	// to report the result of the target OS installation.
+	ProvisioningPath = "/api/v1/provisioning"
+
+	// ProvisioningActionWait tells the host to poll again later
+	ProvisioningActionWait = "wait"
+	// ProvisioningActionProvision tells the host to install the target image
+	ProvisioningActionProvision = "provision"
+)
+
+// ProvisioningHandler hands the target image and configuration to hosts that
+// passed inspection and records the result reported by the installed OS. Polls must
+// present the inspection or provisioning token of the host, reports the one-time
+// provisioning token.
+type ProvisioningHandler struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// CallbackURL is the externally reachable inspection report URL the bootstrap data
+	// URL is resolved against. When empty it is derived from the incoming request.
+	CallbackURL string
+}
+
+// ProvisioningInstructions is the JSON response to a provisioning poll
+type ProvisioningInstructions struct {
+	Action           string `json:"action"`
+	TargetImageURL   string `json:"targetImageURL,omitempty"`
+	ConfigurationURL string `json:"configurationURL,omitempty"`
+	// RootDevice is the disk to install the target image to, empty to let the image choose
+	RootDevice string `json:"rootDevice,omitempty"`
+	// BootstrapDataURL is the authenticated URL of the Machine's bootstrap data, empty
+	// if the Machine has none
+	BootstrapDataURL string `json:"bootstrapDataURL,omitempty"`
+	// Token is the one-time token the installed OS reports the provisioning result with
+	Token string `json:"token,omitempty"`
+}
+
+// ProvisioningStatusRequest is the JSON payload reported by the installed OS
+type ProvisioningStatusRequest struct {
+	// Namespace and name to identify the PhysicalHost
+	Namespace string `json:"namespace"`
+	HostName  string `json:"hostName"`
+
+	// Token is the provisioning token handed to the host in its boot script or
+	// provisioning instructions. It may also be sent as a bearer token.
+	Token string `json:"token,omitempty"`
+
+	// Phase is either Provisioned or Failed
+	Phase infrastructurev1beta1.ProvisioningPhase `json:"phase"`
+
+	// Message optionally describes a failure
+	Message string `json:"message,omitempty"`
+}
+
+// ServeHTTP handles provisioning polls (GET) and status reports (POST)
+func (h *ProvisioningHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := h.Log.WithValues("method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+
+	switch r.Method {
+	case http.MethodGet:
+		h.serveInstructions(w, r, log)
+	case http.MethodPost:
+		h.serveStatusReport(w, r, log)
+	default:
+		log.Info("Method not allowed", "method", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveInstructions returns the target image and configuration once the host
+// has entered the Provisioning phase.
+func (h *ProvisioningHandler) serveInstructions(w http.ResponseWriter, r *http.Request, log logr.Logger) {
+	namespace := r.URL.Query().Get("namespace")
+	hostName := r.URL.Query().Get("hostName")
+	if namespace == "" || hostName == "" {
+		http.Error(w, "namespace and hostName are required", http.StatusBadRequest)
+		return
+	}
+	log = log.WithValues("namespace", namespace, "host", hostName)
+
+	host, err := h.getHost(r.Context(), namespace, hostName)
+	if err != nil {
+		log.Info("PhysicalHost not found", "error", err.Error())
+		// Do not reveal which hosts exist to unauthenticated callers
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !provisioningPollAuthorized(host, requestToken(r)) {
+		log.Info("Rejected provisioning poll with missing or invalid token")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	b7machine, err := getConsumerBeskar7Machine(r.Context(), h.Client, host)
+	if err != nil {
+		log.Error(err, "Failed to get consumer of PhysicalHost")
+		http.Error(w, fmt.Sprintf("Failed to get consumer of PhysicalHost: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	instructions := ProvisioningInstructions{Action: ProvisioningActionWait}
+	if b7machine != nil &&
+		host.Status.State == infrastructurev1beta1.StateReady &&
+		host.Status.ProvisioningPhase == infrastructurev1beta1.ProvisioningPhaseProvisioning {
+		token, err := getProvisioningToken(r.Context(), h.Client, host)
+		if err != nil {
+			log.Error(err, "Failed to get provisioning token")
+			http.Error(w, fmt.Sprintf("Failed to get provisioning token: %v", err), http.StatusInternalServerError)
+			return
+		}
+		bootstrapURL, err := getBootstrapDataURL(r.Context(), h.Client, host, apiURL(r, h.CallbackURL, BootstrapPath))
+		if err != nil {
+			log.Error(err, "Failed to get bootstrap token")
+			http.Error(w, fmt.Sprintf("Failed to get bootstrap token: %v", err), http.StatusInternalServerError)
+			return
+		}
+		instructions = ProvisioningInstructions{
+			Action:           ProvisioningActionProvision,
+			TargetImageURL:   b7machine.Spec.TargetImageURL,
+			ConfigurationURL: b7machine.Spec.ConfigurationURL,
+			RootDevice:       host.Status.RootDevice,
+			BootstrapDataURL: bootstrapURL,
+			Token:            token,
+		}
+		if instructions.ConfigurationURL == "" {
+			// The bootstrap data is the configuration, as in the boot script
+			instructions.ConfigurationURL = bootstrapURL
+		}
+		log.Info("Handing target image to host", "targetImageURL", instructions.TargetImageURL, "rootDevice", instructions.RootDevice)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(instructions); err != nil {
+		log.Error(err, "Failed to encode response")
+	}
+}
+
+// serveStatusReport records the installation result reported by the host. The
+// provisioning token is cleared once the result is recorded, so it is only accepted once.
+func (h *ProvisioningHandler) serveStatusReport(w http.ResponseWriter, r *http.Request, log logr.Logger) {
+	var req ProvisioningStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(err, "Failed to decode provisioning status")
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	log = log.WithValues("namespace", req.Namespace, "host", req.HostName, "phase", req.Phase)
+	log.Info("Received provisioning status")
+
+	if req.Namespace == "" || req.HostName == "" {
+		http.Error(w, "namespace and hostName are required", http.StatusBadRequest)
+		return
+	}
+	if req.Phase != infrastructurev1beta1.ProvisioningPhaseProvisioned &&
+		req.Phase != infrastructurev1beta1.ProvisioningPhaseFailed {
+		http.Error(w, fmt.Sprintf("phase must be %q or %q",
+			infrastructurev1beta1.ProvisioningPhaseProvisioned, infrastructurev1beta1.ProvisioningPhaseFailed),
+			http.StatusBadRequest)
+		return
+	}
+
+	host, err := h.getHost(r.Context(), req.Namespace, req.HostName)
+	if err != nil {
+		log.Info("PhysicalHost not found", "error", err.Error())
+		// Do not reveal which hosts exist to unauthenticated callers
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token := requestToken(r)
+	if token == "" {
+		token = req.Token
+	}
+	if token == "" {
+		log.Info("Rejected provisioning status without token")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !security.TokenMatchesHash(token, host.Status.ProvisioningTokenHash) {
+		log.Info("Rejected provisioning status with invalid or used token")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if host.Status.ProvisioningPhase != infrastructurev1beta1.ProvisioningPhaseProvisioning {
+		log.Info("PhysicalHost is not provisioning", "currentPhase", host.Status.ProvisioningPhase)
+		http.Error(w, fmt.Sprintf("PhysicalHost is not provisioning (phase %q)", host.Status.ProvisioningPhase), http.StatusConflict)
+		return
+	}
+
+	host.Status.ProvisioningPhase = req.Phase
+	host.Status.ProvisioningTokenHash = ""
+	if req.Phase == infrastructurev1beta1.ProvisioningPhaseFailed {
+		host.Status.ErrorMessage = fmt.Sprintf("Provisioning failed: %s", req.Message)
+	}
+	if err := h.Client.Status().Update(r.Context(), host); err != nil {
+		log.Error(err, "Failed to update PhysicalHost")
+		http.Error(w, fmt.Sprintf("Failed to update PhysicalHost: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := deleteProvisioningToken(r.Context(), h.Client, host); err != nil {
+		// The token can no longer be used, only the handoff Secret is left behind
+		log.Error(err, "Failed to delete used provisioning token")
+	}
+
+	log.Info("Successfully recorded provisioning status")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Provisioning status recorded",
+	}); err != nil {
+		log.Error(err, "Failed to encode response")
+	}
+}
+
+// getHost returns the PhysicalHost a request refers to.
+func (h *ProvisioningHandler) getHost(ctx context.Context, namespace, hostName string) (*infrastructurev1beta1.PhysicalHost, error) {
+	host := &infrastructurev1beta1.PhysicalHost{}
+	if err := h.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: hostName}, host); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("PhysicalHost %s/%s not found", namespace, hostName)
+		}
+		return nil, fmt.Errorf("failed to get PhysicalHost: %w", err)
+	}
+	return host, nil
+}
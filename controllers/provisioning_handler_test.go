@@ -0,0 +1,234 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+)
+
+var _ = Describe("ProvisioningHandler", func() {
+	var (
+		testNs       *corev1.Namespace
+		physicalHost *infrastructurev1beta1.PhysicalHost
+		handler      *ProvisioningHandler
+
+		inspectionToken   string
+		provisioningToken string
+	)
+
+	pollWithToken := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, ProvisioningPath+"?namespace="+testNs.Name+"&hostName=test-host", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	poll := func() ProvisioningInstructions {
+		rec := pollWithToken(inspectionToken)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var instructions ProvisioningInstructions
+		Expect(json.NewDecoder(rec.Body).Decode(&instructions)).To(Succeed())
+		return instructions
+	}
+
+	reportWithToken := func(phase infrastructurev1beta1.ProvisioningPhase, token string) int {
+		body, err := json.Marshal(ProvisioningStatusRequest{Namespace: testNs.Name, HostName: "test-host", Token: token, Phase: phase, Message: "disk not found"})
+		Expect(err).NotTo(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, ProvisioningPath, bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	report := func(phase infrastructurev1beta1.ProvisioningPhase) int {
+		return reportWithToken(phase, provisioningToken)
+	}
+
+	getHost := func() *infrastructurev1beta1.PhysicalHost {
+		host := &infrastructurev1beta1.PhysicalHost{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: testNs.Name, Name: "test-host"}, host)).To(Succeed())
+		return host
+	}
+
+	BeforeEach(func() {
+		testNs = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "provisioning-test-"},
+		}
+		Expect(k8sClient.Create(ctx, testNs)).To(Succeed())
+
+		b7machine := &infrastructurev1beta1.Beskar7Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.Beskar7MachineSpec{
+				InspectionImageURL: "http://boot-server/ipxe/inspect.ipxe",
+				TargetImageURL:     "http://boot-server/images/kairos.tar.gz",
+				ConfigurationURL:   "http://boot-server/configs/node.yaml",
+			},
+		}
+		Expect(k8sClient.Create(ctx, b7machine)).To(Succeed())
+
+		physicalHost = &infrastructurev1beta1.PhysicalHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: testNs.Name},
+			Spec: infrastructurev1beta1.PhysicalHostSpec{
+				RedfishConnection: infrastructurev1beta1.RedfishConnection{
+					Address:              "https://192.168.1.100",
+					CredentialsSecretRef: "test-bmc-creds",
+				},
+				ConsumerRef: &corev1.ObjectReference{
+					Name:      b7machine.Name,
+					Namespace: b7machine.Namespace,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, physicalHost)).To(Succeed())
+		physicalHost.Status.State = infrastructurev1beta1.StateReady
+		Expect(mintInspectionToken(ctx, k8sClient, k8sClient.Scheme(), physicalHost, time.Minute)).To(Succeed())
+		Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+		var err error
+		inspectionToken, err = getInspectionToken(ctx, k8sClient, physicalHost)
+		Expect(err).NotTo(HaveOccurred())
+		provisioningToken = ""
+
+		handler = &ProvisioningHandler{
+			Client: k8sClient,
+			Log:    ctrl.Log.WithName("provisioning-handler-test"),
+		}
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, testNs)).To(Succeed())
+	})
+
+	It("should tell the host to wait until provisioning started", func() {
+		Expect(poll().Action).To(Equal(ProvisioningActionWait))
+		Expect(report(infrastructurev1beta1.ProvisioningPhaseProvisioned)).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should reject polls without a valid token", func() {
+		Expect(pollWithToken("").Code).To(Equal(http.StatusUnauthorized))
+		Expect(pollWithToken("not-the-token").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should not reveal which hosts exist", func() {
+		req := httptest.NewRequest(http.MethodGet, ProvisioningPath+"?namespace="+testNs.Name+"&hostName=unknown-host", nil)
+		req.Header.Set("Authorization", "Bearer "+inspectionToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+
+		body, err := json.Marshal(ProvisioningStatusRequest{Namespace: testNs.Name, HostName: "unknown-host", Token: "not-the-token", Phase: infrastructurev1beta1.ProvisioningPhaseProvisioned})
+		Expect(err).NotTo(HaveOccurred())
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, ProvisioningPath, bytes.NewReader(body)))
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	Context("when the host is provisioning", func() {
+		BeforeEach(func() {
+			physicalHost.Status.ProvisioningPhase = infrastructurev1beta1.ProvisioningPhaseProvisioning
+			Expect(mintProvisioningToken(ctx, k8sClient, k8sClient.Scheme(), physicalHost)).To(Succeed())
+			Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+			var err error
+			provisioningToken, err = getProvisioningToken(ctx, k8sClient, physicalHost)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should hand out the target image, configuration and provisioning token", func() {
+			instructions := poll()
+			Expect(instructions.Action).To(Equal(ProvisioningActionProvision))
+			Expect(instructions.TargetImageURL).To(Equal("http://boot-server/images/kairos.tar.gz"))
+			Expect(instructions.ConfigurationURL).To(Equal("http://boot-server/configs/node.yaml"))
+			Expect(instructions.RootDevice).To(BeEmpty())
+			Expect(instructions.Token).To(Equal(provisioningToken))
+		})
+
+		It("should hand out the bootstrap data URL minted by the controller", func() {
+			Expect(mintBootstrapToken(ctx, k8sClient, k8sClient.Scheme(), physicalHost)).To(Succeed())
+			Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+			token, err := getHostToken(ctx, k8sClient, physicalHost, bootstrapTokenKind)
+			Expect(err).NotTo(HaveOccurred())
+
+			instructions := poll()
+			Expect(instructions.BootstrapDataURL).To(Equal(
+				"http://example.com" + BootstrapPath + "/" + testNs.Name + "/test-host?token=" + token))
+
+			// Polling again hands out the same token instead of rotating it
+			Expect(poll().BootstrapDataURL).To(Equal(instructions.BootstrapDataURL))
+			Expect(getHost().Status.BootstrapTokenHash).To(Equal(physicalHost.Status.BootstrapTokenHash))
+		})
+
+		It("should accept polls with the provisioning token", func() {
+			Expect(pollWithToken(provisioningToken).Code).To(Equal(http.StatusOK))
+		})
+
+		It("should hand out the root device", func() {
+			physicalHost.Status.RootDevice = "/dev/nvme0n1"
+			Expect(k8sClient.Status().Update(ctx, physicalHost)).To(Succeed())
+
+			Expect(poll().RootDevice).To(Equal("/dev/nvme0n1"))
+		})
+
+		It("should record a successful installation", func() {
+			Expect(report(infrastructurev1beta1.ProvisioningPhaseProvisioned)).To(Equal(http.StatusOK))
+			host := getHost()
+			Expect(host.Status.ProvisioningPhase).To(Equal(infrastructurev1beta1.ProvisioningPhaseProvisioned))
+			Expect(host.Status.ProvisioningTokenHash).To(BeEmpty())
+
+			remaining, err := getProvisioningToken(ctx, k8sClient, host)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remaining).To(BeEmpty())
+		})
+
+		It("should reject reports without the provisioning token", func() {
+			Expect(reportWithToken(infrastructurev1beta1.ProvisioningPhaseProvisioned, "")).To(Equal(http.StatusUnauthorized))
+			Expect(reportWithToken(infrastructurev1beta1.ProvisioningPhaseProvisioned, inspectionToken)).To(Equal(http.StatusUnauthorized))
+			Expect(getHost().Status.ProvisioningPhase).To(Equal(infrastructurev1beta1.ProvisioningPhaseProvisioning))
+		})
+
+		It("should reject a reused provisioning token", func() {
+			Expect(report(infrastructurev1beta1.ProvisioningPhaseProvisioned)).To(Equal(http.StatusOK))
+			Expect(report(infrastructurev1beta1.ProvisioningPhaseFailed)).To(Equal(http.StatusUnauthorized))
+			Expect(getHost().Status.ProvisioningPhase).To(Equal(infrastructurev1beta1.ProvisioningPhaseProvisioned))
+		})
+
+		It("should record a failed installation", func() {
+			Expect(report(infrastructurev1beta1.ProvisioningPhaseFailed)).To(Equal(http.StatusOK))
+			host := getHost()
+			Expect(host.Status.ProvisioningPhase).To(Equal(infrastructurev1beta1.ProvisioningPhaseFailed))
+			Expect(host.Status.ErrorMessage).To(ContainSubstring("disk not found"))
+		})
+
+		It("should reject unknown phases", func() {
+			Expect(report(infrastructurev1beta1.ProvisioningPhaseProvisioning)).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
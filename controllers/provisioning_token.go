@@ -0,0 +1,119 @@
+/*
+Copyright 2024 The Beskar7 Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
+	"github.com/wrkode/beskar7/internal/security"
+)
+
+// provisioningTokenKind names the handoff Secret of the provisioning token.
+const provisioningTokenKind = "provisioning"
+
+// mintProvisioningToken generates the one-time token the installed OS reports the
+// provisioning result with. The plain token is stored in a Secret owned by the host,
+// from which the boot script and provisioning handlers hand it out; only its hash is
+// recorded in the host status. The caller is responsible for persisting the host status.
+func mintProvisioningToken(ctx context.Context, c client.Client, scheme *runtime.Scheme, host *infrastructurev1beta1.PhysicalHost) error {
+	token, hash, err := security.GenerateToken()
+	if err != nil {
+		return err
+	}
+	if err := storeHostToken(ctx, c, scheme, host, provisioningTokenKind, token); err != nil {
+		return err
+	}
+	host.Status.ProvisioningTokenHash = hash
+	return nil
+}
+
+// getProvisioningToken returns the plain provisioning token of the host, or an empty
+// string if none has been minted or it has already been used.
+func getProvisioningToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) (string, error) {
+	return getHostToken(ctx, c, host, provisioningTokenKind)
+}
+
+// takeProvisioningToken returns the plain provisioning token of the host if it has not
+// been handed out yet, and removes it so it is not handed out again.
+func takeProvisioningToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) (string, error) {
+	return takeHostToken(ctx, c, host, provisioningTokenKind)
+}
+
+// deleteProvisioningToken removes the handoff Secret of a used provisioning token.
+func deleteProvisioningToken(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) error {
+	return deleteHostToken(ctx, c, host, provisioningTokenKind)
+}
+
+// provisioningPollAuthorized reports whether a provisioning poll presents the token of
+// the installed OS or of the inspection image that inspected the host for its current
+// consumer, which keeps polling after its report to install the target image.
+func provisioningPollAuthorized(host *infrastructurev1beta1.PhysicalHost, token string) bool {
+	if security.TokenMatchesHash(token, host.Status.ProvisioningTokenHash) {
+		return true
+	}
+	return host.Status.InspectionToken != nil && security.TokenMatchesHash(token, host.Status.InspectionToken.Hash)
+}
+
+// bootstrapTokenKind names the handoff Secret of the bootstrap token.
+const bootstrapTokenKind = "bootstrap"
+
+// mintBootstrapToken generates the token the host fetches its bootstrap data with. It
+// is minted together with the provisioning token and stays valid until the host is
+// released, as the installed OS may fetch its bootstrap data on every boot. The caller
+// is responsible for persisting the host status.
+func mintBootstrapToken(ctx context.Context, c client.Client, scheme *runtime.Scheme, host *infrastructurev1beta1.PhysicalHost) error {
+	token, hash, err := security.GenerateToken()
+	if err != nil {
+		return err
+	}
+	if err := storeHostToken(ctx, c, scheme, host, bootstrapTokenKind, token); err != nil {
+		return err
+	}
+	host.Status.BootstrapTokenHash = hash
+	return nil
+}
+
+// getBootstrapDataURL returns the authenticated bootstrap data URL of the host below the
+// given bootstrap base URL, or an empty string if no bootstrap token has been minted.
+func getBootstrapDataURL(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost, baseURL string) (string, error) {
+	if host.Status.BootstrapTokenHash == "" {
+		return "", nil
+	}
+	token, err := getHostToken(ctx, c, host, bootstrapTokenKind)
+	if err != nil || token == "" {
+		return "", err
+	}
+	return bootstrapDataURL(baseURL, host, token), nil
+}
+
+// takeBootstrapDataURL returns the authenticated bootstrap data URL of the host below
+// the given bootstrap base URL if its bootstrap token has not been handed out yet. The
+// token stays valid, only its handoff Secret is removed.
+func takeBootstrapDataURL(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost, baseURL string) (string, error) {
+	if host.Status.BootstrapTokenHash == "" {
+		return "", nil
+	}
+	token, err := takeHostToken(ctx, c, host, bootstrapTokenKind)
+	if err != nil || token == "" {
+		return "", err
+	}
+	return bootstrapDataURL(baseURL, host, token), nil
+}
@@ -17,9 +17,16 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"fmt"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/wrkode/beskar7/api/v1beta1"
 )
 
 // isPaused checks if a resource has the pause annotation present.
@@ -36,3 +43,25 @@ func isClusterPaused(cluster *clusterv1.Cluster) bool {
 	}
 	return annotations.HasPaused(cluster)
 }
+
+// getConsumerBeskar7Machine returns the Beskar7Machine referenced by the host's ConsumerRef.
+// It returns nil if the host is not claimed, and an error if the referenced machine has
+// been replaced by another one of the same name.
+func getConsumerBeskar7Machine(ctx context.Context, c client.Client, host *infrastructurev1beta1.PhysicalHost) (*infrastructurev1beta1.Beskar7Machine, error) {
+	if host.Spec.ConsumerRef == nil {
+		return nil, nil
+	}
+
+	key := types.NamespacedName{Namespace: host.Spec.ConsumerRef.Namespace, Name: host.Spec.ConsumerRef.Name}
+	if key.Namespace == "" {
+		key.Namespace = host.Namespace
+	}
+	b7machine := &infrastructurev1beta1.Beskar7Machine{}
+	if err := c.Get(ctx, key, b7machine); err != nil {
+		return nil, fmt.Errorf("failed to get Beskar7Machine %s: %w", key, err)
+	}
+	if !isClaimedBy(host, b7machine) {
+		return nil, fmt.Errorf("Beskar7Machine %s does not own PhysicalHost %s", key, host.Name)
+	}
+	return b7machine, nil
+}
@@ -282,6 +282,15 @@ var (
 		[]string{"namespace", "result_type"},
 	)
 
+	// Inspection server metrics
+	inspectionReportRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "beskar7_inspection_report_rejections_total",
+			Help: "Total number of inspection reports rejected because of their token",
+		},
+		[]string{"namespace", "reason"},
+	)
+
 	claimCoordinatorLeadershipDuration = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "beskar7_claim_coordinator_leadership_duration_seconds",
@@ -377,6 +386,8 @@ func Init() {
 		claimCoordinatorResults,
 		claimCoordinatorProcessing,
 		claimCoordinatorLeadershipDuration,
+		// Register inspection server metrics
+		inspectionReportRejections,
 	)
 }
 
@@ -592,3 +603,18 @@ func RecordClaimCoordinatorProcessing(namespace, resultType string, duration tim
 func RecordClaimCoordinatorLeadershipDuration(namespace, identity string, duration time.Duration) {
 	claimCoordinatorLeadershipDuration.WithLabelValues(namespace, identity).Set(duration.Seconds())
 }
+
+// InspectionRejectionReason represents why an inspection report was rejected
+type InspectionRejectionReason string
+
+const (
+	InspectionRejectionMissingToken InspectionRejectionReason = "missing_token"
+	InspectionRejectionInvalidToken InspectionRejectionReason = "invalid_token"
+	InspectionRejectionExpiredToken InspectionRejectionReason = "expired_token"
+	InspectionRejectionReusedToken  InspectionRejectionReason = "reused_token"
+)
+
+// RecordInspectionReportRejection records an inspection report rejected because of its token
+func RecordInspectionReportRejection(namespace string, reason InspectionRejectionReason) {
+	inspectionReportRejections.WithLabelValues(namespace, string(reason)).Inc()
+}
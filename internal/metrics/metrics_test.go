@@ -209,3 +209,17 @@ func TestRecordError(t *testing.T) {
 		t.Errorf("Expected validation error counter to be 1, got %v", validationMetric.GetCounter().GetValue())
 	}
 }
+
+func TestRecordInspectionReportRejection(t *testing.T) {
+	RecordInspectionReportRejection("test-namespace", InspectionRejectionReusedToken)
+
+	counter := inspectionReportRejections.WithLabelValues("test-namespace", "reused_token")
+	metric := &dto.Metric{}
+	if err := counter.Write(metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+
+	if metric.GetCounter().GetValue() != 1 {
+		t.Errorf("Expected counter to be 1, got %v", metric.GetCounter().GetValue())
+	}
+}
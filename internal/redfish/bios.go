@@ -0,0 +1,83 @@
+package redfish
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidBIOSAttribute is returned when a desired BIOS setting names an attribute the
+// system does not have, or a value that does not fit the type of the attribute.
+var ErrInvalidBIOSAttribute = errors.New("invalid BIOS attribute")
+
+// BIOSSettings holds the BIOS attributes of a system. Changed attributes are staged in
+// the pending settings and only applied by the BMC on the next reboot.
+type BIOSSettings struct {
+	// Attributes are the attribute values currently in effect
+	Attributes map[string]interface{}
+	// PendingAttributes are the attribute values staged for the next reboot
+	PendingAttributes map[string]interface{}
+}
+
+// Changes returns the attributes whose current value differs from the desired one,
+// converted to the type of the current value, so they can be staged with
+// SetBIOSAttributes. Unknown attributes and values that do not convert are reported
+// with ErrInvalidBIOSAttribute.
+func (s *BIOSSettings) Changes(desired map[string]string) (map[string]interface{}, error) {
+	changes := make(map[string]interface{})
+	var invalid []string
+	for _, name := range slices.Sorted(maps.Keys(desired)) {
+		current, ok := s.Attributes[name]
+		if !ok {
+			invalid = append(invalid, fmt.Sprintf("%s: unknown attribute", name))
+			continue
+		}
+		value, err := biosAttributeValue(desired[name], current)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if value != current {
+			changes[name] = value
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBIOSAttribute, strings.Join(invalid, ", "))
+	}
+	return changes, nil
+}
+
+// IsPending reports whether all changes are already staged for the next reboot.
+func (s *BIOSSettings) IsPending(changes map[string]interface{}) bool {
+	for name, value := range changes {
+		pending, ok := s.PendingAttributes[name]
+		if !ok || pending != value {
+			return false
+		}
+	}
+	return true
+}
+
+// biosAttributeValue converts the desired value to the JSON type of the current value.
+// Redfish BIOS attributes are strings, numbers or booleans.
+func biosAttributeValue(desired string, current interface{}) (interface{}, error) {
+	switch current.(type) {
+	case bool:
+		value, err := strconv.ParseBool(desired)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", desired)
+		}
+		return value, nil
+	case float64:
+		value, err := strconv.ParseFloat(desired, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", desired)
+		}
+		return value, nil
+	default:
+		return desired, nil
+	}
+}
@@ -0,0 +1,118 @@
+package redfish
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBIOSSettingsChanges(t *testing.T) {
+	settings := &BIOSSettings{
+		Attributes: map[string]interface{}{
+			"SriovGlobalEnable":  "Disabled",
+			"ProcVirtualization": "Enabled",
+			"IntelTxt":           false,
+			"NumLock":            true,
+			"ProcCStates":        float64(2),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		desired  map[string]string
+		expected map[string]interface{}
+		invalid  bool
+	}{
+		{
+			name:     "nothing desired",
+			desired:  nil,
+			expected: map[string]interface{}{},
+		},
+		{
+			name:     "already applied",
+			desired:  map[string]string{"ProcVirtualization": "Enabled", "NumLock": "true", "ProcCStates": "2"},
+			expected: map[string]interface{}{},
+		},
+		{
+			name:    "string, boolean and number changes",
+			desired: map[string]string{"SriovGlobalEnable": "Enabled", "IntelTxt": "true", "ProcCStates": "6", "NumLock": "true"},
+			expected: map[string]interface{}{
+				"SriovGlobalEnable": "Enabled",
+				"IntelTxt":          true,
+				"ProcCStates":       float64(6),
+			},
+		},
+		{
+			name:    "unknown attribute",
+			desired: map[string]string{"SriovGlobalEnable": "Enabled", "VtD": "Enabled"},
+			invalid: true,
+		},
+		{
+			name:    "not a boolean",
+			desired: map[string]string{"IntelTxt": "Enabled"},
+			invalid: true,
+		},
+		{
+			name:    "not a number",
+			desired: map[string]string{"ProcCStates": "C6"},
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := settings.Changes(tt.desired)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidBIOSAttribute) {
+					t.Fatalf("expected ErrInvalidBIOSAttribute, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, changes)
+			}
+		})
+	}
+}
+
+func TestBIOSSettingsIsPending(t *testing.T) {
+	settings := &BIOSSettings{
+		PendingAttributes: map[string]interface{}{
+			"SriovGlobalEnable": "Enabled",
+			"ProcCStates":       float64(6),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		changes  map[string]interface{}
+		expected bool
+	}{
+		{
+			name:     "all pending",
+			changes:  map[string]interface{}{"SriovGlobalEnable": "Enabled", "ProcCStates": float64(6)},
+			expected: true,
+		},
+		{
+			name:     "pending with another value",
+			changes:  map[string]interface{}{"ProcCStates": float64(2)},
+			expected: false,
+		},
+		{
+			name:     "not pending",
+			changes:  map[string]interface{}{"SriovGlobalEnable": "Enabled", "IntelTxt": true},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := settings.IsPending(tt.changes); result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
@@ -9,7 +9,9 @@ import (
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
-// Client represents a Redfish client - simplified for power management and iPXE boot only
+// Client represents a Redfish client - simplified for power management, BIOS settings,
+// firmware updates, RAID volumes and booting the inspection and target images over iPXE
+// or virtual media
 type Client interface {
 	// Close closes the client connection
 	Close(ctx context.Context)
@@ -20,13 +22,69 @@ type Client interface {
 	// GetPowerState retrieves the current power state
 	GetPowerState(ctx context.Context) (redfish.PowerState, error)
 
-	// SetPowerState sets the power state
+	// SetPowerState sets the power state, forcing the system off for OffPowerState
 	SetPowerState(ctx context.Context, state redfish.PowerState) error
 
-	// SetBootSourcePXE configures the system to boot from PXE/network (iPXE)
+	// PowerAction requests a reset of the given type without waiting for the power
+	// state to change. PowerOff, PowerOn and Restart wait for it.
+	PowerAction(ctx context.Context, resetType redfish.ResetType) error
+
+	// SetBootSourcePXE configures the system to boot once from PXE/network (iPXE)
 	SetBootSourcePXE(ctx context.Context) error
 
-	// Reset performs a system reset
+	// SetBootOverride configures the boot source override target, for the next boot
+	// only (Once) or until cleared (Continuous). Disabled clears the override.
+	SetBootOverride(ctx context.Context, target redfish.BootSourceOverrideTarget, enabled redfish.BootSourceOverrideEnabled) error
+
+	// ClearBootOverride disables the boot source override, so the system boots
+	// following its persistent boot order
+	ClearBootOverride(ctx context.Context) error
+
+	// SetBootSourceHTTP configures the system to boot once from bootURI over UEFI HTTP
+	// boot, falling back to PXE if the BMC does not support it. It reports whether UEFI
+	// HTTP boot was configured.
+	SetBootSourceHTTP(ctx context.Context, bootURI string) (bool, error)
+
+	// InsertVirtualMedia inserts the ISO image at imageURL into the virtual CD/DVD drive,
+	// replacing any image inserted before
+	InsertVirtualMedia(ctx context.Context, imageURL string) error
+
+	// EjectVirtualMedia ejects the image from the virtual CD/DVD drive, if any
+	EjectVirtualMedia(ctx context.Context) error
+
+	// SetBootSourceVirtualCD configures the system to boot once from the virtual CD/DVD drive
+	SetBootSourceVirtualCD(ctx context.Context) error
+
+	// GetBIOSSettings retrieves the current BIOS attributes and those pending the next reboot
+	GetBIOSSettings(ctx context.Context) (*BIOSSettings, error)
+
+	// SetBIOSAttributes stages the given BIOS attributes. The BMC applies them on the
+	// next reboot.
+	SetBIOSAttributes(ctx context.Context, attributes map[string]interface{}) error
+
+	// GetFirmwareInventory retrieves the firmware components of the update service and
+	// their versions
+	GetFirmwareInventory(ctx context.Context) ([]FirmwareComponent, error)
+
+	// SimpleUpdate asks the update service to fetch the firmware image at imageURI and
+	// apply it to the inventory members at targets, or to every applicable component if
+	// there are none. It returns the URI of the task tracking the update, or an empty
+	// string if the BMC does not report one.
+	SimpleUpdate(ctx context.Context, imageURI string, targets []string) (string, error)
+
+	// GetTask retrieves the progress of the task at taskURI
+	GetTask(ctx context.Context, taskURI string) (*Task, error)
+
+	// GetStorage retrieves the storage subsystems of the system with their drives and
+	// volumes
+	GetStorage(ctx context.Context) ([]Storage, error)
+
+	// CreateVolume requests a volume of the RAID type from the drives at driveURIs of
+	// the storage subsystem at storageURI. BMCs that stage storage changes create it on
+	// the next reboot.
+	CreateVolume(ctx context.Context, storageURI, name string, raidType redfish.RAIDType, driveURIs []string) error
+
+	// Reset performs a forced system restart
 	Reset(ctx context.Context) error
 
 	// GetNetworkAddresses retrieves network interface addresses
@@ -38,6 +96,7 @@ type SystemInfo struct {
 	Manufacturer string        `json:"manufacturer"`
 	Model        string        `json:"model"`
 	SerialNumber string        `json:"serialNumber"`
+	MACAddresses []string      `json:"macAddresses,omitempty"`
 	Status       common.Status `json:"status"`
 }
 
@@ -0,0 +1,68 @@
+package redfish
+
+import (
+	"strings"
+
+	"github.com/stmcginnis/gofish/common"
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+// FirmwareComponent is a member of the firmware inventory of the update service, e.g.
+// the BMC, the BIOS or a NIC.
+type FirmwareComponent struct {
+	// ID identifies the component within the inventory
+	ID string
+	// Name is the display name of the component
+	Name string
+	// Version is the firmware version the component runs
+	Version string
+	// Updateable reports whether the update service can update the component
+	Updateable bool
+	// URI is the Redfish URI of the inventory member, used to target updates
+	URI string
+}
+
+// FindFirmwareComponent returns the component with the given ID, or nil.
+func FindFirmwareComponent(inventory []FirmwareComponent, id string) *FirmwareComponent {
+	for i := range inventory {
+		if inventory[i].ID == id {
+			return &inventory[i]
+		}
+	}
+	return nil
+}
+
+// Task is the progress of a long-running operation on the BMC, such as a firmware update.
+type Task struct {
+	// State is the state of the task
+	State redfish.TaskState
+	// Health is the health of the task, Critical once it failed
+	Health common.Health
+	// PercentComplete is the progress of the task, if the BMC reports it
+	PercentComplete int
+	// Messages are the messages the BMC logged for the task
+	Messages []string
+}
+
+// Done reports whether the task reached a final state.
+func (t *Task) Done() bool {
+	switch t.State {
+	case redfish.CompletedTaskState, redfish.KilledTaskState, redfish.ExceptionTaskState, redfish.CancelledTaskState:
+		return true
+	}
+	return false
+}
+
+// Failed reports whether the task ended without completing successfully. BMCs report
+// some failed tasks as Completed with a critical health.
+func (t *Task) Failed() bool {
+	if !t.Done() {
+		return false
+	}
+	return t.State != redfish.CompletedTaskState || t.Health == common.CriticalHealth
+}
+
+// Message returns the messages of the task as a single line.
+func (t *Task) Message() string {
+	return strings.Join(t.Messages, "; ")
+}
@@ -0,0 +1,75 @@
+package redfish
+
+import (
+	"testing"
+
+	"github.com/stmcginnis/gofish/common"
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+func TestTaskDoneAndFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		task   Task
+		done   bool
+		failed bool
+	}{
+		{
+			name: "running",
+			task: Task{State: redfish.RunningTaskState, PercentComplete: 40},
+		},
+		{
+			name: "pending",
+			task: Task{State: redfish.PendingTaskState},
+		},
+		{
+			name: "completed",
+			task: Task{State: redfish.CompletedTaskState, Health: common.OKHealth},
+			done: true,
+		},
+		{
+			name:   "completed with critical health",
+			task:   Task{State: redfish.CompletedTaskState, Health: common.CriticalHealth},
+			done:   true,
+			failed: true,
+		},
+		{
+			name:   "exception",
+			task:   Task{State: redfish.ExceptionTaskState},
+			done:   true,
+			failed: true,
+		},
+		{
+			name:   "cancelled",
+			task:   Task{State: redfish.CancelledTaskState},
+			done:   true,
+			failed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if done := tt.task.Done(); done != tt.done {
+				t.Errorf("expected Done() %v, got %v", tt.done, done)
+			}
+			if failed := tt.task.Failed(); failed != tt.failed {
+				t.Errorf("expected Failed() %v, got %v", tt.failed, failed)
+			}
+		})
+	}
+}
+
+func TestFindFirmwareComponent(t *testing.T) {
+	inventory := []FirmwareComponent{
+		{ID: "BMC", Version: "1.2.3", Updateable: true},
+		{ID: "BIOS", Version: "2.4.0", Updateable: true},
+	}
+
+	component := FindFirmwareComponent(inventory, "BIOS")
+	if component == nil || component.Version != "2.4.0" {
+		t.Fatalf("expected the BIOS component, got %v", component)
+	}
+	if component := FindFirmwareComponent(inventory, "NIC.1"); component != nil {
+		t.Errorf("expected no component, got %v", component)
+	}
+}
@@ -2,11 +2,15 @@ package redfish
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/stmcginnis/gofish"
+	"github.com/stmcginnis/gofish/common"
 	"github.com/stmcginnis/gofish/redfish"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -133,6 +137,23 @@ func (c *gofishClient) GetSystemInfo(ctx context.Context) (*SystemInfo, error) {
 		SerialNumber: system.SerialNumber,
 		Status:       system.Status,
 	}
+
+	// The MAC addresses identify the host towards the inspection image; a BMC
+	// without EthernetInterfaces simply leaves them empty
+	ethernetInterfaces, err := system.EthernetInterfaces()
+	if err != nil {
+		log.Error(err, "Failed to retrieve ethernet interfaces for system info")
+	} else {
+		for _, ethIntf := range ethernetInterfaces {
+			mac := ethIntf.MACAddress
+			if mac == "" {
+				mac = ethIntf.PermanentMACAddress
+			}
+			if mac != "" {
+				info.MACAddresses = append(info.MACAddresses, mac)
+			}
+		}
+	}
 	log.Info("Retrieved system info", "Manufacturer", info.Manufacturer, "Model", info.Model, "SerialNumber", info.SerialNumber, "Status", info.Status.State)
 	return info, nil
 }
@@ -149,11 +170,6 @@ func (c *gofishClient) GetPowerState(ctx context.Context) (redfish.PowerState, e
 
 // SetPowerState sets the desired power state of the system.
 func (c *gofishClient) SetPowerState(ctx context.Context, state redfish.PowerState) error {
-	system, err := c.getSystemService(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get system for setting power state: %w", err)
-	}
-
 	var resetType redfish.ResetType
 	switch state {
 	case redfish.OnPowerState:
@@ -170,52 +186,543 @@ func (c *gofishClient) SetPowerState(ctx context.Context, state redfish.PowerSta
 		}
 	}
 
-	log.Info("Attempting to set power state", "desiredState", state, "resetType", resetType)
+	if err := c.PowerAction(ctx, resetType); err != nil {
+		return fmt.Errorf("failed to set power state to %s: %w", state, err)
+	}
+	return nil
+}
+
+// PowerAction requests a reset of the given type, e.g. GracefulShutdown, ForceOff,
+// PowerCycle or Nmi. It returns once the BMC accepted the request, without waiting
+// for the power state to change.
+func (c *gofishClient) PowerAction(ctx context.Context, resetType redfish.ResetType) error {
+	system, err := c.getSystemService(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get system for power action: %w", err)
+	}
+
+	log.Info("Attempting power action", "resetType", resetType)
 	err = system.Reset(resetType)
 	if err != nil {
-		log.Error(err, "Failed to set power state", "desiredState", state)
-		return fmt.Errorf("failed to set power state to %s: %w", state, err)
+		log.Error(err, "Failed to perform power action", "resetType", resetType)
+		return fmt.Errorf("failed to perform power action %s: %w", resetType, err)
 	}
-	log.Info("Successfully requested power state change", "desiredState", state)
+	log.Info("Successfully requested power action", "resetType", resetType)
 	return nil
 }
 
-// SetBootSourcePXE configures the system to boot from PXE/network for iPXE.
+// SetBootSourcePXE configures the system to boot once from PXE/network for iPXE.
 func (c *gofishClient) SetBootSourcePXE(ctx context.Context) error {
+	return c.SetBootOverride(ctx, redfish.PxeBootSourceOverrideTarget, redfish.OnceBootSourceOverrideEnabled)
+}
+
+// SetBootOverride configures the boot source override of the system. Once overrides
+// apply to the next boot only, Continuous overrides until they are cleared.
+func (c *gofishClient) SetBootOverride(ctx context.Context, target redfish.BootSourceOverrideTarget, enabled redfish.BootSourceOverrideEnabled) error {
+	if enabled == redfish.DisabledBootSourceOverrideEnabled {
+		return c.ClearBootOverride(ctx)
+	}
+	if enabled != redfish.OnceBootSourceOverrideEnabled && enabled != redfish.ContinuousBootSourceOverrideEnabled {
+		return fmt.Errorf("unsupported boot source override enablement %q", enabled)
+	}
+
 	system, err := c.getSystemService(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get system to set PXE boot: %w", err)
+		return fmt.Errorf("failed to get system to set boot source override: %w", err)
+	}
+
+	boot := redfish.Boot{
+		BootSourceOverrideTarget:  target,
+		BootSourceOverrideEnabled: enabled,
+	}
+	log.Info("Attempting to set boot source override", "target", boot.BootSourceOverrideTarget, "enabled", boot.BootSourceOverrideEnabled)
+	err = system.SetBoot(boot)
+	if err != nil {
+		log.Error(err, "Failed to set boot source override", "target", target)
+		return fmt.Errorf("failed to set boot source override to %s: %w", target, err)
+	}
+
+	log.Info("Successfully set boot source override", "target", target, "enabled", enabled)
+	return nil
+}
+
+// ClearBootOverride disables the boot source override of the system, so it boots
+// following its persistent boot order again.
+func (c *gofishClient) ClearBootOverride(ctx context.Context) error {
+	system, err := c.getSystemService(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get system to clear boot source override: %w", err)
+	}
+
+	boot := redfish.Boot{
+		BootSourceOverrideEnabled: redfish.DisabledBootSourceOverrideEnabled,
+	}
+	log.Info("Attempting to clear boot source override")
+	err = system.SetBoot(boot)
+	if err != nil {
+		log.Error(err, "Failed to clear boot source override")
+		return fmt.Errorf("failed to clear boot source override: %w", err)
+	}
+
+	log.Info("Successfully cleared boot source override")
+	return nil
+}
+
+// SetBootSourceHTTP configures the system to boot once from bootURI over UEFI HTTP boot.
+// BMCs that do not list UefiHttp as an allowable override target are set to PXE boot
+// instead. It reports whether UEFI HTTP boot was configured.
+func (c *gofishClient) SetBootSourceHTTP(ctx context.Context, bootURI string) (bool, error) {
+	system, err := c.getSystemService(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get system to set UEFI HTTP boot: %w", err)
+	}
+
+	if !supportsBootSourceOverrideTarget(system.RawData, redfish.UefiHTTPBootSourceOverrideTarget) {
+		log.Info("UEFI HTTP boot is not supported by the BMC, falling back to PXE", "systemID", system.ID)
+		return false, c.SetBootSourcePXE(ctx)
 	}
 
 	boot := redfish.Boot{
-		BootSourceOverrideTarget:  redfish.PxeBootSourceOverrideTarget,
+		BootSourceOverrideTarget:  redfish.UefiHTTPBootSourceOverrideTarget,
 		BootSourceOverrideEnabled: redfish.OnceBootSourceOverrideEnabled,
+		BootSourceOverrideMode:    redfish.UEFIBootSourceOverrideMode,
+		HTTPBootURI:               bootURI,
 	}
-	log.Info("Attempting to set boot source override to PXE", "target", boot.BootSourceOverrideTarget, "enabled", boot.BootSourceOverrideEnabled)
+	log.Info("Attempting to set boot source override to UEFI HTTP", "target", boot.BootSourceOverrideTarget, "enabled", boot.BootSourceOverrideEnabled, "uri", bootURI)
 	err = system.SetBoot(boot)
 	if err != nil {
-		log.Error(err, "Failed to set boot source override to PXE")
-		return fmt.Errorf("failed to set boot source override to PXE: %w", err)
+		log.Error(err, "Failed to set boot source override to UEFI HTTP")
+		return false, fmt.Errorf("failed to set boot source override to UEFI HTTP: %w", err)
 	}
 
-	log.Info("Successfully set boot source to PXE")
+	log.Info("Successfully set boot source to UEFI HTTP", "uri", bootURI)
+	return true, nil
+}
+
+// supportsBootSourceOverrideTarget checks the Redfish.AllowableValues annotation of the
+// boot override target in the raw ComputerSystem JSON, which gofish does not decode.
+// Systems without the annotation are treated as not supporting the target.
+func supportsBootSourceOverrideTarget(rawSystem []byte, target redfish.BootSourceOverrideTarget) bool {
+	var system struct {
+		Boot struct {
+			AllowableValues []redfish.BootSourceOverrideTarget `json:"BootSourceOverrideTarget@Redfish.AllowableValues"`
+		}
+	}
+	if err := json.Unmarshal(rawSystem, &system); err != nil {
+		return false
+	}
+	for _, allowed := range system.Boot.AllowableValues {
+		if allowed == target {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertVirtualMedia inserts an ISO image into the virtual CD/DVD drive of the system.
+func (c *gofishClient) InsertVirtualMedia(ctx context.Context, imageURL string) error {
+	media, err := c.getVirtualCD(ctx)
+	if err != nil {
+		return err
+	}
+
+	if media.Inserted {
+		if media.Image == imageURL {
+			log.Info("Virtual media already inserted", "image", imageURL)
+			return nil
+		}
+		// Most BMCs refuse to insert an image while another one is inserted
+		log.Info("Ejecting previous virtual media", "image", media.Image)
+		if err := media.EjectMedia(); err != nil {
+			log.Error(err, "Failed to eject previous virtual media", "image", media.Image)
+			return fmt.Errorf("failed to eject virtual media %s: %w", media.Image, err)
+		}
+	}
+
+	log.Info("Attempting to insert virtual media", "image", imageURL, "virtualMedia", media.ID)
+	if err := media.InsertMedia(imageURL, true, true); err != nil {
+		log.Error(err, "Failed to insert virtual media", "image", imageURL)
+		return fmt.Errorf("failed to insert virtual media %s: %w", imageURL, err)
+	}
+
+	log.Info("Successfully inserted virtual media", "image", imageURL)
 	return nil
 }
 
-// Reset performs a system reset.
-func (c *gofishClient) Reset(ctx context.Context) error {
+// EjectVirtualMedia ejects the image from the virtual CD/DVD drive of the system.
+func (c *gofishClient) EjectVirtualMedia(ctx context.Context) error {
+	media, err := c.getVirtualCD(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !media.Inserted {
+		return nil
+	}
+
+	log.Info("Attempting to eject virtual media", "image", media.Image, "virtualMedia", media.ID)
+	if err := media.EjectMedia(); err != nil {
+		log.Error(err, "Failed to eject virtual media", "image", media.Image)
+		return fmt.Errorf("failed to eject virtual media %s: %w", media.Image, err)
+	}
+
+	log.Info("Successfully ejected virtual media")
+	return nil
+}
+
+// SetBootSourceVirtualCD configures the system to boot once from the virtual CD/DVD drive.
+func (c *gofishClient) SetBootSourceVirtualCD(ctx context.Context) error {
+	return c.SetBootOverride(ctx, redfish.CdBootSourceOverrideTarget, redfish.OnceBootSourceOverrideEnabled)
+}
+
+// getVirtualCD returns the virtual CD/DVD drive of the system. Newer BMCs list virtual
+// media under the system, older ones only under the manager of the system.
+func (c *gofishClient) getVirtualCD(ctx context.Context) (*redfish.VirtualMedia, error) {
 	system, err := c.getSystemService(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get system for reset: %w", err)
+		return nil, fmt.Errorf("failed to get system for virtual media: %w", err)
 	}
 
-	log.Info("Attempting to reset system")
-	err = system.Reset(redfish.ForceRestartResetType)
+	candidates, err := system.VirtualMedia()
 	if err != nil {
-		log.Error(err, "Failed to reset system")
+		log.V(1).Info("Could not retrieve virtual media from system", "error", err)
+	}
+
+	if len(candidates) == 0 {
+		managers, err := system.ManagedBy()
+		if err != nil || len(managers) == 0 {
+			managers, err = c.gofishClient.Service.Managers()
+			if err != nil {
+				return nil, fmt.Errorf("failed to retrieve managers: %w", err)
+			}
+		}
+		for _, manager := range managers {
+			media, err := manager.VirtualMedia()
+			if err != nil {
+				log.V(1).Info("Could not retrieve virtual media from manager", "manager", manager.ID, "error", err)
+				continue
+			}
+			candidates = append(candidates, media...)
+		}
+	}
+
+	for _, media := range candidates {
+		if !media.SupportsMediaInsert {
+			continue
+		}
+		for _, mediaType := range media.MediaTypes {
+			if mediaType == redfish.CDMediaType || mediaType == redfish.DVDMediaType {
+				return media, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no virtual CD/DVD drive found")
+}
+
+// GetBIOSSettings retrieves the BIOS attributes of the system. BMCs that stage changes
+// in a separate settings object, as advertised by @Redfish.Settings, report the staged
+// attributes as pending.
+func (c *gofishClient) GetBIOSSettings(ctx context.Context) (*BIOSSettings, error) {
+	system, err := c.getSystemService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get system for BIOS settings: %w", err)
+	}
+	bios, err := system.Bios()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve BIOS: %w", err)
+	}
+	if bios == nil {
+		return nil, fmt.Errorf("system %s does not expose BIOS settings", system.ID)
+	}
+
+	current, err := c.getBIOSResource(bios.ODataID)
+	if err != nil {
+		return nil, err
+	}
+	settings := &BIOSSettings{
+		Attributes:        current.Attributes,
+		PendingAttributes: map[string]interface{}{},
+	}
+
+	settingsObject := current.Settings.SettingsObject.String()
+	if settingsObject != "" && settingsObject != bios.ODataID {
+		pending, err := c.getBIOSResource(settingsObject)
+		if err != nil {
+			return nil, err
+		}
+		if pending.Attributes != nil {
+			settings.PendingAttributes = pending.Attributes
+		}
+	}
+	return settings, nil
+}
+
+// biosResource is the part of a Bios resource or its settings object BIOSSettings is
+// built from. gofish does not expose the settings object of a Bios.
+type biosResource struct {
+	Attributes map[string]interface{}
+	Settings   struct {
+		SettingsObject common.Link
+	} `json:"@Redfish.Settings"`
+}
+
+// getBIOSResource retrieves the Bios resource or settings object at uri.
+func (c *gofishClient) getBIOSResource(uri string) (*biosResource, error) {
+	resp, err := c.gofishClient.Get(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve BIOS settings from %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+
+	var resource biosResource
+	if err := json.NewDecoder(resp.Body).Decode(&resource); err != nil {
+		return nil, fmt.Errorf("failed to decode BIOS settings from %s: %w", uri, err)
+	}
+	return &resource, nil
+}
+
+// SetBIOSAttributes stages BIOS attributes through the settings object of the BIOS.
+// Attributes that already have the given value are left out of the request.
+func (c *gofishClient) SetBIOSAttributes(ctx context.Context, attributes map[string]interface{}) error {
+	system, err := c.getSystemService(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get system for BIOS settings: %w", err)
+	}
+	bios, err := system.Bios()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve BIOS: %w", err)
+	}
+	if bios == nil {
+		return fmt.Errorf("system %s does not expose BIOS settings", system.ID)
+	}
+
+	log.Info("Attempting to stage BIOS attributes", "attributes", attributes)
+	if err := bios.UpdateBiosAttributes(redfish.SettingsAttributes(attributes)); err != nil {
+		log.Error(err, "Failed to stage BIOS attributes")
+		return fmt.Errorf("failed to stage BIOS attributes: %w", err)
+	}
+
+	log.Info("Successfully staged BIOS attributes, pending reboot")
+	return nil
+}
+
+// getUpdateService retrieves the update service of the Redfish service root.
+func (c *gofishClient) getUpdateService() (*redfish.UpdateService, error) {
+	if c.gofishClient == nil {
+		return nil, fmt.Errorf("redfish client is not connected")
+	}
+	updateService, err := c.gofishClient.Service.UpdateService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve update service: %w", err)
+	}
+	return updateService, nil
+}
+
+// GetFirmwareInventory retrieves the firmware inventory of the update service.
+func (c *gofishClient) GetFirmwareInventory(ctx context.Context) ([]FirmwareComponent, error) {
+	updateService, err := c.getUpdateService()
+	if err != nil {
+		return nil, err
+	}
+	members, err := updateService.FirmwareInventories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve firmware inventory: %w", err)
+	}
+
+	inventory := make([]FirmwareComponent, 0, len(members))
+	for _, member := range members {
+		inventory = append(inventory, FirmwareComponent{
+			ID:         member.ID,
+			Name:       member.Name,
+			Version:    member.Version,
+			Updateable: member.Updateable,
+			URI:        member.ODataID,
+		})
+	}
+	return inventory, nil
+}
+
+// SimpleUpdate invokes the SimpleUpdate action of the update service. BMCs answer with
+// the task tracking the update, either in the body or in the Location header.
+func (c *gofishClient) SimpleUpdate(ctx context.Context, imageURI string, targets []string) (string, error) {
+	updateService, err := c.getUpdateService()
+	if err != nil {
+		return "", err
+	}
+
+	// gofish does not expose the action target, nor the response of the action
+	var raw struct {
+		Actions struct {
+			SimpleUpdate common.ActionTarget `json:"#UpdateService.SimpleUpdate"`
+		}
+	}
+	if err := json.Unmarshal(updateService.RawData, &raw); err != nil {
+		return "", fmt.Errorf("failed to decode update service: %w", err)
+	}
+	if raw.Actions.SimpleUpdate.Target == "" {
+		return "", fmt.Errorf("update service does not support SimpleUpdate")
+	}
+
+	log.Info("Attempting firmware update", "imageURI", imageURI, "targets", targets)
+	resp, err := c.gofishClient.Post(raw.Actions.SimpleUpdate.Target, &redfish.SimpleUpdateParameters{
+		ImageURI: imageURI,
+		Targets:  targets,
+	})
+	if err != nil {
+		log.Error(err, "Failed to start firmware update")
+		return "", fmt.Errorf("failed to start firmware update: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var task struct {
+		ODataID   string `json:"@odata.id"`
+		ODataType string `json:"@odata.type"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&task); err == nil && task.ODataID != "" &&
+		strings.HasPrefix(task.ODataType, "#Task.") {
+		log.Info("Started firmware update", "task", task.ODataID)
+		return task.ODataID, nil
+	}
+	taskURI := resp.Header.Get("Location")
+	if u, err := url.Parse(taskURI); err == nil && u.IsAbs() {
+		taskURI = u.Path
+	}
+	log.Info("Started firmware update", "task", taskURI)
+	return taskURI, nil
+}
+
+// GetTask retrieves the task at taskURI.
+func (c *gofishClient) GetTask(ctx context.Context, taskURI string) (*Task, error) {
+	if c.gofishClient == nil {
+		return nil, fmt.Errorf("redfish client is not connected")
+	}
+	task, err := redfish.GetTask(c.gofishClient, taskURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve task %s: %w", taskURI, err)
+	}
+
+	result := &Task{
+		State:           task.TaskState,
+		Health:          task.TaskStatus,
+		PercentComplete: task.PercentComplete,
+	}
+	for _, message := range task.Messages {
+		if message.Message != "" {
+			result.Messages = append(result.Messages, message.Message)
+		}
+	}
+	return result, nil
+}
+
+// GetStorage retrieves the storage subsystems of the system with their drives and volumes.
+func (c *gofishClient) GetStorage(ctx context.Context) ([]Storage, error) {
+	system, err := c.getSystemService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get system for storage: %w", err)
+	}
+	subsystems, err := system.Storage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve storage: %w", err)
+	}
+
+	storage := make([]Storage, 0, len(subsystems))
+	for _, subsystem := range subsystems {
+		result := Storage{ID: subsystem.ID, URI: subsystem.ODataID}
+		for _, controller := range subsystem.StorageControllers {
+			result.SupportedRAIDTypes = append(result.SupportedRAIDTypes, controller.SupportedRAIDTypes...)
+		}
+
+		drives, err := subsystem.Drives()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve drives of storage %s: %w", subsystem.ID, err)
+		}
+		for _, drive := range drives {
+			result.Drives = append(result.Drives, Drive{
+				ID:            drive.ID,
+				Model:         drive.Model,
+				SerialNumber:  drive.SerialNumber,
+				CapacityBytes: drive.CapacityBytes,
+				MediaType:     string(drive.MediaType),
+				URI:           drive.ODataID,
+			})
+		}
+
+		// Linked drives are fetched concurrently, sort them so drives are picked alike
+		// on every reconcile
+		slices.SortFunc(result.Drives, func(a, b Drive) int { return strings.Compare(a.ID, b.ID) })
+
+		volumes, err := subsystem.Volumes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve volumes of storage %s: %w", subsystem.ID, err)
+		}
+		for _, volume := range volumes {
+			members, err := volume.Drives()
+			if err != nil {
+				return nil, fmt.Errorf("failed to retrieve drives of volume %s: %w", volume.ID, err)
+			}
+			memberURIs := make([]string, 0, len(members))
+			for _, member := range members {
+				memberURIs = append(memberURIs, member.ODataID)
+			}
+			slices.Sort(memberURIs)
+			result.Volumes = append(result.Volumes, Volume{
+				ID:            volume.ID,
+				Name:          volume.Name,
+				RAIDType:      volume.RAIDType,
+				CapacityBytes: int64(volume.CapacityBytes),
+				Drives:        memberURIs,
+				URI:           volume.ODataID,
+			})
+		}
+		storage = append(storage, result)
+	}
+	return storage, nil
+}
+
+// volumeRequest is the body of a request creating a volume. gofish does not support
+// creating volumes.
+type volumeRequest struct {
+	Name     string
+	RAIDType redfish.RAIDType
+	Links    struct {
+		Drives []volumeDriveLink
+	}
+}
+
+// volumeDriveLink references a member drive of a volume.
+type volumeDriveLink struct {
+	ODataID string `json:"@odata.id"`
+}
+
+// CreateVolume creates a volume in the volume collection of the storage subsystem.
+func (c *gofishClient) CreateVolume(ctx context.Context, storageURI, name string, raidType redfish.RAIDType, driveURIs []string) error {
+	if c.gofishClient == nil {
+		return fmt.Errorf("redfish client is not connected")
+	}
+
+	request := volumeRequest{Name: name, RAIDType: raidType}
+	for _, uri := range driveURIs {
+		request.Links.Drives = append(request.Links.Drives, volumeDriveLink{ODataID: uri})
+	}
+
+	log.Info("Attempting to create volume", "storage", storageURI, "name", name, "raidType", raidType, "drives", driveURIs)
+	resp, err := c.gofishClient.Post(strings.TrimSuffix(storageURI, "/")+"/Volumes", &request)
+	if err != nil {
+		log.Error(err, "Failed to create volume")
+		return fmt.Errorf("failed to create volume %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	log.Info("Requested volume", "name", name)
+	return nil
+}
+
+// Reset performs a forced system restart.
+func (c *gofishClient) Reset(ctx context.Context) error {
+	if err := c.PowerAction(ctx, redfish.ForceRestartResetType); err != nil {
 		return fmt.Errorf("failed to reset system: %w", err)
 	}
-	log.Info("Successfully reset system")
 	return nil
 }
 
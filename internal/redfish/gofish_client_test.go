@@ -0,0 +1,45 @@
+package redfish
+
+import (
+	"testing"
+
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+func TestSupportsBootSourceOverrideTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		system   string
+		expected bool
+	}{
+		{
+			name:     "UefiHttp allowed",
+			system:   `{"Boot": {"BootSourceOverrideTarget@Redfish.AllowableValues": ["None", "Pxe", "Hdd", "UefiHttp"]}}`,
+			expected: true,
+		},
+		{
+			name:     "UefiHttp not allowed",
+			system:   `{"Boot": {"BootSourceOverrideTarget@Redfish.AllowableValues": ["None", "Pxe", "Cd", "Hdd"]}}`,
+			expected: false,
+		},
+		{
+			name:     "no allowable values",
+			system:   `{"Boot": {"BootSourceOverrideTarget": "None"}}`,
+			expected: false,
+		},
+		{
+			name:     "invalid JSON",
+			system:   `{"Boot":`,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := supportsBootSourceOverrideTarget([]byte(tt.system), redfish.UefiHTTPBootSourceOverrideTarget)
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
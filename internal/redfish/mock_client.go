@@ -2,6 +2,9 @@ package redfish
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/stmcginnis/gofish/common"
@@ -9,7 +12,7 @@ import (
 )
 
 // MockClient provides a mock implementation of the Client interface for testing.
-// Simplified for iPXE + inspection workflow (no VirtualMedia).
+// Simplified for the iPXE/virtual media + inspection workflow.
 type MockClient struct {
 	mu sync.Mutex // Protect access to mock state
 
@@ -18,6 +21,37 @@ type MockClient struct {
 	PowerState      redfish.PowerState
 	ShouldFail      map[string]error // Map method name to error to simulate failures
 	BootSourceIsPXE bool
+	BootSourceIsCD  bool
+	// SupportsHTTPBoot makes SetBootSourceHTTP configure UEFI HTTP boot instead of PXE
+	SupportsHTTPBoot bool
+	// IgnoreGracefulShutdown makes GracefulShutdown leave the system on, like an OS
+	// that does not react to the ACPI power button
+	IgnoreGracefulShutdown bool
+	// PowerActions are the reset types requested through PowerAction, in order
+	PowerActions []redfish.ResetType
+	// HTTPBootURI is the URI set by SetBootSourceHTTP
+	HTTPBootURI string
+	// BootOverrideTarget and BootOverrideEnabled are the override set by SetBootOverride
+	BootOverrideTarget  redfish.BootSourceOverrideTarget
+	BootOverrideEnabled redfish.BootSourceOverrideEnabled
+	// VirtualMediaImage is the image inserted into the virtual CD/DVD drive
+	VirtualMediaImage string
+	// BIOSAttributes are the BIOS attributes in effect. PendingBIOSAttributes are those
+	// staged by SetBIOSAttributes, applied when the system is powered on or restarted.
+	BIOSAttributes        map[string]interface{}
+	PendingBIOSAttributes map[string]interface{}
+	// FirmwareInventory is the inventory returned by GetFirmwareInventory
+	FirmwareInventory []FirmwareComponent
+	// Tasks are the tasks returned by GetTask, by URI. SimpleUpdate adds a running task.
+	Tasks map[string]*Task
+	// UpdateImageURI and UpdateTargets are the parameters of the last SimpleUpdate
+	UpdateImageURI string
+	UpdateTargets  []string
+	// Storage are the storage subsystems returned by GetStorage. PendingVolumes are the
+	// volumes requested by CreateVolume by storage URI, created when the system is
+	// powered on or restarted.
+	Storage        []Storage
+	PendingVolumes map[string][]Volume
 
 	// Network address fields
 	NetworkAddresses        []NetworkAddress
@@ -29,6 +63,16 @@ type MockClient struct {
 	GetPowerStateCalled       bool
 	SetPowerStateCalled       bool
 	SetBootSourcePXECalled    bool
+	SetBootSourceHTTPCalled   bool
+	SetBootOverrideCalled     bool
+	ClearBootOverrideCalled   bool
+	InsertVirtualMediaCalled  bool
+	EjectVirtualMediaCalled   bool
+	SetBootSourceCDCalled     bool
+	GetBIOSSettingsCalled     bool
+	SetBIOSAttributesCalled   bool
+	SimpleUpdateCalled        bool
+	CreateVolumeCalled        bool
 	ResetCalled               bool
 	GetNetworkAddressesCalled bool
 }
@@ -97,6 +141,41 @@ func (m *MockClient) SetPowerState(ctx context.Context, state redfish.PowerState
 	return nil
 }
 
+// PowerAction mock implementation. Failures can be simulated for all reset types with
+// the "PowerAction" key or for one with e.g. "PowerAction:GracefulShutdown".
+func (m *MockClient) PowerAction(ctx context.Context, resetType redfish.ResetType) error {
+	m.mu.Lock()
+	m.PowerActions = append(m.PowerActions, resetType)
+	m.mu.Unlock()
+	if err := m.failIfNeeded("PowerAction"); err != nil {
+		return err
+	}
+	if err := m.failIfNeeded("PowerAction:" + string(resetType)); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch resetType {
+	case redfish.OnResetType, redfish.ForceOnResetType:
+		if m.PowerState != redfish.OnPowerState {
+			m.applyPendingBIOSAttributes()
+			m.applyPendingVolumes()
+		}
+		m.PowerState = redfish.OnPowerState
+	case redfish.ForceRestartResetType, redfish.GracefulRestartResetType, redfish.PowerCycleResetType:
+		m.applyPendingBIOSAttributes()
+		m.applyPendingVolumes()
+		m.PowerState = redfish.OnPowerState
+	case redfish.ForceOffResetType:
+		m.PowerState = redfish.OffPowerState
+	case redfish.GracefulShutdownResetType:
+		if !m.IgnoreGracefulShutdown {
+			m.PowerState = redfish.OffPowerState
+		}
+	}
+	return nil
+}
+
 // SetBootSourcePXE mock implementation.
 func (m *MockClient) SetBootSourcePXE(ctx context.Context) error {
 	m.mu.Lock()
@@ -108,9 +187,266 @@ func (m *MockClient) SetBootSourcePXE(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.BootSourceIsPXE = true
+	m.BootSourceIsCD = false
+	m.HTTPBootURI = ""
+	m.BootOverrideTarget = redfish.PxeBootSourceOverrideTarget
+	m.BootOverrideEnabled = redfish.OnceBootSourceOverrideEnabled
+	return nil
+}
+
+// SetBootOverride mock implementation.
+func (m *MockClient) SetBootOverride(ctx context.Context, target redfish.BootSourceOverrideTarget, enabled redfish.BootSourceOverrideEnabled) error {
+	m.mu.Lock()
+	m.SetBootOverrideCalled = true
+	m.mu.Unlock()
+	if err := m.failIfNeeded("SetBootOverride"); err != nil {
+		return err
+	}
+	if enabled == redfish.DisabledBootSourceOverrideEnabled {
+		return m.ClearBootOverride(ctx)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.BootOverrideTarget = target
+	m.BootOverrideEnabled = enabled
+	m.BootSourceIsPXE = target == redfish.PxeBootSourceOverrideTarget
+	m.BootSourceIsCD = target == redfish.CdBootSourceOverrideTarget
+	return nil
+}
+
+// ClearBootOverride mock implementation.
+func (m *MockClient) ClearBootOverride(ctx context.Context) error {
+	m.mu.Lock()
+	m.ClearBootOverrideCalled = true
+	m.mu.Unlock()
+	if err := m.failIfNeeded("ClearBootOverride"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.BootOverrideTarget = ""
+	m.BootOverrideEnabled = redfish.DisabledBootSourceOverrideEnabled
+	m.BootSourceIsPXE = false
+	m.BootSourceIsCD = false
+	return nil
+}
+
+// SetBootSourceHTTP mock implementation.
+func (m *MockClient) SetBootSourceHTTP(ctx context.Context, bootURI string) (bool, error) {
+	m.mu.Lock()
+	m.SetBootSourceHTTPCalled = true
+	supported := m.SupportsHTTPBoot
+	m.mu.Unlock()
+	if err := m.failIfNeeded("SetBootSourceHTTP"); err != nil {
+		return false, err
+	}
+	if !supported {
+		return false, m.SetBootSourcePXE(ctx)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.HTTPBootURI = bootURI
+	m.BootSourceIsPXE = false
+	m.BootSourceIsCD = false
+	m.BootOverrideTarget = redfish.UefiHTTPBootSourceOverrideTarget
+	m.BootOverrideEnabled = redfish.OnceBootSourceOverrideEnabled
+	return true, nil
+}
+
+// InsertVirtualMedia mock implementation.
+func (m *MockClient) InsertVirtualMedia(ctx context.Context, imageURL string) error {
+	m.mu.Lock()
+	m.InsertVirtualMediaCalled = true
+	m.mu.Unlock()
+	if err := m.failIfNeeded("InsertVirtualMedia"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.VirtualMediaImage = imageURL
+	return nil
+}
+
+// EjectVirtualMedia mock implementation.
+func (m *MockClient) EjectVirtualMedia(ctx context.Context) error {
+	m.mu.Lock()
+	m.EjectVirtualMediaCalled = true
+	m.mu.Unlock()
+	if err := m.failIfNeeded("EjectVirtualMedia"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.VirtualMediaImage = ""
+	return nil
+}
+
+// SetBootSourceVirtualCD mock implementation.
+func (m *MockClient) SetBootSourceVirtualCD(ctx context.Context) error {
+	m.mu.Lock()
+	m.SetBootSourceCDCalled = true
+	m.mu.Unlock()
+	if err := m.failIfNeeded("SetBootSourceVirtualCD"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.BootSourceIsPXE = false
+	m.BootSourceIsCD = true
+	m.HTTPBootURI = ""
+	m.BootOverrideTarget = redfish.CdBootSourceOverrideTarget
+	m.BootOverrideEnabled = redfish.OnceBootSourceOverrideEnabled
 	return nil
 }
 
+// GetBIOSSettings mock implementation.
+func (m *MockClient) GetBIOSSettings(ctx context.Context) (*BIOSSettings, error) {
+	m.mu.Lock()
+	m.GetBIOSSettingsCalled = true
+	m.mu.Unlock()
+	if err := m.failIfNeeded("GetBIOSSettings"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &BIOSSettings{
+		Attributes:        maps.Clone(m.BIOSAttributes),
+		PendingAttributes: maps.Clone(m.PendingBIOSAttributes),
+	}, nil
+}
+
+// SetBIOSAttributes mock implementation.
+func (m *MockClient) SetBIOSAttributes(ctx context.Context, attributes map[string]interface{}) error {
+	m.mu.Lock()
+	m.SetBIOSAttributesCalled = true
+	m.mu.Unlock()
+	if err := m.failIfNeeded("SetBIOSAttributes"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.PendingBIOSAttributes == nil {
+		m.PendingBIOSAttributes = make(map[string]interface{})
+	}
+	maps.Copy(m.PendingBIOSAttributes, attributes)
+	return nil
+}
+
+// applyPendingBIOSAttributes applies the staged BIOS attributes, as the BMC does when
+// the system boots. The caller holds the lock.
+func (m *MockClient) applyPendingBIOSAttributes() {
+	if len(m.PendingBIOSAttributes) == 0 {
+		return
+	}
+	if m.BIOSAttributes == nil {
+		m.BIOSAttributes = make(map[string]interface{})
+	}
+	maps.Copy(m.BIOSAttributes, m.PendingBIOSAttributes)
+	m.PendingBIOSAttributes = nil
+}
+
+// GetFirmwareInventory mock implementation.
+func (m *MockClient) GetFirmwareInventory(ctx context.Context) ([]FirmwareComponent, error) {
+	if err := m.failIfNeeded("GetFirmwareInventory"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.FirmwareInventory), nil
+}
+
+// SimpleUpdate mock implementation. The update is tracked by a running task.
+func (m *MockClient) SimpleUpdate(ctx context.Context, imageURI string, targets []string) (string, error) {
+	m.mu.Lock()
+	m.SimpleUpdateCalled = true
+	m.mu.Unlock()
+	if err := m.failIfNeeded("SimpleUpdate"); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.UpdateImageURI = imageURI
+	m.UpdateTargets = slices.Clone(targets)
+	if m.Tasks == nil {
+		m.Tasks = make(map[string]*Task)
+	}
+	taskURI := fmt.Sprintf("/redfish/v1/TaskService/Tasks/%d", len(m.Tasks)+1)
+	m.Tasks[taskURI] = &Task{State: redfish.RunningTaskState}
+	return taskURI, nil
+}
+
+// GetTask mock implementation.
+func (m *MockClient) GetTask(ctx context.Context, taskURI string) (*Task, error) {
+	if err := m.failIfNeeded("GetTask"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task, ok := m.Tasks[taskURI]
+	if !ok {
+		return nil, fmt.Errorf("task %s not found", taskURI)
+	}
+	result := *task
+	return &result, nil
+}
+
+// GetStorage mock implementation.
+func (m *MockClient) GetStorage(ctx context.Context) ([]Storage, error) {
+	if err := m.failIfNeeded("GetStorage"); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	storage := make([]Storage, 0, len(m.Storage))
+	for _, subsystem := range m.Storage {
+		subsystem.Drives = slices.Clone(subsystem.Drives)
+		subsystem.Volumes = slices.Clone(subsystem.Volumes)
+		storage = append(storage, subsystem)
+	}
+	return storage, nil
+}
+
+// CreateVolume mock implementation. The volume is created on the next boot.
+func (m *MockClient) CreateVolume(ctx context.Context, storageURI, name string, raidType redfish.RAIDType, driveURIs []string) error {
+	m.mu.Lock()
+	m.CreateVolumeCalled = true
+	m.mu.Unlock()
+	if err := m.failIfNeeded("CreateVolume"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.PendingVolumes == nil {
+		m.PendingVolumes = make(map[string][]Volume)
+	}
+	m.PendingVolumes[storageURI] = append(m.PendingVolumes[storageURI], Volume{
+		Name:     name,
+		RAIDType: raidType,
+		Drives:   slices.Clone(driveURIs),
+	})
+	return nil
+}
+
+// applyPendingVolumes creates the requested volumes, as the BMC does when the system
+// boots. Their capacity is that of the smallest member drive. The caller holds the lock.
+func (m *MockClient) applyPendingVolumes() {
+	for i := range m.Storage {
+		subsystem := &m.Storage[i]
+		for _, volume := range m.PendingVolumes[subsystem.URI] {
+			for _, drive := range subsystem.Drives {
+				if slices.Contains(volume.Drives, drive.URI) &&
+					(volume.CapacityBytes == 0 || drive.CapacityBytes < volume.CapacityBytes) {
+					volume.CapacityBytes = drive.CapacityBytes
+				}
+			}
+			volume.ID = fmt.Sprintf("Volume%d", len(subsystem.Volumes))
+			volume.URI = subsystem.URI + "/Volumes/" + volume.ID
+			subsystem.Volumes = append(subsystem.Volumes, volume)
+		}
+	}
+	m.PendingVolumes = nil
+}
+
 // Reset mock implementation.
 func (m *MockClient) Reset(ctx context.Context) error {
 	m.mu.Lock()
@@ -122,6 +458,8 @@ func (m *MockClient) Reset(ctx context.Context) error {
 	// Simulate a reset by cycling power state
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.applyPendingBIOSAttributes()
+	m.applyPendingVolumes()
 	m.PowerState = redfish.OnPowerState
 	return nil
 }
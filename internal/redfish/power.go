@@ -0,0 +1,161 @@
+package redfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+const (
+	// DefaultGracefulShutdownTimeout is how long a system may take to shut down
+	// gracefully before it is forced off.
+	DefaultGracefulShutdownTimeout = 2 * time.Minute
+
+	// DefaultForcePowerTimeout is how long a system may take to reach the requested
+	// power state after a forced power action or power on.
+	DefaultForcePowerTimeout = 30 * time.Second
+)
+
+// ErrPowerStateTimeout is returned when a system does not reach the requested power
+// state in time.
+var ErrPowerStateTimeout = errors.New("timed out waiting for power state")
+
+// PowerActionOptions configures how long power operations give the system to reach
+// the requested power state.
+type PowerActionOptions struct {
+	// GracefulTimeout is how long a graceful shutdown may take before the system is
+	// forced off. Negative values skip the graceful shutdown. Defaults to
+	// DefaultGracefulShutdownTimeout.
+	GracefulTimeout time.Duration
+	// ForceTimeout is how long the system may take to reach the requested power state
+	// after a forced power action or power on. Defaults to DefaultForcePowerTimeout.
+	ForceTimeout time.Duration
+}
+
+// withDefaults returns the options with unset durations set to their defaults.
+func (o PowerActionOptions) withDefaults() PowerActionOptions {
+	if o.GracefulTimeout == 0 {
+		o.GracefulTimeout = DefaultGracefulShutdownTimeout
+	}
+	if o.ForceTimeout <= 0 {
+		o.ForceTimeout = DefaultForcePowerTimeout
+	}
+	return o
+}
+
+// PowerOperation names a power operation driven by StepPowerAction.
+type PowerOperation string
+
+const (
+	// PowerOperationOff shuts the system down, gracefully first.
+	PowerOperationOff PowerOperation = "PowerOff"
+	// PowerOperationOn powers the system on.
+	PowerOperationOn PowerOperation = "PowerOn"
+	// PowerOperationRestart powers the system off, gracefully first, and on again.
+	// Unlike a reset, both transitions are observed, so a hung system is reliably
+	// rebooted.
+	PowerOperationRestart PowerOperation = "Restart"
+)
+
+// PowerActionProgress records the last reset sent for a power operation, so the
+// operation can be continued later without blocking the caller.
+type PowerActionProgress struct {
+	// Operation is the power operation in progress.
+	Operation PowerOperation
+	// ResetType is the last reset sent to the system.
+	ResetType redfish.ResetType
+	// Deadline is when the system must have reached the power state requested by the
+	// reset. A graceful shutdown is forced off after it.
+	Deadline time.Time
+}
+
+// StepPowerAction advances a power operation by at most one reset and never waits for
+// the system. Pass nil progress to start the operation. It returns the progress to pass
+// to the next step, or nil once the system has reached the requested power state. A
+// graceful shutdown that is not complete by its deadline, or that the BMC rejects, is
+// escalated to ForceOff. ErrPowerStateTimeout is returned if the system does not reach
+// the requested power state after a forced power off or power on; after any other error
+// the operation may be continued with the previous progress.
+func StepPowerAction(ctx context.Context, c Client, op PowerOperation, progress *PowerActionProgress, opts PowerActionOptions) (*PowerActionProgress, error) {
+	opts = opts.withDefaults()
+
+	state, err := c.GetPowerState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get power state: %w", err)
+	}
+
+	if progress == nil {
+		switch {
+		case op == PowerOperationOn && state == redfish.OnPowerState:
+			return nil, nil
+		case op == PowerOperationOff && state == redfish.OffPowerState:
+			return nil, nil
+		case op != PowerOperationOn && state != redfish.OffPowerState:
+			return shutDown(ctx, c, op, opts)
+		default:
+			return sendReset(ctx, c, op, redfish.OnResetType, opts.ForceTimeout)
+		}
+	}
+
+	switch progress.ResetType {
+	case redfish.GracefulShutdownResetType, redfish.ForceOffResetType:
+		if state == redfish.OffPowerState {
+			if progress.ResetType == redfish.GracefulShutdownResetType {
+				log.Info("System shut down gracefully")
+			}
+			if progress.Operation == PowerOperationRestart {
+				return sendReset(ctx, c, progress.Operation, redfish.OnResetType, opts.ForceTimeout)
+			}
+			return nil, nil
+		}
+		if time.Now().Before(progress.Deadline) {
+			return progress, nil
+		}
+		if progress.ResetType == redfish.GracefulShutdownResetType {
+			log.Info("System did not shut down gracefully in time, forcing power off", "timeout", opts.GracefulTimeout)
+			return sendReset(ctx, c, progress.Operation, redfish.ForceOffResetType, opts.ForceTimeout)
+		}
+		return nil, fmt.Errorf("%w %s after %v, system is %s", ErrPowerStateTimeout, redfish.OffPowerState, opts.ForceTimeout, state)
+
+	case redfish.OnResetType:
+		if state == redfish.OnPowerState {
+			return nil, nil
+		}
+		if time.Now().Before(progress.Deadline) {
+			return progress, nil
+		}
+		return nil, fmt.Errorf("%w %s after %v, system is %s", ErrPowerStateTimeout, redfish.OnPowerState, opts.ForceTimeout, state)
+
+	default:
+		return nil, fmt.Errorf("unexpected reset type %q for power operation %s", progress.ResetType, progress.Operation)
+	}
+}
+
+// shutDown sends the graceful shutdown that starts powering the system off, or forces
+// it off if the graceful shutdown is skipped or rejected by the BMC.
+func shutDown(ctx context.Context, c Client, op PowerOperation, opts PowerActionOptions) (*PowerActionProgress, error) {
+	if opts.GracefulTimeout > 0 {
+		err := c.PowerAction(ctx, redfish.GracefulShutdownResetType)
+		if err == nil {
+			return &PowerActionProgress{
+				Operation: op,
+				ResetType: redfish.GracefulShutdownResetType,
+				Deadline:  time.Now().Add(opts.GracefulTimeout),
+			}, nil
+		}
+		log.Info("Graceful shutdown failed, forcing power off", "error", err.Error())
+	}
+	return sendReset(ctx, c, op, redfish.ForceOffResetType, opts.ForceTimeout)
+}
+
+// sendReset sends the reset to the system and returns the progress that waits for it
+// until the timeout.
+func sendReset(ctx context.Context, c Client, op PowerOperation, resetType redfish.ResetType, timeout time.Duration) (*PowerActionProgress, error) {
+	if err := c.PowerAction(ctx, resetType); err != nil {
+		return nil, err
+	}
+	return &PowerActionProgress{Operation: op, ResetType: resetType, Deadline: time.Now().Add(timeout)}, nil
+}
@@ -0,0 +1,184 @@
+package redfish
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+// runPowerAction steps the power operation until it completes, as the controllers do
+// across reconciles.
+func runPowerAction(t *testing.T, c Client, op PowerOperation, opts PowerActionOptions) error {
+	t.Helper()
+	var progress *PowerActionProgress
+	for range 100 {
+		var err error
+		progress, err = StepPowerAction(context.Background(), c, op, progress, opts)
+		if err != nil || progress == nil {
+			return err
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("power operation %s did not complete", op)
+	return nil
+}
+
+func TestStepPowerActionOff(t *testing.T) {
+	opts := PowerActionOptions{
+		GracefulTimeout: 20 * time.Millisecond,
+		ForceTimeout:    20 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(m *MockClient)
+		expected []redfish.ResetType
+	}{
+		{
+			name:     "graceful shutdown",
+			expected: []redfish.ResetType{redfish.GracefulShutdownResetType},
+		},
+		{
+			name:     "forced off after graceful timeout",
+			setup:    func(m *MockClient) { m.IgnoreGracefulShutdown = true },
+			expected: []redfish.ResetType{redfish.GracefulShutdownResetType, redfish.ForceOffResetType},
+		},
+		{
+			name: "forced off when graceful shutdown is rejected",
+			setup: func(m *MockClient) {
+				m.ShouldFail["PowerAction:GracefulShutdown"] = errors.New("reset type not supported")
+			},
+			expected: []redfish.ResetType{redfish.GracefulShutdownResetType, redfish.ForceOffResetType},
+		},
+		{
+			name:     "already off",
+			setup:    func(m *MockClient) { m.PowerState = redfish.OffPowerState },
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMockClient()
+			m.PowerState = redfish.OnPowerState
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+
+			if err := runPowerAction(t, m, PowerOperationOff, opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if m.PowerState != redfish.OffPowerState {
+				t.Errorf("expected system to be off, got %s", m.PowerState)
+			}
+			if !reflect.DeepEqual(m.PowerActions, tt.expected) {
+				t.Errorf("expected power actions %v, got %v", tt.expected, m.PowerActions)
+			}
+		})
+	}
+}
+
+func TestStepPowerActionDoesNotWait(t *testing.T) {
+	m := NewMockClient()
+	m.PowerState = redfish.OnPowerState
+	m.IgnoreGracefulShutdown = true
+	opts := PowerActionOptions{GracefulTimeout: time.Hour}
+
+	progress, err := StepPowerAction(context.Background(), m, PowerOperationOff, nil, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if progress == nil || progress.ResetType != redfish.GracefulShutdownResetType {
+		t.Fatalf("expected a graceful shutdown in progress, got %+v", progress)
+	}
+
+	// Before the deadline the system is left alone
+	next, err := StepPowerAction(context.Background(), m, PowerOperationOff, progress, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(next, progress) {
+		t.Errorf("expected progress %+v to be kept, got %+v", progress, next)
+	}
+
+	// After it the shutdown is forced
+	progress.Deadline = time.Now().Add(-time.Second)
+	next, err = StepPowerAction(context.Background(), m, PowerOperationOff, progress, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next == nil || next.ResetType != redfish.ForceOffResetType {
+		t.Errorf("expected a forced power off in progress, got %+v", next)
+	}
+}
+
+func TestStepPowerActionSkipsGracefulShutdown(t *testing.T) {
+	m := NewMockClient()
+	m.PowerState = redfish.OnPowerState
+
+	if err := runPowerAction(t, m, PowerOperationOff, PowerActionOptions{GracefulTimeout: -1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []redfish.ResetType{redfish.ForceOffResetType}
+	if !reflect.DeepEqual(m.PowerActions, expected) {
+		t.Errorf("expected power actions %v, got %v", expected, m.PowerActions)
+	}
+}
+
+func TestStepPowerActionRestart(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    redfish.PowerState
+		expected []redfish.ResetType
+	}{
+		{
+			name:     "running system",
+			state:    redfish.OnPowerState,
+			expected: []redfish.ResetType{redfish.GracefulShutdownResetType, redfish.OnResetType},
+		},
+		{
+			name:     "powered off system",
+			state:    redfish.OffPowerState,
+			expected: []redfish.ResetType{redfish.OnResetType},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMockClient()
+			m.PowerState = tt.state
+
+			if err := runPowerAction(t, m, PowerOperationRestart, PowerActionOptions{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if m.PowerState != redfish.OnPowerState {
+				t.Errorf("expected system to be on, got %s", m.PowerState)
+			}
+			if !reflect.DeepEqual(m.PowerActions, tt.expected) {
+				t.Errorf("expected power actions %v, got %v", tt.expected, m.PowerActions)
+			}
+		})
+	}
+}
+
+func TestStepPowerActionTimeout(t *testing.T) {
+	m := NewMockClient()
+	m.PowerState = redfish.OnPowerState
+
+	progress := &PowerActionProgress{
+		Operation: PowerOperationOff,
+		ResetType: redfish.ForceOffResetType,
+		Deadline:  time.Now().Add(-time.Second),
+	}
+	next, err := StepPowerAction(context.Background(), m, PowerOperationOff, progress, PowerActionOptions{})
+	if !errors.Is(err, ErrPowerStateTimeout) {
+		t.Errorf("expected ErrPowerStateTimeout, got %v", err)
+	}
+	if next != nil {
+		t.Errorf("expected the power operation to be given up, got %+v", next)
+	}
+}
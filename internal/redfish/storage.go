@@ -0,0 +1,90 @@
+package redfish
+
+import (
+	"slices"
+
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+// Drive is a physical drive attached to a storage subsystem.
+type Drive struct {
+	// ID identifies the drive within its storage subsystem
+	ID string
+	// Model is the model of the drive
+	Model string
+	// SerialNumber is the serial number of the drive
+	SerialNumber string
+	// CapacityBytes is the raw size of the drive
+	CapacityBytes int64
+	// MediaType is HDD, SSD or SMR, if the BMC reports it
+	MediaType string
+	// URI is the Redfish URI of the drive, used to build volumes from it
+	URI string
+}
+
+// Volume is a logical volume of a storage subsystem, such as a RAID volume.
+type Volume struct {
+	// ID identifies the volume within its storage subsystem
+	ID string
+	// Name is the name given to the volume when it was created
+	Name string
+	// RAIDType is the RAID level of the volume, e.g. RAID1
+	RAIDType redfish.RAIDType
+	// CapacityBytes is the usable size of the volume
+	CapacityBytes int64
+	// Drives are the URIs of the member drives
+	Drives []string
+	// URI is the Redfish URI of the volume
+	URI string
+}
+
+// Storage is a storage subsystem of the system, such as a RAID controller, with its
+// drives and volumes.
+type Storage struct {
+	// ID identifies the storage subsystem, e.g. RAID.Integrated.1-1
+	ID string
+	// URI is the Redfish URI of the storage subsystem
+	URI string
+	// SupportedRAIDTypes are the RAID levels the controllers of the subsystem can build,
+	// empty if the BMC does not report them
+	SupportedRAIDTypes []redfish.RAIDType
+	// Drives are the drives attached to the subsystem, sorted by ID
+	Drives []Drive
+	// Volumes are the volumes of the subsystem
+	Volumes []Volume
+}
+
+// FindVolume returns the volume with the given name, or nil.
+func (s *Storage) FindVolume(name string) *Volume {
+	for i := range s.Volumes {
+		if s.Volumes[i].Name == name {
+			return &s.Volumes[i]
+		}
+	}
+	return nil
+}
+
+// SupportsRAIDType reports whether the subsystem can build volumes of the RAID type.
+// Subsystems that do not report their RAID types are assumed to support it.
+func (s *Storage) SupportsRAIDType(raidType redfish.RAIDType) bool {
+	return len(s.SupportedRAIDTypes) == 0 || slices.Contains(s.SupportedRAIDTypes, raidType)
+}
+
+// UnusedDrives returns the drives that are not a member of any volume, in the order of
+// Drives.
+func (s *Storage) UnusedDrives() []Drive {
+	var unused []Drive
+	for _, drive := range s.Drives {
+		used := false
+		for _, volume := range s.Volumes {
+			if slices.Contains(volume.Drives, drive.URI) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			unused = append(unused, drive)
+		}
+	}
+	return unused
+}
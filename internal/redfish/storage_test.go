@@ -0,0 +1,48 @@
+package redfish
+
+import (
+	"testing"
+
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+func TestStorageVolumesAndDrives(t *testing.T) {
+	storage := Storage{
+		URI: "/redfish/v1/Systems/1/Storage/RAID.Integrated.1-1",
+		Drives: []Drive{
+			{ID: "Disk.0", URI: "/drives/0"},
+			{ID: "Disk.1", URI: "/drives/1"},
+			{ID: "Disk.2", URI: "/drives/2"},
+		},
+		Volumes: []Volume{
+			{Name: "data", RAIDType: redfish.RAID0RAIDType, Drives: []string{"/drives/1"}},
+		},
+	}
+
+	if volume := storage.FindVolume("data"); volume == nil || volume.RAIDType != redfish.RAID0RAIDType {
+		t.Errorf("expected to find volume data, got %v", volume)
+	}
+	if volume := storage.FindVolume("beskar7-root"); volume != nil {
+		t.Errorf("expected no volume beskar7-root, got %v", volume)
+	}
+
+	unused := storage.UnusedDrives()
+	if len(unused) != 2 || unused[0].ID != "Disk.0" || unused[1].ID != "Disk.2" {
+		t.Errorf("expected Disk.0 and Disk.2 to be unused, got %v", unused)
+	}
+}
+
+func TestStorageSupportsRAIDType(t *testing.T) {
+	unknown := Storage{}
+	if !unknown.SupportsRAIDType(redfish.RAID6RAIDType) {
+		t.Error("expected storage without reported RAID types to support RAID6")
+	}
+
+	storage := Storage{SupportedRAIDTypes: []redfish.RAIDType{redfish.RAID0RAIDType, redfish.RAID1RAIDType}}
+	if !storage.SupportsRAIDType(redfish.RAID1RAIDType) {
+		t.Error("expected storage to support RAID1")
+	}
+	if storage.SupportsRAIDType(redfish.RAID5RAIDType) {
+		t.Error("expected storage not to support RAID5")
+	}
+}
@@ -235,26 +235,106 @@ var _ = Describe("Hardware Emulation Tests", func() {
 			Expect(string(ps)).To(Equal("Off"))
 		})
 
+		It("should shut down gracefully before forcing power off on emulated server", func() {
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+			opts := internalredfish.PowerActionOptions{GracefulTimeout: 200 * time.Millisecond}
+
+			err := runPowerAction(ctx, client, internalredfish.PowerOperationOff, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mockServer.GetResetTypes()).To(Equal([]string{"GracefulShutdown"}))
+
+			err = runPowerAction(ctx, client, internalredfish.PowerOperationOn, opts)
+			Expect(err).NotTo(HaveOccurred())
+
+			// An OS ignoring the power button is forced off after the graceful timeout
+			mockServer.SetIgnoreGracefulShutdown(true)
+			err = runPowerAction(ctx, client, internalredfish.PowerOperationOff, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mockServer.GetResetTypes()).To(Equal([]string{"GracefulShutdown", "On", "GracefulShutdown", "ForceOff"}))
+
+			ps, err := client.GetPowerState(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ps).To(Equal(redfish.OffPowerState))
+		})
+
 		It("should handle boot source configuration on emulated server", func() {
 			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
 
-			// Test setting boot source
-			err := client.SetBootSourceISO(ctx, "http://example.com/test.iso")
+			err := client.SetBootSourcePXE(ctx)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(mockServer.GetBootSource()).To(Equal(BootSourcePxe))
+		})
 
-			// Verify request was logged
-			logs := mockServer.GetRequestLog()
-			Expect(len(logs)).To(BeNumerically(">", 0))
-
-			// Check for virtual media or boot override requests
-			foundBootRequest := false
-			for _, log := range logs {
-				if log.URL == "/redfish/v1/Systems/1" && log.Method == "PATCH" {
-					foundBootRequest = true
-					break
-				}
-			}
-			Expect(foundBootRequest).To(BeTrue())
+		It("should set and clear persistent boot overrides on emulated server", func() {
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+
+			err := client.SetBootOverride(ctx, redfish.HddBootSourceOverrideTarget, redfish.ContinuousBootSourceOverrideEnabled)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mockServer.GetBootSource()).To(Equal(BootSourceHdd))
+			Expect(mockServer.GetBootSourceEnabled()).To(Equal("Continuous"))
+
+			err = client.ClearBootOverride(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mockServer.GetBootSource()).To(Equal(BootSourceNone))
+			Expect(mockServer.GetBootSourceEnabled()).To(Equal("Disabled"))
+
+			err = client.SetBootOverride(ctx, redfish.PxeBootSourceOverrideTarget, "Sometimes")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should configure UEFI HTTP boot on emulated server", func() {
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+			mockServer.SetHTTPBootSupported(true)
+
+			httpBoot, err := client.SetBootSourceHTTP(ctx, "https://beskar7.example.com/api/v1/boot/ipxe?serial=ABC123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(httpBoot).To(BeTrue())
+			Expect(mockServer.GetBootSource()).To(Equal(BootSourceUefiHttp))
+			Expect(mockServer.GetHTTPBootURI()).To(Equal("https://beskar7.example.com/api/v1/boot/ipxe?serial=ABC123"))
+		})
+
+		It("should fall back to PXE without UEFI HTTP boot support on emulated server", func() {
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+
+			httpBoot, err := client.SetBootSourceHTTP(ctx, "https://beskar7.example.com/api/v1/boot/ipxe?serial=ABC123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(httpBoot).To(BeFalse())
+			Expect(mockServer.GetBootSource()).To(Equal(BootSourcePxe))
+			Expect(mockServer.GetBootSourceEnabled()).To(Equal("Once"))
+		})
+
+		It("should boot from virtual media on emulated server", func() {
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+
+			err := client.InsertVirtualMedia(ctx, "http://example.com/inspect.iso")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mockServer.GetVirtualCD().Inserted).To(BeTrue())
+			Expect(mockServer.GetVirtualCD().ImageURL).To(Equal("http://example.com/inspect.iso"))
+
+			err = client.SetBootSourceVirtualCD(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mockServer.GetBootSource()).To(Equal(BootSourceCd))
+
+			// Inserting another image replaces the inserted one
+			err = client.InsertVirtualMedia(ctx, "http://example.com/target.iso")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mockServer.GetVirtualCD().ImageURL).To(Equal("http://example.com/target.iso"))
+
+			err = client.EjectVirtualMedia(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mockServer.GetVirtualCD().Inserted).To(BeFalse())
+
+			// Ejecting an empty drive is a no-op
+			err = client.EjectVirtualMedia(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should report virtual media failures on emulated server", func() {
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+			mockServer.SetFailureMode(FailureConfig{MediaFailures: true})
+
+			err := client.InsertVirtualMedia(ctx, "http://example.com/inspect.iso")
+			Expect(err).To(HaveOccurred())
 		})
 	})
 
@@ -335,22 +415,165 @@ var _ = Describe("Hardware Emulation Tests", func() {
 	})
 
 	Context("Vendor-Specific Behavior Testing", func() {
-		It("should test Dell BIOS attribute handling", func() {
+		It("should stage Dell BIOS attributes until the next reboot", func() {
 			mockServer = NewMockRedfishServer(VendorDell)
 			mockServer.DisableAuth()
 			defer mockServer.Close()
 
 			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
 
-			// Test Dell-specific kernel args setting (vendor-specific behavior)
-			// In a real implementation, this would test the vendor-specific boot parameter setting
-			_, err := client.GetSystemInfo(ctx)
+			settings, err := client.GetBIOSSettings(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(settings.Attributes).To(HaveKeyWithValue("SriovGlobalEnable", "Disabled"))
+			Expect(settings.PendingAttributes).To(BeEmpty())
+
+			changes, err := settings.Changes(map[string]string{"SriovGlobalEnable": "Enabled", "ProcVirtualization": "Enabled"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(Equal(map[string]interface{}{"SriovGlobalEnable": "Enabled"}))
+			Expect(client.SetBIOSAttributes(ctx, changes)).To(Succeed())
+
+			// Staged, but not in effect before the reboot
+			Expect(mockServer.GetBIOSAttribute("SriovGlobalEnable")).To(Equal("Disabled"))
+			settings, err = client.GetBIOSSettings(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(settings.PendingAttributes).To(HaveKeyWithValue("SriovGlobalEnable", "Enabled"))
+			Expect(settings.IsPending(changes)).To(BeTrue())
+
+			err = runPowerAction(ctx, client, internalredfish.PowerOperationRestart, internalredfish.PowerActionOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			settings, err = client.GetBIOSSettings(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(settings.Attributes).To(HaveKeyWithValue("SriovGlobalEnable", "Enabled"))
+			Expect(settings.PendingAttributes).To(BeEmpty())
+		})
+
+		It("should reject unknown BIOS attributes", func() {
+			mockServer = NewMockRedfishServer(VendorDell)
+			mockServer.DisableAuth()
+			defer mockServer.Close()
+
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+
+			settings, err := client.GetBIOSSettings(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = settings.Changes(map[string]string{"IntelVtd": "Enabled"})
+			Expect(err).To(MatchError(internalredfish.ErrInvalidBIOSAttribute))
+
+			Expect(client.SetBIOSAttributes(ctx, map[string]interface{}{"IntelVtd": "Enabled"})).NotTo(Succeed())
+			Expect(mockServer.GetPendingBIOSAttributes()).To(BeEmpty())
+		})
+
+		It("should update Dell firmware through the update service", func() {
+			mockServer = NewMockRedfishServer(VendorDell)
+			mockServer.DisableAuth()
+			defer mockServer.Close()
+
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+
+			inventory, err := client.GetFirmwareInventory(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			component := internalredfish.FindFirmwareComponent(inventory, "iDRAC.Embedded.1-1")
+			Expect(component).NotTo(BeNil())
+			Expect(component.Version).To(Equal("6.10.30.00"))
+			Expect(component.Updateable).To(BeTrue())
+
+			taskURI, err := client.SimpleUpdate(ctx, "http://firmware-server/idrac-7.00.00.00.exe", []string{component.URI})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(taskURI).To(Equal(RedfishTasksPath + "/1"))
+
+			mockServer.ProgressFirmwareUpdate("1", 40)
+			task, err := client.GetTask(ctx, taskURI)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(task.Done()).To(BeFalse())
+			Expect(task.PercentComplete).To(Equal(40))
+
+			mockServer.CompleteFirmwareUpdate("1", "7.00.00.00")
+			task, err = client.GetTask(ctx, taskURI)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(task.Done()).To(BeTrue())
+			Expect(task.Failed()).To(BeFalse())
+
+			inventory, err = client.GetFirmwareInventory(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(internalredfish.FindFirmwareComponent(inventory, "iDRAC.Embedded.1-1").Version).To(Equal("7.00.00.00"))
+		})
+
+		It("should report failed and rejected firmware updates", func() {
+			mockServer = NewMockRedfishServer(VendorDell)
+			mockServer.DisableAuth()
+			defer mockServer.Close()
+
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+
+			_, err := client.SimpleUpdate(ctx, "http://firmware-server/tpm.bin",
+				[]string{RedfishFirmwareInventoryPath + "/TPM.Integrated.1-1"})
+			Expect(err).To(HaveOccurred())
+
+			taskURI, err := client.SimpleUpdate(ctx, "http://firmware-server/bios.exe",
+				[]string{RedfishFirmwareInventoryPath + "/BIOS.Setup.1-1"})
+			Expect(err).NotTo(HaveOccurred())
+			mockServer.FailFirmwareUpdate("1", "Image signature verification failed")
+
+			task, err := client.GetTask(ctx, taskURI)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(task.Failed()).To(BeTrue())
+			Expect(task.Message()).To(ContainSubstring("signature verification failed"))
+			Expect(mockServer.GetFirmwareVersion("BIOS.Setup.1-1")).To(Equal("1.9.2"))
+		})
+
+		It("should create a Dell RAID volume on the next reboot", func() {
+			mockServer = NewMockRedfishServer(VendorDell)
+			mockServer.DisableAuth()
+			defer mockServer.Close()
+
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+
+			storage, err := client.GetStorage(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storage).To(HaveLen(1))
+			Expect(storage[0].ID).To(Equal("RAID.Integrated.1-1"))
+			Expect(storage[0].SupportsRAIDType(redfish.RAID10RAIDType)).To(BeTrue())
+			Expect(storage[0].Drives).To(HaveLen(4))
+			Expect(storage[0].Drives[0].Model).To(Equal("MZ7LH480HBHQ0D3"))
+			Expect(storage[0].Volumes).To(BeEmpty())
+
+			driveURIs := []string{storage[0].Drives[0].URI, storage[0].Drives[1].URI}
+			Expect(client.CreateVolume(ctx, storage[0].URI, "beskar7-root", redfish.RAID1RAIDType, driveURIs)).To(Succeed())
+			Expect(mockServer.GetPendingVolumes()).To(HaveLen(1))
+
+			// Drives of a pending volume cannot be used again
+			Expect(client.CreateVolume(ctx, storage[0].URI, "data", redfish.RAID0RAIDType, driveURIs[1:])).NotTo(Succeed())
+
+			err = runPowerAction(ctx, client, internalredfish.PowerOperationRestart, internalredfish.PowerActionOptions{})
 			Expect(err).NotTo(HaveOccurred())
 
-			// This would test actual BIOS attribute setting in a full implementation
-			// For now, we verify the server has the right vendor configuration
-			Expect(mockServer.vendor).To(Equal(VendorDell))
-			Expect(mockServer.biosAttributes).To(HaveKey("KernelArgs"))
+			storage, err = client.GetStorage(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			volume := storage[0].FindVolume("beskar7-root")
+			Expect(volume).NotTo(BeNil())
+			Expect(volume.RAIDType).To(Equal(redfish.RAID1RAIDType))
+			Expect(volume.CapacityBytes).To(Equal(storage[0].Drives[0].CapacityBytes))
+			Expect(volume.Drives).To(Equal(driveURIs))
+			Expect(storage[0].UnusedDrives()).To(HaveLen(2))
+		})
+
+		It("should reject volumes the controller cannot build", func() {
+			mockServer = NewMockRedfishServer(VendorSupermicro)
+			mockServer.DisableAuth()
+			defer mockServer.Close()
+
+			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
+
+			storage, err := client.GetStorage(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storage[0].SupportsRAIDType(redfish.RAID5RAIDType)).To(BeFalse())
+
+			driveURIs := []string{storage[0].Drives[0].URI, storage[0].Drives[1].URI}
+			Expect(client.CreateVolume(ctx, storage[0].URI, "beskar7-root", redfish.RAID5RAIDType, driveURIs)).NotTo(Succeed())
+			Expect(client.CreateVolume(ctx, storage[0].URI, "beskar7-root", redfish.RAID1RAIDType,
+				[]string{storage[0].URI + "/Drives/missing"})).NotTo(Succeed())
+			Expect(mockServer.GetPendingVolumes()).To(BeEmpty())
 		})
 
 		It("should test HPE UEFI boot override behavior", func() {
@@ -360,8 +583,10 @@ var _ = Describe("Hardware Emulation Tests", func() {
 
 			client := createRedfishClient(mockServer.GetURL(), "admin", "password123")
 
-			// Test HPE-specific UEFI target boot override
-			err := client.SetBootSourceISO(ctx, "http://example.com/hpe-test.iso")
+			// Test HPE virtual CD boot override
+			err := client.InsertVirtualMedia(ctx, "http://example.com/hpe-test.iso")
+			Expect(err).NotTo(HaveOccurred())
+			err = client.SetBootSourceVirtualCD(ctx)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Verify HPE-specific configuration
@@ -371,6 +596,20 @@ var _ = Describe("Hardware Emulation Tests", func() {
 	})
 })
 
+// runPowerAction steps the power operation until it completes, as the controllers do
+// across reconciles.
+func runPowerAction(ctx context.Context, c internalredfish.Client, op internalredfish.PowerOperation, opts internalredfish.PowerActionOptions) error {
+	var progress *internalredfish.PowerActionProgress
+	for {
+		var err error
+		progress, err = internalredfish.StepPowerAction(ctx, c, op, progress, opts)
+		if err != nil || progress == nil {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // createRedfishClient creates a Redfish client with TLS verification disabled for testing
 func createRedfishClient(address, username, password string) internalredfish.Client {
 	// Create custom HTTP client that skips TLS verification
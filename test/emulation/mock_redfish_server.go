@@ -20,8 +20,11 @@ package emulation
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -31,7 +34,12 @@ import (
 const (
 	RedfishAPIRoot    = "/redfish/v1/"
 	RedfishSystemPath = "/redfish/v1/Systems/1"
-	BiosEnabledState  = "Enabled"
+
+	RedfishUpdateServicePath     = "/redfish/v1/UpdateService"
+	RedfishFirmwareInventoryPath = "/redfish/v1/UpdateService/FirmwareInventory"
+	RedfishTasksPath             = "/redfish/v1/TaskService/Tasks"
+	RedfishStoragePath           = "/redfish/v1/Systems/1/Storage"
+	BiosEnabledState             = "Enabled"
 )
 
 // System information constants
@@ -71,6 +79,7 @@ const (
 	BootSourceHdd        BootSourceOverrideTarget = "Hdd"
 	BootSourceCd         BootSourceOverrideTarget = "Cd"
 	BootSourceUefiTarget BootSourceOverrideTarget = "UefiTarget"
+	BootSourceUefiHttp   BootSourceOverrideTarget = "UefiHttp"
 )
 
 // MockRedfishServer represents a mock Redfish BMC server
@@ -80,9 +89,18 @@ type MockRedfishServer struct {
 	mu             sync.RWMutex
 	powerState     PowerState
 	bootSource     BootSourceOverrideTarget
+	bootEnabled    string
+	httpBootURI    string
+	httpBoot       bool
+	ignoreGraceful bool
+	resetTypes     []string
 	bootParameters []string
 	virtualMedia   []VirtualMedia
 	biosAttributes map[string]interface{}
+	biosPending    map[string]interface{}
+	firmware       []FirmwareComponent
+	tasks          map[string]*UpdateTask
+	storage        StorageController
 	systemInfo     SystemInfo
 	failures       FailureConfig
 	requestLog     []RequestLog
@@ -111,6 +129,53 @@ type VirtualMedia struct {
 	ConnectedVia   string
 }
 
+// FirmwareComponent represents a member of the firmware inventory
+type FirmwareComponent struct {
+	ID         string
+	Name       string
+	Version    string
+	Updateable bool
+}
+
+// UpdateTask represents the task tracking a firmware update
+type UpdateTask struct {
+	ID              string
+	ImageURI        string
+	Targets         []string
+	State           string
+	TaskStatus      string
+	PercentComplete int
+	Messages        []string
+}
+
+// Drive represents a physical drive of the storage controller
+type Drive struct {
+	ID            string
+	Model         string
+	SerialNumber  string
+	CapacityBytes int64
+	MediaType     string
+}
+
+// Volume represents a volume of the storage controller
+type Volume struct {
+	ID            string
+	Name          string
+	RAIDType      string
+	Drives        []string
+	CapacityBytes int64
+}
+
+// StorageController represents the storage subsystem of the system. Volumes requested
+// through the API are pending until the next reboot, like on BMCs creating them in a job.
+type StorageController struct {
+	ID                 string
+	SupportedRAIDTypes []string
+	Drives             []Drive
+	Volumes            []Volume
+	PendingVolumes     []Volume
+}
+
 // FailureConfig configures various failure scenarios
 type FailureConfig struct {
 	NetworkErrors   bool
@@ -137,9 +202,12 @@ func NewMockRedfishServer(vendor VendorType) *MockRedfishServer {
 		vendor:         vendor,
 		powerState:     PowerStateOn,
 		bootSource:     BootSourceNone,
+		bootEnabled:    "Disabled",
 		bootParameters: make([]string, 0),
 		virtualMedia:   make([]VirtualMedia, 2), // CD and USB
 		biosAttributes: make(map[string]interface{}),
+		biosPending:    make(map[string]interface{}),
+		tasks:          make(map[string]*UpdateTask),
 		failures:       FailureConfig{},
 		requestLog:     make([]RequestLog, 0),
 		authEnabled:    true,
@@ -166,6 +234,12 @@ func NewMockRedfishServer(vendor VendorType) *MockRedfishServer {
 	// Initialize BIOS attributes based on vendor
 	mrs.initializeBIOSAttributes()
 
+	// Initialize the firmware inventory based on vendor
+	mrs.initializeFirmwareInventory()
+
+	// Initialize the storage controller based on vendor
+	mrs.initializeStorage()
+
 	// Create HTTP server
 	mrs.server = httptest.NewTLSServer(http.HandlerFunc(mrs.handleRequest))
 
@@ -198,6 +272,169 @@ func (mrs *MockRedfishServer) GetRequestLog() []RequestLog {
 	return logCopy
 }
 
+// GetVirtualCD returns the state of the virtual CD
+func (mrs *MockRedfishServer) GetVirtualCD() VirtualMedia {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	return mrs.virtualMedia[0]
+}
+
+// GetBootSource returns the current boot source override target
+func (mrs *MockRedfishServer) GetBootSource() BootSourceOverrideTarget {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	return mrs.bootSource
+}
+
+// GetBootSourceEnabled returns whether the boot source override applies Once,
+// Continuous or is Disabled
+func (mrs *MockRedfishServer) GetBootSourceEnabled() string {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	return mrs.bootEnabled
+}
+
+// SetIgnoreGracefulShutdown makes GracefulShutdown leave the system on, like an OS
+// that does not react to the ACPI power button
+func (mrs *MockRedfishServer) SetIgnoreGracefulShutdown(ignore bool) {
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+	mrs.ignoreGraceful = ignore
+}
+
+// GetResetTypes returns the reset types requested so far, in order
+func (mrs *MockRedfishServer) GetResetTypes() []string {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	resetTypes := make([]string, len(mrs.resetTypes))
+	copy(resetTypes, mrs.resetTypes)
+	return resetTypes
+}
+
+// GetHTTPBootURI returns the URI set for UEFI HTTP boot
+func (mrs *MockRedfishServer) GetHTTPBootURI() string {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	return mrs.httpBootURI
+}
+
+// SetHTTPBootSupported controls whether UefiHttp is advertised as an allowable boot
+// override target
+func (mrs *MockRedfishServer) SetHTTPBootSupported(supported bool) {
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+	mrs.httpBoot = supported
+}
+
+// GetBIOSAttribute returns the value of a BIOS attribute currently in effect
+func (mrs *MockRedfishServer) GetBIOSAttribute(name string) interface{} {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	return mrs.biosAttributes[name]
+}
+
+// SetBIOSAttribute changes a BIOS attribute right away, like an operator in the BIOS setup
+func (mrs *MockRedfishServer) SetBIOSAttribute(name string, value interface{}) {
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+	mrs.biosAttributes[name] = value
+}
+
+// GetPendingBIOSAttributes returns the BIOS attributes staged for the next reboot
+func (mrs *MockRedfishServer) GetPendingBIOSAttributes() map[string]interface{} {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	pending := make(map[string]interface{}, len(mrs.biosPending))
+	for name, value := range mrs.biosPending {
+		pending[name] = value
+	}
+	return pending
+}
+
+// GetVolume returns the volume with the given name, or nil if it was not created yet
+func (mrs *MockRedfishServer) GetVolume(name string) *Volume {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	for _, volume := range mrs.storage.Volumes {
+		if volume.Name == name {
+			volume.Drives = append([]string(nil), volume.Drives...)
+			return &volume
+		}
+	}
+	return nil
+}
+
+// GetPendingVolumes returns the volumes created on the next reboot
+func (mrs *MockRedfishServer) GetPendingVolumes() []Volume {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	return append([]Volume(nil), mrs.storage.PendingVolumes...)
+}
+
+// GetFirmwareVersion returns the version of a firmware inventory member
+func (mrs *MockRedfishServer) GetFirmwareVersion(id string) string {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	for _, component := range mrs.firmware {
+		if component.ID == id {
+			return component.Version
+		}
+	}
+	return ""
+}
+
+// GetUpdateTask returns a copy of the firmware update task with the given ID, if any
+func (mrs *MockRedfishServer) GetUpdateTask(id string) *UpdateTask {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+	task, ok := mrs.tasks[id]
+	if !ok {
+		return nil
+	}
+	result := *task
+	return &result
+}
+
+// ProgressFirmwareUpdate sets the progress of a running firmware update task
+func (mrs *MockRedfishServer) ProgressFirmwareUpdate(id string, percent int) {
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+	if task, ok := mrs.tasks[id]; ok {
+		task.PercentComplete = percent
+	}
+}
+
+// CompleteFirmwareUpdate completes a firmware update task, updating its targets to version
+func (mrs *MockRedfishServer) CompleteFirmwareUpdate(id, version string) {
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+	task, ok := mrs.tasks[id]
+	if !ok {
+		return
+	}
+	task.State = "Completed"
+	task.PercentComplete = 100
+	task.Messages = append(task.Messages, "The update completed successfully.")
+	for i := range mrs.firmware {
+		for _, target := range task.Targets {
+			if target == RedfishFirmwareInventoryPath+"/"+mrs.firmware[i].ID {
+				mrs.firmware[i].Version = version
+			}
+		}
+	}
+}
+
+// FailFirmwareUpdate ends a firmware update task with an exception
+func (mrs *MockRedfishServer) FailFirmwareUpdate(id, message string) {
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+	if task, ok := mrs.tasks[id]; ok {
+		task.State = "Exception"
+		task.TaskStatus = "Critical"
+		task.Messages = append(task.Messages, message)
+	}
+}
+
 // SetCredentials configures authentication
 func (mrs *MockRedfishServer) SetCredentials(username, password string) {
 	mrs.mu.Lock()
@@ -280,6 +517,9 @@ func (mrs *MockRedfishServer) initializeBIOSAttributes() {
 		mrs.biosAttributes["KernelArgs"] = ""
 		mrs.biosAttributes["BootMode"] = "Uefi"
 		mrs.biosAttributes["SecureBoot"] = BiosEnabledState
+		mrs.biosAttributes["SriovGlobalEnable"] = "Disabled"
+		mrs.biosAttributes["ProcVirtualization"] = BiosEnabledState
+		mrs.biosAttributes["ProcCStates"] = "Enabled"
 	case VendorHPE:
 		mrs.biosAttributes["BootOrderPolicy"] = "AttemptOnce"
 		mrs.biosAttributes["UefiOptimizedBoot"] = BiosEnabledState
@@ -293,6 +533,50 @@ func (mrs *MockRedfishServer) initializeBIOSAttributes() {
 	}
 }
 
+// initializeFirmwareInventory sets the vendor-specific firmware inventory
+func (mrs *MockRedfishServer) initializeFirmwareInventory() {
+	switch mrs.vendor {
+	case VendorDell:
+		mrs.firmware = []FirmwareComponent{
+			{ID: "iDRAC.Embedded.1-1", Name: "Integrated Dell Remote Access Controller", Version: "6.10.30.00", Updateable: true},
+			{ID: "BIOS.Setup.1-1", Name: "BIOS", Version: "1.9.2", Updateable: true},
+			{ID: "NIC.Integrated.1-1", Name: "Broadcom Gigabit Ethernet BCM5720", Version: "22.31.6", Updateable: true},
+			{ID: "TPM.Integrated.1-1", Name: "TPM", Version: "7.2.2.0", Updateable: false},
+		}
+	default:
+		mrs.firmware = []FirmwareComponent{
+			{ID: "BMC", Name: "BMC Firmware", Version: "1.0.0", Updateable: true},
+			{ID: "BIOS", Name: "System BIOS", Version: "1.0.0", Updateable: true},
+		}
+	}
+}
+
+// initializeStorage sets the vendor-specific storage controller and its drives
+func (mrs *MockRedfishServer) initializeStorage() {
+	switch mrs.vendor {
+	case VendorDell:
+		mrs.storage = StorageController{
+			ID:                 "RAID.Integrated.1-1",
+			SupportedRAIDTypes: []string{"RAID0", "RAID1", "RAID5", "RAID6", "RAID10"},
+			Drives: []Drive{
+				{ID: "Disk.Bay.0:Enclosure.Internal.0-1:RAID.Integrated.1-1", Model: "MZ7LH480HBHQ0D3", SerialNumber: "S45PNA0M500001", CapacityBytes: 480103981056, MediaType: "SSD"},
+				{ID: "Disk.Bay.1:Enclosure.Internal.0-1:RAID.Integrated.1-1", Model: "MZ7LH480HBHQ0D3", SerialNumber: "S45PNA0M500002", CapacityBytes: 480103981056, MediaType: "SSD"},
+				{ID: "Disk.Bay.2:Enclosure.Internal.0-1:RAID.Integrated.1-1", Model: "ST2000NM0055", SerialNumber: "ZC20A001", CapacityBytes: 2000398934016, MediaType: "HDD"},
+				{ID: "Disk.Bay.3:Enclosure.Internal.0-1:RAID.Integrated.1-1", Model: "ST2000NM0055", SerialNumber: "ZC20A002", CapacityBytes: 2000398934016, MediaType: "HDD"},
+			},
+		}
+	default:
+		mrs.storage = StorageController{
+			ID:                 "1",
+			SupportedRAIDTypes: []string{"RAID0", "RAID1"},
+			Drives: []Drive{
+				{ID: "0", Model: "Generic SSD", SerialNumber: "SSD0001", CapacityBytes: 480103981056, MediaType: "SSD"},
+				{ID: "1", Model: "Generic SSD", SerialNumber: "SSD0002", CapacityBytes: 480103981056, MediaType: "SSD"},
+			},
+		}
+	}
+}
+
 // handleRequest is the main HTTP request handler
 func (mrs *MockRedfishServer) handleRequest(w http.ResponseWriter, r *http.Request) {
 	// Log the request
@@ -326,30 +610,56 @@ func (mrs *MockRedfishServer) handleRequest(w http.ResponseWriter, r *http.Reque
 		mrs.handleServiceRoot(w, r)
 	case r.URL.Path == "/redfish/v1/Systems" && r.Method == http.MethodGet:
 		mrs.handleSystemsCollection(w, r)
+	case r.URL.Path == RedfishSystemPath+"/Bios" && r.Method == http.MethodGet:
+		mrs.handleBiosGet(w, r)
+	case r.URL.Path == RedfishSystemPath+"/Bios/Settings" && r.Method == http.MethodGet:
+		mrs.handleBiosSettingsGet(w, r)
+	case r.URL.Path == RedfishSystemPath+"/Bios/Settings" && r.Method == http.MethodPatch:
+		mrs.handleBiosSettingsPatch(w, r)
+	case r.URL.Path == RedfishStoragePath && r.Method == http.MethodGet:
+		mrs.handleStorageCollection(w, r)
+	case r.URL.Path == mrs.storagePath() && r.Method == http.MethodGet:
+		mrs.handleStorageGet(w, r)
+	case strings.HasPrefix(r.URL.Path, mrs.storagePath()+"/Drives/") && r.Method == http.MethodGet:
+		mrs.handleDriveGet(w, r)
+	case r.URL.Path == mrs.storagePath()+"/Volumes" && r.Method == http.MethodGet:
+		mrs.handleVolumeCollection(w, r)
+	case r.URL.Path == mrs.storagePath()+"/Volumes" && r.Method == http.MethodPost:
+		mrs.handleVolumeCreate(w, r)
+	case strings.HasPrefix(r.URL.Path, mrs.storagePath()+"/Volumes/") && r.Method == http.MethodGet:
+		mrs.handleVolumeGet(w, r)
 	case strings.HasPrefix(r.URL.Path, "/redfish/v1/Systems/") && r.Method == http.MethodGet:
 		mrs.handleSystemGet(w, r)
 	case r.URL.Path == RedfishSystemPath && (r.Method == http.MethodPatch || r.Method == http.MethodPost):
-		// Accept Boot Set requests
-		w.WriteHeader(http.StatusNoContent)
+		mrs.handleSystemPatch(w, r)
 	case strings.HasPrefix(r.URL.Path, "/redfish/v1/Systems/") && strings.HasSuffix(r.URL.Path, "/Actions/ComputerSystem.Reset") && r.Method == http.MethodPost:
 		mrs.handleSystemReset(w, r)
+	case r.URL.Path == RedfishUpdateServicePath && r.Method == http.MethodGet:
+		mrs.handleUpdateServiceGet(w, r)
+	case r.URL.Path == RedfishFirmwareInventoryPath && r.Method == http.MethodGet:
+		mrs.handleFirmwareInventoryCollection(w, r)
+	case strings.HasPrefix(r.URL.Path, RedfishFirmwareInventoryPath+"/") && r.Method == http.MethodGet:
+		mrs.handleFirmwareInventoryGet(w, r)
+	case r.URL.Path == RedfishUpdateServicePath+"/Actions/UpdateService.SimpleUpdate" && r.Method == http.MethodPost:
+		mrs.handleSimpleUpdate(w, r)
+	case strings.HasPrefix(r.URL.Path, RedfishTasksPath+"/") && r.Method == http.MethodGet:
+		mrs.handleTaskGet(w, r)
 	case r.URL.Path == "/redfish/v1/Managers" && r.Method == http.MethodGet:
 		mrs.handleManagersCollection(w, r)
 	case strings.HasPrefix(r.URL.Path, "/redfish/v1/Managers/") && strings.HasSuffix(r.URL.Path, "/VirtualMedia") && r.Method == http.MethodGet:
 		mrs.handleManagerVirtualMediaCollection(w, r)
 	case strings.HasPrefix(r.URL.Path, "/redfish/v1/Managers/") && strings.Contains(r.URL.Path, "/VirtualMedia/") && strings.Contains(r.URL.Path, "/Actions/"):
-		// Accept any VirtualMedia actions
-		w.WriteHeader(http.StatusNoContent)
+		mrs.handleVirtualMediaAction(w, r)
 	case strings.HasPrefix(r.URL.Path, "/redfish/v1/Managers/") && strings.Contains(r.URL.Path, "/VirtualMedia/") && r.Method == http.MethodGet:
 		mrs.handleVirtualMediaGet(w, r)
 	case strings.HasPrefix(r.URL.Path, "/redfish/v1/Managers/") && r.Method == http.MethodGet:
 		mrs.handleManagerGet(w, r)
 	case strings.Contains(r.URL.Path, "VirtualMedia"):
-		// Basic virtual media endpoints are handled via SetBootSourceISO in client tests
+		// Only the virtual CD of the manager is emulated
 		w.WriteHeader(http.StatusNotFound)
 	case strings.Contains(r.URL.Path, "Bios"):
-		// BIOS attribute GET/PATCH can be added if tests require deeper emulation
-		w.WriteHeader(http.StatusNotFound)
+		// The current attributes are read-only, changes go through the settings object
+		w.WriteHeader(http.StatusMethodNotAllowed)
 	default:
 		http.NotFound(w, r)
 	}
@@ -409,6 +719,9 @@ func (mrs *MockRedfishServer) handleServiceRoot(w http.ResponseWriter, r *http.R
 		"Managers": map[string]string{
 			"@odata.id": "/redfish/v1/Managers",
 		},
+		"UpdateService": map[string]string{
+			"@odata.id": RedfishUpdateServicePath,
+		},
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -494,16 +807,20 @@ func (mrs *MockRedfishServer) handleManagerVirtualMediaCollection(w http.Respons
 
 // handleVirtualMediaGet handles GET /redfish/v1/Managers/1/VirtualMedia/1
 func (mrs *MockRedfishServer) handleVirtualMediaGet(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	cd := mrs.virtualMedia[0]
+	mrs.mu.RUnlock()
+
 	response := map[string]interface{}{
 		"@odata.type":    "#VirtualMedia.v1_5_0.VirtualMedia",
 		"@odata.id":      "/redfish/v1/Managers/1/VirtualMedia/1",
 		"Id":             "1",
 		"Name":           "Virtual CD",
 		"MediaTypes":     []string{"CD", "DVD"},
-		"Image":          "",
-		"Inserted":       false,
-		"WriteProtected": true,
-		"ConnectedVia":   "URI",
+		"Image":          cd.ImageURL,
+		"Inserted":       cd.Inserted,
+		"WriteProtected": cd.WriteProtected,
+		"ConnectedVia":   cd.ConnectedVia,
 		"Actions": map[string]map[string]string{
 			"#VirtualMedia.InsertMedia": {"target": "/redfish/v1/Managers/1/VirtualMedia/1/Actions/VirtualMedia.InsertMedia"},
 			"#VirtualMedia.EjectMedia":  {"target": "/redfish/v1/Managers/1/VirtualMedia/1/Actions/VirtualMedia.EjectMedia"},
@@ -515,11 +832,88 @@ func (mrs *MockRedfishServer) handleVirtualMediaGet(w http.ResponseWriter, r *ht
 	}
 }
 
+// handleVirtualMediaAction handles the InsertMedia and EjectMedia actions of the virtual CD
+func (mrs *MockRedfishServer) handleVirtualMediaAction(w http.ResponseWriter, r *http.Request) {
+	if mrs.failures.MediaFailures {
+		http.Error(w, "Virtual media operation failed", http.StatusInternalServerError)
+		return
+	}
+
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/VirtualMedia.InsertMedia"):
+		var insertRequest struct {
+			Image          string `json:"Image"`
+			Inserted       *bool  `json:"Inserted"`
+			WriteProtected *bool  `json:"WriteProtected"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&insertRequest); err != nil || insertRequest.Image == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		// Like most BMCs, refuse to insert over an inserted image
+		if mrs.virtualMedia[0].Inserted {
+			http.Error(w, "Virtual media already inserted", http.StatusConflict)
+			return
+		}
+		mrs.virtualMedia[0].ImageURL = insertRequest.Image
+		mrs.virtualMedia[0].Inserted = insertRequest.Inserted == nil || *insertRequest.Inserted
+		if insertRequest.WriteProtected != nil {
+			mrs.virtualMedia[0].WriteProtected = *insertRequest.WriteProtected
+		}
+	case strings.HasSuffix(r.URL.Path, "/VirtualMedia.EjectMedia"):
+		mrs.virtualMedia[0].ImageURL = ""
+		mrs.virtualMedia[0].Inserted = false
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSystemPatch handles PATCH /redfish/v1/Systems/1, recording boot overrides
+func (mrs *MockRedfishServer) handleSystemPatch(w http.ResponseWriter, r *http.Request) {
+	var patchRequest struct {
+		Boot struct {
+			BootSourceOverrideTarget  BootSourceOverrideTarget `json:"BootSourceOverrideTarget"`
+			BootSourceOverrideEnabled string                   `json:"BootSourceOverrideEnabled"`
+			HTTPBootURI               string                   `json:"HttpBootUri"`
+		} `json:"Boot"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&patchRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mrs.mu.Lock()
+	if patchRequest.Boot.BootSourceOverrideTarget != "" {
+		mrs.bootSource = patchRequest.Boot.BootSourceOverrideTarget
+		mrs.httpBootURI = patchRequest.Boot.HTTPBootURI
+	}
+	if patchRequest.Boot.BootSourceOverrideEnabled != "" {
+		mrs.bootEnabled = patchRequest.Boot.BootSourceOverrideEnabled
+		if mrs.bootEnabled == "Disabled" {
+			mrs.bootSource = BootSourceNone
+		}
+	}
+	mrs.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // handleSystemGet handles GET /redfish/v1/Systems/1
 func (mrs *MockRedfishServer) handleSystemGet(w http.ResponseWriter, r *http.Request) {
 	mrs.mu.RLock()
 	defer mrs.mu.RUnlock()
 
+	allowedBootSources := []BootSourceOverrideTarget{BootSourceNone, BootSourcePxe, BootSourceHdd, BootSourceCd, BootSourceUefiTarget}
+	if mrs.httpBoot {
+		allowedBootSources = append(allowedBootSources, BootSourceUefiHttp)
+	}
+
 	response := map[string]interface{}{
 		"@odata.type":  "#ComputerSystem.v1_10_0.ComputerSystem",
 		"@odata.id":    "/redfish/v1/Systems/1",
@@ -542,8 +936,10 @@ func (mrs *MockRedfishServer) handleSystemGet(w http.ResponseWriter, r *http.Req
 			"Health": mrs.systemInfo.Health,
 		},
 		"Boot": map[string]interface{}{
-			"BootSourceOverrideTarget":  mrs.bootSource,
-			"BootSourceOverrideEnabled": "Once",
+			"BootSourceOverrideTarget":                         mrs.bootSource,
+			"BootSourceOverrideEnabled":                        mrs.bootEnabled,
+			"BootSourceOverrideTarget@Redfish.AllowableValues": allowedBootSources,
+			"HttpBootUri":                                      mrs.httpBootURI,
 		},
 		"Actions": map[string]interface{}{
 			"#ComputerSystem.Reset": map[string]string{
@@ -553,6 +949,9 @@ func (mrs *MockRedfishServer) handleSystemGet(w http.ResponseWriter, r *http.Req
 		"Bios": map[string]string{
 			"@odata.id": "/redfish/v1/Systems/1/Bios",
 		},
+		"Storage": map[string]string{
+			"@odata.id": RedfishStoragePath,
+		},
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -581,21 +980,491 @@ func (mrs *MockRedfishServer) handleSystemReset(w http.ResponseWriter, r *http.R
 	defer mrs.mu.Unlock()
 
 	switch resetRequest.ResetType {
-	case "On":
+	case "On", "ForceOn":
+		if mrs.powerState != PowerStateOn {
+			mrs.applyPendingBIOSAttributes()
+			mrs.applyPendingVolumes()
+		}
 		mrs.powerState = PowerStateOn
 	case "ForceOff":
 		mrs.powerState = PowerStateOff
 	case "GracefulShutdown":
-		mrs.powerState = PowerStateOff
-	case "ForceRestart":
+		if !mrs.ignoreGraceful {
+			mrs.powerState = PowerStateOff
+		}
+	case "ForceRestart", "GracefulRestart", "PowerCycle":
+		mrs.applyPendingBIOSAttributes()
+		mrs.applyPendingVolumes()
 		mrs.powerState = PowerStateOn
+	case "Nmi":
 	default:
 		http.Error(w, "Invalid ResetType", http.StatusBadRequest)
 		return
 	}
+	mrs.resetTypes = append(mrs.resetTypes, resetRequest.ResetType)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// Additional handler methods would be implemented here...
-// handleManagerRequest, handleVirtualMediaRequest, handleBIOSRequest, etc.
+// applyPendingBIOSAttributes applies the staged BIOS attributes, as the BMC does when
+// the system boots. The caller holds the lock.
+func (mrs *MockRedfishServer) applyPendingBIOSAttributes() {
+	for name, value := range mrs.biosPending {
+		mrs.biosAttributes[name] = value
+	}
+	mrs.biosPending = make(map[string]interface{})
+}
+
+// applyPendingVolumes creates the requested volumes, as the BMC does when the system
+// boots. The caller holds the lock.
+func (mrs *MockRedfishServer) applyPendingVolumes() {
+	mrs.storage.Volumes = append(mrs.storage.Volumes, mrs.storage.PendingVolumes...)
+	mrs.storage.PendingVolumes = nil
+}
+
+// handleBiosGet handles GET /redfish/v1/Systems/1/Bios, pointing at the settings object
+// changes are staged in
+func (mrs *MockRedfishServer) handleBiosGet(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+
+	response := map[string]interface{}{
+		"@odata.type": "#Bios.v1_1_0.Bios",
+		"@odata.id":   RedfishSystemPath + "/Bios",
+		"Id":          "Bios",
+		"Name":        "BIOS Configuration Current Settings",
+		"Attributes":  mrs.biosAttributes,
+		"@Redfish.Settings": map[string]interface{}{
+			"@odata.type": "#Settings.v1_3_0.Settings",
+			"SettingsObject": map[string]string{
+				"@odata.id": RedfishSystemPath + "/Bios/Settings",
+			},
+			"SupportedApplyTimes": []string{"OnReset"},
+		},
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleBiosSettingsGet handles GET /redfish/v1/Systems/1/Bios/Settings, listing the
+// attributes staged for the next reboot
+func (mrs *MockRedfishServer) handleBiosSettingsGet(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+
+	response := map[string]interface{}{
+		"@odata.type": "#Bios.v1_1_0.Bios",
+		"@odata.id":   RedfishSystemPath + "/Bios/Settings",
+		"Id":          "Settings",
+		"Name":        "BIOS Configuration Pending Settings",
+		"Attributes":  mrs.biosPending,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleBiosSettingsPatch handles PATCH /redfish/v1/Systems/1/Bios/Settings, staging
+// attributes until the next reboot. Unknown attributes are rejected like real BMCs do.
+func (mrs *MockRedfishServer) handleBiosSettingsPatch(w http.ResponseWriter, r *http.Request) {
+	var patchRequest struct {
+		Attributes map[string]interface{} `json:"Attributes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&patchRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+
+	for name := range patchRequest.Attributes {
+		if _, ok := mrs.biosAttributes[name]; !ok {
+			http.Error(w, "Unknown BIOS attribute "+name, http.StatusBadRequest)
+			return
+		}
+	}
+	for name, value := range patchRequest.Attributes {
+		mrs.biosPending[name] = value
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUpdateServiceGet handles GET /redfish/v1/UpdateService
+func (mrs *MockRedfishServer) handleUpdateServiceGet(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"@odata.type":    "#UpdateService.v1_8_0.UpdateService",
+		"@odata.id":      RedfishUpdateServicePath,
+		"Id":             "UpdateService",
+		"Name":           "Update Service",
+		"ServiceEnabled": true,
+		"FirmwareInventory": map[string]string{
+			"@odata.id": RedfishFirmwareInventoryPath,
+		},
+		"Actions": map[string]interface{}{
+			"#UpdateService.SimpleUpdate": map[string]interface{}{
+				"target": RedfishUpdateServicePath + "/Actions/UpdateService.SimpleUpdate",
+				"TransferProtocol@Redfish.AllowableValues": []string{"HTTP", "HTTPS"},
+			},
+		},
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleFirmwareInventoryCollection handles GET /redfish/v1/UpdateService/FirmwareInventory
+func (mrs *MockRedfishServer) handleFirmwareInventoryCollection(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+
+	members := make([]map[string]string, 0, len(mrs.firmware))
+	for _, component := range mrs.firmware {
+		members = append(members, map[string]string{"@odata.id": RedfishFirmwareInventoryPath + "/" + component.ID})
+	}
+	response := map[string]interface{}{
+		"@odata.type":         "#SoftwareInventoryCollection.SoftwareInventoryCollection",
+		"@odata.id":           RedfishFirmwareInventoryPath,
+		"Name":                "Firmware Inventory Collection",
+		"Members@odata.count": len(members),
+		"Members":             members,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleFirmwareInventoryGet handles GET /redfish/v1/UpdateService/FirmwareInventory/{id}
+func (mrs *MockRedfishServer) handleFirmwareInventoryGet(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+
+	id := strings.TrimPrefix(r.URL.Path, RedfishFirmwareInventoryPath+"/")
+	for _, component := range mrs.firmware {
+		if component.ID != id {
+			continue
+		}
+		response := map[string]interface{}{
+			"@odata.type": "#SoftwareInventory.v1_3_0.SoftwareInventory",
+			"@odata.id":   RedfishFirmwareInventoryPath + "/" + component.ID,
+			"Id":          component.ID,
+			"Name":        component.Name,
+			"Version":     component.Version,
+			"Updateable":  component.Updateable,
+			"Status":      map[string]string{"State": "Enabled", "Health": "OK"},
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "encode error", http.StatusInternalServerError)
+		}
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// handleSimpleUpdate handles the SimpleUpdate action, starting a task that runs until
+// the test completes or fails it. Unknown and read-only targets are rejected.
+func (mrs *MockRedfishServer) handleSimpleUpdate(w http.ResponseWriter, r *http.Request) {
+	var updateRequest struct {
+		ImageURI string   `json:"ImageURI"`
+		Targets  []string `json:"Targets"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil || updateRequest.ImageURI == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+
+	for _, target := range updateRequest.Targets {
+		updateable := false
+		for _, component := range mrs.firmware {
+			if target == RedfishFirmwareInventoryPath+"/"+component.ID {
+				updateable = component.Updateable
+			}
+		}
+		if !updateable {
+			http.Error(w, "Target cannot be updated: "+target, http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := strconv.Itoa(len(mrs.tasks) + 1)
+	mrs.tasks[id] = &UpdateTask{
+		ID:       id,
+		ImageURI: updateRequest.ImageURI,
+		Targets:  updateRequest.Targets,
+		State:    "Running",
+	}
+
+	w.Header().Set("Location", RedfishTasksPath+"/"+id)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(mrs.taskResponse(mrs.tasks[id])); err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleTaskGet handles GET /redfish/v1/TaskService/Tasks/{id}
+func (mrs *MockRedfishServer) handleTaskGet(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+
+	task, ok := mrs.tasks[strings.TrimPrefix(r.URL.Path, RedfishTasksPath+"/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(mrs.taskResponse(task)); err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// taskResponse renders a firmware update task. The caller holds the lock.
+func (mrs *MockRedfishServer) taskResponse(task *UpdateTask) map[string]interface{} {
+	status := task.TaskStatus
+	if status == "" {
+		status = "OK"
+	}
+	messages := make([]map[string]string, 0, len(task.Messages))
+	for _, message := range task.Messages {
+		messages = append(messages, map[string]string{"Message": message})
+	}
+	return map[string]interface{}{
+		"@odata.type":     "#Task.v1_4_3.Task",
+		"@odata.id":       RedfishTasksPath + "/" + task.ID,
+		"Id":              task.ID,
+		"Name":            "Firmware Update Task",
+		"TaskState":       task.State,
+		"TaskStatus":      status,
+		"PercentComplete": task.PercentComplete,
+		"Messages":        messages,
+	}
+}
+
+// storagePath returns the URI of the storage controller
+func (mrs *MockRedfishServer) storagePath() string {
+	return RedfishStoragePath + "/" + mrs.storage.ID
+}
+
+// handleStorageCollection handles GET /redfish/v1/Systems/1/Storage
+func (mrs *MockRedfishServer) handleStorageCollection(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"@odata.type":         "#StorageCollection.StorageCollection",
+		"@odata.id":           RedfishStoragePath,
+		"Name":                "Storage Collection",
+		"Members@odata.count": 1,
+		"Members":             []map[string]string{{"@odata.id": mrs.storagePath()}},
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleStorageGet handles GET /redfish/v1/Systems/1/Storage/{id}
+func (mrs *MockRedfishServer) handleStorageGet(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+
+	drives := make([]map[string]string, 0, len(mrs.storage.Drives))
+	for _, drive := range mrs.storage.Drives {
+		drives = append(drives, map[string]string{"@odata.id": mrs.storagePath() + "/Drives/" + drive.ID})
+	}
+	response := map[string]interface{}{
+		"@odata.type":                    "#Storage.v1_8_0.Storage",
+		"@odata.id":                      mrs.storagePath(),
+		"Id":                             mrs.storage.ID,
+		"Name":                           "Storage Controller",
+		"Drives":                         drives,
+		"Drives@odata.count":             len(drives),
+		"Volumes":                        map[string]string{"@odata.id": mrs.storagePath() + "/Volumes"},
+		"Status":                         map[string]string{"State": "Enabled", "Health": "OK"},
+		"StorageControllers@odata.count": 1,
+		"StorageControllers": []map[string]interface{}{{
+			"MemberId":           "0",
+			"Name":               "RAID Controller",
+			"SupportedRAIDTypes": mrs.storage.SupportedRAIDTypes,
+		}},
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleDriveGet handles GET /redfish/v1/Systems/1/Storage/{id}/Drives/{id}
+func (mrs *MockRedfishServer) handleDriveGet(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+
+	id := strings.TrimPrefix(r.URL.Path, mrs.storagePath()+"/Drives/")
+	for _, drive := range mrs.storage.Drives {
+		if drive.ID != id {
+			continue
+		}
+		response := map[string]interface{}{
+			"@odata.type":   "#Drive.v1_9_0.Drive",
+			"@odata.id":     mrs.storagePath() + "/Drives/" + drive.ID,
+			"Id":            drive.ID,
+			"Name":          drive.ID,
+			"Model":         drive.Model,
+			"SerialNumber":  drive.SerialNumber,
+			"CapacityBytes": drive.CapacityBytes,
+			"MediaType":     drive.MediaType,
+			"Status":        map[string]string{"State": "Enabled", "Health": "OK"},
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "encode error", http.StatusInternalServerError)
+		}
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// handleVolumeCollection handles GET /redfish/v1/Systems/1/Storage/{id}/Volumes, listing
+// the volumes that were created
+func (mrs *MockRedfishServer) handleVolumeCollection(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+
+	members := make([]map[string]string, 0, len(mrs.storage.Volumes))
+	for _, volume := range mrs.storage.Volumes {
+		members = append(members, map[string]string{"@odata.id": mrs.storagePath() + "/Volumes/" + volume.ID})
+	}
+	response := map[string]interface{}{
+		"@odata.type":         "#VolumeCollection.VolumeCollection",
+		"@odata.id":           mrs.storagePath() + "/Volumes",
+		"Name":                "Volume Collection",
+		"Members@odata.count": len(members),
+		"Members":             members,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleVolumeGet handles GET /redfish/v1/Systems/1/Storage/{id}/Volumes/{id}
+func (mrs *MockRedfishServer) handleVolumeGet(w http.ResponseWriter, r *http.Request) {
+	mrs.mu.RLock()
+	defer mrs.mu.RUnlock()
+
+	id := strings.TrimPrefix(r.URL.Path, mrs.storagePath()+"/Volumes/")
+	for _, volume := range mrs.storage.Volumes {
+		if volume.ID != id {
+			continue
+		}
+		drives := make([]map[string]string, 0, len(volume.Drives))
+		for _, driveID := range volume.Drives {
+			drives = append(drives, map[string]string{"@odata.id": mrs.storagePath() + "/Drives/" + driveID})
+		}
+		response := map[string]interface{}{
+			"@odata.type":   "#Volume.v1_6_0.Volume",
+			"@odata.id":     mrs.storagePath() + "/Volumes/" + volume.ID,
+			"Id":            volume.ID,
+			"Name":          volume.Name,
+			"RAIDType":      volume.RAIDType,
+			"CapacityBytes": volume.CapacityBytes,
+			"Status":        map[string]string{"State": "Enabled", "Health": "OK"},
+			"Links": map[string]interface{}{
+				"Drives":             drives,
+				"Drives@odata.count": len(drives),
+			},
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "encode error", http.StatusInternalServerError)
+		}
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// handleVolumeCreate handles POST /redfish/v1/Systems/1/Storage/{id}/Volumes, creating
+// the volume on the next reboot. Unsupported RAID types and unknown or used drives are
+// rejected like real BMCs do.
+func (mrs *MockRedfishServer) handleVolumeCreate(w http.ResponseWriter, r *http.Request) {
+	var createRequest struct {
+		Name     string `json:"Name"`
+		RAIDType string `json:"RAIDType"`
+		Links    struct {
+			Drives []struct {
+				ODataID string `json:"@odata.id"`
+			} `json:"Drives"`
+		} `json:"Links"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&createRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mrs.mu.Lock()
+	defer mrs.mu.Unlock()
+
+	if createRequest.Name == "" || len(createRequest.Links.Drives) == 0 {
+		http.Error(w, "Name and drives are required", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(mrs.storage.SupportedRAIDTypes, createRequest.RAIDType) {
+		http.Error(w, "Unsupported RAIDType "+createRequest.RAIDType, http.StatusBadRequest)
+		return
+	}
+
+	volumes := append(slices.Clone(mrs.storage.Volumes), mrs.storage.PendingVolumes...)
+	volume := Volume{
+		ID:       fmt.Sprintf("Disk.Virtual.%d:%s", len(volumes), mrs.storage.ID),
+		Name:     createRequest.Name,
+		RAIDType: createRequest.RAIDType,
+	}
+	var smallest int64
+	for _, link := range createRequest.Links.Drives {
+		driveID := strings.TrimPrefix(link.ODataID, mrs.storagePath()+"/Drives/")
+		index := slices.IndexFunc(mrs.storage.Drives, func(drive Drive) bool { return drive.ID == driveID })
+		if index < 0 {
+			http.Error(w, "Unknown drive "+link.ODataID, http.StatusBadRequest)
+			return
+		}
+		for _, existing := range volumes {
+			if slices.Contains(existing.Drives, driveID) {
+				http.Error(w, "Drive "+driveID+" is a member of volume "+existing.Name, http.StatusBadRequest)
+				return
+			}
+		}
+		if capacity := mrs.storage.Drives[index].CapacityBytes; smallest == 0 || capacity < smallest {
+			smallest = capacity
+		}
+		volume.Drives = append(volume.Drives, driveID)
+	}
+
+	// Usable capacity of the RAID level
+	count := int64(len(volume.Drives))
+	switch volume.RAIDType {
+	case "RAID0":
+		volume.CapacityBytes = count * smallest
+	case "RAID5":
+		volume.CapacityBytes = (count - 1) * smallest
+	case "RAID6":
+		volume.CapacityBytes = (count - 2) * smallest
+	case "RAID10":
+		volume.CapacityBytes = count / 2 * smallest
+	default:
+		volume.CapacityBytes = smallest
+	}
+	mrs.storage.PendingVolumes = append(mrs.storage.PendingVolumes, volume)
+
+	w.WriteHeader(http.StatusAccepted)
+}